@@ -0,0 +1,206 @@
+package matchtree_test
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/roy2220/matchtree"
+)
+
+func newInverseChildrenMatchTree(b *testing.B) *MatchTree[int] {
+	matchTree := NewMatchTree[int]([]MatchType{MatchString, MatchInteger, MatchIntegerInterval})
+	for i := range 100 {
+		_, err := matchTree.AddRule(MatchRule[int]{
+			Patterns: []MatchPattern{
+				{Type: MatchString, IsInverse: true, Strings: []string{fmt.Sprintf("s%d", i), fmt.Sprintf("s%d", i+1)}},
+				{Type: MatchInteger, IsInverse: true, Integers: []int64{int64(i), int64(i + 1)}},
+				{Type: MatchIntegerInterval, IsInverse: true, IntegerIntervals: []IntegerInterval{
+					{Min: Int64Ptr(int64(i)), Max: Int64Ptr(int64(i + 10))},
+				}},
+			},
+			Value:    i,
+			Priority: int64(i % 10),
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	return matchTree
+}
+
+var inverseChildrenMatchKeys = []MatchKey{
+	{Type: MatchString, String: "s50"},
+	{Type: MatchInteger, Integer: 50},
+	{Type: MatchIntegerInterval, Integer: 50},
+}
+
+func BenchmarkMatchTree_Search_InverseChildren(b *testing.B) {
+	matchTree := newInverseChildrenMatchTree(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		_, _ = matchTree.Search(inverseChildrenMatchKeys)
+	}
+}
+
+func BenchmarkFrozenMatchTree_Search_InverseChildren(b *testing.B) {
+	frozenMatchTree := newInverseChildrenMatchTree(b).Freeze()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		_, _ = frozenMatchTree.Search(inverseChildrenMatchKeys)
+	}
+}
+
+func BenchmarkMatchTree_SearchAny_InverseChildren(b *testing.B) {
+	matchTree := newInverseChildrenMatchTree(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		_, _ = matchTree.SearchAny(inverseChildrenMatchKeys)
+	}
+}
+
+func BenchmarkMatchTree_SearchAppend_InverseChildren(b *testing.B) {
+	matchTree := newInverseChildrenMatchTree(b)
+	var values []int
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		values, _ = matchTree.SearchAppend(values[:0], inverseChildrenMatchKeys)
+	}
+}
+
+// newManyInverseChildrenMatchTree returns a tree of one dimension, whose root has 500 inverse
+// children excluding overlapping ranges of values.
+func newManyInverseChildrenMatchTree(b *testing.B, type1 MatchType) *MatchTree[int] {
+	matchTree := NewMatchTree[int]([]MatchType{type1})
+	for i := range 500 {
+		pattern := MatchPattern{Type: type1, IsInverse: true}
+		switch type1 {
+		case MatchString:
+			for j := i; j < i+400; j += 10 {
+				pattern.Strings = append(pattern.Strings, fmt.Sprintf("s%d", j))
+			}
+		case MatchIntegerInterval:
+			pattern.IntegerIntervals = []IntegerInterval{{Min: Int64Ptr(int64(i)), Max: Int64Ptr(int64(i + 400))}}
+		}
+		if _, err := matchTree.AddRule(MatchRule[int]{Patterns: []MatchPattern{pattern}, Value: i}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return matchTree
+}
+
+func BenchmarkMatchTree_Search_ManyInverseStrings(b *testing.B) {
+	matchTree := newManyInverseChildrenMatchTree(b, MatchString)
+	keys := []MatchKey{StringsKey("s400", "s401", "s402", "s403", "s404", "s405", "s406", "s407", "s408", "s409")}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		_, _ = matchTree.Search(keys)
+	}
+}
+
+func BenchmarkFrozenMatchTree_Search_ManyInverseStrings(b *testing.B) {
+	frozenMatchTree := newManyInverseChildrenMatchTree(b, MatchString).Freeze()
+	keys := []MatchKey{StringsKey("s400", "s401", "s402", "s403", "s404", "s405", "s406", "s407", "s408", "s409")}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		_, _ = frozenMatchTree.Search(keys)
+	}
+}
+
+func BenchmarkMatchTree_Search_ManyInverseIntervals(b *testing.B) {
+	matchTree := newManyInverseChildrenMatchTree(b, MatchIntegerInterval)
+	keys := []MatchKey{{Type: MatchIntegerInterval, Integer: 450}}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		_, _ = matchTree.Search(keys)
+	}
+}
+
+func BenchmarkFrozenMatchTree_Search_ManyInverseIntervals(b *testing.B) {
+	frozenMatchTree := newManyInverseChildrenMatchTree(b, MatchIntegerInterval).Freeze()
+	keys := []MatchKey{{Type: MatchIntegerInterval, Integer: 450}}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		_, _ = frozenMatchTree.Search(keys)
+	}
+}
+
+func newBulkLoadRules() []MatchRule[int] {
+	rules := make([]MatchRule[int], 100)
+	for i := range rules {
+		strings := make([]string, 200)
+		integers := make([]int64, 200)
+		for j := range 200 {
+			strings[j] = fmt.Sprintf("s%d", i*200+j)
+			integers[j] = int64(i*200 + j)
+		}
+		rules[i] = MatchRule[int]{
+			Patterns: []MatchPattern{
+				{Type: MatchString, IsInverse: true, Strings: strings},
+				{Type: MatchInteger, IsInverse: true, Integers: integers},
+			},
+			Value: i,
+		}
+	}
+	return rules
+}
+
+func BenchmarkMatchTree_AddRule_BulkLoad(b *testing.B) {
+	rules := newBulkLoadRules()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		matchTree := NewMatchTree[int]([]MatchType{MatchString, MatchInteger})
+		for _, rule := range rules {
+			if _, err := matchTree.AddRule(rule); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkMatchTree_AddRuleUnsafe_BulkLoad(b *testing.B) {
+	rules := newBulkLoadRules()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		matchTree := NewMatchTree[int]([]MatchType{MatchString, MatchInteger})
+		for _, rule := range rules {
+			if _, err := matchTree.AddRuleUnsafe(rule); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkMatchTree_AddRule_ManyIntervals(b *testing.B) {
+	rules := make([]MatchRule[int], 10000)
+	for i := range rules {
+		// descending lower bounds, each interval inserted in front of the others
+		min := int64(len(rules)-i) * 10
+		rules[i] = MatchRule[int]{
+			Patterns: []MatchPattern{IntegerIntervalPattern(ClosedInterval(min, min+5))},
+			Value:    i,
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		matchTree := NewMatchTree[int]([]MatchType{MatchIntegerInterval})
+		for _, rule := range rules {
+			if _, err := matchTree.AddRule(rule); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if _, err := matchTree.Search([]MatchKey{IntegerIntervalKey(52)}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
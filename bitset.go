@@ -0,0 +1,62 @@
+package matchtree
+
+import (
+	"iter"
+	"math/bits"
+	"sync"
+)
+
+// bitset is a set of small non-negative integers, such as the indexes of the inverse children
+// of a node, packed into words of 64 bits.
+type bitset []uint64
+
+// newBitset returns an empty bitset with room for the integers below n.
+func newBitset(n int) bitset { return make(bitset, (n+63)/64) }
+
+// Add adds the integer i to the bitset.
+func (b bitset) Add(i int) { b[i/64] |= 1 << (i % 64) }
+
+// AddAll adds the integers in other, which must have no more room than b, to the bitset.
+func (b bitset) AddAll(other bitset) {
+	for i, word := range other {
+		b[i] |= word
+	}
+}
+
+// Missing returns an iterator over the integers below n that are not in the bitset, in ascending
+// order. A nil bitset has no integers at all.
+func (b bitset) Missing(n int) iter.Seq[int] {
+	return func(yield func(int) bool) {
+		for i := 0; i < n; i += 64 {
+			missing := ^uint64(0)
+			if w := i / 64; w < len(b) {
+				missing = ^b[w]
+			}
+			if n-i < 64 {
+				missing &= 1<<(n-i) - 1
+			}
+			for ; missing != 0; missing &= missing - 1 {
+				if !yield(i + bits.TrailingZeros64(missing)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+var bitsetPool = sync.Pool{New: func() any { return new(bitset) }}
+
+// getBitset returns an empty scratch bitset with room for the integers below n from the pool,
+// which should be returned with putBitset.
+func getBitset(n int) *bitset {
+	b := bitsetPool.Get().(*bitset)
+	if w := (n + 63) / 64; cap(*b) < w {
+		*b = newBitset(n)
+	} else {
+		*b = (*b)[:w]
+		clear(*b)
+	}
+	return b
+}
+
+func putBitset(b *bitset) { bitsetPool.Put(b) }
@@ -0,0 +1,259 @@
+package matchtree
+
+import (
+	"errors"
+	"maps"
+)
+
+// BuildFromRules creates a MatchTree with the specified sequence of MatchTypes and the rules,
+// like NewMatchTreeChecked followed by AddRulesStrict, which it produces an identical tree to.
+// Instead of inserting the rules one at a time, it inserts all of them dimension by dimension,
+// so that each node knows the distinct exact values of its children and each leaf node the
+// number of its results before any of them is inserted, and is allocated with room for them
+// once rather than grown repeatedly. If any rule is invalid, no tree is built and the errors of
+// all invalid rules are returned like AddRulesStrict does.
+func BuildFromRules[T any](types []MatchType, rules []MatchRule[T], optionFuncs ...MatchTreeOptionFunc[T]) (*MatchTree[T], error) {
+	t, err := NewMatchTreeChecked(types, optionFuncs...)
+	if err != nil {
+		return nil, err
+	}
+	options := makeAddRuleOptions(nil)
+
+	var errs []error
+	rulePatterns := make([][]MatchPattern, len(rules))
+	for i, rule := range rules {
+		patterns, err := t.preparePatterns(rule.Patterns, options)
+		if err != nil {
+			errs = append(errs, wrapError(err, "match rule #%d", i+1))
+			continue
+		}
+		rulePatterns[i] = patterns
+	}
+	if len(errs) >= 1 {
+		return nil, errors.Join(errs...)
+	}
+	if len(rules) == 0 {
+		return t, nil
+	}
+
+	b := treeBuilder[T]{
+		MatchTree:    t,
+		rulePatterns: rulePatterns,
+		results:      make([]matchResult, len(rules)),
+		leaves:       make([][]matchNode, len(rules)),
+		scratches:    make([]treeBuilderScratch, len(types)),
+	}
+	t.values = make([]T, 0, len(rules))
+	ruleIndexes := make([]int, len(rules))
+	for i, rule := range rules {
+		t.lastRuleID++
+		b.results[i] = matchResult{
+			ValueIndex: len(t.values),
+			Priority:   rule.Priority,
+			Weight:     rule.Weight,
+			RuleID:     t.lastRuleID,
+			Expiry:     makeExpiry(rule.ExpiresAt),
+		}
+		t.values = append(t.values, rule.Value)
+		ruleIndexes[i] = i
+	}
+	t.root = newMatchNode(b.nodeType(0))
+	b.buildNode(t.root, 0, ruleIndexes)
+
+	t.rules = make(map[RuleID]ruleLocation, len(rules))
+	for i, rule := range rules {
+		result := &b.results[i]
+		t.rules[result.RuleID] = ruleLocation{
+			ValueIndex: result.ValueIndex,
+			Leaves:     b.leaves[i],
+			Expiry:     result.Expiry,
+			Labels:     maps.Clone(rule.Labels),
+		}
+		if onAddRule := t.metrics.OnAddRule; onAddRule != nil {
+			onAddRule(len(b.leaves[i]))
+		}
+	}
+	return t, nil
+}
+
+// treeBuilder holds the state of BuildFromRules.
+type treeBuilder[T any] struct {
+	*MatchTree[T]
+
+	rulePatterns [][]MatchPattern
+	results      []matchResult
+	leaves       [][]matchNode
+
+	// scratch space for the nodes at each depth, reused from node to node since the subtree of a
+	// node is built before the next node at the same depth
+	scratches []treeBuilderScratch
+
+	// scratch sets for counting the distinct exact values of the children of a node
+	strings  map[string]struct{}
+	integers map[int64]struct{}
+}
+
+// treeBuilderScratch is the scratch space for building a node.
+type treeBuilderScratch struct {
+	ChildOrdinals map[matchNode]int
+	Children      []matchNode
+	Pairs         [][2]int // child ordinals and rule indexes
+	Ends          []int
+	RuleIndexes   []int
+}
+
+// childReserver is implemented by the match nodes able to make room in advance for the given
+// number of exact children.
+type childReserver interface {
+	reserveChildren(numberOfChildren int)
+}
+
+// resultReserver is implemented by the match nodes able to make room in advance for the given
+// number of results.
+type resultReserver interface {
+	reserveResults(numberOfResults int)
+}
+
+// nodeType returns the MatchType of the nodes at the depth, which is MatchNone for the leaves.
+func (b *treeBuilder[T]) nodeType(depth int) MatchType {
+	if depth == len(b.types) {
+		return MatchNone
+	}
+	return b.types[depth]
+}
+
+// buildNode inserts the rules of the indexes, in ascending order, into the subtree of the node at
+// the depth. The children of the node are created in the order AddRule would create them, i.e.
+// in the order of the rules and then of the values of each rule's pattern.
+func (b *treeBuilder[T]) buildNode(node matchNode, depth int, ruleIndexes []int) {
+	if depth == len(b.types) {
+		// leaf
+		if r, ok := node.(resultReserver); ok {
+			r.reserveResults(len(ruleIndexes))
+		}
+		for _, i := range ruleIndexes {
+			node.AddResult(b.results[i])
+			b.leaves[i] = append(b.leaves[i], node)
+		}
+		return
+	}
+
+	// non-leaf
+	if r, ok := node.(childReserver); ok {
+		if n := b.countExactValues(depth, ruleIndexes); n >= 2 {
+			r.reserveChildren(n)
+		}
+	}
+	// group the rules by the children they lead to, keeping the children in the order of their
+	// first appearance and the rules of each child in ascending order
+	s := &b.scratches[depth]
+	if s.ChildOrdinals == nil {
+		s.ChildOrdinals = make(map[matchNode]int)
+	}
+	s.Children, s.Pairs = s.Children[:0], s.Pairs[:0]
+	childType := b.nodeType(depth + 1)
+	for _, i := range ruleIndexes {
+		pattern := &b.rulePatterns[i][depth]
+		for j := range pattern.numberOfValues() {
+			pattern.selectValue(j)
+			child := node.GetOrInsertChild(pattern, childType)
+			ordinal, ok := s.ChildOrdinals[child]
+			if !ok {
+				ordinal = len(s.Children)
+				s.ChildOrdinals[child] = ordinal
+				s.Children = append(s.Children, child)
+			}
+			s.Pairs = append(s.Pairs, [2]int{ordinal, i})
+		}
+	}
+	if len(s.Children) > maxScratchSetSize {
+		// clearing a map costs as much as its capacity, which never shrinks
+		s.ChildOrdinals = nil
+	} else {
+		clear(s.ChildOrdinals)
+	}
+
+	// counting sort of the pairs by the child ordinals, after which ends[k] is the end of the
+	// rules of the child k
+	ends := resizeInts(s.Ends, len(s.Children))
+	clear(ends)
+	for _, pair := range s.Pairs {
+		ends[pair[0]]++
+	}
+	n := 0
+	for k, count := range ends {
+		ends[k] = n
+		n += count
+	}
+	childRuleIndexes := resizeInts(s.RuleIndexes, len(s.Pairs))
+	for _, pair := range s.Pairs {
+		childRuleIndexes[ends[pair[0]]] = pair[1]
+		ends[pair[0]]++
+	}
+	s.Ends, s.RuleIndexes = ends, childRuleIndexes
+
+	start := 0
+	for k, child := range s.Children {
+		b.buildNode(child, depth+1, childRuleIndexes[start:ends[k]])
+		start = ends[k]
+	}
+}
+
+// resizeInts returns s resized to n integers, reallocating it only if it has not enough capacity.
+func resizeInts(s []int, n int) []int {
+	if cap(s) < n {
+		return make([]int, n)
+	}
+	return s[:n]
+}
+
+// countExactValues returns the number of the distinct exact values of the patterns at the depth of
+// the rules of the indexes, for the match types keying the exact children by their values, or 0
+// for the other match types.
+func (b *treeBuilder[T]) countExactValues(depth int, ruleIndexes []int) int {
+	type1 := b.types[depth]
+	switch type1 {
+	case MatchString, MatchBytes:
+		if b.strings == nil {
+			b.strings = make(map[string]struct{})
+		}
+		clear(b.strings)
+	case MatchInteger, MatchEnum:
+		if b.integers == nil {
+			b.integers = make(map[int64]struct{})
+		}
+		clear(b.integers)
+	default:
+		return 0
+	}
+	for _, i := range ruleIndexes {
+		pattern := &b.rulePatterns[i][depth]
+		if pattern.IsAny || pattern.IsInverse {
+			continue
+		}
+		switch type1 {
+		case MatchString, MatchBytes:
+			for _, v := range pattern.Strings {
+				b.strings[v] = struct{}{}
+			}
+		default:
+			for _, v := range pattern.Integers {
+				b.integers[v] = struct{}{}
+			}
+		}
+	}
+	var n int
+	if type1 == MatchString || type1 == MatchBytes {
+		n = len(b.strings)
+	} else {
+		n = len(b.integers)
+	}
+	if n > maxScratchSetSize {
+		// clearing a map costs as much as its capacity, which never shrinks
+		b.strings, b.integers = nil, nil
+	}
+	return n
+}
+
+// maxScratchSetSize is the size of the largest scratch set to be reused.
+const maxScratchSetSize = 64
@@ -0,0 +1,133 @@
+package matchtree_test
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	. "github.com/roy2220/matchtree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRandomRules returns n random rules for the MatchString, MatchInteger, MatchIntegerInterval
+// and MatchRegexp types, mixing exact, inverse and any patterns.
+func newRandomRules(n int) []MatchRule[int] {
+	rand := rand.New(rand.NewSource(1))
+	randomPattern := func(type1 MatchType) MatchPattern {
+		pattern := MatchPattern{Type: type1}
+		switch rand.Intn(4) {
+		case 0:
+			pattern.IsAny = true
+			return pattern
+		case 1:
+			pattern.IsInverse = true
+		}
+		for range 1 + rand.Intn(3) {
+			v := int64(rand.Intn(20))
+			switch type1 {
+			case MatchString:
+				pattern.Strings = append(pattern.Strings, fmt.Sprintf("s%d", v))
+			case MatchInteger:
+				pattern.Integers = append(pattern.Integers, v)
+			case MatchIntegerInterval:
+				pattern.IntegerIntervals = append(pattern.IntegerIntervals, IntegerInterval{Min: Int64Ptr(v), Max: Int64Ptr(v + 5)})
+			case MatchRegexp:
+				pattern.Regexp = fmt.Sprintf("^s%d", v)
+			}
+		}
+		return pattern
+	}
+
+	rules := make([]MatchRule[int], n)
+	for i := range rules {
+		rules[i] = MatchRule[int]{
+			Patterns: []MatchPattern{
+				randomPattern(MatchString),
+				randomPattern(MatchInteger),
+				randomPattern(MatchIntegerInterval),
+				randomPattern(MatchRegexp),
+			},
+			Value:    i,
+			Priority: int64(rand.Intn(5)),
+		}
+	}
+	return rules
+}
+
+var randomRuleTypes = []MatchType{MatchString, MatchInteger, MatchIntegerInterval, MatchRegexp}
+
+func TestBuildFromRules(t *testing.T) {
+	rules := newRandomRules(300)
+	rules[0].Labels = map[string]string{"k": "v"}
+	matchTree := NewMatchTree[int](randomRuleTypes)
+	require.NoError(t, matchTree.AddRulesStrict(rules))
+	builtMatchTree, err := BuildFromRules(randomRuleTypes, rules)
+	require.NoError(t, err)
+
+	assert.Equal(t, matchTree.Stats(), builtMatchTree.Stats())
+	assert.Equal(t, matchTree.ToRules(), builtMatchTree.ToRules())
+	var dot, builtDOT bytes.Buffer
+	require.NoError(t, matchTree.WriteDOT(&dot))
+	require.NoError(t, builtMatchTree.WriteDOT(&builtDOT))
+	assert.Equal(t, dot.String(), builtDOT.String())
+	for i := range 20 {
+		keys := []MatchKey{
+			StringKey(fmt.Sprintf("s%d", i)),
+			IntegerKey(int64(i)),
+			IntegerIntervalKey(int64(i)),
+			RegexpKey(fmt.Sprintf("s%d", 19-i)),
+		}
+		values, err := matchTree.SearchAll(keys)
+		require.NoError(t, err)
+		builtValues, err := builtMatchTree.SearchAll(keys)
+		require.NoError(t, err)
+		assert.Equal(t, values, builtValues)
+	}
+
+	// the rules are tracked like by AddRule
+	require.NoError(t, builtMatchTree.RemoveRuleByID(1))
+	_, err = builtMatchTree.AddRule(rules[0])
+	require.NoError(t, err)
+	assert.True(t, builtMatchTree.HasRule(rules[0]))
+}
+
+func TestBuildFromRules_InvalidRules(t *testing.T) {
+	_, err := BuildFromRules([]MatchType{MatchString}, []MatchRule[string]{
+		{Patterns: []MatchPattern{StringsPattern("a")}, Value: "rule_1"},
+		{Patterns: []MatchPattern{IntegersPattern(1)}, Value: "rule_2"},
+		{Patterns: nil, Value: "rule_3"},
+	})
+	assert.EqualError(t, err, "matchtree: match rule #2: unexpected match type #1; expected=STRING actual=INTEGER\n"+
+		"matchtree: match rule #3: unexpected number of match patterns; expected=1 actual=0")
+
+	matchTree, err := BuildFromRules[string]([]MatchType{MatchString}, nil)
+	require.NoError(t, err)
+	values, err := matchTree.Search([]MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.Empty(t, values)
+}
+
+func BenchmarkMatchTree_AddRules(b *testing.B) {
+	rules := newRandomRules(3000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		matchTree := NewMatchTree[int](randomRuleTypes)
+		if err := matchTree.AddRules(rules); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBuildFromRules(b *testing.B) {
+	rules := newRandomRules(3000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		if _, err := BuildFromRules(randomRuleTypes, rules); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package matchtree
+
+import (
+	"fmt"
+	"slices"
+)
+
+// RuleBuilder builds a MatchRule fluently, appending one pattern per call in the order of the
+// tree's types. Each pattern is validated against the expected MatchType as it is appended,
+// and the first error is reported by Build.
+type RuleBuilder[T any] struct {
+	types []MatchType
+	rule  MatchRule[T]
+	err   error
+}
+
+// NewRuleBuilder creates a RuleBuilder for a MatchTree with the specified sequence of MatchTypes.
+func NewRuleBuilder[T any](types []MatchType) *RuleBuilder[T] {
+	return &RuleBuilder[T]{types: types}
+}
+
+// Pattern appends the given pattern.
+func (b *RuleBuilder[T]) Pattern(pattern MatchPattern) *RuleBuilder[T] {
+	if b.err != nil {
+		return b
+	}
+	i := len(b.rule.Patterns)
+	if i >= len(b.types) {
+		b.err = fmt.Errorf("%w; expected=%v actual=%v", ErrPatternCountMismatch, len(b.types), i+1)
+		return b
+	}
+	if type1 := b.types[i]; pattern.Type != type1 {
+		b.err = &TypeMismatchError{Index: i, Expected: type1, Actual: pattern.Type}
+		return b
+	}
+	if err := pattern.Validate(); err != nil {
+		b.err = wrapError(err, "match pattern #%d", i+1)
+		return b
+	}
+	b.rule.Patterns = append(b.rule.Patterns, pattern)
+	return b
+}
+
+// MatchStrings appends a pattern matching any of the strings.
+func (b *RuleBuilder[T]) MatchStrings(strings ...string) *RuleBuilder[T] {
+	return b.Pattern(StringsPattern(strings...))
+}
+
+// NotStrings appends a pattern matching any string not in the strings.
+func (b *RuleBuilder[T]) NotStrings(strings ...string) *RuleBuilder[T] {
+	return b.Pattern(InverseStringsPattern(strings...))
+}
+
+// AnyString appends a pattern matching any string.
+func (b *RuleBuilder[T]) AnyString() *RuleBuilder[T] {
+	return b.Pattern(AnyPattern(MatchString))
+}
+
+// MatchIntegers appends a pattern matching any of the integers.
+func (b *RuleBuilder[T]) MatchIntegers(integers ...int64) *RuleBuilder[T] {
+	return b.Pattern(IntegersPattern(integers...))
+}
+
+// NotIntegers appends a pattern matching any integer not in the integers.
+func (b *RuleBuilder[T]) NotIntegers(integers ...int64) *RuleBuilder[T] {
+	return b.Pattern(InverseIntegersPattern(integers...))
+}
+
+// AnyInteger appends a pattern matching any integer.
+func (b *RuleBuilder[T]) AnyInteger() *RuleBuilder[T] {
+	return b.Pattern(AnyPattern(MatchInteger))
+}
+
+// IntegerRange appends a pattern matching the integers between min and max.
+func (b *RuleBuilder[T]) IntegerRange(min int64, max int64, minIsExcluded bool, maxIsExcluded bool) *RuleBuilder[T] {
+	return b.MatchIntegerIntervals(IntegerInterval{
+		Min:           Int64Ptr(min),
+		MinIsExcluded: minIsExcluded,
+		Max:           Int64Ptr(max),
+		MaxIsExcluded: maxIsExcluded,
+	})
+}
+
+// MatchIntegerIntervals appends a pattern matching the integers in any of the intervals.
+func (b *RuleBuilder[T]) MatchIntegerIntervals(intervals ...IntegerInterval) *RuleBuilder[T] {
+	return b.Pattern(IntegerIntervalPattern(intervals...))
+}
+
+// NotIntegerIntervals appends a pattern matching the integers in none of the intervals.
+func (b *RuleBuilder[T]) NotIntegerIntervals(intervals ...IntegerInterval) *RuleBuilder[T] {
+	return b.Pattern(InverseIntegerIntervalPattern(intervals...))
+}
+
+// AnyIntegerInterval appends a pattern matching any integer of an integer interval type.
+func (b *RuleBuilder[T]) AnyIntegerInterval() *RuleBuilder[T] {
+	return b.Pattern(AnyPattern(MatchIntegerInterval))
+}
+
+// NumberRange appends a pattern matching the numbers between min and max.
+func (b *RuleBuilder[T]) NumberRange(min float64, max float64, minIsExcluded bool, maxIsExcluded bool) *RuleBuilder[T] {
+	return b.MatchNumberIntervals(NumberInterval{
+		Min:           Float64Ptr(min),
+		MinIsExcluded: minIsExcluded,
+		Max:           Float64Ptr(max),
+		MaxIsExcluded: maxIsExcluded,
+	})
+}
+
+// MatchNumberIntervals appends a pattern matching the numbers in any of the intervals.
+func (b *RuleBuilder[T]) MatchNumberIntervals(intervals ...NumberInterval) *RuleBuilder[T] {
+	return b.Pattern(NumberIntervalPattern(intervals...))
+}
+
+// NotNumberIntervals appends a pattern matching the numbers in none of the intervals.
+func (b *RuleBuilder[T]) NotNumberIntervals(intervals ...NumberInterval) *RuleBuilder[T] {
+	return b.Pattern(InverseNumberIntervalPattern(intervals...))
+}
+
+// AnyNumberInterval appends a pattern matching any number.
+func (b *RuleBuilder[T]) AnyNumberInterval() *RuleBuilder[T] {
+	return b.Pattern(AnyPattern(MatchNumberInterval))
+}
+
+// MatchRegexp appends a pattern matching the strings matching the regular expression.
+func (b *RuleBuilder[T]) MatchRegexp(regexp string) *RuleBuilder[T] {
+	return b.Pattern(RegexpPattern(regexp))
+}
+
+// NotRegexp appends a pattern matching the strings not matching the regular expression.
+func (b *RuleBuilder[T]) NotRegexp(regexp string) *RuleBuilder[T] {
+	return b.Pattern(InverseRegexpPattern(regexp))
+}
+
+// AnyRegexp appends a pattern matching any string of a regexp type.
+func (b *RuleBuilder[T]) AnyRegexp() *RuleBuilder[T] {
+	return b.Pattern(AnyPattern(MatchRegexp))
+}
+
+// Value sets the value of the rule.
+func (b *RuleBuilder[T]) Value(value T) *RuleBuilder[T] {
+	b.rule.Value = value
+	return b
+}
+
+// Priority sets the priority of the rule.
+func (b *RuleBuilder[T]) Priority(priority int64) *RuleBuilder[T] {
+	b.rule.Priority = priority
+	return b
+}
+
+// Build returns the rule, or the first error encountered while appending the patterns.
+// It returns an error if fewer patterns than types have been appended.
+func (b *RuleBuilder[T]) Build() (MatchRule[T], error) {
+	if b.err != nil {
+		return MatchRule[T]{}, b.err
+	}
+	if n := len(b.rule.Patterns); n != len(b.types) {
+		return MatchRule[T]{}, fmt.Errorf("%w; expected=%v actual=%v", ErrPatternCountMismatch, len(b.types), n)
+	}
+	rule := b.rule
+	rule.Patterns = slices.Clip(rule.Patterns)
+	return rule, nil
+}
@@ -0,0 +1,92 @@
+package matchtree_test
+
+import (
+	"testing"
+
+	. "github.com/roy2220/matchtree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuleBuilder(t *testing.T) {
+	types := []MatchType{MatchString, MatchInteger, MatchIntegerInterval, MatchRegexp}
+	rule, err := NewRuleBuilder[string](types).
+		NotStrings("joe").
+		AnyInteger().
+		IntegerRange(1, 10, false, true).
+		MatchRegexp("^a").
+		Value("rule_1").
+		Priority(3).
+		Build()
+	require.NoError(t, err)
+	assert.Equal(t, MatchRule[string]{
+		Patterns: []MatchPattern{
+			{Type: MatchString, IsInverse: true, Strings: []string{"joe"}},
+			{Type: MatchInteger, IsAny: true},
+			{Type: MatchIntegerInterval, IntegerIntervals: []IntegerInterval{
+				{Min: Int64Ptr(1), Max: Int64Ptr(10), MaxIsExcluded: true},
+			}},
+			{Type: MatchRegexp, Regexp: "^a"},
+		},
+		Value:    "rule_1",
+		Priority: 3,
+	}, rule)
+
+	matchTree := NewMatchTree[string](types)
+	_, err = matchTree.AddRule(rule)
+	require.NoError(t, err)
+	values, err := matchTree.Search([]MatchKey{
+		{Type: MatchString, String: "tom"},
+		{Type: MatchInteger, Integer: 7},
+		{Type: MatchIntegerInterval, Integer: 9},
+		{Type: MatchRegexp, String: "abc"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_1"}, values)
+}
+
+func TestRuleBuilder_Errors(t *testing.T) {
+	types := []MatchType{MatchString, MatchInteger}
+	tests := []struct {
+		name    string
+		build   func(b *RuleBuilder[string]) *RuleBuilder[string]
+		wantErr string
+	}{
+		{
+			name:    "wrong type",
+			build:   func(b *RuleBuilder[string]) *RuleBuilder[string] { return b.AnyString().AnyString() },
+			wantErr: "matchtree: unexpected match type #2; expected=INTEGER actual=STRING",
+		},
+		{
+			name:    "invalid pattern",
+			build:   func(b *RuleBuilder[string]) *RuleBuilder[string] { return b.MatchStrings() },
+			wantErr: "matchtree: match pattern #1: no strings for STRING pattern",
+		},
+		{
+			name:    "too few patterns",
+			build:   func(b *RuleBuilder[string]) *RuleBuilder[string] { return b.AnyString() },
+			wantErr: "matchtree: unexpected number of match patterns; expected=2 actual=1",
+		},
+		{
+			name: "too many patterns",
+			build: func(b *RuleBuilder[string]) *RuleBuilder[string] {
+				return b.AnyString().AnyInteger().AnyInteger()
+			},
+			wantErr: "matchtree: unexpected number of match patterns; expected=2 actual=3",
+		},
+		{
+			name: "first error wins",
+			build: func(b *RuleBuilder[string]) *RuleBuilder[string] {
+				return b.AnyInteger().MatchStrings()
+			},
+			wantErr: "matchtree: unexpected match type #1; expected=STRING actual=INTEGER",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.build(NewRuleBuilder[string](types)).Build()
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package matchtree
+
+import (
+	"iter"
+	"unsafe"
+)
+
+// ----- match node of bytes -----
+
+// matchNodeOfBytes keys the byte slices by their strings like matchNodeOfString.
+type matchNodeOfBytes struct {
+	matchNodeOfString
+}
+
+var _ matchNode = (*matchNodeOfBytes)(nil)
+
+func (n *matchNodeOfBytes) FindChildren(children []matchNode, key MatchKey) []matchNode {
+	key.String = bytesToString(key.Bytes)
+	return n.matchNodeOfString.FindChildren(children, key)
+}
+
+func (n *matchNodeOfBytes) Edges() iter.Seq2[MatchPattern, matchNode] {
+	return func(yield func(MatchPattern, matchNode) bool) {
+		for pattern, child := range n.matchNodeOfString.Edges() {
+			pattern.Type = MatchBytes
+			for _, v := range pattern.Strings {
+				pattern.ByteSlices = append(pattern.ByteSlices, []byte(v))
+			}
+			pattern.Strings = nil
+			if !yield(pattern, child) {
+				return
+			}
+		}
+	}
+}
+
+// bytesToString returns a string sharing the memory of b, for lookups not retaining the string.
+func bytesToString(b []byte) string { return unsafe.String(unsafe.SliceData(b), len(b)) }
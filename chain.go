@@ -0,0 +1,64 @@
+package matchtree
+
+// Chain composes two stages of MatchTrees into a router: a search of the first tree selects, by
+// each value found, the MatchTree of the next stage to search, e.g. to match coarse dimensions
+// first and then the finer ones of the tree for the coarse match.
+type Chain[T, U any] struct {
+	first *MatchTree[T]
+	next  func(T) *MatchTree[U]
+}
+
+// NewChain returns a Chain searching the first MatchTree, and then for each value found, the
+// MatchTree returned by next for the value, or none if next returns nil.
+func NewChain[T, U any](first *MatchTree[T], next func(T) *MatchTree[U]) *Chain[T, U] {
+	return &Chain[T, U]{first: first, next: next}
+}
+
+// Search searches the first MatchTree with the first keys, and then the MatchTree of the next
+// stage for each value found, in the order of the values, with the next keys. It returns the
+// values of the next stage, the ones from the tree of a higher-ranked first value first, each
+// tree's values in the order returned by its Search. It returns an error if the keys do not match
+// the types of a tree searched, wrapped with the stage of the tree.
+func (c *Chain[T, U]) Search(firstKeys, nextKeys []MatchKey) ([]U, error) {
+	firstValues, err := c.first.Search(firstKeys)
+	if err != nil {
+		return nil, wrapError(err, "chain stage #1")
+	}
+	var values []U
+	for _, firstValue := range firstValues {
+		tree := c.next(firstValue)
+		if tree == nil {
+			continue
+		}
+		values, err = tree.search(values, nextKeys, defaultSearchOptions)
+		if err != nil {
+			return nil, wrapError(err, "chain stage #2")
+		}
+	}
+	return values, nil
+}
+
+// SearchFirstMatch is like Search but returns only the first value of the next stage, the one of
+// SearchFirstMatch of the tree selected by the highest-ranked first value whose tree matches the
+// next keys; it reports false if no value is found.
+func (c *Chain[T, U]) SearchFirstMatch(firstKeys, nextKeys []MatchKey) (U, bool, error) {
+	var zero U
+	firstValues, err := c.first.Search(firstKeys)
+	if err != nil {
+		return zero, false, wrapError(err, "chain stage #1")
+	}
+	for _, firstValue := range firstValues {
+		tree := c.next(firstValue)
+		if tree == nil {
+			continue
+		}
+		value, ok, err := tree.SearchFirstMatch(nextKeys)
+		if err != nil {
+			return zero, false, wrapError(err, "chain stage #2")
+		}
+		if ok {
+			return value, true, nil
+		}
+	}
+	return zero, false, nil
+}
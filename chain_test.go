@@ -0,0 +1,59 @@
+package matchtree_test
+
+import (
+	"testing"
+
+	. "github.com/roy2220/matchtree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChain(t *testing.T) {
+	regions := NewMatchTree[string]([]MatchType{MatchString})
+	require.NoError(t, regions.AddRules([]MatchRule[string]{
+		{Patterns: []MatchPattern{StringsPattern("cn", "jp")}, Value: "asia", Priority: 1},
+		{Patterns: []MatchPattern{AnyPattern(MatchString)}, Value: "global"},
+		{Patterns: []MatchPattern{StringsPattern("us")}, Value: "america"},
+	}))
+	asia := NewMatchTree[int]([]MatchType{MatchInteger})
+	require.NoError(t, asia.AddRules([]MatchRule[int]{
+		{Patterns: []MatchPattern{IntegersPattern(1, 2)}, Value: 101},
+		{Patterns: []MatchPattern{InverseIntegersPattern(1)}, Value: 102, Priority: 1},
+	}))
+	global := NewMatchTree[int]([]MatchType{MatchInteger})
+	require.NoError(t, global.AddRules([]MatchRule[int]{
+		{Patterns: []MatchPattern{IntegersPattern(1)}, Value: 201},
+	}))
+	trees := map[string]*MatchTree[int]{"asia": asia, "global": global}
+	chain := NewChain(regions, func(region string) *MatchTree[int] { return trees[region] })
+
+	tests := []struct {
+		region    string
+		version   int64
+		want      []int
+		wantFirst int
+	}{
+		{"cn", 1, []int{101, 201}, 101},
+		{"jp", 2, []int{102, 101}, 102},
+		{"us", 1, []int{201}, 201},
+		{"de", 2, nil, 0},
+	}
+	for _, tt := range tests {
+		firstKeys := []MatchKey{StringKey(tt.region)}
+		nextKeys := []MatchKey{IntegerKey(tt.version)}
+		values, err := chain.Search(firstKeys, nextKeys)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, values, "%v %v", tt.region, tt.version)
+		value, ok, err := chain.SearchFirstMatch(firstKeys, nextKeys)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want != nil, ok)
+		assert.Equal(t, tt.wantFirst, value)
+	}
+
+	_, err := chain.Search([]MatchKey{IntegerKey(1)}, []MatchKey{IntegerKey(1)})
+	assert.ErrorContains(t, err, "matchtree: chain stage #1: unexpected match type #1")
+	_, _, err = chain.SearchFirstMatch([]MatchKey{StringKey("cn")}, []MatchKey{StringKey("a")})
+	var typeMismatchError *TypeMismatchError
+	assert.ErrorAs(t, err, &typeMismatchError)
+	assert.ErrorContains(t, err, "matchtree: chain stage #2: unexpected match type #1")
+}
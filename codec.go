@@ -0,0 +1,153 @@
+package matchtree
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// MarshalJSON marshals the MatchType to its string representation.
+func (t MatchType) MarshalJSON() ([]byte, error) { return json.Marshal(t.String()) }
+
+// UnmarshalJSON unmarshals a JSON string into a MatchType.
+func (t *MatchType) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	var err error
+	*t, err = ParseMatchType(s)
+	return err
+}
+
+// MarshalText marshals the MatchType to its string representation.
+func (t MatchType) MarshalText() ([]byte, error) { return []byte(t.String()), nil }
+
+// UnmarshalText unmarshals a text string into a MatchType.
+func (t *MatchType) UnmarshalText(text []byte) error {
+	var err error
+	*t, err = ParseMatchType(string(text))
+	return err
+}
+
+// MarshalYAML marshals the MatchType to its string representation.
+func (t MatchType) MarshalYAML() (any, error) { return t.String(), nil }
+
+// UnmarshalYAML unmarshals a YAML string into a MatchType.
+func (t *MatchType) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	var err error
+	*t, err = ParseMatchType(s)
+	return err
+}
+
+// EncodeMsgpack encodes the MatchType to its string representation in MessagePack.
+func (t MatchType) EncodeMsgpack(encoder *msgpack.Encoder) error {
+	return encoder.EncodeString(t.String())
+}
+
+// DecodeMsgpack decodes a MessagePack string into a MatchType.
+func (t *MatchType) DecodeMsgpack(decoder *msgpack.Decoder) error {
+	s, err := decoder.DecodeString()
+	if err != nil {
+		return err
+	}
+	*t, err = ParseMatchType(s)
+	return err
+}
+
+// GobEncode encodes the IntegerInterval for encoding/gob, which would otherwise not tell a bound
+// of 0 from a nil one.
+func (i IntegerInterval) GobEncode() ([]byte, error) {
+	data := []byte{encodeBoundFlags(i.Min != nil, i.MinIsExcluded, i.Max != nil, i.MaxIsExcluded)}
+	if i.Min != nil {
+		data = binary.AppendVarint(data, *i.Min)
+	}
+	if i.Max != nil {
+		data = binary.AppendVarint(data, *i.Max)
+	}
+	return data, nil
+}
+
+// GobDecode decodes an IntegerInterval encoded by GobEncode.
+func (i *IntegerInterval) GobDecode(data []byte) error {
+	if len(data) == 0 {
+		return errors.New("matchtree: invalid gob data for integer interval")
+	}
+	hasMin, minIsExcluded, hasMax, maxIsExcluded := decodeBoundFlags(data[0])
+	data = data[1:]
+	*i = IntegerInterval{MinIsExcluded: minIsExcluded, MaxIsExcluded: maxIsExcluded}
+	for _, bound := range []struct {
+		Has bool
+		Ptr **int64
+	}{{hasMin, &i.Min}, {hasMax, &i.Max}} {
+		if !bound.Has {
+			continue
+		}
+		x, n := binary.Varint(data)
+		if n <= 0 {
+			return errors.New("matchtree: invalid gob data for integer interval")
+		}
+		*bound.Ptr = Int64Ptr(x)
+		data = data[n:]
+	}
+	return nil
+}
+
+// GobEncode encodes the NumberInterval for encoding/gob, which would otherwise not tell a bound
+// of 0 from a nil one.
+func (i NumberInterval) GobEncode() ([]byte, error) {
+	data := []byte{encodeBoundFlags(i.Min != nil, i.MinIsExcluded, i.Max != nil, i.MaxIsExcluded)}
+	if i.Min != nil {
+		data = binary.BigEndian.AppendUint64(data, math.Float64bits(*i.Min))
+	}
+	if i.Max != nil {
+		data = binary.BigEndian.AppendUint64(data, math.Float64bits(*i.Max))
+	}
+	return data, nil
+}
+
+// GobDecode decodes a NumberInterval encoded by GobEncode.
+func (i *NumberInterval) GobDecode(data []byte) error {
+	if len(data) == 0 {
+		return errors.New("matchtree: invalid gob data for number interval")
+	}
+	hasMin, minIsExcluded, hasMax, maxIsExcluded := decodeBoundFlags(data[0])
+	data = data[1:]
+	*i = NumberInterval{MinIsExcluded: minIsExcluded, MaxIsExcluded: maxIsExcluded}
+	for _, bound := range []struct {
+		Has bool
+		Ptr **float64
+	}{{hasMin, &i.Min}, {hasMax, &i.Max}} {
+		if !bound.Has {
+			continue
+		}
+		if len(data) < 8 {
+			return errors.New("matchtree: invalid gob data for number interval")
+		}
+		*bound.Ptr = Float64Ptr(math.Float64frombits(binary.BigEndian.Uint64(data)))
+		data = data[8:]
+	}
+	return nil
+}
+
+func encodeBoundFlags(hasMin, minIsExcluded, hasMax, maxIsExcluded bool) byte {
+	var flags byte
+	for i, flag := range [...]bool{hasMin, minIsExcluded, hasMax, maxIsExcluded} {
+		if flag {
+			flags |= 1 << i
+		}
+	}
+	return flags
+}
+
+func decodeBoundFlags(flags byte) (hasMin, minIsExcluded, hasMax, maxIsExcluded bool) {
+	return flags&1 != 0, flags&2 != 0, flags&4 != 0, flags&8 != 0
+}
@@ -0,0 +1,145 @@
+package matchtree
+
+import "slices"
+
+// Compact removes the nodes left with no results by removing rules, frees the slots of the values
+// removed, shrinks the internal maps and slices of the MatchTree to their exact sizes and drops
+// index entries that refer to no child, reducing the memory footprint of a tree that is done
+// with adding rules. It does not change the results of searches, but renumbers the value indexes
+// reported by Walk and FindShadowedRules.
+func (t *MatchTree[T]) Compact() {
+	t.prune()
+	t.values = slices.Clip(t.values)
+	t.compiledRegexps = compactMap(t.compiledRegexps)
+	t.rules = compactMap(t.rules)
+	if t.root != nil {
+		t.compactMatchNode(t.root, 0)
+	}
+}
+
+func (t *MatchTree[T]) compactMatchNode(node matchNode, depth int) {
+	if depth == len(t.types) {
+		if leaf, ok := node.(*matchNodeOfNone); ok {
+			leaf.results = slices.Clip(leaf.results)
+		}
+		return
+	}
+
+	switch node := node.(type) {
+	case *matchNodeOfString:
+		node.children = compactMap(node.children)
+		node.inverseChildren = slices.Clip(node.inverseChildren)
+		node.inverseChildIndexes = compactInverseChildIndexes(node.inverseChildIndexes)
+	case *matchNodeOfInteger:
+		node.children = compactMap(node.children)
+		node.inverseChildren = slices.Clip(node.inverseChildren)
+		node.inverseChildIndexes = compactInverseChildIndexes(node.inverseChildIndexes)
+		node.updateChildKeys()
+	case *matchNodeOfIntegerInterval:
+		compactMatchNodeOfIntegerInterval(node)
+	case *matchNodeOfNumeric:
+		node.integerChildren = compactMap(node.integerChildren)
+		compactMatchNodeOfIntegerInterval(&node.matchNodeOfIntegerInterval)
+	case *matchNodeOfNumberInterval:
+		compactMatchNodeOfNumberInterval(node)
+	case *matchNodeOfBytes:
+		node.children = compactMap(node.children)
+		node.inverseChildren = slices.Clip(node.inverseChildren)
+		node.inverseChildIndexes = compactInverseChildIndexes(node.inverseChildIndexes)
+	case *matchNodeOfEnum:
+		node.children = compactMap(node.children)
+		node.inverseChildren = slices.Clip(node.inverseChildren)
+		node.inverseChildIndexes = compactInverseChildIndexes(node.inverseChildIndexes)
+		node.names = compactMap(node.names)
+		node.updateChildKeys()
+	case *matchNodeOfRegexp:
+		node.children = slices.Clip(node.children)
+		node.inverseChildren = slices.Clip(node.inverseChildren)
+	case *matchNodeOfSemverRange:
+		node.children = slices.Clip(node.children)
+		node.inverseChildren = slices.Clip(node.inverseChildren)
+	case *matchNodeOfGlob:
+		node.children = slices.Clip(node.children)
+		node.inverseChildren = slices.Clip(node.inverseChildren)
+	case *customMatchNode:
+	default:
+		// a leaf node at the wrong depth, left to Validate to report
+		return
+	}
+
+	for _, child := range node.Edges() {
+		t.compactMatchNode(child, depth+1)
+	}
+}
+
+// compactMap rebuilds the map at its exact size, as a map does not shrink when entries are deleted.
+func compactMap[K comparable, V any](m map[K]V) map[K]V {
+	if m == nil {
+		return nil
+	}
+	compactedMap := make(map[K]V, len(m))
+	for k, v := range m {
+		compactedMap[k] = v
+	}
+	return compactedMap
+}
+
+// compactInverseChildIndexes rebuilds the index at its exact size, dropping keys of no child.
+func compactInverseChildIndexes[K comparable](inverseChildIndexes map[K][]int) map[K][]int {
+	if inverseChildIndexes == nil {
+		return nil
+	}
+	n := 0
+	for _, childIndexes := range inverseChildIndexes {
+		if len(childIndexes) >= 1 {
+			n++
+		}
+	}
+	compactedInverseChildIndexes := make(map[K][]int, n)
+	for k, childIndexes := range inverseChildIndexes {
+		if len(childIndexes) >= 1 {
+			compactedInverseChildIndexes[k] = slices.Clip(childIndexes)
+		}
+	}
+	return compactedInverseChildIndexes
+}
+
+// compactMatchNodeOfIntegerInterval compacts the node itself, leaving its children to the caller.
+func compactMatchNodeOfIntegerInterval(node *matchNodeOfIntegerInterval) {
+	node.children = slices.Clip(node.children)
+	node.childTree.Compact()
+	node.inverseChildren = slices.Clip(node.inverseChildren)
+	inverseChildIndexes := node.inverseChildIndexes[:0:0]
+	var inverseChildIndexesTree integerIntervalTree[int]
+	for _, v := range node.inverseChildIndexes {
+		if len(v.MatchNodeIndexes) == 0 {
+			continue
+		}
+		v.MatchNodeIndexes = slices.Clip(v.MatchNodeIndexes)
+		inverseChildIndexesTree.Insert(v.IntegerInterval, len(inverseChildIndexes))
+		inverseChildIndexes = append(inverseChildIndexes, v)
+	}
+	node.inverseChildIndexes = slices.Clip(inverseChildIndexes)
+	inverseChildIndexesTree.Compact()
+	node.inverseChildIndexesTree = inverseChildIndexesTree
+}
+
+// compactMatchNodeOfNumberInterval compacts the node itself, leaving its children to the caller.
+func compactMatchNodeOfNumberInterval(node *matchNodeOfNumberInterval) {
+	node.children = slices.Clip(node.children)
+	node.childTree.Compact()
+	node.inverseChildren = slices.Clip(node.inverseChildren)
+	inverseChildIndexes := node.inverseChildIndexes[:0:0]
+	var inverseChildIndexesTree numberIntervalTree[int]
+	for _, v := range node.inverseChildIndexes {
+		if len(v.MatchNodeIndexes) == 0 {
+			continue
+		}
+		v.MatchNodeIndexes = slices.Clip(v.MatchNodeIndexes)
+		inverseChildIndexesTree.Insert(v.NumberInterval, len(inverseChildIndexes))
+		inverseChildIndexes = append(inverseChildIndexes, v)
+	}
+	node.inverseChildIndexes = slices.Clip(inverseChildIndexes)
+	inverseChildIndexesTree.Compact()
+	node.inverseChildIndexesTree = inverseChildIndexesTree
+}
@@ -0,0 +1,76 @@
+package matchtree_test
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"testing"
+
+	. "github.com/roy2220/matchtree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchTree_Compact(t *testing.T) {
+	for _, suite := range loadTestSuites(t) {
+		matchTree := buildMatchTree(t, suite)
+		var before bytes.Buffer
+		require.NoError(t, matchTree.WriteDOT(&before))
+		matchTree.Compact()
+		var after bytes.Buffer
+		require.NoError(t, matchTree.WriteDOT(&after))
+		assert.Equal(t, before.String(), after.String(), suite.Scenario)
+
+		for i, case1 := range suite.Cases {
+			t.Run(fmt.Sprintf("%s#%d", suite.Scenario, i+1), func(t *testing.T) {
+				values, err := matchTree.Search(case1.MatchKeys)
+				require.NoError(t, err)
+				assert.Equal(t, case1.Values, values)
+			})
+		}
+	}
+}
+
+func TestMatchTree_Compact_RemovedRules(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString, MatchInteger})
+	var ids []RuleID
+	for i := range 10000 {
+		id, err := matchTree.AddRule(MatchRule[string]{
+			Patterns: []MatchPattern{StringsPattern(fmt.Sprintf("s%d", i)), InverseIntegersPattern(int64(i))},
+			Value:    fmt.Sprintf("rule_%d", i),
+		})
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	for _, id := range ids[10:] {
+		require.NoError(t, matchTree.RemoveRuleByID(id))
+	}
+	statsBefore := matchTree.Stats()
+	heapAllocBefore := heapAlloc()
+
+	matchTree.Compact()
+	heapAllocAfter := heapAlloc()
+	stats := matchTree.Stats()
+	assert.Equal(t, 21, stats.NodeCount)
+	assert.Less(t, stats.NodeCount, statsBefore.NodeCount)
+	assert.Less(t, heapAllocAfter, heapAllocBefore, "footprint shrunk")
+	require.NoError(t, matchTree.Validate())
+
+	for i := range 20 {
+		values, err := matchTree.Search([]MatchKey{StringKey(fmt.Sprintf("s%d", i)), IntegerKey(-1)})
+		require.NoError(t, err)
+		if i < 10 {
+			assert.Equal(t, []string{fmt.Sprintf("rule_%d", i)}, values)
+		} else {
+			assert.Empty(t, values)
+		}
+	}
+	runtime.KeepAlive(matchTree)
+}
+
+func heapAlloc() uint64 {
+	runtime.GC()
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	return memStats.HeapAlloc
+}
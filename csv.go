@@ -0,0 +1,153 @@
+package matchtree
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// LoadRulesCSV reads MatchRules from a CSV table whose first record is a header.
+// The header must contain a "value" column and may contain a "priority" column; the remaining
+// columns, in order, are the dimensions of the rules and correspond to the given types.
+//
+// A dimension cell is written as:
+//   - "*" for any value;
+//   - "a|b" for exact values, or "[1,5)|[10,)" for intervals (see ParseIntegerInterval), or
+//     both, e.g. "1|[5,10)", for the MatchNumeric type;
+//   - "!a|b" for any value not in the list;
+//   - a regular expression, optionally prefixed with "!", for the MatchRegexp type;
+//   - a version constraint, optionally prefixed with "!", for the MatchSemverRange type;
+//   - a glob, optionally prefixed with "!", for the MatchGlob type;
+//   - empty for an empty pattern, which AddRule accepts with TreatEmptyPatternAsAny.
+func LoadRulesCSV(r io.Reader, spec []MatchType) ([]MatchRule[string], error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, errors.New("matchtree: missing csv header")
+		}
+		return nil, fmt.Errorf("matchtree: read csv header: %w", err)
+	}
+
+	valueColumn, priorityColumn := -1, -1
+	var patternColumns []int
+	for i, name := range header {
+		switch strings.TrimSpace(name) {
+		case "value":
+			valueColumn = i
+		case "priority":
+			priorityColumn = i
+		default:
+			patternColumns = append(patternColumns, i)
+		}
+	}
+	if valueColumn < 0 {
+		return nil, errors.New("matchtree: missing value column in csv header")
+	}
+	if len(patternColumns) != len(spec) {
+		return nil, fmt.Errorf("matchtree: unexpected number of pattern columns in csv header; expected=%v actual=%v", len(spec), len(patternColumns))
+	}
+
+	var rules []MatchRule[string]
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("matchtree: read csv record: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+
+		rule := MatchRule[string]{Value: record[valueColumn]}
+		if priorityColumn >= 0 {
+			if s := strings.TrimSpace(record[priorityColumn]); s != "" {
+				rule.Priority, err = strconv.ParseInt(s, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("matchtree: csv line %d: invalid priority: %w", line, err)
+				}
+			}
+		}
+		rule.Patterns = make([]MatchPattern, len(spec))
+		for i, column := range patternColumns {
+			rule.Patterns[i], err = parseCSVPattern(record[column], spec[i])
+			if err != nil {
+				return nil, wrapError(err, "csv line %d, column %q", line, header[column])
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func parseCSVPattern(cell string, type1 MatchType) (MatchPattern, error) {
+	cell = strings.TrimSpace(cell)
+	if cell == "" {
+		return MatchPattern{}, nil
+	}
+	if cell == "*" {
+		return AnyPattern(type1), nil
+	}
+
+	pattern := MatchPattern{Type: type1}
+	if s, ok := strings.CutPrefix(cell, "!"); ok {
+		pattern.IsInverse = true
+		cell = strings.TrimSpace(s)
+	}
+	switch type1 {
+	case MatchRegexp:
+		pattern.Regexp = cell
+		return pattern, nil
+	case MatchSemverRange:
+		pattern.VersionConstraint = cell
+		return pattern, nil
+	case MatchGlob:
+		pattern.Glob = cell
+		return pattern, nil
+	}
+
+	for _, item := range strings.Split(cell, "|") {
+		item = strings.TrimSpace(item)
+		switch type1 {
+		case MatchString:
+			pattern.Strings = append(pattern.Strings, item)
+		case MatchInteger:
+			integer, err := strconv.ParseInt(item, 10, 64)
+			if err != nil {
+				return MatchPattern{}, err
+			}
+			pattern.Integers = append(pattern.Integers, integer)
+		case MatchIntegerInterval:
+			interval, err := ParseIntegerInterval(item)
+			if err != nil {
+				return MatchPattern{}, err
+			}
+			pattern.IntegerIntervals = append(pattern.IntegerIntervals, interval)
+		case MatchNumeric:
+			if integer, err := strconv.ParseInt(item, 10, 64); err == nil {
+				pattern.Integers = append(pattern.Integers, integer)
+				break
+			}
+			interval, err := ParseIntegerInterval(item)
+			if err != nil {
+				return MatchPattern{}, err
+			}
+			pattern.IntegerIntervals = append(pattern.IntegerIntervals, interval)
+		case MatchNumberInterval:
+			interval, err := ParseNumberInterval(item)
+			if err != nil {
+				return MatchPattern{}, err
+			}
+			pattern.NumberIntervals = append(pattern.NumberIntervals, interval)
+		default:
+			if !isCustomMatchType(type1) {
+				return MatchPattern{}, fmt.Errorf("unknown match type %v", type1)
+			}
+			pattern.Strings = append(pattern.Strings, item)
+		}
+	}
+	return pattern, nil
+}
@@ -0,0 +1,108 @@
+package matchtree_test
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/roy2220/matchtree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadRulesCSV(t *testing.T) {
+	const data = `gender,age,height,name,value,priority
+female,"[18,30)|[40,)",*,^a,rule_1,2
+!male|other,*,"(160,180]",!^b,rule_2,
+,"[25,25]",*,*,rule_3,1
+`
+	types := []MatchType{MatchString, MatchIntegerInterval, MatchNumberInterval, MatchRegexp}
+	rules, err := LoadRulesCSV(strings.NewReader(data), types)
+	require.NoError(t, err)
+	assert.Equal(t, []MatchRule[string]{
+		{
+			Patterns: []MatchPattern{
+				StringsPattern("female"),
+				IntegerIntervalPattern(
+					IntegerInterval{Min: Int64Ptr(18), Max: Int64Ptr(30), MaxIsExcluded: true},
+					IntegerInterval{Min: Int64Ptr(40)},
+				),
+				AnyPattern(MatchNumberInterval),
+				RegexpPattern("^a"),
+			},
+			Value:    "rule_1",
+			Priority: 2,
+		},
+		{
+			Patterns: []MatchPattern{
+				InverseStringsPattern("male", "other"),
+				AnyPattern(MatchIntegerInterval),
+				NumberIntervalPattern(NumberInterval{Min: Float64Ptr(160), MinIsExcluded: true, Max: Float64Ptr(180)}),
+				InverseRegexpPattern("^b"),
+			},
+			Value: "rule_2",
+		},
+		{
+			Patterns: []MatchPattern{
+				{},
+				IntegerIntervalPattern(IntegerInterval{Min: Int64Ptr(25), Max: Int64Ptr(25)}),
+				AnyPattern(MatchNumberInterval),
+				AnyPattern(MatchRegexp),
+			},
+			Value:    "rule_3",
+			Priority: 1,
+		},
+	}, rules)
+
+	matchTree := NewMatchTree[string](types)
+	require.NoError(t, matchTree.AddRules(rules, TreatEmptyPatternAsAny()))
+	values, err := matchTree.Search([]MatchKey{
+		StringKey("female"),
+		IntegerIntervalKey(25),
+		NumberKey(170),
+		RegexpKey("abc"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_1", "rule_3", "rule_2"}, values)
+}
+
+func TestLoadRulesCSV_Errors(t *testing.T) {
+	types := []MatchType{MatchInteger}
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name:    "no header",
+			data:    "",
+			wantErr: "matchtree: missing csv header",
+		},
+		{
+			name:    "no value column",
+			data:    "age\n1\n",
+			wantErr: "matchtree: missing value column in csv header",
+		},
+		{
+			name:    "wrong number of pattern columns",
+			data:    "age,height,value\n",
+			wantErr: "matchtree: unexpected number of pattern columns in csv header; expected=1 actual=2",
+		},
+		{
+			name:    "invalid integer",
+			data:    "age,value\n1,a\nx,b\n",
+			wantErr: `matchtree: csv line 3, column "age": strconv.ParseInt: parsing "x": invalid syntax`,
+		},
+		{
+			name:    "invalid priority",
+			data:    "age,value,priority\n1,a,high\n",
+			wantErr: `matchtree: csv line 2: invalid priority: strconv.ParseInt: parsing "high": invalid syntax`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadRulesCSV(strings.NewReader(tt.data), types)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package matchtree
+
+import (
+	"fmt"
+	"iter"
+	"slices"
+	"sync"
+)
+
+// CustomMatchNode is a non-leaf node of a custom match type registered with RegisterMatchType.
+// Patterns of a custom type carry their values in Strings, and keys in String.
+// Leaf nodes always belong to the tree, so a custom node only has to route to its children,
+// which are opaque to it.
+type CustomMatchNode interface {
+	// GetOrInsertChild returns the child through which the pattern is reached, calling newChild to
+	// create one if it does not exist yet. The pattern, including IsAny and IsInverse, is handed as
+	// a whole, i.e. GetOrInsertChild is called once per rule rather than once per value in Strings.
+	GetOrInsertChild(pattern *MatchPattern, newChild func() ChildNode) ChildNode
+
+	// FindChildren appends to children the children that the key matches, in a deterministic order
+	// and without duplicates, and returns the extended slice.
+	// It must be safe to call concurrently as long as GetOrInsertChild is not called.
+	FindChildren(children []ChildNode, key MatchKey) []ChildNode
+
+	// Edges iterates over all children of the node, each with the pattern through which it is
+	// reached; see ExplanationStep.Pattern.
+	Edges() iter.Seq2[MatchPattern, ChildNode]
+}
+
+// ChildNode is an opaque handle of a child node held by a CustomMatchNode.
+type ChildNode struct {
+	node matchNode
+}
+
+var customMatchTypes struct {
+	sync.RWMutex
+
+	Names     []string
+	Factories []func() CustomMatchNode
+}
+
+// RegisterMatchType registers a custom match type with the name and the factory of its nodes,
+// and returns the new MatchType, which NewMatchTree, String and ParseMatchType then recognize.
+// It is intended to be called during program initialization, and panics if the name is taken.
+//
+// A FrozenMatchTree shares the custom nodes with the MatchTree it is frozen from, so rules must
+// not be added to the MatchTree concurrently with searches of the FrozenMatchTree.
+func RegisterMatchType(name string, factory func() CustomMatchNode) MatchType {
+	customMatchTypes.Lock()
+	defer customMatchTypes.Unlock()
+	if slices.Contains(matchType2String[:], name) || slices.Contains(customMatchTypes.Names, name) {
+		panic(fmt.Sprintf("matchtree: match type %q already registered", name))
+	}
+	customMatchTypes.Names = append(customMatchTypes.Names, name)
+	customMatchTypes.Factories = append(customMatchTypes.Factories, factory)
+	return MatchType(NumberOfMatchTypes + len(customMatchTypes.Names) - 1)
+}
+
+func customMatchTypeName(type1 MatchType) (string, bool) {
+	customMatchTypes.RLock()
+	defer customMatchTypes.RUnlock()
+	i := int(type1) - NumberOfMatchTypes
+	if i < 0 || i >= len(customMatchTypes.Names) {
+		return "", false
+	}
+	return customMatchTypes.Names[i], true
+}
+
+func parseCustomMatchType(s string) (MatchType, bool) {
+	customMatchTypes.RLock()
+	defer customMatchTypes.RUnlock()
+	for i, name := range customMatchTypes.Names {
+		if name == s {
+			return MatchType(NumberOfMatchTypes + i), true
+		}
+	}
+	return 0, false
+}
+
+func isCustomMatchType(type1 MatchType) bool {
+	_, ok := customMatchTypeName(type1)
+	return ok
+}
+
+func newCustomMatchNode(type1 MatchType) matchNode {
+	customMatchTypes.RLock()
+	factory := customMatchTypes.Factories[int(type1)-NumberOfMatchTypes]
+	customMatchTypes.RUnlock()
+	return &customMatchNode{custom: factory()}
+}
+
+// childNodesPool holds the scratch slices handed to CustomMatchNode.FindChildren, so that searches
+// through custom nodes do not allocate a slice of children each time.
+var childNodesPool = sync.Pool{New: func() any { return new([]ChildNode) }}
+
+func getChildNodes() *[]ChildNode { return childNodesPool.Get().(*[]ChildNode) }
+
+func putChildNodes(childNodes *[]ChildNode) {
+	clear(*childNodes)
+	*childNodes = (*childNodes)[:0]
+	childNodesPool.Put(childNodes)
+}
+
+// ----- custom match node -----
+
+type customMatchNode struct {
+	dummyMatchNode
+
+	custom CustomMatchNode
+}
+
+var _ matchNode = (*customMatchNode)(nil)
+
+func (n *customMatchNode) GetOrInsertChild(pattern *MatchPattern, newChildType MatchType) matchNode {
+	return n.custom.GetOrInsertChild(pattern, func() ChildNode {
+		return ChildNode{newMatchNode(newChildType)}
+	}).node
+}
+
+func (n *customMatchNode) FindChildren(children []matchNode, key MatchKey) []matchNode {
+	if key.IsAbsent {
+		// custom nodes need not know about absent keys
+		return n.appendAnyChildren(children)
+	}
+
+	childNodes := getChildNodes()
+	*childNodes = n.custom.FindChildren((*childNodes)[:0], key)
+	for _, child := range *childNodes {
+		children = append(children, child.node)
+	}
+	putChildNodes(childNodes)
+	return children
+}
+
+// appendAnyChildren appends the children reached by any value, kept apart from FindChildren so
+// that the closure ranging over Edges does not move the children of every search to the heap.
+func (n *customMatchNode) appendAnyChildren(children []matchNode) []matchNode {
+	for pattern, child := range n.custom.Edges() {
+		if pattern.IsAny {
+			children = append(children, child.node)
+		}
+	}
+	return children
+}
+
+func (n *customMatchNode) Edges() iter.Seq2[MatchPattern, matchNode] {
+	return func(yield func(MatchPattern, matchNode) bool) {
+		for pattern, child := range n.custom.Edges() {
+			if !yield(pattern, child.node) {
+				return
+			}
+		}
+	}
+}
+
+// ----- frozen custom match node -----
+
+type frozenCustomMatchNode struct {
+	dummyFrozenMatchNode
+
+	custom   CustomMatchNode
+	children map[matchNode]frozenMatchNode
+}
+
+var _ frozenMatchNode = (*frozenCustomMatchNode)(nil)
+
+func (f *matchNodeFreezer) freezeCustomMatchNode(node *customMatchNode) *frozenCustomMatchNode {
+	frozenNode := &frozenCustomMatchNode{
+		custom:   node.custom,
+		children: make(map[matchNode]frozenMatchNode),
+	}
+	if f.depth > f.leafDepth {
+		// a faulty custom node where a leaf node is expected, whose children are left out so that
+		// one leading back up the tree cannot make the freezing go on forever
+		return frozenNode
+	}
+	for _, child := range node.Edges() {
+		if _, ok := frozenNode.children[child]; !ok {
+			frozenNode.children[child] = f.freezeMatchNode(child)
+		}
+	}
+	return frozenNode
+}
+
+func (n *frozenCustomMatchNode) FindChildren(children []frozenMatchNode, key MatchKey) []frozenMatchNode {
+	if key.IsAbsent {
+		return n.appendAnyChildren(children)
+	}
+
+	childNodes := getChildNodes()
+	*childNodes = n.custom.FindChildren((*childNodes)[:0], key)
+	for _, child := range *childNodes {
+		// children inserted after freezing are not part of the snapshot
+		if frozenChild, ok := n.children[child.node]; ok {
+			children = append(children, frozenChild)
+		}
+	}
+	putChildNodes(childNodes)
+	return children
+}
+
+func (n *frozenCustomMatchNode) appendAnyChildren(children []frozenMatchNode) []frozenMatchNode {
+	for pattern, child := range n.custom.Edges() {
+		if frozenChild, ok := n.children[child.node]; ok && pattern.IsAny {
+			children = append(children, frozenChild)
+		}
+	}
+	return children
+}
@@ -0,0 +1,194 @@
+package matchtree_test
+
+import (
+	"iter"
+	"strings"
+	"testing"
+
+	. "github.com/roy2220/matchtree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// prefixMatchNode matches a key with any of the prefixes of a pattern.
+type prefixMatchNode struct {
+	prefixes [][]string
+	children []ChildNode
+	anyChild *ChildNode
+}
+
+func (n *prefixMatchNode) GetOrInsertChild(pattern *MatchPattern, newChild func() ChildNode) ChildNode {
+	if pattern.IsAny {
+		if n.anyChild == nil {
+			child := newChild()
+			n.anyChild = &child
+		}
+		return *n.anyChild
+	}
+	child := newChild()
+	n.prefixes = append(n.prefixes, pattern.Strings)
+	n.children = append(n.children, child)
+	return child
+}
+
+func (n *prefixMatchNode) FindChildren(children []ChildNode, key MatchKey) []ChildNode {
+	for i, prefixes := range n.prefixes {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key.String, prefix) {
+				children = append(children, n.children[i])
+				break
+			}
+		}
+	}
+	if n.anyChild != nil {
+		children = append(children, *n.anyChild)
+	}
+	return children
+}
+
+func (n *prefixMatchNode) Edges() iter.Seq2[MatchPattern, ChildNode] {
+	return func(yield func(MatchPattern, ChildNode) bool) {
+		for i, prefixes := range n.prefixes {
+			if !yield(MatchPattern{Type: matchPrefix, Strings: prefixes}, n.children[i]) {
+				return
+			}
+		}
+		if n.anyChild != nil {
+			yield(MatchPattern{Type: matchPrefix, IsAny: true}, *n.anyChild)
+		}
+	}
+}
+
+var matchPrefix = RegisterMatchType("TEST_PREFIX", func() CustomMatchNode { return new(prefixMatchNode) })
+
+func TestRegisterMatchType(t *testing.T) {
+	assert.Equal(t, "TEST_PREFIX", matchPrefix.String())
+	type1, err := ParseMatchType("TEST_PREFIX")
+	require.NoError(t, err)
+	assert.Equal(t, matchPrefix, type1)
+	assert.Panics(t, func() { RegisterMatchType("TEST_PREFIX", nil) })
+	assert.Panics(t, func() { RegisterMatchType("STRING", nil) })
+	assert.True(t, matchPrefix.IsValid())
+	assert.Contains(t, AllMatchTypes(), matchPrefix)
+
+	matchTree, err := NewMatchTreeChecked[string]([]MatchType{matchPrefix, MatchInteger})
+	require.NoError(t, err)
+	require.NoError(t, matchTree.AddRules([]MatchRule[string]{
+		{
+			Patterns: []MatchPattern{{Type: matchPrefix, Strings: []string{"/api/", "/v1/"}}, AnyPattern(MatchInteger)},
+			Value:    "rule_1",
+			Priority: 1,
+		},
+		{
+			Patterns: []MatchPattern{AnyPattern(matchPrefix), IntegersPattern(1)},
+			Value:    "rule_2",
+		},
+	}))
+	pattern := MatchPattern{Type: matchPrefix, IsAny: true, Integers: []int64{1}}
+	assert.EqualError(t, pattern.Validate(), "matchtree: unexpected integers for TEST_PREFIX pattern")
+	frozenMatchTree := matchTree.Freeze()
+
+	tests := []struct {
+		keys []MatchKey
+		want []string
+	}{
+		{[]MatchKey{{Type: matchPrefix, String: "/api/users"}, IntegerKey(1)}, []string{"rule_1", "rule_2"}},
+		{[]MatchKey{{Type: matchPrefix, String: "/v1/users"}, IntegerKey(2)}, []string{"rule_1"}},
+		{[]MatchKey{{Type: matchPrefix, String: "/v2/users"}, IntegerKey(2)}, nil},
+		{[]MatchKey{AbsentKey(matchPrefix), IntegerKey(1)}, []string{"rule_2"}},
+	}
+	for _, tt := range tests {
+		values, err := matchTree.Search(tt.keys)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, values)
+
+		values, err = frozenMatchTree.Search(tt.keys)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, values)
+	}
+
+	explanations, err := matchTree.Explain(tests[0].keys)
+	require.NoError(t, err)
+	if assert.Len(t, explanations, 2) {
+		assert.Equal(t, ExplanationStep{
+			Kind:    ExactChild,
+			Pattern: MatchPattern{Type: matchPrefix, Strings: []string{"/api/", "/v1/"}},
+		}, explanations[0].Steps[0])
+	}
+}
+
+func TestFrozenMatchTree_Search_CustomAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("sync.Pool drops items randomly under the race detector")
+	}
+	matchTree := NewMatchTree[string]([]MatchType{matchPrefix, MatchInteger})
+	require.NoError(t, matchTree.AddRules([]MatchRule[string]{
+		{Patterns: []MatchPattern{{Type: matchPrefix, Strings: []string{"/api/"}}, AnyPattern(MatchInteger)}, Value: "rule_1"},
+		{Patterns: []MatchPattern{AnyPattern(matchPrefix), IntegersPattern(1)}, Value: "rule_2"},
+	}))
+	frozenMatchTree := matchTree.Freeze()
+
+	keys := []MatchKey{{Type: matchPrefix, String: "/api/users"}, IntegerKey(1)}
+	allocs := testing.AllocsPerRun(100, func() {
+		_, _ = frozenMatchTree.Search(keys)
+	})
+	assert.Equal(t, 1.0, allocs) // the returned slice
+}
+
+// misalignedMatchNode is a faulty custom node that matches any key with the first child created by
+// a node of its type, whichever depth it is at.
+type misalignedMatchNode struct {
+	child ChildNode
+}
+
+var firstMisalignedChild ChildNode
+
+func (n *misalignedMatchNode) GetOrInsertChild(pattern *MatchPattern, newChild func() ChildNode) ChildNode {
+	if n.child == (ChildNode{}) {
+		n.child = newChild()
+		if firstMisalignedChild == (ChildNode{}) {
+			firstMisalignedChild = n.child
+		}
+	}
+	return n.child
+}
+
+func (n *misalignedMatchNode) FindChildren(children []ChildNode, key MatchKey) []ChildNode {
+	return append(children, firstMisalignedChild)
+}
+
+func (n *misalignedMatchNode) Edges() iter.Seq2[MatchPattern, ChildNode] {
+	return func(yield func(MatchPattern, ChildNode) bool) {
+		yield(MatchPattern{Type: matchMisaligned, IsAny: true}, firstMisalignedChild)
+	}
+}
+
+var matchMisaligned = RegisterMatchType("TEST_MISALIGNED", func() CustomMatchNode { return new(misalignedMatchNode) })
+
+func TestMatchTree_Search_MisalignedTree(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{matchMisaligned, matchMisaligned})
+	_, err := matchTree.AddRule(MatchRule[string]{
+		Patterns: []MatchPattern{{Type: matchMisaligned, Strings: []string{"a"}}, {Type: matchMisaligned, Strings: []string{"b"}}},
+		Value:    "rule_1",
+	})
+	require.NoError(t, err)
+
+	// the key at depth 1 leads back to the node at depth 1 rather than to a leaf node
+	keys := []MatchKey{{Type: matchMisaligned, String: "a"}, {Type: matchMisaligned, String: "b"}}
+	_, err = matchTree.Search(keys)
+	assert.ErrorIs(t, err, ErrMisalignedTree)
+	_, _, err = matchTree.SearchFirstMatch(keys)
+	assert.ErrorIs(t, err, ErrMisalignedTree)
+	_, err = matchTree.SearchAny(keys)
+	assert.ErrorIs(t, err, ErrMisalignedTree)
+	_, err = matchTree.Explain(keys)
+	assert.ErrorIs(t, err, ErrMisalignedTree)
+	_, err = matchTree.SearchExplainNoMatch(keys)
+	assert.ErrorIs(t, err, ErrMisalignedTree)
+	_, err = matchTree.SearchNearMatches(keys, 1)
+	assert.ErrorIs(t, err, ErrMisalignedTree)
+	_, err = matchTree.Freeze().Search(keys)
+	assert.ErrorIs(t, err, ErrMisalignedTree)
+	_, err = matchTree.Freeze(WithSharedSubtrees()).Search(keys)
+	assert.ErrorIs(t, err, ErrMisalignedTree)
+}
@@ -0,0 +1,118 @@
+package matchtree
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// WriteDOT writes the structure of the MatchTree to w in the Graphviz DOT language.
+// Non-leaf nodes are labeled with their MatchTypes, and edges with the conditions through which
+// the child nodes are reached: an exact value or interval, ANY, or !{...} for inverse children.
+// Leaf nodes are labeled with the value indexes (in insertion order) and priorities of their results.
+func (t *MatchTree[T]) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph matchtree {")
+	if t.root != nil {
+		nodeCount := 0
+		var writeNode func(node matchNode, depth int) int
+		writeNode = func(node matchNode, depth int) int {
+			nodeID := nodeCount
+			nodeCount++
+			if depth == len(t.types) {
+				// leaf
+				var label strings.Builder
+				for i, result := range node.GetResults() {
+					if i >= 1 {
+						label.WriteByte('\n')
+					}
+					fmt.Fprintf(&label, "#%d (priority %d)", result.ValueIndex, result.Priority)
+				}
+				fmt.Fprintf(bw, "\tn%d [shape=box, label=%s];\n", nodeID, quoteDOTString(label.String()))
+				return nodeID
+			}
+
+			// non-leaf
+			fmt.Fprintf(bw, "\tn%d [label=%s];\n", nodeID, quoteDOTString(t.types[depth].String()))
+			for pattern, child := range node.Edges() {
+				childID := writeNode(child, depth+1)
+				fmt.Fprintf(bw, "\tn%d -> n%d [label=%s];\n", nodeID, childID, quoteDOTString(edgeLabel(&pattern)))
+			}
+			return nodeID
+		}
+		writeNode(t.root, 0)
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// edgeLabel formats the pattern describing how a child node is reached.
+func edgeLabel(pattern *MatchPattern) string {
+	if pattern.IsAny {
+		return "ANY"
+	}
+
+	items := formatPatternItems(pattern, strconv.Quote)
+	if pattern.IsInverse {
+		return "!{" + strings.Join(items, ",") + "}"
+	}
+	return strings.Join(items, ",")
+}
+
+// formatPatternItems formats the values, intervals, regexp, version constraint or glob of the
+// pattern, formatting strings with formatString.
+func formatPatternItems(pattern *MatchPattern, formatString func(string) string) []string {
+	var items []string
+	switch pattern.Type {
+	case MatchString, MatchEnum:
+		for _, v := range pattern.Strings {
+			items = append(items, formatString(v))
+		}
+	case MatchInteger:
+		for _, v := range pattern.Integers {
+			items = append(items, strconv.FormatInt(v, 10))
+		}
+	case MatchIntegerInterval:
+		for _, v := range pattern.IntegerIntervals {
+			items = append(items, v.String())
+		}
+	case MatchNumeric:
+		for _, v := range pattern.Integers {
+			items = append(items, strconv.FormatInt(v, 10))
+		}
+		for _, v := range pattern.IntegerIntervals {
+			items = append(items, v.String())
+		}
+	case MatchNumberInterval:
+		for _, v := range pattern.NumberIntervals {
+			items = append(items, v.String())
+		}
+	case MatchRegexp:
+		items = append(items, "/"+pattern.Regexp+"/")
+	case MatchSemverRange:
+		items = append(items, pattern.VersionConstraint)
+	case MatchGlob:
+		items = append(items, formatString(pattern.Glob))
+	case MatchBytes:
+		for _, v := range pattern.ByteSlices {
+			items = append(items, "0x"+hex.EncodeToString(v))
+		}
+	default:
+		// custom match type
+		for _, v := range pattern.Strings {
+			items = append(items, formatString(v))
+		}
+	}
+	return items
+}
+
+// quoteDOTString quotes s as a DOT string, in which "\n" denotes a line break.
+func quoteDOTString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,101 @@
+package matchtree_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/roy2220/matchtree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchTree_WriteDOT(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString, MatchIntegerInterval})
+	err := matchTree.AddRules([]MatchRule[string]{
+		{
+			Patterns: []MatchPattern{
+				{Type: MatchString, Strings: []string{"foo", `b"r`}},
+				{Type: MatchIntegerInterval, IntegerIntervals: []IntegerInterval{{Min: Int64Ptr(1), Max: Int64Ptr(5), MaxIsExcluded: true}}},
+			},
+			Value:    "rule_1",
+			Priority: 1,
+		},
+		{
+			Patterns: []MatchPattern{
+				{Type: MatchString, IsInverse: true, Strings: []string{"foo"}},
+				{Type: MatchIntegerInterval, IsAny: true},
+			},
+			Value:    "rule_2",
+			Priority: 2,
+		},
+		{
+			Patterns: []MatchPattern{
+				{Type: MatchString, IsInverse: true, Strings: []string{"foo"}},
+				{Type: MatchIntegerInterval, IsInverse: true, IntegerIntervals: []IntegerInterval{{Max: Int64Ptr(0)}}},
+			},
+			Value: "rule_3",
+		},
+	})
+	require.NoError(t, err)
+
+	var b strings.Builder
+	err = matchTree.WriteDOT(&b)
+	require.NoError(t, err)
+	assert.Equal(t, `digraph matchtree {
+	n0 [label="STRING"];
+	n1 [label="INTEGER_INTERVAL"];
+	n2 [shape=box, label="#0 (priority 1)"];
+	n1 -> n2 [label="[1,5)"];
+	n0 -> n1 [label="\"b\\\"r\""];
+	n3 [label="INTEGER_INTERVAL"];
+	n4 [shape=box, label="#0 (priority 1)"];
+	n3 -> n4 [label="[1,5)"];
+	n0 -> n3 [label="\"foo\""];
+	n5 [label="INTEGER_INTERVAL"];
+	n6 [shape=box, label="#2 (priority 0)"];
+	n5 -> n6 [label="!{(,0]}"];
+	n7 [shape=box, label="#1 (priority 2)"];
+	n5 -> n7 [label="ANY"];
+	n0 -> n5 [label="!{\"foo\"}"];
+}
+`, b.String())
+
+	b.Reset()
+	err = NewMatchTree[string]([]MatchType{MatchString}).WriteDOT(&b)
+	require.NoError(t, err)
+	assert.Equal(t, "digraph matchtree {\n}\n", b.String())
+}
+
+func TestMatchTree_WriteDOT_Deterministic(t *testing.T) {
+	types := []MatchType{MatchString, MatchInteger, MatchEnum, MatchBytes}
+	codes := map[string]int64{"red": 1, "green": 2, "blue": 3}
+	var rules []MatchRule[int]
+	for i := range 50 {
+		rules = append(rules, MatchRule[int]{
+			Patterns: []MatchPattern{
+				StringsPattern(fmt.Sprint("s", i%7), fmt.Sprint("s", i%11)),
+				InverseIntegersPattern(int64(i%5), int64(i%13)),
+				EnumPattern(codes, []string{"red", "green", "blue"}[i%3]),
+				BytesPattern([]byte{byte(i % 9)}),
+			},
+			Value: i,
+		})
+	}
+
+	// the children of a node are kept in maps, which are iterated in a different order each time
+	var wantDOT string
+	var wantRules []MatchRule[int]
+	for i := range 5 {
+		matchTree := NewMatchTree[int](types)
+		require.NoError(t, matchTree.AddRules(rules))
+		var sb strings.Builder
+		require.NoError(t, matchTree.WriteDOT(&sb))
+		if i == 0 {
+			wantDOT, wantRules = sb.String(), matchTree.ToRules()
+			continue
+		}
+		assert.Equal(t, wantDOT, sb.String())
+		assert.Equal(t, wantRules, matchTree.ToRules())
+	}
+}
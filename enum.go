@@ -0,0 +1,43 @@
+package matchtree
+
+import "iter"
+
+// ----- match node of enum -----
+
+type matchNodeOfEnum struct {
+	matchNodeOfInteger
+
+	names map[int64]string
+}
+
+var _ matchNode = (*matchNodeOfEnum)(nil)
+
+func (n *matchNodeOfEnum) GetOrInsertChild(pattern *MatchPattern, newChildType MatchType) matchNode {
+	for _, name := range pattern.Strings {
+		if n.names == nil {
+			n.names = make(map[int64]string)
+		}
+		n.names[pattern.EnumCodes[name]] = name
+	}
+	return n.matchNodeOfInteger.GetOrInsertChild(pattern, newChildType)
+}
+
+func (n *matchNodeOfEnum) Edges() iter.Seq2[MatchPattern, matchNode] {
+	return func(yield func(MatchPattern, matchNode) bool) {
+		for pattern, child := range n.matchNodeOfInteger.Edges() {
+			pattern.Type = MatchEnum
+			if !pattern.IsAny {
+				pattern.EnumCodes = make(map[string]int64, len(pattern.Integers))
+				for _, v := range pattern.Integers {
+					name := n.names[v]
+					pattern.Strings = append(pattern.Strings, name)
+					pattern.EnumCodes[name] = v
+				}
+				pattern.Integers = nil
+			}
+			if !yield(pattern, child) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package matchtree
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+)
+
+// ChildKind describes how a child node is reached from its parent node.
+type ChildKind int
+
+const (
+	// ExactChild is a child reached by a specific value, interval or regular expression.
+	ExactChild = ChildKind(iota)
+	// InverseChild is a child reached by any value not in a list of values or intervals,
+	// or not matching a regular expression.
+	InverseChild
+	// AnyChild is a child reached by any value.
+	AnyChild
+	// NumberOfChildKinds indicates the total number of defined child kinds.
+	NumberOfChildKinds = int(iota)
+)
+
+var childKind2String = [NumberOfChildKinds]string{
+	ExactChild:   "EXACT",
+	InverseChild: "INVERSE",
+	AnyChild:     "ANY",
+}
+
+// String returns the string representation of a ChildKind.
+func (k ChildKind) String() string {
+	i := int(k)
+	if i >= 0 && i < NumberOfChildKinds {
+		return childKind2String[k]
+	}
+	return fmt.Sprintf("UNKNOWN(%d)", i)
+}
+
+func childKindOf(pattern *MatchPattern) ChildKind {
+	switch {
+	case pattern.IsAny:
+		return AnyChild
+	case pattern.IsInverse:
+		return InverseChild
+	default:
+		return ExactChild
+	}
+}
+
+// Explanation describes how a value matched the keys in a search.
+type Explanation[T any] struct {
+	Value    T
+	Priority int64
+
+	// Steps lists how the key of each dimension was matched, in the order of the tree's types.
+	Steps []ExplanationStep
+}
+
+// ExplanationStep describes how a key was matched at a single dimension.
+type ExplanationStep struct {
+	// Kind indicates whether the key matched an exact child, an inverse child or the any child.
+	Kind ChildKind
+
+	// Pattern describes the condition the key satisfied, i.e. a single value or interval for
+	// an exact child, the excluded values or intervals for an inverse child, or IsAny for the any child.
+	Pattern MatchPattern
+}
+
+// Explain searches the MatchTree like Search, but instead of the values, it returns an Explanation
+// of each path through which a value matched, in the same order as Search returns the values.
+// A value reached through multiple paths, e.g. via a custom match type, is explained once per
+// path. It returns an error if the keys do not match the tree's defined types.
+func (t *MatchTree[T]) Explain(keys []MatchKey) ([]Explanation[T], error) {
+	if err := checkKeys(t.types, keys); err != nil {
+		return nil, err
+	}
+	if t.root == nil {
+		return nil, nil
+	}
+	keys = normalizeKeys(keys, t.stringForm)
+
+	type path struct {
+		Node  matchNode
+		Steps []ExplanationStep
+	}
+	paths := []path{{Node: t.root}}
+	var nextPaths []path
+	for _, key := range keys {
+		for _, path1 := range paths {
+			// non-leaf
+			children := path1.Node.FindChildren(nil, key)
+			if len(children) == 0 {
+				continue
+			}
+			edges := make(map[matchNode]MatchPattern)
+			for pattern, child := range path1.Node.Edges() {
+				edges[child] = pattern
+			}
+			for _, child := range children {
+				pattern := edges[child]
+				nextPaths = append(nextPaths, path{
+					Node: child,
+					Steps: append(slices.Clip(path1.Steps), ExplanationStep{
+						Kind:    childKindOf(&pattern),
+						Pattern: pattern,
+					}),
+				})
+			}
+		}
+		paths, nextPaths = nextPaths, paths[:0]
+	}
+
+	type resultAndSteps struct {
+		Result matchResult
+		Steps  []ExplanationStep
+	}
+	var resultsAndSteps []resultAndSteps
+	for _, path1 := range paths {
+		// leaf
+		if err := checkLeaf(path1.Node); err != nil {
+			return nil, err
+		}
+		for _, result := range path1.Node.GetResults() {
+			if !result.isEnabled() {
+				continue
+			}
+			resultsAndSteps = append(resultsAndSteps, resultAndSteps{result, path1.Steps})
+		}
+	}
+	if len(resultsAndSteps) == 0 {
+		return nil, nil
+	}
+	slices.SortStableFunc(resultsAndSteps, func(x, y resultAndSteps) int {
+		return compareResults(x.Result, y.Result)
+	})
+
+	explanations := make([]Explanation[T], len(resultsAndSteps))
+	for i, v := range resultsAndSteps {
+		explanations[i] = Explanation[T]{
+			Value:    t.values[v.Result.ValueIndex],
+			Priority: v.Result.Priority,
+			Steps:    v.Steps,
+		}
+	}
+	return explanations, nil
+}
+
+// NoMatchReport describes where a search found no values, as reported by SearchExplainNoMatch.
+type NoMatchReport struct {
+	// IsMatched indicates that the keys matched some values, in which case nothing else is
+	// reported.
+	IsMatched bool
+
+	// Depth is the index of the key that matched none of the children of the nodes reached by the
+	// keys before it, or the number of the tree's types if the keys reached leaf nodes whose
+	// results are all of disabled or removed rules.
+	Depth int
+
+	// FrontierSize is the number of nodes at Depth reached by the keys before it, which is 0 if
+	// the tree has no rules.
+	FrontierSize int
+
+	// Children holds the distinct patterns of the children of the nodes at Depth, none of which the
+	// key at Depth matched, e.g. the strings of the exact children to compare with the key.
+	// It is empty at the leaf nodes.
+	Children []MatchPattern
+}
+
+// SearchExplainNoMatch searches the MatchTree like Search, and if no value is found, reports where
+// the search came to a dead end: the key that no child matched, along with the children it failed
+// to match, to tell e.g. a misspelled key value or a missing rule. It complements Explain, which
+// explains the values matched. It returns an error if the keys do not match the tree's defined
+// types.
+func (t *MatchTree[T]) SearchExplainNoMatch(keys []MatchKey) (NoMatchReport, error) {
+	if err := checkKeys(t.types, keys); err != nil {
+		return NoMatchReport{}, err
+	}
+	if t.root == nil {
+		return NoMatchReport{}, nil
+	}
+	keys = normalizeKeys(keys, t.stringForm)
+
+	nodes := []matchNode{t.root}
+	var nextNodes []matchNode
+	for i, key := range keys {
+		for _, node := range nodes {
+			// non-leaf
+			nextNodes = node.FindChildren(nextNodes, key)
+		}
+		if len(nextNodes) == 0 {
+			report := NoMatchReport{Depth: i, FrontierSize: len(nodes)}
+			var patternStrings []string
+			for _, node := range nodes {
+				for pattern := range node.Edges() {
+					pattern.compiledRegexp = nil
+					pattern.versionRanges = nil
+					if s := pattern.String(); !slices.Contains(patternStrings, s) {
+						patternStrings = append(patternStrings, s)
+						report.Children = append(report.Children, pattern)
+					}
+				}
+			}
+			return report, nil
+		}
+		nodes, nextNodes = nextNodes, nodes[:0]
+	}
+
+	for _, node := range nodes {
+		// leaf
+		if err := checkLeaf(node); err != nil {
+			return NoMatchReport{}, err
+		}
+		if slices.ContainsFunc(node.GetResults(), func(result matchResult) bool {
+			return result.isActiveAt(defaultSearchOptions.Now)
+		}) {
+			return NoMatchReport{IsMatched: true}, nil
+		}
+	}
+	return NoMatchReport{Depth: len(t.types), FrontierSize: len(nodes)}, nil
+}
+
+// NearMatch describes a value that would match the keys in a search if the keys of a few
+// dimensions were different, as reported by SearchNearMatches.
+type NearMatch[T any] struct {
+	Value    T
+	Priority int64
+
+	// DifferingDimensions lists the indices of the keys that matched no condition of the rule,
+	// in ascending order.
+	DifferingDimensions []int
+}
+
+// SearchNearMatches searches the MatchTree like Search, but allows the keys of up to maxDiff
+// dimensions to mismatch: at each dimension, the children the key does not match are followed too,
+// as long as no more than maxDiff keys have been mismatched. It returns a NearMatch for each active
+// rule reached with at least one mismatched key, e.g. for "did you mean" suggestions; the rules
+// matching all the keys are left to Search. A rule reached through multiple paths is reported once,
+// by the path with the fewest mismatched keys. The near matches are sorted by the number of
+// mismatched keys, and then in the same order as Search returns the values. It returns an error if
+// the keys do not match the tree's defined types, or if maxDiff is negative.
+func (t *MatchTree[T]) SearchNearMatches(keys []MatchKey, maxDiff int) ([]NearMatch[T], error) {
+	if err := checkKeys(t.types, keys); err != nil {
+		return nil, err
+	}
+	if maxDiff < 0 {
+		return nil, fmt.Errorf("matchtree: invalid max diff %v", maxDiff)
+	}
+	if t.root == nil || maxDiff == 0 {
+		return nil, nil
+	}
+	keys = normalizeKeys(keys, t.stringForm)
+
+	type path struct {
+		Node                matchNode
+		DifferingDimensions []int
+	}
+	paths := []path{{Node: t.root}}
+	var nextPaths []path
+	matchedChildren := make(map[matchNode]struct{})
+	for i, key := range keys {
+		for _, path1 := range paths {
+			// non-leaf
+			children := path1.Node.FindChildren(nil, key)
+			for _, child := range children {
+				nextPaths = append(nextPaths, path{child, path1.DifferingDimensions})
+			}
+			if len(path1.DifferingDimensions) == maxDiff {
+				continue
+			}
+			clear(matchedChildren)
+			for _, child := range children {
+				matchedChildren[child] = struct{}{}
+			}
+			for _, child := range path1.Node.Edges() {
+				if _, ok := matchedChildren[child]; ok {
+					continue
+				}
+				matchedChildren[child] = struct{}{}
+				nextPaths = append(nextPaths, path{
+					Node:                child,
+					DifferingDimensions: append(slices.Clip(path1.DifferingDimensions), i),
+				})
+			}
+		}
+		paths, nextPaths = nextPaths, paths[:0]
+	}
+
+	type resultAndDimensions struct {
+		Result              matchResult
+		DifferingDimensions []int
+	}
+	var resultsAndDimensions []resultAndDimensions
+	ruleIndexes := make(map[RuleID]int)
+	for _, path1 := range paths {
+		// leaf
+		if err := checkLeaf(path1.Node); err != nil {
+			return nil, err
+		}
+		for _, result := range path1.Node.GetResults() {
+			if !result.isActiveAt(defaultSearchOptions.Now) {
+				continue
+			}
+			i, ok := ruleIndexes[result.RuleID]
+			if !ok {
+				ruleIndexes[result.RuleID] = len(resultsAndDimensions)
+				resultsAndDimensions = append(resultsAndDimensions, resultAndDimensions{result, path1.DifferingDimensions})
+				continue
+			}
+			if len(path1.DifferingDimensions) < len(resultsAndDimensions[i].DifferingDimensions) {
+				resultsAndDimensions[i].DifferingDimensions = path1.DifferingDimensions
+			}
+		}
+	}
+	resultsAndDimensions = slices.DeleteFunc(resultsAndDimensions, func(v resultAndDimensions) bool {
+		return len(v.DifferingDimensions) == 0
+	})
+	if len(resultsAndDimensions) == 0 {
+		return nil, nil
+	}
+	slices.SortStableFunc(resultsAndDimensions, func(x, y resultAndDimensions) int {
+		if c := cmp.Compare(len(x.DifferingDimensions), len(y.DifferingDimensions)); c != 0 {
+			return c
+		}
+		return compareResults(x.Result, y.Result)
+	})
+
+	nearMatches := make([]NearMatch[T], len(resultsAndDimensions))
+	for i, v := range resultsAndDimensions {
+		nearMatches[i] = NearMatch[T]{
+			Value:               t.values[v.Result.ValueIndex],
+			Priority:            v.Result.Priority,
+			DifferingDimensions: v.DifferingDimensions,
+		}
+	}
+	return nearMatches, nil
+}
@@ -0,0 +1,205 @@
+package matchtree_test
+
+import (
+	"testing"
+
+	. "github.com/roy2220/matchtree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchTree_Explain(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString, MatchInteger, MatchNumberInterval})
+	err := matchTree.AddRules([]MatchRule[string]{
+		{
+			Patterns: []MatchPattern{
+				{Type: MatchString, Strings: []string{"tom"}},
+				{Type: MatchInteger, IsAny: true},
+				{Type: MatchNumberInterval, NumberIntervals: []NumberInterval{
+					{Min: Float64Ptr(200), Max: Float64Ptr(300)},
+					{Min: Float64Ptr(250), Max: Float64Ptr(350)},
+				}},
+			},
+			Value:    "rule_1",
+			Priority: 1,
+		},
+		{
+			Patterns: []MatchPattern{
+				{Type: MatchString, IsInverse: true, Strings: []string{"joe", "bob"}},
+				{Type: MatchInteger, Integers: []int64{30}},
+				{Type: MatchNumberInterval, IsAny: true},
+			},
+			Value:    "rule_2",
+			Priority: 2,
+		},
+		{
+			Patterns: []MatchPattern{
+				{Type: MatchString, IsAny: true},
+				{Type: MatchInteger, Integers: []int64{99}},
+				{Type: MatchNumberInterval, IsAny: true},
+			},
+			Value: "rule_3",
+		},
+	})
+	require.NoError(t, err)
+
+	explanations, err := matchTree.Explain([]MatchKey{
+		{Type: MatchString, String: "tom"},
+		{Type: MatchInteger, Integer: 30},
+		{Type: MatchNumberInterval, Number: 260},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []Explanation[string]{
+		{
+			Value:    "rule_2",
+			Priority: 2,
+			Steps: []ExplanationStep{
+				{Kind: InverseChild, Pattern: MatchPattern{Type: MatchString, IsInverse: true, Strings: []string{"bob", "joe"}}},
+				{Kind: ExactChild, Pattern: MatchPattern{Type: MatchInteger, Integers: []int64{30}}},
+				{Kind: AnyChild, Pattern: MatchPattern{Type: MatchNumberInterval, IsAny: true}},
+			},
+		},
+		{
+			Value:    "rule_1",
+			Priority: 1,
+			Steps: []ExplanationStep{
+				{Kind: ExactChild, Pattern: MatchPattern{Type: MatchString, Strings: []string{"tom"}}},
+				{Kind: AnyChild, Pattern: MatchPattern{Type: MatchInteger, IsAny: true}},
+				// the overlapping intervals are merged at AddRule
+				{Kind: ExactChild, Pattern: MatchPattern{Type: MatchNumberInterval, NumberIntervals: []NumberInterval{
+					{Min: Float64Ptr(200), Max: Float64Ptr(350)},
+				}}},
+			},
+		},
+	}, explanations)
+
+	explanations, err = matchTree.Explain([]MatchKey{
+		{Type: MatchString, String: "bob"},
+		{Type: MatchInteger, Integer: 30},
+		{Type: MatchNumberInterval, Number: 260},
+	})
+	require.NoError(t, err)
+	assert.Nil(t, explanations)
+
+	_, err = matchTree.Explain([]MatchKey{{Type: MatchString, String: "bob"}})
+	assert.EqualError(t, err, "matchtree: unexpected number of match keys; expected=3 actual=1")
+}
+
+func TestMatchTree_SearchExplainNoMatch(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString, MatchInteger})
+	report, err := matchTree.SearchExplainNoMatch([]MatchKey{StringKey("a"), IntegerKey(1)})
+	require.NoError(t, err)
+	assert.Equal(t, NoMatchReport{}, report)
+
+	var ids []RuleID
+	for _, rule := range []MatchRule[string]{
+		{Patterns: []MatchPattern{StringsPattern("a", "b"), IntegersPattern(1)}, Value: "rule_1"},
+		{Patterns: []MatchPattern{InverseStringsPattern("a", "c"), IntegersPattern(2)}, Value: "rule_2"},
+		{Patterns: []MatchPattern{StringsPattern("d"), IntegersPattern(3)}, Value: "rule_3"},
+	} {
+		id, err := matchTree.AddRule(rule)
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+
+	report, err = matchTree.SearchExplainNoMatch([]MatchKey{StringKey("a"), IntegerKey(1)})
+	require.NoError(t, err)
+	assert.Equal(t, NoMatchReport{IsMatched: true}, report)
+
+	report, err = matchTree.SearchExplainNoMatch([]MatchKey{StringKey("c"), IntegerKey(1)})
+	require.NoError(t, err)
+	assert.Equal(t, NoMatchReport{
+		Depth:        0,
+		FrontierSize: 1,
+		Children: []MatchPattern{
+			StringsPattern("a"),
+			StringsPattern("b"),
+			StringsPattern("d"),
+			InverseStringsPattern("a", "c"),
+		},
+	}, report)
+
+	// b reaches the children of both the exact b and the inverse child
+	report, err = matchTree.SearchExplainNoMatch([]MatchKey{StringKey("b"), IntegerKey(3)})
+	require.NoError(t, err)
+	assert.Equal(t, NoMatchReport{
+		Depth:        1,
+		FrontierSize: 2,
+		Children:     []MatchPattern{IntegersPattern(1), IntegersPattern(2)},
+	}, report)
+
+	require.NoError(t, matchTree.SetRuleEnabled(ids[2], false))
+	report, err = matchTree.SearchExplainNoMatch([]MatchKey{StringKey("d"), IntegerKey(3)})
+	require.NoError(t, err)
+	assert.Equal(t, NoMatchReport{Depth: 2, FrontierSize: 1}, report)
+
+	_, err = matchTree.SearchExplainNoMatch([]MatchKey{StringKey("d")})
+	assert.Error(t, err)
+}
+
+func TestMatchTree_SearchNearMatches(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString, MatchInteger, MatchString})
+	nearMatches, err := matchTree.SearchNearMatches([]MatchKey{StringKey("a"), IntegerKey(1), StringKey("x")}, 1)
+	require.NoError(t, err)
+	assert.Empty(t, nearMatches)
+
+	var ids []RuleID
+	for _, rule := range []MatchRule[string]{
+		{Patterns: []MatchPattern{StringsPattern("a", "b"), IntegersPattern(1), StringsPattern("x")}, Value: "rule_1"},
+		{Patterns: []MatchPattern{StringsPattern("a"), IntegersPattern(2), AnyPattern(MatchString)}, Value: "rule_2", Priority: 1},
+		{Patterns: []MatchPattern{InverseStringsPattern("a"), IntegersPattern(1), StringsPattern("y")}, Value: "rule_3"},
+		{Patterns: []MatchPattern{StringsPattern("c"), IntegersPattern(3), StringsPattern("z")}, Value: "rule_4", Priority: 2},
+		{Patterns: []MatchPattern{StringsPattern("a"), IntegersPattern(1), InverseStringsPattern("y")}, Value: "rule_5"},
+	} {
+		id, err := matchTree.AddRule(rule)
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+
+	keys := []MatchKey{StringKey("a"), IntegerKey(1), StringKey("x")}
+	nearMatches, err = matchTree.SearchNearMatches(keys, 1)
+	require.NoError(t, err)
+	// rule_1 and rule_5 match all the keys
+	assert.Equal(t, []NearMatch[string]{
+		{Value: "rule_2", Priority: 1, DifferingDimensions: []int{1}},
+	}, nearMatches)
+
+	nearMatches, err = matchTree.SearchNearMatches(keys, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []NearMatch[string]{
+		{Value: "rule_2", Priority: 1, DifferingDimensions: []int{1}},
+		{Value: "rule_3", DifferingDimensions: []int{0, 2}},
+	}, nearMatches)
+
+	nearMatches, err = matchTree.SearchNearMatches(keys, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []NearMatch[string]{
+		{Value: "rule_2", Priority: 1, DifferingDimensions: []int{1}},
+		{Value: "rule_3", DifferingDimensions: []int{0, 2}},
+		{Value: "rule_4", Priority: 2, DifferingDimensions: []int{0, 1, 2}},
+	}, nearMatches)
+
+	// rule_1 is reached through both the children a and b, the latter with fewer differences,
+	// and rule_5 differs in all the keys
+	nearMatches, err = matchTree.SearchNearMatches([]MatchKey{StringKey("b"), IntegerKey(2), StringKey("y")}, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []NearMatch[string]{
+		{Value: "rule_2", Priority: 1, DifferingDimensions: []int{0}},
+		{Value: "rule_3", DifferingDimensions: []int{1}},
+		{Value: "rule_1", DifferingDimensions: []int{1, 2}},
+	}, nearMatches)
+
+	// disabled rules are left out
+	require.NoError(t, matchTree.SetRuleEnabled(ids[1], false))
+	nearMatches, err = matchTree.SearchNearMatches(keys, 1)
+	require.NoError(t, err)
+	assert.Empty(t, nearMatches)
+
+	nearMatches, err = matchTree.SearchNearMatches(keys, 0)
+	require.NoError(t, err)
+	assert.Empty(t, nearMatches)
+	_, err = matchTree.SearchNearMatches(keys, -1)
+	assert.EqualError(t, err, "matchtree: invalid max diff -1")
+	_, err = matchTree.SearchNearMatches(keys[:2], 1)
+	assert.Error(t, err)
+}
@@ -0,0 +1,156 @@
+package matchtree
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// treeFile is the content of a file saved by SaveToFile.
+type treeFile[T any] struct {
+	Types []MatchType    `json:"types" msgpack:"types"`
+	Rules []MatchRule[T] `json:"rules" msgpack:"rules"`
+}
+
+// SaveToFile saves the MatchTree to the file at path, in the format picked by the file extension:
+// JSON for ".json", gob for ".gob" and MessagePack for ".bin". The file holds the MatchTypes and
+// the rules as returned by ToRules, so the values must be encodable in the format; rule IDs are not
+// preserved, and disabled rules are left out, as by ToRules and SaveMmapFile.
+// The file is written atomically, by renaming a temporary file in the same directory, which takes
+// the permissions of the file replaced, if any.
+func (t *MatchTree[T]) SaveToFile(path string) error {
+	encode, err := fileEncoder(path)
+	if err != nil {
+		return err
+	}
+
+	tempFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("matchtree: create temporary file: %w", err)
+	}
+	tempPath := tempFile.Name()
+	if err := writeTreeFile(tempFile, path, encode, treeFile[T]{Types: t.types, Rules: t.ToRules()}); err != nil {
+		_ = os.Remove(tempPath)
+		return err
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("matchtree: rename temporary file: %w", err)
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler for MatchTree, encoding it as SaveToFile does in a JSON
+// file, which LoadFromFile can load: its MatchTypes and the enabled rules returned by ToRules. The rules
+// come in the stable order of ToRules, and the maps of the rules, i.e. labels and enum codes, are
+// encoded with their keys sorted, so that the output of equal trees is equal and diffs cleanly
+// when tracked in version control.
+func (t *MatchTree[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(treeFile[T]{Types: t.types, Rules: t.ToRules()})
+}
+
+// writeTreeFile writes the content to the temporary file to be renamed to the path, with the
+// permissions of the file at the path, if any.
+func writeTreeFile(file *os.File, path string, encode func(io.Writer, any) error, content any) error {
+	if err := encode(file, content); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("matchtree: encode match tree: %w", err)
+	}
+	mode := os.FileMode(0o644)
+	if fileInfo, err := os.Stat(path); err == nil {
+		mode = fileInfo.Mode().Perm()
+	}
+	if err := file.Chmod(mode); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("matchtree: chmod temporary file: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("matchtree: sync temporary file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("matchtree: close temporary file: %w", err)
+	}
+	return nil
+}
+
+// LoadFromFile loads a MatchTree from the file at path saved by SaveToFile, picking the format by
+// the file extension likewise, and creating the tree with the options. To add the rules with
+// AddRuleOptionFuncs instead, create the tree with NewMatchTree and use AddRulesFromFile.
+func LoadFromFile[T any](path string, optionFuncs ...MatchTreeOptionFunc[T]) (*MatchTree[T], error) {
+	content, err := readTreeFile[T](path)
+	if err != nil {
+		return nil, err
+	}
+	t, err := NewMatchTreeChecked(content.Types, optionFuncs...)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.AddRulesStrict(content.Rules); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// AddRulesFromFile adds the rules of the file at path saved by SaveToFile to the MatchTree, like
+// AddRulesStrict with the options. The file must hold the MatchTypes of the tree.
+func (t *MatchTree[T]) AddRulesFromFile(path string, optionFuncs ...AddRuleOptionFunc) error {
+	content, err := readTreeFile[T](path)
+	if err != nil {
+		return err
+	}
+	if !slices.Equal(content.Types, t.types) {
+		return fmt.Errorf("matchtree: unexpected match types; expected=%v actual=%v", t.types, content.Types)
+	}
+	return t.AddRulesStrict(content.Rules, optionFuncs...)
+}
+
+func readTreeFile[T any](path string) (treeFile[T], error) {
+	decode, err := fileDecoder(path)
+	if err != nil {
+		return treeFile[T]{}, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return treeFile[T]{}, fmt.Errorf("matchtree: open file: %w", err)
+	}
+	defer file.Close()
+	var content treeFile[T]
+	if err := decode(file, &content); err != nil {
+		return treeFile[T]{}, fmt.Errorf("matchtree: decode match tree: %w", err)
+	}
+	return content, nil
+}
+
+func fileEncoder(path string) (func(io.Writer, any) error, error) {
+	switch ext := filepath.Ext(path); ext {
+	case ".json":
+		return func(w io.Writer, v any) error { return json.NewEncoder(w).Encode(v) }, nil
+	case ".gob":
+		return func(w io.Writer, v any) error { return gob.NewEncoder(w).Encode(v) }, nil
+	case ".bin":
+		return func(w io.Writer, v any) error { return msgpack.NewEncoder(w).Encode(v) }, nil
+	default:
+		return nil, fmt.Errorf("matchtree: unsupported file extension %q", ext)
+	}
+}
+
+func fileDecoder(path string) (func(io.Reader, any) error, error) {
+	switch ext := filepath.Ext(path); ext {
+	case ".json":
+		return func(r io.Reader, v any) error { return json.NewDecoder(r).Decode(v) }, nil
+	case ".gob":
+		return func(r io.Reader, v any) error { return gob.NewDecoder(r).Decode(v) }, nil
+	case ".bin":
+		return func(r io.Reader, v any) error { return msgpack.NewDecoder(r).Decode(v) }, nil
+	default:
+		return nil, fmt.Errorf("matchtree: unsupported file extension %q", ext)
+	}
+}
@@ -0,0 +1,155 @@
+package matchtree_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/roy2220/matchtree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchTree_SaveToFile(t *testing.T) {
+	types := []MatchType{MatchString, MatchIntegerInterval, MatchNumberInterval, MatchRegexp}
+	matchTree := NewMatchTree[string](types)
+	require.NoError(t, matchTree.AddRules([]MatchRule[string]{
+		{
+			Patterns: []MatchPattern{
+				StringsPattern("a", "b"),
+				IntegerIntervalPattern(IntegerInterval{Min: Int64Ptr(0), Max: Int64Ptr(10), MaxIsExcluded: true}),
+				NumberIntervalPattern(NumberInterval{Max: Float64Ptr(0)}),
+				AnyPattern(MatchRegexp),
+			},
+			Value:    "rule_1",
+			Priority: 1,
+			Labels:   map[string]string{"owner": "tom"},
+		},
+		{
+			Patterns: []MatchPattern{
+				InverseStringsPattern("a"),
+				AnyPattern(MatchIntegerInterval),
+				InverseNumberIntervalPattern(NumberInterval{Min: Float64Ptr(0), MinIsExcluded: true}),
+				RegexpPattern("^x"),
+			},
+			Value: "rule_2",
+		},
+	}))
+	keySets := [][]MatchKey{
+		{StringKey("a"), IntegerIntervalKey(0), NumberKey(0), RegexpKey("x")},
+		{StringKey("b"), IntegerIntervalKey(-1), NumberKey(-1), RegexpKey("y")},
+		{StringKey("c"), IntegerIntervalKey(5), NumberKey(-0.5), RegexpKey("xy")},
+	}
+
+	for _, ext := range []string{".json", ".gob", ".bin"} {
+		path := filepath.Join(t.TempDir(), "tree"+ext)
+		require.NoError(t, matchTree.SaveToFile(path), ext)
+		matchTree2, err := LoadFromFile[string](path)
+		require.NoError(t, err, ext)
+		assert.Equal(t, matchTree.ToRules(), matchTree2.ToRules(), ext)
+		for _, keys := range keySets {
+			values, err := matchTree.Search(keys)
+			require.NoError(t, err)
+			values2, err := matchTree2.Search(keys)
+			require.NoError(t, err)
+			assert.Equal(t, values, values2, "%v %v", ext, keys)
+		}
+
+		entries, err := os.ReadDir(filepath.Dir(path))
+		require.NoError(t, err)
+		assert.Len(t, entries, 1, "no temporary file is left")
+	}
+
+	err := matchTree.SaveToFile(filepath.Join(t.TempDir(), "tree.txt"))
+	assert.EqualError(t, err, `matchtree: unsupported file extension ".txt"`)
+	_, err = LoadFromFile[string](filepath.Join(t.TempDir(), "tree.json"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestMatchTree_SaveToFile_DisabledRulesAndMode(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString})
+	_, err := matchTree.AddRule(MatchRule[string]{Patterns: []MatchPattern{StringsPattern("a")}, Value: "rule_1"})
+	require.NoError(t, err)
+	id, err := matchTree.AddRule(MatchRule[string]{Patterns: []MatchPattern{StringsPattern("a")}, Value: "rule_2"})
+	require.NoError(t, err)
+	require.NoError(t, matchTree.SetRuleEnabled(id, false))
+
+	path := filepath.Join(t.TempDir(), "tree.json")
+	require.NoError(t, os.WriteFile(path, nil, 0o600))
+	require.NoError(t, matchTree.SaveToFile(path))
+	fileInfo, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), fileInfo.Mode().Perm(), "the mode of the file replaced is kept")
+	data, err := json.Marshal(matchTree)
+	require.NoError(t, err)
+	data2, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(data), string(data2))
+
+	matchTree2, err := LoadFromFile(path, WithValueKey(func(value string) string { return "" }))
+	require.NoError(t, err)
+	assert.Equal(t, []MatchRule[string]{{Patterns: []MatchPattern{StringsPattern("a")}, Value: "rule_1"}}, matchTree2.ToRules(), "disabled rules are left out")
+	_, err = matchTree2.AddRule(MatchRule[string]{Patterns: []MatchPattern{AnyPattern(MatchString)}, Value: "rule_3"})
+	require.NoError(t, err)
+	values, err := matchTree2.Search([]MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_1"}, values, "the tree options apply")
+
+	require.NoError(t, matchTree2.AddRulesFromFile(path, WithDedupIdenticalRules()))
+	assert.Equal(t, 3, matchTree2.Stats().ResultCount)
+	values, err = matchTree2.SearchAll([]MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_1", "rule_3"}, values, "the rule options apply")
+	err = NewMatchTree[string]([]MatchType{MatchInteger}).AddRulesFromFile(path)
+	assert.EqualError(t, err, "matchtree: unexpected match types; expected=[INTEGER] actual=[STRING]")
+}
+
+func TestMatchTree_MarshalJSON(t *testing.T) {
+	types := []MatchType{MatchString, MatchIntegerInterval, MatchEnum}
+	codes := map[string]int64{"red": 1, "green": 2, "blue": 3}
+	newMatchTree := func(rules []MatchRule[string]) *MatchTree[string] {
+		matchTree := NewMatchTree[string](types)
+		require.NoError(t, matchTree.AddRules(rules))
+		return matchTree
+	}
+	matchTree := newMatchTree([]MatchRule[string]{
+		{
+			Patterns: []MatchPattern{StringsPattern("b", "a"), IntegerIntervalPattern(FromInterval(10), ToInterval(0)), EnumPattern(codes, "red", "blue")},
+			Value:    "rule_1",
+			Labels:   map[string]string{"owner": "tom", "source": "a.csv"},
+		},
+		{
+			Patterns: []MatchPattern{InverseStringsPattern("c", "a"), AnyPattern(MatchIntegerInterval), AnyPattern(MatchEnum)},
+			Value:    "rule_2",
+			Priority: 1,
+		},
+	})
+	matchTree2 := newMatchTree([]MatchRule[string]{
+		{
+			Patterns: []MatchPattern{StringsPattern("a", "b"), IntegerIntervalPattern(ToInterval(0), FromInterval(10)), EnumPattern(codes, "blue", "red")},
+			Value:    "rule_1",
+			Labels:   map[string]string{"source": "a.csv", "owner": "tom"},
+		},
+		{
+			Patterns: []MatchPattern{InverseStringsPattern("a", "c"), AnyPattern(MatchIntegerInterval), AnyPattern(MatchEnum)},
+			Value:    "rule_2",
+			Priority: 1,
+		},
+	})
+
+	data, err := json.Marshal(matchTree)
+	require.NoError(t, err)
+	data2, err := json.Marshal(matchTree2)
+	require.NoError(t, err)
+	assert.Equal(t, string(data), string(data2))
+	data2, err = json.Marshal(matchTree)
+	require.NoError(t, err)
+	assert.Equal(t, string(data), string(data2))
+
+	path := filepath.Join(t.TempDir(), "tree.json")
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+	matchTree3, err := LoadFromFile[string](path)
+	require.NoError(t, err)
+	assert.Equal(t, matchTree.ToRules(), matchTree3.ToRules())
+}
@@ -0,0 +1,1022 @@
+package matchtree
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// FrozenMatchTree is an immutable snapshot of a MatchTree optimized for searching.
+// It is safe for concurrent use by multiple goroutines and accepts no more rules.
+type FrozenMatchTree[T any] struct {
+	types       []MatchType
+	values      []T
+	valueEqual  func(x, y T) bool
+	valueKey    func(T) string
+	stringForm  *norm.Form
+	root        frozenMatchNode
+	nodeCount   int
+	metrics     MetricsHooks
+	scratchPool sync.Pool
+
+	// maxSearchGoroutines is the number of goroutines a search may split the children of the root
+	// matching the first key across, if at least 2 (see WithParallelSearch).
+	maxSearchGoroutines int
+
+	// mapped is the tree of a FrozenMatchTree from OpenMmap, in place of root.
+	mapped *mappedTree
+}
+
+// FreezeOptionFunc defines a function type for configuring the Freeze operation.
+type FreezeOptionFunc func(freezeOptions) freezeOptions
+
+type freezeOptions struct {
+	ShareSubtrees       bool
+	MaxSearchGoroutines int
+}
+
+// WithSharedSubtrees configures the Freeze operation to merge the structurally identical subtrees
+// of the MatchTree, i.e. the ones with the same conditions leading to the same results, into
+// shared nodes, turning the FrozenMatchTree into a DAG.
+// A rule with several multi-value patterns is expanded into a cartesian product of paths, most of
+// whose suffixes are identical, so the FrozenMatchTree of such rules takes far fewer nodes.
+// Nodes of custom match types are not shared, since their conditions are opaque.
+func WithSharedSubtrees() FreezeOptionFunc {
+	return func(o freezeOptions) freezeOptions {
+		o.ShareSubtrees = true
+		return o
+	}
+}
+
+// WithParallelSearch configures the Freeze operation to have each search of the FrozenMatchTree
+// split the children of the root matching the first key into runs across up to maxGoroutines
+// goroutines, each expanding its run with the rest of the keys, for trees whose first dimension
+// fans out widely, e.g. to interval or inverse children matching a key in large numbers. The leaf
+// nodes reached are merged in the same order as by a search on a single goroutine, so the values
+// are sorted and deduplicated alike. A search with fewer than 2 such children, or of a tree of a
+// single type, stays on the calling goroutine. Searches split across goroutines allocate.
+func WithParallelSearch(maxGoroutines int) FreezeOptionFunc {
+	return func(o freezeOptions) freezeOptions {
+		o.MaxSearchGoroutines = maxGoroutines
+		return o
+	}
+}
+
+func makeFreezeOptions(optionFuncs []FreezeOptionFunc) freezeOptions {
+	options := freezeOptions{
+		ShareSubtrees:       false,
+		MaxSearchGoroutines: 0,
+	}
+	for _, optionFunc := range optionFuncs {
+		options = optionFunc(options)
+	}
+	return options
+}
+
+// Freeze converts the MatchTree into an immutable FrozenMatchTree.
+// The MatchTree remains usable afterwards, and rules added to it later are not
+// reflected in the FrozenMatchTree.
+func (t *MatchTree[T]) Freeze(optionFuncs ...FreezeOptionFunc) *FrozenMatchTree[T] {
+	options := makeFreezeOptions(optionFuncs)
+	frozenTree := &FrozenMatchTree[T]{
+		types:      slices.Clone(t.types),
+		values:     slices.Clone(t.values),
+		valueEqual: t.valueEqual,
+		valueKey:   t.valueKey,
+		stringForm: t.stringForm,
+		metrics:    t.metrics,
+
+		maxSearchGoroutines: options.MaxSearchGoroutines,
+	}
+	if t.root != nil {
+		f := matchNodeFreezer{leafDepth: len(t.types)}
+		if options.ShareSubtrees {
+			f.nodeClasses = make(map[matchNode]int)
+			f.classes = make(map[string]int)
+			f.frozenNodes = make(map[int]frozenMatchNode)
+		}
+		frozenTree.root = f.freezeMatchNode(t.root)
+		frozenTree.nodeCount = f.nodeCount
+	}
+	frozenTree.scratchPool.New = func() any { return new(searchScratch) }
+	return frozenTree
+}
+
+// NodeCount returns the number of nodes of the FrozenMatchTree, including leaves, in which a node
+// shared by several parents (see WithSharedSubtrees) is counted once.
+func (t *FrozenMatchTree[T]) NodeCount() int { return t.nodeCount }
+
+type searchScratch struct {
+	Nodes       []frozenMatchNode
+	NextNodes   []frozenMatchNode
+	ResultLists [][]matchResult
+	Results     []matchResult
+
+	// for searching a tree from OpenMmap
+	Offsets        []uint64
+	NextOffsets    []uint64
+	LeafResults    []matchResult
+	ResultListEnds []int
+}
+
+// Search traverses the FrozenMatchTree with the given keys and returns a slice of matching values.
+// The returned values are sorted by priority (descending) and then by their insertion order.
+// It returns an error if the keys do not match the tree's defined types.
+// Apart from the returned slice, Search does not allocate, unless the CustomMatchNodes of a custom
+// match type allocate when finding children.
+func (t *FrozenMatchTree[T]) Search(keys []MatchKey) ([]T, error) {
+	onSearch := t.metrics.OnSearch
+	if onSearch == nil {
+		values, _, err := t.search(keys)
+		return values, err
+	}
+	start := time.Now()
+	values, resultCount, err := t.search(keys)
+	if err != nil {
+		return nil, err
+	}
+	onSearch(len(keys), resultCount, time.Since(start))
+	return values, nil
+}
+
+// SearchMulti searches the FrozenMatchTree with each of the key sets, e.g. of a batch of lookups,
+// and returns the values for each key set like Search, in the order of the key sets. The key sets
+// are all checked before any search. If parallelism is greater than 1, the key sets are split into
+// as many runs of consecutive ones, searched by as many goroutines. It returns an error if any key
+// set does not match the tree's defined types, wrapped with the position of the key set.
+func (t *FrozenMatchTree[T]) SearchMulti(keySets [][]MatchKey, parallelism int) ([][]T, error) {
+	for i, keys := range keySets {
+		if err := checkKeys(t.types, keys); err != nil {
+			return nil, wrapError(err, "key set #%d", i+1)
+		}
+	}
+
+	valueLists := make([][]T, len(keySets))
+	searchRun := func(i, j int) error {
+		for ; i < j; i++ {
+			values, err := t.Search(keySets[i])
+			if err != nil {
+				return wrapError(err, "key set #%d", i+1)
+			}
+			valueLists[i] = values
+		}
+		return nil
+	}
+	parallelism = min(parallelism, len(keySets))
+	if parallelism <= 1 {
+		if err := searchRun(0, len(keySets)); err != nil {
+			return nil, err
+		}
+		return valueLists, nil
+	}
+
+	errs := make([]error, parallelism)
+	var wg sync.WaitGroup
+	for k := range parallelism {
+		i, j := k*len(keySets)/parallelism, (k+1)*len(keySets)/parallelism
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[k] = searchRun(i, j)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return valueLists, nil
+}
+
+// search is Search returning the number of results found as well, without reporting the search.
+func (t *FrozenMatchTree[T]) search(keys []MatchKey) ([]T, int, error) {
+	if err := checkKeys(t.types, keys); err != nil {
+		return nil, 0, err
+	}
+	if t.mapped != nil {
+		return t.searchMapped(keys)
+	}
+	if t.root == nil {
+		return nil, 0, nil
+	}
+
+	scratch := t.scratchPool.Get().(*searchScratch)
+	defer t.scratchPool.Put(scratch)
+
+	keys = normalizeKeys(keys, t.stringForm)
+	nodes := append(scratch.Nodes[:0], t.root)
+	nextNodes := scratch.NextNodes[:0]
+	for i, key := range keys {
+		if i == 1 && t.maxSearchGoroutines >= 2 && len(nodes) >= 2 {
+			nodes, nextNodes = t.expandNodesInParallel(nextNodes, nodes, keys[1:]), nodes[:0]
+			break
+		}
+		for _, node := range nodes {
+			// non-leaf
+			nextNodes = node.FindChildren(nextNodes, key)
+		}
+		nodes, nextNodes = nextNodes, nodes[:0]
+	}
+	scratch.Nodes, scratch.NextNodes = nodes, nextNodes
+	if len(nodes) == 0 {
+		return nil, 0, nil
+	}
+
+	for _, node := range nodes {
+		if err := checkFrozenLeaf(node); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	resultLists := scratch.ResultLists[:0]
+	for _, node := range nodes {
+		resultLists = append(resultLists, node.GetResults())
+	}
+	results := mergeResults(scratch.Results[:0], resultLists, defaultSearchOptions)
+	clear(resultLists)
+	scratch.ResultLists, scratch.Results = resultLists, results
+	if len(results) == 0 {
+		return nil, 0, nil
+	}
+
+	values := make([]T, len(results))
+	for i, result := range results {
+		values[i] = t.values[result.ValueIndex]
+	}
+	values = dedupValuesWith(values, t.valueEqual, t.valueKey)
+	return values, len(results), nil
+}
+
+// checkFrozenLeaf is like checkLeaf, for the node of a FrozenMatchTree.
+func checkFrozenLeaf(node frozenMatchNode) error {
+	if _, ok := node.(*frozenMatchNodeOfNone); !ok {
+		return fmt.Errorf("%w; node=%T", ErrMisalignedTree, node)
+	}
+	return nil
+}
+
+// expandNodesInParallel expands the nodes with the keys on up to maxSearchGoroutines goroutines,
+// each taking a run of consecutive nodes, and appends the leaf nodes reached to leaves in the
+// same order as the nodes.
+func (t *FrozenMatchTree[T]) expandNodesInParallel(leaves, nodes []frozenMatchNode, keys []MatchKey) []frozenMatchNode {
+	n := min(t.maxSearchGoroutines, len(nodes))
+	leafLists := make([][]frozenMatchNode, n)
+	var wg sync.WaitGroup
+	for k := range n {
+		// the runs are copied, since expanding them reuses their backing arrays
+		run := slices.Clone(nodes[k*len(nodes)/n : (k+1)*len(nodes)/n])
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var nextRun []frozenMatchNode
+			for _, key := range keys {
+				for _, node := range run {
+					// non-leaf
+					nextRun = node.FindChildren(nextRun, key)
+				}
+				run, nextRun = nextRun, run[:0]
+			}
+			leafLists[k] = run
+		}()
+	}
+	wg.Wait()
+	for _, leafList := range leafLists {
+		leaves = append(leaves, leafList...)
+	}
+	return leaves
+}
+
+// frozenMatchNode is an interface that defines the behavior of nodes within the FrozenMatchTree.
+type frozenMatchNode interface {
+	// FindChildren appends child nodes that match the given key to children,
+	// in the same order as matchNode.FindChildren does.
+	FindChildren(children []frozenMatchNode, key MatchKey) []frozenMatchNode
+
+	// GetResults returns the match results associated with a leaf node,
+	// sorted by priority (descending) and then by value index.
+	GetResults() []matchResult
+}
+
+// matchNodeFreezer converts the nodes of a MatchTree into frozen ones, sharing the frozen nodes
+// of the nodes in the same class of structurally identical ones if the classes are tracked.
+type matchNodeFreezer struct {
+	nodeClasses map[matchNode]int
+	classes     map[string]int
+	frozenNodes map[int]frozenMatchNode
+	nodeCount   int
+	leafDepth   int
+	depth       int // the depth of the node being frozen plus 1, or 0 if none
+}
+
+func (f *matchNodeFreezer) freezeMatchNode(node matchNode) frozenMatchNode {
+	f.depth++
+	frozenNode := f.doFreezeMatchNode(node)
+	f.depth--
+	return frozenNode
+}
+
+func (f *matchNodeFreezer) doFreezeMatchNode(node matchNode) frozenMatchNode {
+	if f.nodeClasses == nil {
+		f.nodeCount++
+		return f.freezeNewMatchNode(node)
+	}
+	class := f.getNodeClass(node)
+	if frozenNode, ok := f.frozenNodes[class]; ok {
+		return frozenNode
+	}
+	f.nodeCount++
+	frozenNode := f.freezeNewMatchNode(node)
+	f.frozenNodes[class] = frozenNode
+	return frozenNode
+}
+
+// getNodeClass returns the class of the node, identified by the conditions through which its
+// children are reached and the classes of the children, or by the results for a leaf node.
+func (f *matchNodeFreezer) getNodeClass(node matchNode) int {
+	if class, ok := f.nodeClasses[node]; ok {
+		return class
+	}
+
+	var key string
+	switch node := node.(type) {
+	case *matchNodeOfNone:
+		key = fmt.Sprintf("%T%v", node, node.results)
+	case *customMatchNode:
+		// never shared
+		key = fmt.Sprintf("%T%p", node, node)
+	default:
+		var edges []string
+		for pattern, child := range node.Edges() {
+			edges = append(edges, edgeLabel(&pattern)+"->"+strconv.Itoa(f.getNodeClass(child)))
+		}
+		slices.Sort(edges)
+		key = fmt.Sprintf("%T%q", node, edges)
+	}
+	class, ok := f.classes[key]
+	if !ok {
+		class = len(f.classes)
+		f.classes[key] = class
+	}
+	f.nodeClasses[node] = class
+	return class
+}
+
+func (f *matchNodeFreezer) freezeNewMatchNode(node matchNode) frozenMatchNode {
+	switch node := node.(type) {
+	case *matchNodeOfNone:
+		return f.freezeMatchNodeOfNone(node)
+	case *matchNodeOfString:
+		return f.freezeMatchNodeOfString(node)
+	case *matchNodeOfInteger:
+		return f.freezeMatchNodeOfInteger(node)
+	case *matchNodeOfIntegerInterval:
+		return f.freezeMatchNodeOfIntegerInterval(node)
+	case *matchNodeOfNumberInterval:
+		return f.freezeMatchNodeOfNumberInterval(node)
+	case *matchNodeOfBytes:
+		return &frozenMatchNodeOfBytes{f.freezeMatchNodeOfString(&node.matchNodeOfString)}
+	case *matchNodeOfEnum:
+		return f.freezeMatchNodeOfInteger(&node.matchNodeOfInteger)
+	case *matchNodeOfRegexp:
+		return f.freezeMatchNodeOfRegexp(node)
+	case *matchNodeOfSemverRange:
+		return f.freezeMatchNodeOfSemverRange(node)
+	case *matchNodeOfGlob:
+		return f.freezeMatchNodeOfGlob(node)
+	case *matchNodeOfNumeric:
+		return f.freezeMatchNodeOfNumeric(node)
+	case *customMatchNode:
+		return f.freezeCustomMatchNode(node)
+	default:
+		panic("unreachable")
+	}
+}
+
+func (f *matchNodeFreezer) freezeOptionalMatchNode(node matchNode) frozenMatchNode {
+	if node == nil {
+		return nil
+	}
+	return f.freezeMatchNode(node)
+}
+
+func (f *matchNodeFreezer) freezeInverseChildren(inverseChildren []matchNodeWithRefCount) []frozenMatchNode {
+	frozenInverseChildren := make([]frozenMatchNode, len(inverseChildren))
+	for i, child := range inverseChildren {
+		frozenInverseChildren[i] = f.freezeMatchNode(child.MatchNode)
+	}
+	return frozenInverseChildren
+}
+
+// appendFrozenInverseChildrenOfValues appends the inverse children excluding none of the values.
+func appendFrozenInverseChildrenOfValues[K cmp.Ordered](children []frozenMatchNode, inverseChildren []frozenMatchNode, inverseChildKeys []K, excludedChildIndexSets []bitset, values []K) []frozenMatchNode {
+	excludedChildIndexes := getBitset(len(inverseChildren))
+	for _, v := range values {
+		if i, ok := slices.BinarySearch(inverseChildKeys, v); ok {
+			excludedChildIndexes.AddAll(excludedChildIndexSets[i])
+		}
+	}
+	children = appendFrozenInverseChildren(children, inverseChildren, *excludedChildIndexes)
+	putBitset(excludedChildIndexes)
+	return children
+}
+
+// appendFrozenInverseChildren appends the inverse children whose indexes are not in
+// excludedChildIndexes.
+func appendFrozenInverseChildren(children []frozenMatchNode, inverseChildren []frozenMatchNode, excludedChildIndexes bitset) []frozenMatchNode {
+	for childIndex := range excludedChildIndexes.Missing(len(inverseChildren)) {
+		children = append(children, inverseChildren[childIndex])
+	}
+	return children
+}
+
+// makeExcludedChildIndexSets returns the sets of the indexes of the inverse children excluding
+// each of the keys, in the order of the keys.
+func makeExcludedChildIndexSets[K comparable](keys []K, inverseChildIndexes map[K][]int, numberOfInverseChildren int) []bitset {
+	excludedChildIndexSets := make([]bitset, len(keys))
+	for i, k := range keys {
+		excludedChildIndexes := newBitset(numberOfInverseChildren)
+		for _, childIndex := range inverseChildIndexes[k] {
+			excludedChildIndexes.Add(childIndex)
+		}
+		excludedChildIndexSets[i] = excludedChildIndexes
+	}
+	return excludedChildIndexSets
+}
+
+// ----- dummy frozen match node -----
+
+type dummyFrozenMatchNode struct{}
+
+var _ frozenMatchNode = (*dummyFrozenMatchNode)(nil)
+
+func (n dummyFrozenMatchNode) FindChildren(children []frozenMatchNode, key MatchKey) []frozenMatchNode {
+	panic("unreachable")
+}
+func (n dummyFrozenMatchNode) GetResults() []matchResult { panic("unreachable") }
+
+// ----- frozen match node of none -----
+
+type frozenMatchNodeOfNone struct {
+	dummyFrozenMatchNode
+
+	results []matchResult
+}
+
+var _ frozenMatchNode = (*frozenMatchNodeOfNone)(nil)
+
+func (f *matchNodeFreezer) freezeMatchNodeOfNone(node *matchNodeOfNone) *frozenMatchNodeOfNone {
+	return &frozenMatchNodeOfNone{
+		results: slices.DeleteFunc(slices.Clone(node.results), func(result matchResult) bool { return !result.isEnabled() }),
+	}
+}
+
+func (n *frozenMatchNodeOfNone) GetResults() []matchResult { return n.results }
+
+// ----- frozen match node of bytes -----
+
+type frozenMatchNodeOfBytes struct {
+	*frozenMatchNodeOfString
+}
+
+func (n *frozenMatchNodeOfBytes) FindChildren(children []frozenMatchNode, key MatchKey) []frozenMatchNode {
+	key.String = bytesToString(key.Bytes)
+	return n.frozenMatchNodeOfString.FindChildren(children, key)
+}
+
+// ----- frozen match node of string -----
+
+type frozenMatchNodeOfString struct {
+	dummyFrozenMatchNode
+
+	childKeys        []string
+	children         []frozenMatchNode
+	inverseChildren  []frozenMatchNode
+	inverseChildKeys []string
+	// the sets of the indexes of the inverse children excluding each key, taking a bit per
+	// inverse child for each key, so that the inverse children of a key are found by bitset
+	// operations
+	excludedChildIndexSets []bitset
+	anyChild               frozenMatchNode
+}
+
+var _ frozenMatchNode = (*frozenMatchNodeOfString)(nil)
+
+func (f *matchNodeFreezer) freezeMatchNodeOfString(node *matchNodeOfString) *frozenMatchNodeOfString {
+	frozenNode := &frozenMatchNodeOfString{
+		inverseChildren: f.freezeInverseChildren(node.inverseChildren),
+		anyChild:        f.freezeOptionalMatchNode(node.anyChild),
+	}
+	frozenNode.childKeys = sortedKeys(node.children)
+	frozenNode.children = make([]frozenMatchNode, len(frozenNode.childKeys))
+	for i, k := range frozenNode.childKeys {
+		frozenNode.children[i] = f.freezeMatchNode(node.children[k])
+	}
+	frozenNode.inverseChildKeys = sortedKeys(node.inverseChildIndexes)
+	frozenNode.excludedChildIndexSets = makeExcludedChildIndexSets(frozenNode.inverseChildKeys, node.inverseChildIndexes, len(node.inverseChildren))
+	return frozenNode
+}
+
+func (n *frozenMatchNodeOfString) FindChildren(children []frozenMatchNode, key MatchKey) []frozenMatchNode {
+	if key.IsAbsent {
+		return appendAnyChild(children, n.anyChild)
+	}
+
+	if len(key.Strings) >= 1 {
+		return n.findChildrenOfStrings(children, key.Strings)
+	}
+
+	if i, ok := slices.BinarySearch(n.childKeys, key.String); ok {
+		children = append(children, n.children[i])
+	}
+
+	if len(n.inverseChildren) >= 1 {
+		var excludedChildIndexes bitset
+		if i, ok := slices.BinarySearch(n.inverseChildKeys, key.String); ok {
+			excludedChildIndexes = n.excludedChildIndexSets[i]
+		}
+		children = appendFrozenInverseChildren(children, n.inverseChildren, excludedChildIndexes)
+	}
+
+	if child := n.anyChild; child != nil {
+		children = append(children, child)
+	}
+	return children
+}
+
+func (n *frozenMatchNodeOfString) findChildrenOfStrings(children []frozenMatchNode, keyStrings []string) []frozenMatchNode {
+	for i, v := range keyStrings {
+		if slices.Contains(keyStrings[:i], v) {
+			continue
+		}
+		if j, ok := slices.BinarySearch(n.childKeys, v); ok {
+			children = append(children, n.children[j])
+		}
+	}
+
+	if len(n.inverseChildren) >= 1 {
+		children = appendFrozenInverseChildrenOfValues(children, n.inverseChildren, n.inverseChildKeys, n.excludedChildIndexSets, keyStrings)
+	}
+
+	if child := n.anyChild; child != nil {
+		children = append(children, child)
+	}
+	return children
+}
+
+// ----- frozen match node of integer -----
+
+type frozenMatchNodeOfInteger struct {
+	dummyFrozenMatchNode
+
+	childKeys        []int64
+	children         []frozenMatchNode
+	inverseChildren  []frozenMatchNode
+	inverseChildKeys []int64
+	// the sets of the indexes of the inverse children excluding each key, taking a bit per
+	// inverse child for each key, so that the inverse children of a key are found by bitset
+	// operations
+	excludedChildIndexSets []bitset
+	anyChild               frozenMatchNode
+}
+
+var _ frozenMatchNode = (*frozenMatchNodeOfInteger)(nil)
+
+func (f *matchNodeFreezer) freezeMatchNodeOfInteger(node *matchNodeOfInteger) *frozenMatchNodeOfInteger {
+	frozenNode := &frozenMatchNodeOfInteger{
+		inverseChildren: f.freezeInverseChildren(node.inverseChildren),
+		anyChild:        f.freezeOptionalMatchNode(node.anyChild),
+	}
+	frozenNode.childKeys = sortedKeys(node.children)
+	frozenNode.children = make([]frozenMatchNode, len(frozenNode.childKeys))
+	for i, k := range frozenNode.childKeys {
+		frozenNode.children[i] = f.freezeMatchNode(node.children[k])
+	}
+	frozenNode.inverseChildKeys = sortedKeys(node.inverseChildIndexes)
+	frozenNode.excludedChildIndexSets = makeExcludedChildIndexSets(frozenNode.inverseChildKeys, node.inverseChildIndexes, len(node.inverseChildren))
+	return frozenNode
+}
+
+func (n *frozenMatchNodeOfInteger) FindChildren(children []frozenMatchNode, key MatchKey) []frozenMatchNode {
+	if key.IsAbsent {
+		return appendAnyChild(children, n.anyChild)
+	}
+
+	if len(key.Integers) >= 1 {
+		return n.findChildrenOfIntegers(children, key.Integers)
+	}
+
+	if key.IntegerRange != nil {
+		return n.findChildrenOfRange(children, *key.IntegerRange)
+	}
+
+	if i, ok := slices.BinarySearch(n.childKeys, key.Integer); ok {
+		children = append(children, n.children[i])
+	}
+
+	if len(n.inverseChildren) >= 1 {
+		var excludedChildIndexes bitset
+		if i, ok := slices.BinarySearch(n.inverseChildKeys, key.Integer); ok {
+			excludedChildIndexes = n.excludedChildIndexSets[i]
+		}
+		children = appendFrozenInverseChildren(children, n.inverseChildren, excludedChildIndexes)
+	}
+
+	if child := n.anyChild; child != nil {
+		children = append(children, child)
+	}
+	return children
+}
+
+func (n *frozenMatchNodeOfInteger) findChildrenOfIntegers(children []frozenMatchNode, keyIntegers []int64) []frozenMatchNode {
+	for i, v := range keyIntegers {
+		if slices.Contains(keyIntegers[:i], v) {
+			continue
+		}
+		if j, ok := slices.BinarySearch(n.childKeys, v); ok {
+			children = append(children, n.children[j])
+		}
+	}
+
+	if len(n.inverseChildren) >= 1 {
+		children = appendFrozenInverseChildrenOfValues(children, n.inverseChildren, n.inverseChildKeys, n.excludedChildIndexSets, keyIntegers)
+	}
+
+	if child := n.anyChild; child != nil {
+		children = append(children, child)
+	}
+	return children
+}
+
+func (n *frozenMatchNodeOfInteger) findChildrenOfRange(children []frozenMatchNode, keyRange IntegerInterval) []frozenMatchNode {
+	if lowerBound, upperBound, ok := integerIntervalBounds(keyRange); ok {
+		i, _ := slices.BinarySearch(n.childKeys, lowerBound)
+		for ; i < len(n.childKeys) && n.childKeys[i] <= upperBound; i++ {
+			children = append(children, n.children[i])
+		}
+
+		if len(n.inverseChildren) >= 1 {
+			i, _ := slices.BinarySearch(n.inverseChildKeys, lowerBound)
+			j := i
+			for j < len(n.inverseChildKeys) && n.inverseChildKeys[j] <= upperBound {
+				j++
+			}
+			excludedChildIndexes := getBitset(len(n.inverseChildren))
+			for _, excludedChildIndexSet := range n.excludedChildIndexSets[i:j] {
+				excludedChildIndexes.AddAll(excludedChildIndexSet)
+			}
+			children = appendFrozenInverseChildren(children, n.inverseChildren, *excludedChildIndexes)
+			putBitset(excludedChildIndexes)
+		}
+	}
+
+	if child := n.anyChild; child != nil {
+		children = append(children, child)
+	}
+	return children
+}
+
+// ----- frozen match node of integer interval -----
+
+type frozenMatchNodeOfIntegerInterval struct {
+	dummyFrozenMatchNode
+
+	childTree       integerIntervalTree[frozenMatchNode]
+	inverseChildren []integerIntervalsAndFrozenMatchNode
+	anyChild        frozenMatchNode
+}
+
+var _ frozenMatchNode = (*frozenMatchNodeOfIntegerInterval)(nil)
+
+type integerIntervalsAndFrozenMatchNode struct {
+	IntegerIntervals []IntegerInterval
+	MatchNode        frozenMatchNode
+}
+
+func (f *matchNodeFreezer) freezeMatchNodeOfIntegerInterval(node *matchNodeOfIntegerInterval) *frozenMatchNodeOfIntegerInterval {
+	frozenNode := &frozenMatchNodeOfIntegerInterval{
+		inverseChildren: make([]integerIntervalsAndFrozenMatchNode, len(node.inverseChildren)),
+		anyChild:        f.freezeOptionalMatchNode(node.anyChild),
+	}
+	for _, child := range node.children {
+		frozenNode.childTree.Insert(child.IntegerInterval, f.freezeMatchNode(child.MatchNode))
+	}
+	frozenNode.childTree.Build()
+	for i, child := range node.inverseChildren {
+		frozenNode.inverseChildren[i].MatchNode = f.freezeMatchNode(child.MatchNode)
+	}
+	for _, v := range node.inverseChildIndexes {
+		for _, childIndex := range v.MatchNodeIndexes {
+			inverseChild := &frozenNode.inverseChildren[childIndex]
+			inverseChild.IntegerIntervals = append(inverseChild.IntegerIntervals, v.IntegerInterval)
+		}
+	}
+	return frozenNode
+}
+
+func (n *frozenMatchNodeOfIntegerInterval) FindChildren(children []frozenMatchNode, key MatchKey) []frozenMatchNode {
+	if key.IsAbsent {
+		return appendAnyChild(children, n.anyChild)
+	}
+
+	n.childTree.Search(key.Integer, func(child frozenMatchNode) bool {
+		children = append(children, child)
+		return true
+	})
+
+	for i := range n.inverseChildren {
+		if !slices.ContainsFunc(n.inverseChildren[i].IntegerIntervals, func(x IntegerInterval) bool {
+			return x.Contains(key.Integer)
+		}) {
+			children = append(children, n.inverseChildren[i].MatchNode)
+		}
+	}
+
+	if child := n.anyChild; child != nil {
+		children = append(children, child)
+	}
+	return children
+}
+
+// ----- frozen match node of numeric -----
+
+type frozenMatchNodeOfNumeric struct {
+	*frozenMatchNodeOfIntegerInterval
+
+	integerChildKeys []int64
+	integerChildren  []frozenMatchNode
+}
+
+var _ frozenMatchNode = (*frozenMatchNodeOfNumeric)(nil)
+
+func (f *matchNodeFreezer) freezeMatchNodeOfNumeric(node *matchNodeOfNumeric) *frozenMatchNodeOfNumeric {
+	frozenNode := &frozenMatchNodeOfNumeric{
+		frozenMatchNodeOfIntegerInterval: f.freezeMatchNodeOfIntegerInterval(&node.matchNodeOfIntegerInterval),
+	}
+	frozenNode.integerChildKeys = sortedKeys(node.integerChildren)
+	frozenNode.integerChildren = make([]frozenMatchNode, len(frozenNode.integerChildKeys))
+	for i, k := range frozenNode.integerChildKeys {
+		frozenNode.integerChildren[i] = f.freezeMatchNode(node.integerChildren[k])
+	}
+	return frozenNode
+}
+
+func (n *frozenMatchNodeOfNumeric) FindChildren(children []frozenMatchNode, key MatchKey) []frozenMatchNode {
+	if !key.IsAbsent {
+		if i, ok := slices.BinarySearch(n.integerChildKeys, key.Integer); ok {
+			children = append(children, n.integerChildren[i])
+		}
+	}
+	return n.frozenMatchNodeOfIntegerInterval.FindChildren(children, key)
+}
+
+// ----- frozen match node of number interval -----
+
+type frozenMatchNodeOfNumberInterval struct {
+	dummyFrozenMatchNode
+
+	childTree       numberIntervalTree[frozenMatchNode]
+	inverseChildren []numberIntervalsAndFrozenMatchNode
+	anyChild        frozenMatchNode
+}
+
+var _ frozenMatchNode = (*frozenMatchNodeOfNumberInterval)(nil)
+
+type numberIntervalsAndFrozenMatchNode struct {
+	NumberIntervals []NumberInterval
+	MatchNode       frozenMatchNode
+}
+
+func (f *matchNodeFreezer) freezeMatchNodeOfNumberInterval(node *matchNodeOfNumberInterval) *frozenMatchNodeOfNumberInterval {
+	frozenNode := &frozenMatchNodeOfNumberInterval{
+		inverseChildren: make([]numberIntervalsAndFrozenMatchNode, len(node.inverseChildren)),
+		anyChild:        f.freezeOptionalMatchNode(node.anyChild),
+	}
+	for _, child := range node.children {
+		frozenNode.childTree.Insert(child.NumberInterval, f.freezeMatchNode(child.MatchNode))
+	}
+	frozenNode.childTree.Build()
+	for i, child := range node.inverseChildren {
+		frozenNode.inverseChildren[i].MatchNode = f.freezeMatchNode(child.MatchNode)
+	}
+	for _, v := range node.inverseChildIndexes {
+		for _, childIndex := range v.MatchNodeIndexes {
+			inverseChild := &frozenNode.inverseChildren[childIndex]
+			inverseChild.NumberIntervals = append(inverseChild.NumberIntervals, v.NumberInterval)
+		}
+	}
+	return frozenNode
+}
+
+func (n *frozenMatchNodeOfNumberInterval) FindChildren(children []frozenMatchNode, key MatchKey) []frozenMatchNode {
+	if key.IsAbsent {
+		return appendAnyChild(children, n.anyChild)
+	}
+
+	n.childTree.Search(key.Number, func(child frozenMatchNode) bool {
+		children = append(children, child)
+		return true
+	})
+
+	for i := range n.inverseChildren {
+		if !slices.ContainsFunc(n.inverseChildren[i].NumberIntervals, func(x NumberInterval) bool {
+			return x.Contains(key.Number)
+		}) {
+			children = append(children, n.inverseChildren[i].MatchNode)
+		}
+	}
+
+	if child := n.anyChild; child != nil {
+		children = append(children, child)
+	}
+	return children
+}
+
+// ----- frozen match node of regexp -----
+
+type frozenMatchNodeOfRegexp struct {
+	dummyFrozenMatchNode
+
+	children        []regexpAndFrozenMatchNode
+	inverseChildren []regexpAndFrozenMatchNode
+	anyChild        frozenMatchNode
+}
+
+var _ frozenMatchNode = (*frozenMatchNodeOfRegexp)(nil)
+
+type regexpAndFrozenMatchNode struct {
+	Regexp    *regexp.Regexp
+	MatchNode frozenMatchNode
+}
+
+func (f *matchNodeFreezer) freezeMatchNodeOfRegexp(node *matchNodeOfRegexp) *frozenMatchNodeOfRegexp {
+	frozenNode := &frozenMatchNodeOfRegexp{
+		children:        make([]regexpAndFrozenMatchNode, len(node.children)),
+		inverseChildren: make([]regexpAndFrozenMatchNode, len(node.inverseChildren)),
+		anyChild:        f.freezeOptionalMatchNode(node.anyChild),
+	}
+	for i, child := range node.children {
+		frozenNode.children[i] = regexpAndFrozenMatchNode{
+			Regexp:    child.Regexp,
+			MatchNode: f.freezeMatchNode(child.MatchNode),
+		}
+	}
+	for i, child := range node.inverseChildren {
+		frozenNode.inverseChildren[i] = regexpAndFrozenMatchNode{
+			Regexp:    child.Regexp,
+			MatchNode: f.freezeMatchNode(child.MatchNode),
+		}
+	}
+	return frozenNode
+}
+
+func (n *frozenMatchNodeOfRegexp) FindChildren(children []frozenMatchNode, key MatchKey) []frozenMatchNode {
+	if key.IsAbsent {
+		return appendAnyChild(children, n.anyChild)
+	}
+
+	for _, child := range n.children {
+		if child.Regexp.MatchString(key.String) {
+			children = append(children, child.MatchNode)
+		}
+	}
+
+	for _, child := range n.inverseChildren {
+		if !child.Regexp.MatchString(key.String) {
+			children = append(children, child.MatchNode)
+		}
+	}
+
+	if child := n.anyChild; child != nil {
+		children = append(children, child)
+	}
+	return children
+}
+
+// ----- frozen match node of semver range -----
+
+type frozenMatchNodeOfSemverRange struct {
+	dummyFrozenMatchNode
+
+	children        []versionRangesAndFrozenMatchNode
+	inverseChildren []versionRangesAndFrozenMatchNode
+	anyChild        frozenMatchNode
+}
+
+var _ frozenMatchNode = (*frozenMatchNodeOfSemverRange)(nil)
+
+type versionRangesAndFrozenMatchNode struct {
+	VersionRanges []VersionRange
+	MatchNode     frozenMatchNode
+}
+
+func (f *matchNodeFreezer) freezeMatchNodeOfSemverRange(node *matchNodeOfSemverRange) *frozenMatchNodeOfSemverRange {
+	frozenNode := &frozenMatchNodeOfSemverRange{
+		children:        make([]versionRangesAndFrozenMatchNode, len(node.children)),
+		inverseChildren: make([]versionRangesAndFrozenMatchNode, len(node.inverseChildren)),
+		anyChild:        f.freezeOptionalMatchNode(node.anyChild),
+	}
+	for i, child := range node.children {
+		frozenNode.children[i] = versionRangesAndFrozenMatchNode{
+			VersionRanges: child.VersionRanges,
+			MatchNode:     f.freezeMatchNode(child.MatchNode),
+		}
+	}
+	for i, child := range node.inverseChildren {
+		frozenNode.inverseChildren[i] = versionRangesAndFrozenMatchNode{
+			VersionRanges: child.VersionRanges,
+			MatchNode:     f.freezeMatchNode(child.MatchNode),
+		}
+	}
+	return frozenNode
+}
+
+func (n *frozenMatchNodeOfSemverRange) FindChildren(children []frozenMatchNode, key MatchKey) []frozenMatchNode {
+	if key.IsAbsent {
+		return appendAnyChild(children, n.anyChild)
+	}
+
+	for _, child := range n.children {
+		if containsVersion(child.VersionRanges, key.Version) {
+			children = append(children, child.MatchNode)
+		}
+	}
+
+	for _, child := range n.inverseChildren {
+		if !containsVersion(child.VersionRanges, key.Version) {
+			children = append(children, child.MatchNode)
+		}
+	}
+
+	if child := n.anyChild; child != nil {
+		children = append(children, child)
+	}
+	return children
+}
+
+// ----- frozen match node of glob -----
+
+type frozenMatchNodeOfGlob struct {
+	dummyFrozenMatchNode
+
+	children        []globAndFrozenMatchNode
+	inverseChildren []globAndFrozenMatchNode
+	anyChild        frozenMatchNode
+}
+
+var _ frozenMatchNode = (*frozenMatchNodeOfGlob)(nil)
+
+type globAndFrozenMatchNode struct {
+	Glob      string
+	MatchNode frozenMatchNode
+}
+
+func (f *matchNodeFreezer) freezeMatchNodeOfGlob(node *matchNodeOfGlob) *frozenMatchNodeOfGlob {
+	frozenNode := &frozenMatchNodeOfGlob{
+		children:        make([]globAndFrozenMatchNode, len(node.children)),
+		inverseChildren: make([]globAndFrozenMatchNode, len(node.inverseChildren)),
+		anyChild:        f.freezeOptionalMatchNode(node.anyChild),
+	}
+	for i, child := range node.children {
+		frozenNode.children[i] = globAndFrozenMatchNode{
+			Glob:      child.Glob,
+			MatchNode: f.freezeMatchNode(child.MatchNode),
+		}
+	}
+	for i, child := range node.inverseChildren {
+		frozenNode.inverseChildren[i] = globAndFrozenMatchNode{
+			Glob:      child.Glob,
+			MatchNode: f.freezeMatchNode(child.MatchNode),
+		}
+	}
+	return frozenNode
+}
+
+func (n *frozenMatchNodeOfGlob) FindChildren(children []frozenMatchNode, key MatchKey) []frozenMatchNode {
+	if key.IsAbsent {
+		return appendAnyChild(children, n.anyChild)
+	}
+
+	for _, child := range n.children {
+		if globMatches(child.Glob, key.String) {
+			children = append(children, child.MatchNode)
+		}
+	}
+
+	for _, child := range n.inverseChildren {
+		if !globMatches(child.Glob, key.String) {
+			children = append(children, child.MatchNode)
+		}
+	}
+
+	if child := n.anyChild; child != nil {
+		children = append(children, child)
+	}
+	return children
+}
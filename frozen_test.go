@@ -0,0 +1,189 @@
+package matchtree_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	. "github.com/roy2220/matchtree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrozenMatchTree_Search(t *testing.T) {
+	for _, suite := range loadTestSuites(t) {
+		frozenMatchTree := buildMatchTree(t, suite).Freeze()
+
+		for i, case1 := range suite.Cases {
+			t.Run(fmt.Sprintf("%s#%d", suite.Scenario, i+1), func(t *testing.T) {
+				values, err := frozenMatchTree.Search(case1.MatchKeys)
+				require.NoError(t, err)
+				assert.Equal(t, case1.Values, values)
+			})
+		}
+	}
+}
+
+func TestFrozenMatchTree_Search_WithSharedSubtrees(t *testing.T) {
+	for _, suite := range loadTestSuites(t) {
+		matchTree := buildMatchTree(t, suite)
+		frozenMatchTree := matchTree.Freeze(WithSharedSubtrees())
+		assert.LessOrEqual(t, frozenMatchTree.NodeCount(), matchTree.Freeze().NodeCount())
+
+		for i, case1 := range suite.Cases {
+			t.Run(fmt.Sprintf("%s#%d", suite.Scenario, i+1), func(t *testing.T) {
+				values, err := frozenMatchTree.Search(case1.MatchKeys)
+				require.NoError(t, err)
+				assert.Equal(t, case1.Values, values)
+			})
+		}
+	}
+}
+
+func TestFrozenMatchTree_NodeCount_WithSharedSubtrees(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString, MatchInteger, MatchInteger})
+	require.NoError(t, matchTree.AddRules([]MatchRule[string]{
+		{Patterns: []MatchPattern{StringsPattern("a", "b", "c"), IntegersPattern(1, 2, 3), IntegersPattern(4, 5, 6)}, Value: "wide"},
+		{Patterns: []MatchPattern{StringsPattern("c"), IntegersPattern(3), IntegersPattern(6)}, Value: "narrow"},
+	}))
+	// 1 root + 3 at depth 1 + 9 at depth 2 + 27 leaves
+	assert.Equal(t, 40, matchTree.Freeze().NodeCount())
+	// 1 root + 1 shared by a and b and 1 of c at depth 1 + 1 shared by all but 3 of c and 1 of 3 of c
+	// at depth 2 + 1 leaf of "wide" and 1 leaf of "wide" and "narrow"
+	frozenMatchTree := matchTree.Freeze(WithSharedSubtrees())
+	assert.Equal(t, 7, frozenMatchTree.NodeCount())
+
+	for _, case1 := range []struct {
+		Keys   []MatchKey
+		Values []string
+	}{
+		{[]MatchKey{StringKey("a"), IntegerKey(3), IntegerKey(6)}, []string{"wide"}},
+		{[]MatchKey{StringKey("c"), IntegerKey(2), IntegerKey(6)}, []string{"wide"}},
+		{[]MatchKey{StringKey("c"), IntegerKey(3), IntegerKey(6)}, []string{"wide", "narrow"}},
+		{[]MatchKey{StringKey("c"), IntegerKey(3), IntegerKey(7)}, nil},
+	} {
+		values, err := frozenMatchTree.Search(case1.Keys)
+		require.NoError(t, err)
+		assert.Equal(t, case1.Values, values)
+	}
+}
+
+func TestFrozenMatchTree_Search_Concurrent(t *testing.T) {
+	for _, suite := range loadTestSuites(t) {
+		frozenMatchTree := buildMatchTree(t, suite).Freeze()
+
+		var wg sync.WaitGroup
+		for range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range 100 {
+					for _, case1 := range suite.Cases {
+						values, err := frozenMatchTree.Search(case1.MatchKeys)
+						assert.NoError(t, err)
+						assert.Equal(t, case1.Values, values)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+func TestFrozenMatchTree_Search_WithParallelSearch(t *testing.T) {
+	for _, suite := range loadTestSuites(t) {
+		frozenMatchTree := buildMatchTree(t, suite).Freeze(WithParallelSearch(3))
+		for _, case1 := range suite.Cases {
+			values, err := frozenMatchTree.Search(case1.MatchKeys)
+			require.NoError(t, err)
+			assert.Equal(t, case1.Values, values, "%v", case1.MatchKeys)
+		}
+	}
+
+	// the first dimension fans out to many inverse and interval children
+	types := []MatchType{MatchIntegerInterval, MatchString, MatchInteger}
+	var rules []MatchRule[int]
+	for i := range 300 {
+		rules = append(rules, MatchRule[int]{
+			Patterns: []MatchPattern{
+				InverseIntegerIntervalPattern(ClosedInterval(int64(i%17), int64(i%17+2))),
+				StringsPattern(fmt.Sprint("s", i%3), fmt.Sprint("s", i%4)),
+				AnyPattern(MatchInteger),
+			},
+			Value:    i % 100,
+			Priority: int64(i % 5),
+		})
+	}
+	matchTree := NewMatchTree(types, WithValueDedup(func(x, y int) bool { return x == y }))
+	require.NoError(t, matchTree.AddRules(rules))
+	for _, optionFuncs := range [][]FreezeOptionFunc{
+		{WithParallelSearch(4)},
+		{WithParallelSearch(1000), WithSharedSubtrees()},
+	} {
+		frozenMatchTree := matchTree.Freeze(optionFuncs...)
+		var wg sync.WaitGroup
+		for range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for x := int64(-1); x <= 20; x++ {
+					for _, s := range []string{"s0", "s1", "s3", "s9"} {
+						keys := []MatchKey{IntegerIntervalKey(x), StringKey(s), IntegerKey(x)}
+						want, err := matchTree.Search(keys)
+						assert.NoError(t, err)
+						values, err := frozenMatchTree.Search(keys)
+						assert.NoError(t, err)
+						assert.Equal(t, want, values, "%v", keys)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+func TestFrozenMatchTree_Search_Allocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("sync.Pool drops items randomly under the race detector")
+	}
+	for _, suite := range loadTestSuites(t) {
+		frozenMatchTree := buildMatchTree(t, suite).Freeze()
+
+		for i, case1 := range suite.Cases {
+			t.Run(fmt.Sprintf("%s#%d", suite.Scenario, i+1), func(t *testing.T) {
+				allocs := testing.AllocsPerRun(100, func() {
+					_, _ = frozenMatchTree.Search(case1.MatchKeys)
+				})
+				expectedAllocs := 0.0
+				if len(case1.Values) >= 1 {
+					expectedAllocs = 1 // the returned slice
+				}
+				assert.Equal(t, expectedAllocs, allocs)
+			})
+		}
+	}
+}
+
+func TestFrozenMatchTree_IsSnapshot(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString})
+	_, err := matchTree.AddRule(MatchRule[string]{
+		Patterns: []MatchPattern{{Type: MatchString, Strings: []string{"foo"}}},
+		Value:    "rule_1",
+	})
+	require.NoError(t, err)
+	frozenMatchTree := matchTree.Freeze()
+
+	_, err = matchTree.AddRule(MatchRule[string]{
+		Patterns: []MatchPattern{{Type: MatchString, IsAny: true}},
+		Value:    "rule_2",
+	})
+	require.NoError(t, err)
+
+	keys := []MatchKey{{Type: MatchString, String: "foo"}}
+	values, err := frozenMatchTree.Search(keys)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_1"}, values)
+	values, err = matchTree.Search(keys)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_1", "rule_2"}, values)
+}
@@ -0,0 +1,165 @@
+package matchtree
+
+import (
+	"fmt"
+	"iter"
+	"strings"
+	"unicode/utf8"
+)
+
+// checkGlob checks that the glob of a MatchGlob pattern is well-formed, i.e. it does not end
+// with an unescaped backslash.
+func checkGlob(glob string) error {
+	for i := 0; i < len(glob); i++ {
+		if glob[i] == '\\' {
+			if i == len(glob)-1 {
+				return fmt.Errorf("matchtree: invalid glob %q: trailing backslash", glob)
+			}
+			i++
+		}
+	}
+	return nil
+}
+
+// globMatches reports whether the string s matches the glob, where "?" matches exactly one
+// rune, "*" matches any run of runes, including an empty one, and a backslash escapes the
+// rune following it. Runes of s are decoded as UTF-8, so "?" matches a multi-byte rune as a
+// whole, or a single byte of an invalid encoding.
+func globMatches(glob, s string) bool {
+	i, j := 0, 0          // positions in glob and s
+	starI, starJ := -1, 0 // positions after the last "*" in glob and where its run ends in s
+	for j < len(s) {
+		if i < len(glob) {
+			switch glob[i] {
+			case '*':
+				starI, starJ = i+1, j
+				i++
+				continue
+			case '?':
+				_, n := utf8.DecodeRuneInString(s[j:])
+				i++
+				j += n
+				continue
+			default:
+				literal, n := globLiteral(glob[i:])
+				if strings.HasPrefix(s[j:], literal) {
+					i += n
+					j += len(literal)
+					continue
+				}
+			}
+		}
+		if starI < 0 {
+			return false
+		}
+		// extend the run of the last "*" by one rune and retry
+		_, n := utf8.DecodeRuneInString(s[starJ:])
+		starJ += n
+		i, j = starI, starJ
+	}
+	for i < len(glob) && glob[i] == '*' {
+		i++
+	}
+	return i == len(glob)
+}
+
+// globLiteral returns the literal rune at the start of the glob, in UTF-8, and the number of
+// bytes of the glob it takes, including the escaping backslash if any.
+func globLiteral(glob string) (string, int) {
+	if glob[0] == '\\' && len(glob) >= 2 {
+		_, n := utf8.DecodeRuneInString(glob[1:])
+		return glob[1 : 1+n], 1 + n
+	}
+	_, n := utf8.DecodeRuneInString(glob)
+	return glob[:n], n
+}
+
+// ----- match node of glob -----
+
+// matchNodeOfGlob scans its children linearly like matchNodeOfRegexp, as globs cannot be keyed.
+type matchNodeOfGlob struct {
+	dummyMatchNode
+
+	children        []globAndMatchNode
+	inverseChildren []globAndMatchNode
+	anyChild        matchNode
+}
+
+var _ matchNode = (*matchNodeOfGlob)(nil)
+
+type globAndMatchNode struct {
+	Glob      string
+	MatchNode matchNode
+}
+
+func (n *matchNodeOfGlob) GetOrInsertChild(pattern *MatchPattern, newChildType MatchType) matchNode {
+	if pattern.IsAny {
+		child := n.anyChild
+		if child == nil {
+			child = newMatchNode(newChildType)
+			n.anyChild = child
+		}
+		return child
+	}
+
+	var children *[]globAndMatchNode
+	if pattern.IsInverse {
+		children = &n.inverseChildren
+	} else {
+		children = &n.children
+	}
+	for _, child := range *children {
+		if child.Glob == pattern.Glob {
+			return child.MatchNode
+		}
+	}
+	newChild := newMatchNode(newChildType)
+	*children = append(*children, globAndMatchNode{
+		Glob:      pattern.Glob,
+		MatchNode: newChild,
+	})
+	return newChild
+}
+
+func (n *matchNodeOfGlob) FindChildren(children []matchNode, key MatchKey) []matchNode {
+	if key.IsAbsent {
+		return appendAnyChild(children, n.anyChild)
+	}
+
+	for _, child := range n.children {
+		if globMatches(child.Glob, key.String) {
+			children = append(children, child.MatchNode)
+		}
+	}
+
+	for _, child := range n.inverseChildren {
+		if !globMatches(child.Glob, key.String) {
+			children = append(children, child.MatchNode)
+		}
+	}
+
+	if child := n.anyChild; child != nil {
+		children = append(children, child)
+	}
+	return children
+}
+
+func (n *matchNodeOfGlob) Edges() iter.Seq2[MatchPattern, matchNode] {
+	return func(yield func(MatchPattern, matchNode) bool) {
+		for _, child := range n.children {
+			if !yield(MatchPattern{Type: MatchGlob, Glob: child.Glob}, child.MatchNode) {
+				return
+			}
+		}
+
+		for _, child := range n.inverseChildren {
+			if !yield(MatchPattern{Type: MatchGlob, IsInverse: true, Glob: child.Glob}, child.MatchNode) {
+				return
+			}
+		}
+
+		if child := n.anyChild; child != nil {
+			yield(MatchPattern{Type: MatchGlob, IsAny: true}, child)
+		}
+	}
+}
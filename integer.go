@@ -0,0 +1,205 @@
+package matchtree
+
+import (
+	"iter"
+	"slices"
+)
+
+// ----- match node of integer -----
+
+type matchNodeOfInteger struct {
+	dummyMatchNode
+
+	children            map[int64]matchNode
+	childKeys           []int64 // the keys of children in ascending order, for range queries
+	inverseChildren     []matchNodeWithRefCount
+	inverseChildIndexes map[int64][]int
+	inverseChildKeys    []int64 // the keys of inverseChildIndexes in ascending order
+	anyChild            matchNode
+}
+
+var _ matchNode = (*matchNodeOfInteger)(nil)
+
+func (n *matchNodeOfInteger) GetOrInsertChild(pattern *MatchPattern, newChildType MatchType) matchNode {
+	if pattern.IsAny {
+		child := n.anyChild
+		if child == nil {
+			child = newMatchNode(newChildType)
+			n.anyChild = child
+		}
+		return child
+	}
+
+	if pattern.IsInverse {
+		refCounts := make([]int, len(n.inverseChildren))
+		for _, v := range pattern.Integers {
+			for _, childIndex := range n.inverseChildIndexes[v] {
+				refCounts[childIndex]++
+			}
+		}
+		maxRefCount := len(pattern.Integers)
+		for childIndex, refCount := range refCounts {
+			if refCount == maxRefCount && n.inverseChildren[childIndex].MaxRefCount == maxRefCount {
+				return n.inverseChildren[childIndex].MatchNode
+			}
+		}
+		newChild := newMatchNode(newChildType)
+		newChildIndex := len(n.inverseChildren)
+		n.inverseChildren = append(n.inverseChildren, matchNodeWithRefCount{
+			MatchNode:   newChild,
+			MaxRefCount: maxRefCount,
+		})
+		inverseChildIndexes := n.inverseChildIndexes
+		if inverseChildIndexes == nil {
+			inverseChildIndexes = make(map[int64][]int, maxRefCount)
+			n.inverseChildIndexes = inverseChildIndexes
+		}
+		for _, v := range pattern.Integers {
+			childIndexes, ok := inverseChildIndexes[v]
+			if !ok {
+				n.inverseChildKeys = insertSortedKey(n.inverseChildKeys, v)
+			}
+			inverseChildIndexes[v] = append(childIndexes, newChildIndex)
+		}
+		return newChild
+	}
+
+	children := n.children
+	if children == nil {
+		children = make(map[int64]matchNode, 1)
+		n.children = children
+	}
+	child, ok := children[pattern.currentInteger]
+	if !ok {
+		child = newMatchNode(newChildType)
+		children[pattern.currentInteger] = child
+		n.childKeys = insertSortedKey(n.childKeys, pattern.currentInteger)
+	}
+	return child
+}
+
+func (n *matchNodeOfInteger) reserveChildren(numberOfChildren int) {
+	if n.children == nil {
+		n.children = make(map[int64]matchNode, numberOfChildren)
+	}
+}
+
+func (n *matchNodeOfInteger) FindChildren(children []matchNode, key MatchKey) []matchNode {
+	if key.IsAbsent {
+		return appendAnyChild(children, n.anyChild)
+	}
+
+	if len(key.Integers) >= 1 {
+		return n.findChildrenOfIntegers(children, key.Integers)
+	}
+
+	if key.IntegerRange != nil {
+		return n.findChildrenOfRange(children, *key.IntegerRange)
+	}
+
+	if child, ok := n.children[key.Integer]; ok {
+		children = append(children, child)
+	}
+
+	if len(n.inverseChildren) >= 1 {
+		children = appendInverseChildren(children, n.inverseChildren, n.inverseChildIndexes[key.Integer])
+	}
+
+	if child := n.anyChild; child != nil {
+		children = append(children, child)
+	}
+	return children
+}
+
+func (n *matchNodeOfInteger) findChildrenOfIntegers(children []matchNode, keyIntegers []int64) []matchNode {
+	for i, v := range keyIntegers {
+		if slices.Contains(keyIntegers[:i], v) {
+			continue
+		}
+		if child, ok := n.children[v]; ok {
+			children = append(children, child)
+		}
+	}
+
+	if len(n.inverseChildren) >= 1 {
+		children = appendInverseChildrenOfValues(children, n.inverseChildren, n.inverseChildIndexes, keyIntegers)
+	}
+
+	if child := n.anyChild; child != nil {
+		children = append(children, child)
+	}
+	return children
+}
+
+// findChildrenOfRange finds the children for a range query, walking the sorted integers of the
+// children from the lower bound of the interval up to its upper bound.
+func (n *matchNodeOfInteger) findChildrenOfRange(children []matchNode, keyRange IntegerInterval) []matchNode {
+	if lowerBound, upperBound, ok := integerIntervalBounds(keyRange); ok {
+		i, _ := slices.BinarySearch(n.childKeys, lowerBound)
+		for ; i < len(n.childKeys) && n.childKeys[i] <= upperBound; i++ {
+			children = append(children, n.children[n.childKeys[i]])
+		}
+
+		if len(n.inverseChildren) >= 1 {
+			excludedChildIndexes := getBitset(len(n.inverseChildren))
+			i, _ := slices.BinarySearch(n.inverseChildKeys, lowerBound)
+			for ; i < len(n.inverseChildKeys) && n.inverseChildKeys[i] <= upperBound; i++ {
+				for _, childIndex := range n.inverseChildIndexes[n.inverseChildKeys[i]] {
+					excludedChildIndexes.Add(childIndex)
+				}
+			}
+			children = appendInverseChildrenNotIn(children, n.inverseChildren, *excludedChildIndexes)
+			putBitset(excludedChildIndexes)
+		}
+	}
+
+	if child := n.anyChild; child != nil {
+		children = append(children, child)
+	}
+	return children
+}
+
+// updateChildKeys brings the sorted keys back in line with the maps, after the removal of
+// children by pruning or compaction.
+func (n *matchNodeOfInteger) updateChildKeys() {
+	n.childKeys = nil
+	if len(n.children) >= 1 {
+		n.childKeys = sortedKeys(n.children)
+	}
+	n.inverseChildKeys = nil
+	if len(n.inverseChildIndexes) >= 1 {
+		n.inverseChildKeys = sortedKeys(n.inverseChildIndexes)
+	}
+}
+
+// insertSortedKey inserts the key, not yet present, into the sorted keys.
+func insertSortedKey(keys []int64, key int64) []int64 {
+	i, _ := slices.BinarySearch(keys, key)
+	return slices.Insert(keys, i, key)
+}
+
+func (n *matchNodeOfInteger) Edges() iter.Seq2[MatchPattern, matchNode] {
+	return func(yield func(MatchPattern, matchNode) bool) {
+		for _, v := range sortedKeys(n.children) {
+			if !yield(MatchPattern{Type: MatchInteger, Integers: []int64{v}}, n.children[v]) {
+				return
+			}
+		}
+
+		inverseValues := make([][]int64, len(n.inverseChildren))
+		for _, v := range sortedKeys(n.inverseChildIndexes) {
+			for _, childIndex := range n.inverseChildIndexes[v] {
+				inverseValues[childIndex] = append(inverseValues[childIndex], v)
+			}
+		}
+		for childIndex, child := range n.inverseChildren {
+			if !yield(MatchPattern{Type: MatchInteger, IsInverse: true, Integers: inverseValues[childIndex]}, child.MatchNode) {
+				return
+			}
+		}
+
+		if child := n.anyChild; child != nil {
+			yield(MatchPattern{Type: MatchInteger, IsAny: true}, child)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package matchtree
+
+import (
+	"iter"
+	"slices"
+)
+
+// ----- match node of integer interval -----
+
+type matchNodeOfIntegerInterval struct {
+	dummyMatchNode
+
+	children                []integerIntervalAndMatchNode
+	childTree               integerIntervalTree[matchNode]
+	inverseChildren         []matchNodeWithRefCount
+	inverseChildIndexes     []integerIntervalAndMatchNodeIndexes
+	inverseChildIndexesTree integerIntervalTree[int]
+	anyChild                matchNode
+}
+
+var _ matchNode = (*matchNodeOfIntegerInterval)(nil)
+
+type integerIntervalAndMatchNode struct {
+	IntegerInterval IntegerInterval
+	MatchNode       matchNode
+}
+
+type integerIntervalAndMatchNodeIndexes struct {
+	IntegerInterval  IntegerInterval
+	MatchNodeIndexes []int
+}
+
+func (n *matchNodeOfIntegerInterval) GetOrInsertChild(pattern *MatchPattern, newChildType MatchType) matchNode {
+	if pattern.IsAny {
+		child := n.anyChild
+		if child == nil {
+			child = newMatchNode(newChildType)
+			n.anyChild = child
+		}
+		return child
+	}
+
+	if pattern.IsInverse {
+		refCounts := make([]int, len(n.inverseChildren))
+		for _, v := range pattern.IntegerIntervals {
+			i := slices.IndexFunc(n.inverseChildIndexes, func(x integerIntervalAndMatchNodeIndexes) bool {
+				return x.IntegerInterval.Equals(v)
+			})
+			if i < 0 {
+				continue
+			}
+			for _, childIndex := range n.inverseChildIndexes[i].MatchNodeIndexes {
+				refCounts[childIndex]++
+			}
+		}
+		maxRefCount := len(pattern.IntegerIntervals)
+		for childIndex, refCount := range refCounts {
+			if refCount == maxRefCount && n.inverseChildren[childIndex].MaxRefCount == maxRefCount {
+				return n.inverseChildren[childIndex].MatchNode
+			}
+		}
+		newChild := newMatchNode(newChildType)
+		newChildIndex := len(n.inverseChildren)
+		n.inverseChildren = append(n.inverseChildren, matchNodeWithRefCount{
+			MatchNode:   newChild,
+			MaxRefCount: maxRefCount,
+		})
+		for _, v := range pattern.IntegerIntervals {
+			i := slices.IndexFunc(n.inverseChildIndexes, func(x integerIntervalAndMatchNodeIndexes) bool {
+				return x.IntegerInterval.Equals(v)
+			})
+			if i < 0 {
+				n.inverseChildIndexesTree.Insert(v, len(n.inverseChildIndexes))
+				n.inverseChildIndexes = append(n.inverseChildIndexes, integerIntervalAndMatchNodeIndexes{
+					IntegerInterval:  v,
+					MatchNodeIndexes: []int{newChildIndex},
+				})
+				continue
+			}
+			n.inverseChildIndexes[i].MatchNodeIndexes = append(n.inverseChildIndexes[i].MatchNodeIndexes, newChildIndex)
+		}
+		return newChild
+	}
+
+	if childIndex := slices.IndexFunc(n.children, func(x integerIntervalAndMatchNode) bool {
+		return x.IntegerInterval.Equals(pattern.currentIntegerInterval)
+	}); childIndex >= 0 {
+		return n.children[childIndex].MatchNode
+	}
+	newChild := newMatchNode(newChildType)
+	n.children = append(n.children, integerIntervalAndMatchNode{
+		IntegerInterval: pattern.currentIntegerInterval,
+		MatchNode:       newChild,
+	})
+	n.childTree.Insert(pattern.currentIntegerInterval, newChild)
+	return newChild
+}
+
+func (n *matchNodeOfIntegerInterval) FindChildren(children []matchNode, key MatchKey) []matchNode {
+	if key.IsAbsent {
+		return appendAnyChild(children, n.anyChild)
+	}
+
+	n.childTree.Search(key.Integer, func(child matchNode) bool {
+		children = append(children, child)
+		return true
+	})
+
+	if len(n.inverseChildren) >= 1 {
+		excludedChildIndexes := getBitset(len(n.inverseChildren))
+		n.inverseChildIndexesTree.Search(key.Integer, func(i int) bool {
+			for _, childIndex := range n.inverseChildIndexes[i].MatchNodeIndexes {
+				excludedChildIndexes.Add(childIndex)
+			}
+			return true
+		})
+		children = appendInverseChildrenNotIn(children, n.inverseChildren, *excludedChildIndexes)
+		putBitset(excludedChildIndexes)
+	}
+
+	if child := n.anyChild; child != nil {
+		children = append(children, child)
+	}
+	return children
+}
+
+func (n *matchNodeOfIntegerInterval) Edges() iter.Seq2[MatchPattern, matchNode] {
+	return func(yield func(MatchPattern, matchNode) bool) {
+		for _, child := range n.children {
+			if !yield(MatchPattern{Type: MatchIntegerInterval, IntegerIntervals: []IntegerInterval{child.IntegerInterval}}, child.MatchNode) {
+				return
+			}
+		}
+
+		inverseIntervals := make([][]IntegerInterval, len(n.inverseChildren))
+		for _, v := range n.inverseChildIndexes {
+			for _, childIndex := range v.MatchNodeIndexes {
+				inverseIntervals[childIndex] = append(inverseIntervals[childIndex], v.IntegerInterval)
+			}
+		}
+		for childIndex, child := range n.inverseChildren {
+			if !yield(MatchPattern{Type: MatchIntegerInterval, IsInverse: true, IntegerIntervals: inverseIntervals[childIndex]}, child.MatchNode) {
+				return
+			}
+		}
+
+		if child := n.anyChild; child != nil {
+			yield(MatchPattern{Type: MatchIntegerInterval, IsAny: true}, child)
+		}
+	}
+}
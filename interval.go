@@ -0,0 +1,497 @@
+package matchtree
+
+import (
+	"cmp"
+	"math"
+	"slices"
+)
+
+// IntegerInterval represents a closed, open, or half-open interval for integers.
+// A nil Min or Max indicates the interval is unbounded on that side; bounds of math.MinInt64 and
+// math.MaxInt64 are ordinary bounds, so e.g. a Max of math.MaxInt64 with MaxIsExcluded does not
+// contain math.MaxInt64.
+type IntegerInterval struct {
+	Min           *int64 `json:"min" yaml:"min" msgpack:"min"`
+	MinIsExcluded bool   `json:"min_is_excluded" yaml:"min_is_excluded" msgpack:"min_is_excluded"`
+	Max           *int64 `json:"max" yaml:"max" msgpack:"max"`
+	MaxIsExcluded bool   `json:"max_is_excluded" yaml:"max_is_excluded" msgpack:"max_is_excluded"`
+}
+
+// Int64Ptr is a helper function to create a pointer to an int64 value.
+func Int64Ptr(x int64) *int64 { return &x }
+
+// Equals checks if two IntegerIntervals are equal.
+func (i IntegerInterval) Equals(other IntegerInterval) bool {
+	if !((i.Min == nil) == (other.Min == nil) &&
+		(i.Max == nil) == (other.Max == nil)) {
+		return false
+	}
+
+	if i.Min != nil {
+		if *i.Min != *other.Min {
+			return false
+		}
+		if i.MinIsExcluded != other.MinIsExcluded {
+			return false
+		}
+	}
+
+	if i.Max != nil {
+		if *i.Max != *other.Max {
+			return false
+		}
+		if i.MaxIsExcluded != other.MaxIsExcluded {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Contains checks if the given integer `x` falls within the interval.
+func (i IntegerInterval) Contains(x int64) bool {
+	if i.Min != nil {
+		y := *i.Min
+		if i.MinIsExcluded {
+			if x <= y {
+				return false
+			}
+		} else {
+			if x < y {
+				return false
+			}
+		}
+	}
+	if i.Max != nil {
+		y := *i.Max
+		if i.MaxIsExcluded {
+			if x >= y {
+				return false
+			}
+		} else {
+			if x > y {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// String returns the IntegerInterval in the notation of ParseIntegerInterval, e.g. "[1,5)", with
+// an unbounded side written as empty, e.g. "(,10]".
+func (i IntegerInterval) String() string {
+	return formatInterval(i.Min, i.MinIsExcluded, i.Max, i.MaxIsExcluded)
+}
+
+// IsEmpty checks if the interval contains no integer, e.g. "(5,5)", "[5,5)" or "[6,5]".
+func (i IntegerInterval) IsEmpty() bool {
+	_, _, ok := integerIntervalBounds(i)
+	return !ok
+}
+
+// Overlaps checks if the interval and the other one have any integer in common.
+func (i IntegerInterval) Overlaps(other IntegerInterval) bool {
+	lowerBound, upperBound, ok := integerIntervalBounds(i)
+	if !ok {
+		return false
+	}
+	lowerBound2, upperBound2, ok := integerIntervalBounds(other)
+	return ok && lowerBound <= upperBound2 && lowerBound2 <= upperBound
+}
+
+// ContainsInterval checks if every integer in the other interval is also in the interval,
+// e.g. "[1,10]" contains "(2,9)" but "[2,10]" does not contain "[1,5]".
+// An empty interval is contained in any interval.
+func (i IntegerInterval) ContainsInterval(other IntegerInterval) bool {
+	lowerBound2, upperBound2, ok := integerIntervalBounds(other)
+	if !ok {
+		return true
+	}
+	lowerBound, upperBound, ok := integerIntervalBounds(i)
+	return ok && lowerBound <= lowerBound2 && upperBound2 <= upperBound
+}
+
+// NumberInterval represents a closed, open, or half-open interval for floating-point numbers.
+// A nil Min or Max indicates the interval is unbounded on that side, and so does an infinite one,
+// e.g. a Min of math.Inf(-1), except that an excluded infinite bound excludes the infinity itself.
+type NumberInterval struct {
+	Min           *float64 `json:"min" yaml:"min" msgpack:"min"`
+	MinIsExcluded bool     `json:"min_is_excluded" yaml:"min_is_excluded" msgpack:"min_is_excluded"`
+	Max           *float64 `json:"max" yaml:"max" msgpack:"max"`
+	MaxIsExcluded bool     `json:"max_is_excluded" yaml:"max_is_excluded" msgpack:"max_is_excluded"`
+}
+
+// Float64Ptr is a helper function to create a pointer to a float64 value.
+func Float64Ptr(x float64) *float64 { return &x }
+
+const epsilon = 1e-10
+
+// Equals checks if two NumberIntervals are equal, considering floating-point precision.
+func (i NumberInterval) Equals(other NumberInterval) bool {
+	if !((i.Min == nil) == (other.Min == nil) &&
+		(i.Max == nil) == (other.Max == nil)) {
+		return false
+	}
+
+	if i.Min != nil {
+		if !numbersAreEqual(*i.Min, *other.Min) {
+			return false
+		}
+		if i.MinIsExcluded != other.MinIsExcluded {
+			return false
+		}
+	}
+
+	if i.Max != nil {
+		if !numbersAreEqual(*i.Max, *other.Max) {
+			return false
+		}
+		if i.MaxIsExcluded != other.MaxIsExcluded {
+			return false
+		}
+	}
+
+	return true
+}
+
+// numbersAreEqual checks if two floating-point numbers are equal, considering floating-point
+// precision. Infinities are only equal to themselves.
+func numbersAreEqual(x, y float64) bool { return x == y || math.Abs(x-y) < epsilon }
+
+// Contains checks if the given floating-point number `x` falls within the interval,
+// considering floating-point precision.
+func (i NumberInterval) Contains(x float64) bool {
+	if i.Min != nil {
+		y := *i.Min
+		if i.MinIsExcluded {
+			if x <= y+epsilon {
+				return false
+			}
+		} else {
+			if x < y-epsilon {
+				return false
+			}
+		}
+	}
+	if i.Max != nil {
+		y := *i.Max
+		if i.MaxIsExcluded {
+			if x >= y-epsilon {
+				return false
+			}
+		} else {
+			if x > y+epsilon {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Overlaps checks if the interval and the other one have any floating-point number in common,
+// considering floating-point precision like Contains.
+func (i NumberInterval) Overlaps(other NumberInterval) bool {
+	// the intersection is not empty iff every lower bound is below every upper bound
+	return !i.IsEmpty() && !other.IsEmpty() &&
+		isBelowNumberBound(i.Min, i.MinIsExcluded, other.Max, other.MaxIsExcluded) &&
+		isBelowNumberBound(other.Min, other.MinIsExcluded, i.Max, i.MaxIsExcluded)
+}
+
+// String returns the NumberInterval in the notation of ParseNumberInterval, e.g. "(0.5,1]", with
+// an unbounded side written as empty, e.g. "[0,)".
+func (i NumberInterval) String() string {
+	return formatInterval(i.Min, i.MinIsExcluded, i.Max, i.MaxIsExcluded)
+}
+
+// ContainsInterval checks if every floating-point number in the other interval is also in the
+// interval, considering floating-point precision like Equals, e.g. "[1,10]" contains "(2,9)"
+// but "[2,10]" does not contain "[1,5]". An empty interval is contained in any interval.
+func (i NumberInterval) ContainsInterval(other NumberInterval) bool {
+	if other.IsEmpty() {
+		return true
+	}
+	return !i.IsEmpty() &&
+		coversNumberBound(i.Min, i.MinIsExcluded, other.Min, other.MinIsExcluded, -1) &&
+		coversNumberBound(i.Max, i.MaxIsExcluded, other.Max, other.MaxIsExcluded, 1)
+}
+
+// coversNumberBound checks if the bound admits every floating-point number that the other bound
+// admits, both being lower bounds if sign is -1 or upper bounds if sign is 1, considering
+// floating-point precision like Equals.
+func coversNumberBound(bound *float64, isExcluded bool, otherBound *float64, otherIsExcluded bool, sign float64) bool {
+	// an unbounded side is taken as an included infinity
+	x, y := math.Inf(int(sign)), math.Inf(int(sign))
+	if bound == nil {
+		isExcluded = false
+	} else {
+		x = *bound
+	}
+	if otherBound == nil {
+		otherIsExcluded = false
+	} else {
+		y = *otherBound
+	}
+	if numbersAreEqual(x, y) {
+		return !isExcluded || otherIsExcluded
+	}
+	return sign*x > sign*y
+}
+
+// normalizeZeros returns the interval with any bound of -0 replaced by 0, without modifying
+// the bounds it points to. The two zeros compare equal, so this changes no match, but -0 would
+// otherwise be kept through String and encodings, e.g. as "[-0,1]" or as -0 in JSON.
+func (i NumberInterval) normalizeZeros() NumberInterval {
+	if i.Min != nil && *i.Min == 0 && math.Signbit(*i.Min) {
+		i.Min = Float64Ptr(0)
+	}
+	if i.Max != nil && *i.Max == 0 && math.Signbit(*i.Max) {
+		i.Max = Float64Ptr(0)
+	}
+	return i
+}
+
+// IsEmpty checks if the interval contains no floating-point number, e.g. "(5,5)", "[5,5)" or
+// "[6,5]", considering floating-point precision: bounds closer than epsilon are taken as equal.
+func (i NumberInterval) IsEmpty() bool {
+	if i.Min == nil || i.Max == nil {
+		return false
+	}
+	if *i.Min == *i.Max {
+		// including infinite bounds
+		return i.MinIsExcluded || i.MaxIsExcluded
+	}
+	d := *i.Max - *i.Min
+	if d <= -epsilon {
+		return true
+	}
+	if d < epsilon {
+		return i.MinIsExcluded || i.MaxIsExcluded
+	}
+	return false
+}
+
+// isBelowNumberBound checks if some floating-point number satisfies both the lower bound and
+// the upper bound, considering floating-point precision like Contains.
+func isBelowNumberBound(lowerBound *float64, lowerBoundIsExcluded bool, upperBound *float64, upperBoundIsExcluded bool) bool {
+	if lowerBound == nil || upperBound == nil {
+		return true
+	}
+	x, y := *lowerBound-epsilon, *upperBound+epsilon
+	if lowerBoundIsExcluded {
+		x = *lowerBound + epsilon
+	}
+	if upperBoundIsExcluded {
+		y = *upperBound - epsilon
+	}
+	if lowerBoundIsExcluded || upperBoundIsExcluded {
+		return x < y
+	}
+	return x <= y
+}
+
+// ClosedInterval returns the IntegerInterval "[min,max]".
+func ClosedInterval(min, max int64) IntegerInterval {
+	return IntegerInterval{Min: Int64Ptr(min), Max: Int64Ptr(max)}
+}
+
+// OpenInterval returns the IntegerInterval "(min,max)".
+func OpenInterval(min, max int64) IntegerInterval {
+	return IntegerInterval{Min: Int64Ptr(min), MinIsExcluded: true, Max: Int64Ptr(max), MaxIsExcluded: true}
+}
+
+// HalfOpenInterval returns the IntegerInterval "[min,max)", the same as RightOpenInterval, which
+// is the usual form of a half-open interval, e.g. of a version or time range.
+func HalfOpenInterval(min, max int64) IntegerInterval { return RightOpenInterval(min, max) }
+
+// LeftOpenInterval returns the IntegerInterval "(min,max]".
+func LeftOpenInterval(min, max int64) IntegerInterval {
+	return IntegerInterval{Min: Int64Ptr(min), MinIsExcluded: true, Max: Int64Ptr(max)}
+}
+
+// RightOpenInterval returns the IntegerInterval "[min,max)".
+func RightOpenInterval(min, max int64) IntegerInterval {
+	return IntegerInterval{Min: Int64Ptr(min), Max: Int64Ptr(max), MaxIsExcluded: true}
+}
+
+// FromInterval returns the IntegerInterval "[min,)", unbounded above.
+func FromInterval(min int64) IntegerInterval { return IntegerInterval{Min: Int64Ptr(min)} }
+
+// ToInterval returns the IntegerInterval "(,max]", unbounded below.
+func ToInterval(max int64) IntegerInterval { return IntegerInterval{Max: Int64Ptr(max)} }
+
+// ClosedNumberInterval returns the NumberInterval "[min,max]".
+func ClosedNumberInterval(min, max float64) NumberInterval {
+	return NumberInterval{Min: Float64Ptr(min), Max: Float64Ptr(max)}
+}
+
+// OpenNumberInterval returns the NumberInterval "(min,max)".
+func OpenNumberInterval(min, max float64) NumberInterval {
+	return NumberInterval{Min: Float64Ptr(min), MinIsExcluded: true, Max: Float64Ptr(max), MaxIsExcluded: true}
+}
+
+// HalfOpenNumberInterval returns the NumberInterval "[min,max)", the same as
+// RightOpenNumberInterval.
+func HalfOpenNumberInterval(min, max float64) NumberInterval {
+	return RightOpenNumberInterval(min, max)
+}
+
+// LeftOpenNumberInterval returns the NumberInterval "(min,max]".
+func LeftOpenNumberInterval(min, max float64) NumberInterval {
+	return NumberInterval{Min: Float64Ptr(min), MinIsExcluded: true, Max: Float64Ptr(max)}
+}
+
+// RightOpenNumberInterval returns the NumberInterval "[min,max)".
+func RightOpenNumberInterval(min, max float64) NumberInterval {
+	return NumberInterval{Min: Float64Ptr(min), Max: Float64Ptr(max), MaxIsExcluded: true}
+}
+
+// FromNumberInterval returns the NumberInterval "[min,)", unbounded above.
+func FromNumberInterval(min float64) NumberInterval { return NumberInterval{Min: Float64Ptr(min)} }
+
+// ToNumberInterval returns the NumberInterval "(,max]", unbounded below.
+func ToNumberInterval(max float64) NumberInterval { return NumberInterval{Max: Float64Ptr(max)} }
+
+// Intersect returns the integers in both the interval and the other one, keeping the tighter
+// bound of each side as it is, e.g. "[1,10]" and "(2,12]" intersect in "(2,10]".
+// It returns false if the intervals have no integer in common.
+func (i IntegerInterval) Intersect(other IntegerInterval) (IntegerInterval, bool) {
+	lowerBound, upperBound, ok := integerIntervalBounds(i)
+	if !ok {
+		return IntegerInterval{}, false
+	}
+	lowerBound2, upperBound2, ok := integerIntervalBounds(other)
+	if !ok || lowerBound > upperBound2 || lowerBound2 > upperBound {
+		return IntegerInterval{}, false
+	}
+
+	intersection := i
+	if lowerBound2 > lowerBound {
+		intersection.Min, intersection.MinIsExcluded = other.Min, other.MinIsExcluded
+	}
+	if upperBound2 < upperBound {
+		intersection.Max, intersection.MaxIsExcluded = other.Max, other.MaxIsExcluded
+	}
+	return intersection, true
+}
+
+// MergeIntegerIntervals coalesces the overlapping or adjacent intervals, e.g. "[1,5]", "[6,8)" and
+// "[3,4]" into "[1,8)", and returns the resulting disjoint intervals in ascending order. Empty
+// intervals are dropped. A pattern of the merged intervals matches the same integers with fewer
+// interval children.
+func MergeIntegerIntervals(intervals []IntegerInterval) []IntegerInterval {
+	type boundedInterval struct {
+		IntegerInterval
+		LowerBound int64
+		UpperBound int64
+	}
+	boundedIntervals := make([]boundedInterval, 0, len(intervals))
+	for _, interval := range intervals {
+		lowerBound, upperBound, ok := integerIntervalBounds(interval)
+		if !ok {
+			continue
+		}
+		boundedIntervals = append(boundedIntervals, boundedInterval{interval, lowerBound, upperBound})
+	}
+	if len(boundedIntervals) == 0 {
+		return nil
+	}
+	slices.SortStableFunc(boundedIntervals, func(x, y boundedInterval) int {
+		return cmp.Compare(x.LowerBound, y.LowerBound)
+	})
+
+	var mergedIntervals []IntegerInterval
+	last := boundedIntervals[0]
+	for _, next := range boundedIntervals[1:] {
+		// next.LowerBound-1 cannot overflow once next.LowerBound is above last.UpperBound
+		if next.LowerBound > last.UpperBound && next.LowerBound-1 > last.UpperBound {
+			mergedIntervals = append(mergedIntervals, last.IntegerInterval)
+			last = next
+			continue
+		}
+		if next.UpperBound > last.UpperBound {
+			last.Max, last.MaxIsExcluded = next.Max, next.MaxIsExcluded
+			last.UpperBound = next.UpperBound
+		}
+	}
+	return append(mergedIntervals, last.IntegerInterval)
+}
+
+// Intersect returns the floating-point numbers in both the interval and the other one, keeping
+// the tighter bound of each side as it is, e.g. "[1,10]" and "(2,12]" intersect in "(2,10]".
+// It returns false if the intervals have no floating-point number in common, considering
+// floating-point precision like Overlaps.
+func (i NumberInterval) Intersect(other NumberInterval) (NumberInterval, bool) {
+	if !i.Overlaps(other) {
+		return NumberInterval{}, false
+	}
+
+	intersection := i
+	if coversNumberBound(i.Min, i.MinIsExcluded, other.Min, other.MinIsExcluded, -1) {
+		intersection.Min, intersection.MinIsExcluded = other.Min, other.MinIsExcluded
+	}
+	if coversNumberBound(i.Max, i.MaxIsExcluded, other.Max, other.MaxIsExcluded, 1) {
+		intersection.Max, intersection.MaxIsExcluded = other.Max, other.MaxIsExcluded
+	}
+	return intersection, true
+}
+
+// MergeNumberIntervals coalesces the overlapping or adjacent intervals, e.g. "[1,5)", "[5,8]"
+// and "[3,4]" into "[1,8]", and returns the resulting disjoint intervals in ascending order.
+// Bounds closer than epsilon are taken as equal, so "[1,2]" and "(2.00000000001,3]" are adjacent,
+// but "[1,2)" and "(2,3]" are not since they both exclude 2. Empty intervals are dropped.
+// A pattern of the merged intervals matches the same floating-point numbers with fewer interval
+// children.
+func MergeNumberIntervals(intervals []NumberInterval) []NumberInterval {
+	nonEmptyIntervals := make([]NumberInterval, 0, len(intervals))
+	for _, interval := range intervals {
+		if interval.IsEmpty() {
+			continue
+		}
+		nonEmptyIntervals = append(nonEmptyIntervals, interval)
+	}
+	if len(nonEmptyIntervals) == 0 {
+		return nil
+	}
+	slices.SortStableFunc(nonEmptyIntervals, func(x, y NumberInterval) int {
+		switch {
+		case x.Min == nil && y.Min == nil:
+			return 0
+		case x.Min == nil:
+			// an unbounded side goes first
+			return -1
+		case y.Min == nil:
+			return 1
+		case *x.Min != *y.Min:
+			return cmp.Compare(*x.Min, *y.Min)
+		case x.MinIsExcluded == y.MinIsExcluded:
+			return 0
+		case !x.MinIsExcluded:
+			// an included bound goes first
+			return -1
+		default:
+			return 1
+		}
+	})
+
+	var mergedIntervals []NumberInterval
+	last := nonEmptyIntervals[0]
+	for _, next := range nonEmptyIntervals[1:] {
+		if !last.Overlaps(next) && !numberIntervalsAreAdjacent(last, next) {
+			mergedIntervals = append(mergedIntervals, last)
+			last = next
+			continue
+		}
+		if !coversNumberBound(last.Max, last.MaxIsExcluded, next.Max, next.MaxIsExcluded, 1) {
+			last.Max, last.MaxIsExcluded = next.Max, next.MaxIsExcluded
+		}
+	}
+	return append(mergedIntervals, last)
+}
+
+// numberIntervalsAreAdjacent checks if the upper bound of the interval meets the lower bound of
+// the next one without a gap, considering floating-point precision like Equals.
+func numberIntervalsAreAdjacent(interval, next NumberInterval) bool {
+	return interval.Max != nil && next.Min != nil &&
+		numbersAreEqual(*interval.Max, *next.Min) &&
+		!(interval.MaxIsExcluded && next.MinIsExcluded)
+}
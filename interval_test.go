@@ -0,0 +1,306 @@
+package matchtree_test
+
+import (
+	"math"
+	"testing"
+
+	. "github.com/roy2220/matchtree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntervalConstructors(t *testing.T) {
+	for _, tt := range []struct {
+		i    IntegerInterval
+		want string
+	}{
+		{ClosedInterval(1, 5), "[1,5]"},
+		{OpenInterval(1, 5), "(1,5)"},
+		{HalfOpenInterval(1, 5), "[1,5)"},
+		{LeftOpenInterval(1, 5), "(1,5]"},
+		{RightOpenInterval(1, 5), "[1,5)"},
+		{FromInterval(1), "[1,)"},
+		{ToInterval(5), "(,5]"},
+	} {
+		assert.Equal(t, tt.want, tt.i.String())
+		interval, err := ParseIntegerInterval(tt.want)
+		if assert.NoError(t, err) {
+			assert.Equal(t, tt.i, interval)
+		}
+	}
+
+	for _, tt := range []struct {
+		i    NumberInterval
+		want string
+	}{
+		{ClosedNumberInterval(0.5, 1), "[0.5,1]"},
+		{OpenNumberInterval(0.5, 1), "(0.5,1)"},
+		{HalfOpenNumberInterval(0.5, 1), "[0.5,1)"},
+		{LeftOpenNumberInterval(0.5, 1), "(0.5,1]"},
+		{RightOpenNumberInterval(0.5, 1), "[0.5,1)"},
+		{FromNumberInterval(0.5), "[0.5,)"},
+		{ToNumberInterval(1), "(,1]"},
+	} {
+		assert.Equal(t, tt.want, tt.i.String())
+		interval, err := ParseNumberInterval(tt.want)
+		if assert.NoError(t, err) {
+			assert.Equal(t, tt.i, interval)
+		}
+	}
+}
+
+func TestIntegerInterval_Intersect(t *testing.T) {
+	f := Int64Ptr
+
+	tests := []struct {
+		name   string
+		i      IntegerInterval
+		j      IntegerInterval
+		want   IntegerInterval
+		wantOk bool
+	}{
+		{
+			name:   "intersecting intervals",
+			i:      IntegerInterval{Min: f(1), Max: f(10)},
+			j:      IntegerInterval{Min: f(2), MinIsExcluded: true, Max: f(12)},
+			want:   IntegerInterval{Min: f(2), MinIsExcluded: true, Max: f(10)},
+			wantOk: true,
+		},
+		{
+			name:   "nested intervals",
+			i:      IntegerInterval{},
+			j:      IntegerInterval{Min: f(1), Max: f(5), MaxIsExcluded: true},
+			want:   IntegerInterval{Min: f(1), Max: f(5), MaxIsExcluded: true},
+			wantOk: true,
+		},
+		{
+			name:   "touching at included endpoints",
+			i:      IntegerInterval{Min: f(1), Max: f(5)},
+			j:      IntegerInterval{Min: f(5)},
+			want:   IntegerInterval{Min: f(5), Max: f(5)},
+			wantOk: true,
+		},
+		{
+			name:   "touching at excluded endpoint",
+			i:      IntegerInterval{Min: f(1), Max: f(5), MaxIsExcluded: true},
+			j:      IntegerInterval{Min: f(5)},
+			wantOk: false,
+		},
+		{
+			name:   "empty interval",
+			i:      IntegerInterval{Min: f(5), MinIsExcluded: true, Max: f(5)},
+			j:      IntegerInterval{},
+			wantOk: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.i.Intersect(tt.j)
+			assert.Equal(t, tt.wantOk, ok)
+			if ok {
+				assert.Equal(t, tt.want, got)
+			}
+			got, ok = tt.j.Intersect(tt.i)
+			assert.Equal(t, tt.wantOk, ok)
+			if ok {
+				assert.True(t, tt.want.Equals(got), "%v", got)
+			}
+		})
+	}
+}
+
+func TestMergeIntegerIntervals(t *testing.T) {
+	f := Int64Ptr
+
+	tests := []struct {
+		name      string
+		intervals []IntegerInterval
+		want      []IntegerInterval
+	}{
+		{
+			name:      "no intervals",
+			intervals: nil,
+			want:      nil,
+		},
+		{
+			name: "overlapping and adjacent intervals",
+			intervals: []IntegerInterval{
+				{Min: f(1), Max: f(5)},
+				{Min: f(6), Max: f(8), MaxIsExcluded: true},
+				{Min: f(3), Max: f(4)},
+			},
+			want: []IntegerInterval{
+				{Min: f(1), Max: f(8), MaxIsExcluded: true},
+			},
+		},
+		{
+			name: "disjoint intervals",
+			intervals: []IntegerInterval{
+				{Min: f(10)},
+				{Min: f(1), Max: f(5), MaxIsExcluded: true},
+				{Min: f(5), MinIsExcluded: true, Max: f(8)},
+			},
+			want: []IntegerInterval{
+				{Min: f(1), Max: f(5), MaxIsExcluded: true},
+				{Min: f(5), MinIsExcluded: true, Max: f(8)},
+				{Min: f(10)},
+			},
+		},
+		{
+			name: "adjacent integers across excluded endpoints",
+			intervals: []IntegerInterval{
+				{Min: f(1), Max: f(5), MaxIsExcluded: true},
+				{Min: f(4), MinIsExcluded: true, Max: f(8)},
+			},
+			want: []IntegerInterval{
+				{Min: f(1), Max: f(8)},
+			},
+		},
+		{
+			name: "extreme bounds and empty intervals",
+			intervals: []IntegerInterval{
+				{Min: f(math.MaxInt64), MinIsExcluded: true},
+				{Min: f(0)},
+				{Max: f(-1)},
+				{Min: f(5), Max: f(3)},
+			},
+			want: []IntegerInterval{
+				{},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, MergeIntegerIntervals(tt.intervals))
+		})
+	}
+}
+
+func TestNumberInterval_Intersect(t *testing.T) {
+	f := Float64Ptr
+
+	tests := []struct {
+		name   string
+		i      NumberInterval
+		j      NumberInterval
+		want   NumberInterval
+		wantOk bool
+	}{
+		{
+			name:   "intersecting intervals",
+			i:      NumberInterval{Min: f(1), Max: f(10)},
+			j:      NumberInterval{Min: f(2), MinIsExcluded: true, Max: f(12)},
+			want:   NumberInterval{Min: f(2), MinIsExcluded: true, Max: f(10)},
+			wantOk: true,
+		},
+		{
+			name:   "same bounds with excluded endpoints",
+			i:      NumberInterval{Min: f(1), Max: f(5), MaxIsExcluded: true},
+			j:      NumberInterval{Min: f(1), MinIsExcluded: true, Max: f(5)},
+			want:   NumberInterval{Min: f(1), MinIsExcluded: true, Max: f(5), MaxIsExcluded: true},
+			wantOk: true,
+		},
+		{
+			name:   "touching at included endpoints",
+			i:      NumberInterval{Max: f(5)},
+			j:      NumberInterval{Min: f(5)},
+			want:   NumberInterval{Min: f(5), Max: f(5)},
+			wantOk: true,
+		},
+		{
+			name:   "touching at excluded endpoint",
+			i:      NumberInterval{Min: f(1), Max: f(5), MaxIsExcluded: true},
+			j:      NumberInterval{Min: f(5)},
+			wantOk: false,
+		},
+		{
+			name:   "disjoint intervals",
+			i:      NumberInterval{Min: f(1), Max: f(2)},
+			j:      NumberInterval{Min: f(3), Max: f(4)},
+			wantOk: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.i.Intersect(tt.j)
+			assert.Equal(t, tt.wantOk, ok)
+			if ok {
+				assert.Equal(t, tt.want, got)
+			}
+			got, ok = tt.j.Intersect(tt.i)
+			assert.Equal(t, tt.wantOk, ok)
+			if ok {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMergeNumberIntervals(t *testing.T) {
+	f := Float64Ptr
+
+	tests := []struct {
+		name      string
+		intervals []NumberInterval
+		want      []NumberInterval
+	}{
+		{
+			name:      "no intervals",
+			intervals: nil,
+			want:      nil,
+		},
+		{
+			name: "overlapping and adjacent intervals",
+			intervals: []NumberInterval{
+				{Min: f(1), Max: f(5), MaxIsExcluded: true},
+				{Min: f(5), Max: f(8)},
+				{Min: f(3), Max: f(4)},
+			},
+			want: []NumberInterval{
+				{Min: f(1), Max: f(8)},
+			},
+		},
+		{
+			name: "adjacent within precision",
+			intervals: []NumberInterval{
+				{Min: f(2.00000000001), MinIsExcluded: true, Max: f(3)},
+				{Min: f(1), Max: f(2)},
+			},
+			want: []NumberInterval{
+				{Min: f(1), Max: f(3)},
+			},
+		},
+		{
+			name: "both endpoints excluded",
+			intervals: []NumberInterval{
+				{Min: f(2), MinIsExcluded: true, Max: f(3)},
+				{Min: f(1), Max: f(2), MaxIsExcluded: true},
+			},
+			want: []NumberInterval{
+				{Min: f(1), Max: f(2), MaxIsExcluded: true},
+				{Min: f(2), MinIsExcluded: true, Max: f(3)},
+			},
+		},
+		{
+			name: "unbounded and empty intervals",
+			intervals: []NumberInterval{
+				{Min: f(10)},
+				{Min: f(5), MinIsExcluded: true, Max: f(5)},
+				{Max: f(0)},
+				{Min: f(-1), Max: f(1)},
+			},
+			want: []NumberInterval{
+				{Max: f(1)},
+				{Min: f(10)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, MergeNumberIntervals(tt.intervals))
+		})
+	}
+}
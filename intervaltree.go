@@ -0,0 +1,360 @@
+package matchtree
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// intervalTreeBuildMutex serializes the builds of interval trees by concurrent searches, which
+// only contend on the first search after inserts.
+var intervalTreeBuildMutex sync.Mutex
+
+// integerIntervalTree indexes values by IntegerIntervals for point stabbing queries.
+// Intervals are kept sorted by their lower bounds, and a segment tree maintains the maximum
+// upper bound of each range of intervals, so that a query runs in O(log n) plus O(log n) per match.
+// The segment tree is built on the first search after inserts rather than on every insert, so that
+// inserting many intervals in a row does not rebuild it each time.
+type integerIntervalTree[V any] struct {
+	entries        []integerIntervalTreeEntry[V]
+	maxUpperBounds []int64
+	numberOfLeaves int
+	isBuilt        uint32 // accessed atomically, as searches may build the tree concurrently
+}
+
+type integerIntervalTreeEntry[V any] struct {
+	LowerBound int64
+	UpperBound int64
+	Value      V
+}
+
+// integerIntervalBounds converts the interval into inclusive lower and upper bounds.
+// It returns false if the interval contains no integer.
+func integerIntervalBounds(i IntegerInterval) (int64, int64, bool) {
+	lowerBound := int64(math.MinInt64)
+	if i.Min != nil {
+		lowerBound = *i.Min
+		if i.MinIsExcluded {
+			if lowerBound == math.MaxInt64 {
+				return 0, 0, false
+			}
+			lowerBound++
+		}
+	}
+	upperBound := int64(math.MaxInt64)
+	if i.Max != nil {
+		upperBound = *i.Max
+		if i.MaxIsExcluded {
+			if upperBound == math.MinInt64 {
+				return 0, 0, false
+			}
+			upperBound--
+		}
+	}
+	if lowerBound > upperBound {
+		return 0, 0, false
+	}
+	return lowerBound, upperBound, true
+}
+
+// Insert adds the value indexed by the interval.
+// Values of intervals with the same lower bound are kept in insertion order.
+func (t *integerIntervalTree[V]) Insert(interval IntegerInterval, value V) {
+	lowerBound, upperBound, ok := integerIntervalBounds(interval)
+	if !ok {
+		return
+	}
+	i := t.countEntries(lowerBound)
+	t.entries = slices.Insert(t.entries, i, integerIntervalTreeEntry[V]{
+		LowerBound: lowerBound,
+		UpperBound: upperBound,
+		Value:      value,
+	})
+	atomic.StoreUint32(&t.isBuilt, 0)
+}
+
+// countEntries returns the number of entries whose lower bounds are not greater than x.
+func (t *integerIntervalTree[V]) countEntries(x int64) int {
+	i, j := 0, len(t.entries)
+	for i < j {
+		k := int(uint(i+j) >> 1)
+		if t.entries[k].LowerBound <= x {
+			i = k + 1
+		} else {
+			j = k
+		}
+	}
+	return i
+}
+
+func (t *integerIntervalTree[V]) rebuild() {
+	numberOfLeaves := 1
+	for numberOfLeaves < len(t.entries) {
+		numberOfLeaves *= 2
+	}
+	maxUpperBounds := t.maxUpperBounds
+	if cap(maxUpperBounds) >= 2*numberOfLeaves {
+		maxUpperBounds = maxUpperBounds[:2*numberOfLeaves]
+	} else {
+		maxUpperBounds = make([]int64, 2*numberOfLeaves)
+	}
+	for i := range numberOfLeaves {
+		if i < len(t.entries) {
+			maxUpperBounds[numberOfLeaves+i] = t.entries[i].UpperBound
+		} else {
+			maxUpperBounds[numberOfLeaves+i] = math.MinInt64
+		}
+	}
+	for i := numberOfLeaves - 1; i >= 1; i-- {
+		maxUpperBounds[i] = max(maxUpperBounds[2*i], maxUpperBounds[2*i+1])
+	}
+	t.maxUpperBounds = maxUpperBounds
+	t.numberOfLeaves = numberOfLeaves
+}
+
+// Build builds the segment tree if intervals were inserted since it was last built. Searches
+// build it when needed, so calling Build only spares the first search the work.
+func (t *integerIntervalTree[V]) Build() {
+	if atomic.LoadUint32(&t.isBuilt) == 1 {
+		return
+	}
+	intervalTreeBuildMutex.Lock()
+	defer intervalTreeBuildMutex.Unlock()
+	if atomic.LoadUint32(&t.isBuilt) == 0 {
+		t.rebuild()
+		atomic.StoreUint32(&t.isBuilt, 1)
+	}
+}
+
+// Compact builds the segment tree and trims the spare capacity of the internal slices.
+func (t *integerIntervalTree[V]) Compact() {
+	t.Build()
+	t.entries = slices.Clip(t.entries)
+	t.maxUpperBounds = slices.Clip(t.maxUpperBounds)
+}
+
+// Search calls callback for each value whose interval contains x, ordered by the lower bounds of
+// the intervals, until callback returns false. It returns false if callback returned false.
+func (t *integerIntervalTree[V]) Search(x int64, callback func(V) bool) bool {
+	n := t.countEntries(x)
+	if n == 0 {
+		return true
+	}
+	t.Build()
+	return t.doSearch(1, 0, t.numberOfLeaves, n, x, callback)
+}
+
+func (t *integerIntervalTree[V]) doSearch(node int, begin int, end int, n int, x int64, callback func(V) bool) bool {
+	if begin >= n || t.maxUpperBounds[node] < x {
+		return true
+	}
+	if end-begin == 1 {
+		return callback(t.entries[begin].Value)
+	}
+	middle := (begin + end) / 2
+	return t.doSearch(2*node, begin, middle, n, x, callback) &&
+		t.doSearch(2*node+1, middle, end, n, x, callback)
+}
+
+// numberIntervalTree indexes values by NumberIntervals for point stabbing queries.
+// It works like integerIntervalTree, but each bound of an interval is shifted by epsilon and
+// may be strict, exactly as NumberInterval.Contains compares x with the bounds.
+type numberIntervalTree[V any] struct {
+	entries        []numberIntervalTreeEntry[V]
+	maxUpperBounds []numberBound
+	numberOfLeaves int
+	isBuilt        uint32
+}
+
+type numberIntervalTreeEntry[V any] struct {
+	LowerBound numberBound
+	UpperBound numberBound
+	Value      V
+}
+
+// numberBound represents a bound of a NumberInterval after being shifted by epsilon.
+type numberBound struct {
+	Value    float64
+	IsStrict bool
+}
+
+// numberIntervalBounds converts the interval into lower and upper bounds.
+// Any NaN bound is treated as unbounded, as NumberInterval.Contains never fails on it.
+func numberIntervalBounds(i NumberInterval) (numberBound, numberBound) {
+	lowerBound := numberBound{Value: math.Inf(-1)}
+	if i.Min != nil && !math.IsNaN(*i.Min) {
+		if i.MinIsExcluded {
+			lowerBound = numberBound{Value: *i.Min + epsilon, IsStrict: true}
+		} else {
+			lowerBound = numberBound{Value: *i.Min - epsilon}
+		}
+	}
+	upperBound := numberBound{Value: math.Inf(1)}
+	if i.Max != nil && !math.IsNaN(*i.Max) {
+		if i.MaxIsExcluded {
+			upperBound = numberBound{Value: *i.Max - epsilon, IsStrict: true}
+		} else {
+			upperBound = numberBound{Value: *i.Max + epsilon}
+		}
+	}
+	return lowerBound, upperBound
+}
+
+// compareLowerBounds orders lower bounds by how many numbers they admit, most first.
+func compareLowerBounds(x, y numberBound) int {
+	if x.Value < y.Value {
+		return -1
+	}
+	if x.Value > y.Value {
+		return 1
+	}
+	if x.IsStrict == y.IsStrict {
+		return 0
+	}
+	if x.IsStrict {
+		return 1
+	}
+	return -1
+}
+
+// compareUpperBounds orders upper bounds by how many numbers they admit, fewest first.
+func compareUpperBounds(x, y numberBound) int {
+	if x.Value < y.Value {
+		return -1
+	}
+	if x.Value > y.Value {
+		return 1
+	}
+	if x.IsStrict == y.IsStrict {
+		return 0
+	}
+	if x.IsStrict {
+		return -1
+	}
+	return 1
+}
+
+func (b numberBound) AdmitsAsLowerBound(x float64) bool {
+	return x > b.Value || (x == b.Value && !b.IsStrict)
+}
+
+func (b numberBound) AdmitsAsUpperBound(x float64) bool {
+	return x < b.Value || (x == b.Value && !b.IsStrict)
+}
+
+// Insert adds the value indexed by the interval.
+// Values of intervals with the same lower bound are kept in insertion order.
+func (t *numberIntervalTree[V]) Insert(interval NumberInterval, value V) {
+	lowerBound, upperBound := numberIntervalBounds(interval)
+	i, j := 0, len(t.entries)
+	for i < j {
+		k := int(uint(i+j) >> 1)
+		if compareLowerBounds(t.entries[k].LowerBound, lowerBound) <= 0 {
+			i = k + 1
+		} else {
+			j = k
+		}
+	}
+	t.entries = slices.Insert(t.entries, i, numberIntervalTreeEntry[V]{
+		LowerBound: lowerBound,
+		UpperBound: upperBound,
+		Value:      value,
+	})
+	atomic.StoreUint32(&t.isBuilt, 0)
+}
+
+// countEntries returns the number of entries whose lower bounds admit x.
+func (t *numberIntervalTree[V]) countEntries(x float64) int {
+	i, j := 0, len(t.entries)
+	for i < j {
+		k := int(uint(i+j) >> 1)
+		if t.entries[k].LowerBound.AdmitsAsLowerBound(x) {
+			i = k + 1
+		} else {
+			j = k
+		}
+	}
+	return i
+}
+
+func (t *numberIntervalTree[V]) rebuild() {
+	numberOfLeaves := 1
+	for numberOfLeaves < len(t.entries) {
+		numberOfLeaves *= 2
+	}
+	maxUpperBounds := t.maxUpperBounds
+	if cap(maxUpperBounds) >= 2*numberOfLeaves {
+		maxUpperBounds = maxUpperBounds[:2*numberOfLeaves]
+	} else {
+		maxUpperBounds = make([]numberBound, 2*numberOfLeaves)
+	}
+	for i := range numberOfLeaves {
+		if i < len(t.entries) {
+			maxUpperBounds[numberOfLeaves+i] = t.entries[i].UpperBound
+		} else {
+			maxUpperBounds[numberOfLeaves+i] = numberBound{Value: math.Inf(-1), IsStrict: true}
+		}
+	}
+	for i := numberOfLeaves - 1; i >= 1; i-- {
+		maxUpperBounds[i] = maxUpperBounds[2*i]
+		if compareUpperBounds(maxUpperBounds[2*i+1], maxUpperBounds[i]) > 0 {
+			maxUpperBounds[i] = maxUpperBounds[2*i+1]
+		}
+	}
+	t.maxUpperBounds = maxUpperBounds
+	t.numberOfLeaves = numberOfLeaves
+}
+
+// Build builds the segment tree if intervals were inserted since it was last built. Searches
+// build it when needed, so calling Build only spares the first search the work.
+func (t *numberIntervalTree[V]) Build() {
+	if atomic.LoadUint32(&t.isBuilt) == 1 {
+		return
+	}
+	intervalTreeBuildMutex.Lock()
+	defer intervalTreeBuildMutex.Unlock()
+	if atomic.LoadUint32(&t.isBuilt) == 0 {
+		t.rebuild()
+		atomic.StoreUint32(&t.isBuilt, 1)
+	}
+}
+
+// Compact builds the segment tree and trims the spare capacity of the internal slices.
+func (t *numberIntervalTree[V]) Compact() {
+	t.Build()
+	t.entries = slices.Clip(t.entries)
+	t.maxUpperBounds = slices.Clip(t.maxUpperBounds)
+}
+
+// Search calls callback for each value whose interval contains x, ordered by the lower bounds of
+// the intervals, until callback returns false. It returns false if callback returned false.
+func (t *numberIntervalTree[V]) Search(x float64, callback func(V) bool) bool {
+	if math.IsNaN(x) {
+		// NumberInterval.Contains never fails on NaN
+		for i := range t.entries {
+			if !callback(t.entries[i].Value) {
+				return false
+			}
+		}
+		return true
+	}
+	n := t.countEntries(x)
+	if n == 0 {
+		return true
+	}
+	t.Build()
+	return t.doSearch(1, 0, t.numberOfLeaves, n, x, callback)
+}
+
+func (t *numberIntervalTree[V]) doSearch(node int, begin int, end int, n int, x float64, callback func(V) bool) bool {
+	if begin >= n || !t.maxUpperBounds[node].AdmitsAsUpperBound(x) {
+		return true
+	}
+	if end-begin == 1 {
+		return callback(t.entries[begin].Value)
+	}
+	middle := (begin + end) / 2
+	return t.doSearch(2*node, begin, middle, n, x, callback) &&
+		t.doSearch(2*node+1, middle, end, n, x, callback)
+}
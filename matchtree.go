@@ -1,12 +1,26 @@
 package matchtree
 
 import (
+	"cmp"
+	"context"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"iter"
+	"maps"
 	"math"
+	"math/rand"
+	"reflect"
 	"regexp"
 	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
 )
 
 // MatchTree is a generic tree structure for efficient pattern matching.
@@ -16,6 +30,59 @@ type MatchTree[T any] struct {
 	compiledRegexps map[string]*regexp.Regexp
 	values          []T
 	root            matchNode
+	lastRuleID      RuleID
+	rules           map[RuleID]ruleLocation
+	valueEqual      func(x, y T) bool
+	valueKey        func(T) string
+	stringForm      *norm.Form
+	maxExpansion    int
+	metrics         MetricsHooks
+	visitCounts     *visitCounts // nil if not counting visits
+}
+
+// ErrRuleNotFound is returned by the operations taking a RuleID that no rule in the tree has.
+var ErrRuleNotFound = errors.New("matchtree: rule not found")
+
+// ErrPatternCountMismatch is returned, wrapped, when a rule has more or fewer patterns than the
+// tree has types.
+var ErrPatternCountMismatch = errors.New("matchtree: unexpected number of match patterns")
+
+// ErrKeyCountMismatch is returned, wrapped, when a search is given more or fewer keys than the
+// tree has types.
+var ErrKeyCountMismatch = errors.New("matchtree: unexpected number of match keys")
+
+// ErrMisalignedTree is returned, wrapped, when a search ends on a node that is not a leaf node,
+// e.g. because a CustomMatchNode returns a child of a node at another depth, instead of a panic.
+var ErrMisalignedTree = errors.New("matchtree: search ended on a non-leaf node")
+
+// wrapError wraps the error with the context it occurred in, as "matchtree: <context>: <message>",
+// where the message of the error drops its own "matchtree: " prefix.
+func wrapError(err error, format string, args ...any) error {
+	return &wrappedError{context: fmt.Sprintf(format, args...), err: err}
+}
+
+type wrappedError struct {
+	context string
+	err     error
+}
+
+func (e *wrappedError) Error() string {
+	return "matchtree: " + e.context + ": " + strings.TrimPrefix(e.err.Error(), "matchtree: ")
+}
+
+func (e *wrappedError) Unwrap() error { return e.err }
+
+// TypeMismatchError is returned when a pattern of a rule, or a key of a search, is not of the
+// MatchType of the tree at its index.
+type TypeMismatchError struct {
+	Index    int // 0-based
+	Expected MatchType
+	Actual   MatchType
+}
+
+// Error implements the error interface.
+func (e *TypeMismatchError) Error() string {
+	return fmt.Sprintf("matchtree: unexpected match type #%d; expected=%v actual=%v", e.Index+1, e.Expected, e.Actual)
 }
 
 // MatchType defines the type of data a pattern or key represents.
@@ -34,6 +101,17 @@ const (
 	MatchNumberInterval
 	// MatchRegexp represents a regular expression type.
 	MatchRegexp
+	// MatchEnum represents an enumeration type, whose values are named integer codes.
+	MatchEnum
+	// MatchBytes represents a byte slice type.
+	MatchBytes
+	// MatchSemverRange represents a semantic version range type.
+	MatchSemverRange
+	// MatchGlob represents a glob type, matching strings with "?" and "*" wildcards.
+	MatchGlob
+	// MatchNumeric represents an integer type matching both exact integers and integer intervals,
+	// so that a pattern can mix them.
+	MatchNumeric
 	// NumberOfMatchTypes indicates the total number of defined match types.
 	NumberOfMatchTypes = int(iota)
 )
@@ -45,6 +123,11 @@ var matchType2String = [NumberOfMatchTypes]string{
 	MatchIntegerInterval: "INTEGER_INTERVAL",
 	MatchNumberInterval:  "NUMBER_INTERVAL",
 	MatchRegexp:          "REGEXP",
+	MatchEnum:            "ENUM",
+	MatchBytes:           "BYTES",
+	MatchSemverRange:     "SEMVER_RANGE",
+	MatchGlob:            "GLOB",
+	MatchNumeric:         "NUMERIC",
 }
 
 // String returns the string representation of a MatchType.
@@ -53,6 +136,9 @@ func (t MatchType) String() string {
 	if i >= 0 && i < NumberOfMatchTypes {
 		return matchType2String[t]
 	}
+	if name, ok := customMatchTypeName(t); ok {
+		return name
+	}
 	return fmt.Sprintf("UNKNOWN(%d)", i)
 }
 
@@ -63,78 +149,192 @@ func ParseMatchType(s string) (MatchType, error) {
 			return MatchType(i), nil
 		}
 	}
+	if t, ok := parseCustomMatchType(s); ok {
+		return t, nil
+	}
 	return 0, fmt.Errorf("matchtree: unknown match type %q", s)
 }
 
-// MarshalJSON marshals the MatchType to its string representation.
-func (t MatchType) MarshalJSON() ([]byte, error) { return json.Marshal(t.String()) }
+// AllMatchTypes returns the MatchTypes a MatchTree can be made of, i.e. the built-in ones except
+// MatchNone, in the order of their values, followed by the custom ones registered so far.
+func AllMatchTypes() []MatchType {
+	customMatchTypes.RLock()
+	defer customMatchTypes.RUnlock()
+	types := make([]MatchType, 0, NumberOfMatchTypes-1+len(customMatchTypes.Names))
+	for i := 1; i < NumberOfMatchTypes+len(customMatchTypes.Names); i++ {
+		types = append(types, MatchType(i))
+	}
+	return types
+}
 
-// UnmarshalJSON unmarshals a JSON string into a MatchType.
-func (t *MatchType) UnmarshalJSON(data []byte) error {
-	var s string
-	if err := json.Unmarshal(data, &s); err != nil {
-		return err
+// IsValid reports whether the MatchType is one a MatchTree can be made of, i.e. a built-in one
+// except MatchNone, or a registered custom one.
+func (t MatchType) IsValid() bool {
+	i := int(t)
+	if i >= 1 && i < NumberOfMatchTypes {
+		return true
 	}
-	var err error
-	*t, err = ParseMatchType(s)
-	return err
+	return isCustomMatchType(t)
 }
 
 // NewMatchTree creates a new MatchTree with the specified sequence of MatchTypes.
 // The order of types matters and defines the structure of the tree.
-func NewMatchTree[T any](types []MatchType) *MatchTree[T] {
+// It panics if any of the types is unknown; see NewMatchTreeChecked for a non-panicking variant.
+func NewMatchTree[T any](types []MatchType, optionFuncs ...MatchTreeOptionFunc[T]) *MatchTree[T] {
+	t, err := NewMatchTreeChecked(types, optionFuncs...)
+	if err != nil {
+		panic(err.Error())
+	}
+	return t
+}
+
+// NewMatchTreeChecked is like NewMatchTree but returns an error instead of panicking
+// if any of the types is unknown.
+func NewMatchTreeChecked[T any](types []MatchType, optionFuncs ...MatchTreeOptionFunc[T]) (*MatchTree[T], error) {
 	for i, type1 := range types {
-		switch type1 {
-		case MatchString, MatchInteger, MatchIntegerInterval, MatchNumberInterval, MatchRegexp:
-		default:
-			panic(fmt.Sprintf("matchtree: unknown match type #%d: %v", i+1, type1))
+		if !type1.IsValid() {
+			return nil, fmt.Errorf("matchtree: unknown match type #%d: %v", i+1, type1)
 		}
 	}
-	return &MatchTree[T]{
-		types: types,
+	options := matchTreeOptions[T]{
+		MaxExpansion: DefaultMaxLeaves,
+	}
+	for _, optionFunc := range optionFuncs {
+		options = optionFunc(options)
+	}
+	t := &MatchTree[T]{
+		types:        types,
+		valueEqual:   options.ValueEqual,
+		valueKey:     options.ValueKey,
+		stringForm:   options.StringForm,
+		maxExpansion: options.MaxExpansion,
+		metrics:      options.Metrics,
+	}
+	if t.maxExpansion <= 0 {
+		t.maxExpansion = DefaultMaxLeaves
+	}
+	if options.CountVisits {
+		t.visitCounts = new(visitCounts)
+	}
+	return t, nil
+}
+
+// MatchTreeOptionFunc defines a function type for configuring a MatchTree on creation.
+type MatchTreeOptionFunc[T any] func(matchTreeOptions[T]) matchTreeOptions[T]
+
+type matchTreeOptions[T any] struct {
+	ValueEqual   func(x, y T) bool
+	ValueKey     func(T) string
+	StringForm   *norm.Form
+	MaxExpansion int
+	Metrics      MetricsHooks
+	CountVisits  bool
+}
+
+// WithMaxExpansion configures the MatchTree to reject, before changing anything, a rule whose
+// patterns expand into more than n leaf paths, i.e. whose product of the numbers of values of the
+// exact patterns exceeds n, instead of DefaultMaxLeaves. This guards a tree ingesting untrusted
+// rules against running out of memory. An n of 0 or less leaves DefaultMaxLeaves in effect.
+func WithMaxExpansion[T any](n int) MatchTreeOptionFunc[T] {
+	return func(o matchTreeOptions[T]) matchTreeOptions[T] {
+		o.MaxExpansion = n
+		return o
+	}
+}
+
+// WithValueDedup configures the MatchTree to collapse the values of search results that are equal
+// as per the function, keeping the first one in the order of priority, while by default only the
+// value of the same rule is deduplicated. It applies to Search and its variants, except SearchAll
+// and SearchDetailed, and to the FrozenMatchTree frozen from the MatchTree.
+// Each value is compared with all the values kept before it, so a search matching n rules costs
+// O(n²) calls to the function.
+func WithValueDedup[T any](equal func(x, y T) bool) MatchTreeOptionFunc[T] {
+	return func(o matchTreeOptions[T]) matchTreeOptions[T] {
+		o.ValueEqual = equal
+		return o
+	}
+}
+
+// WithValueKey configures the MatchTree to collapse the values of search results with the same
+// key as per the function, like WithValueDedup but for values, such as structs or pointers, that
+// are told apart by a key derived from them: the keys seen are kept in a map, so a search matching
+// n rules costs O(n) calls to the function. It takes precedence over WithValueDedup. Without either
+// option, only the value of the same rule is deduplicated.
+func WithValueKey[T any](key func(T) string) MatchTreeOptionFunc[T] {
+	return func(o matchTreeOptions[T]) matchTreeOptions[T] {
+		o.ValueKey = key
+		return o
 	}
 }
 
 // MatchRule represents a single rule to be added to the MatchTree.
 // It consists of a sequence of patterns, a value to associate, and a priority.
 type MatchRule[T any] struct {
-	Patterns []MatchPattern `json:"patterns"`
-	Value    T              `json:"value"`
-	Priority int            `json:"priority"`
+	Patterns []MatchPattern `json:"patterns" yaml:"patterns" msgpack:"patterns"`
+	Value    T              `json:"value" yaml:"value" msgpack:"value"`
+	Priority int64          `json:"priority" yaml:"priority" msgpack:"priority"`
+
+	// Weight is the relative chance of the value to be picked by SearchWeightedOne among the
+	// values of the same priority; a Weight less than 1 counts as 1.
+	Weight int `json:"weight,omitempty" yaml:"weight,omitempty" msgpack:"weight,omitempty"`
+
+	// ExpiresAt is the time from which the rule no longer matches in SearchAt, if not nil.
+	ExpiresAt *time.Time `json:"expires_at,omitempty" yaml:"expires_at,omitempty" msgpack:"expires_at,omitempty"`
+
+	// Labels carries metadata of the rule (e.g. source or owner) that is not matched on but
+	// returned by SearchDetailed.
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty" msgpack:"labels,omitempty"`
 }
 
 // MatchPattern defines a single pattern within a MatchRule.
 // It can be an 'any' pattern, an 'inverse' pattern, or a specific value/interval pattern.
 type MatchPattern struct {
-	Type MatchType `json:"type"`
+	Type MatchType `json:"type" yaml:"type" msgpack:"type"`
 
 	// IsAny indicates if this pattern matches any value for its type.
-	IsAny bool `json:"is_any"`
+	IsAny bool `json:"is_any" yaml:"is_any" msgpack:"is_any"`
 
 	// IsInverse indicates if this pattern matches any value NOT in its specified list/intervals.
-	IsInverse bool `json:"is_inverse"`
+	// An inverse pattern with an empty list/intervals excludes nothing, and thus is equivalent to IsAny.
+	IsInverse bool `json:"is_inverse" yaml:"is_inverse" msgpack:"is_inverse"`
 
-	// Strings for MatchString type.
-	Strings []string `json:"strings"`
+	// Strings for MatchString type, or the names of the values for MatchEnum type.
+	Strings []string `json:"strings" yaml:"strings" msgpack:"strings"`
 
-	// Integers for MatchInteger type.
-	Integers []int64 `json:"integers"`
+	// Integers for MatchInteger, MatchNumeric types.
+	Integers []int64 `json:"integers" yaml:"integers" msgpack:"integers"`
 
-	// IntegerIntervals for MatchIntegerInterval type.
-	IntegerIntervals []IntegerInterval `json:"integer_intervals"`
+	// IntegerIntervals for MatchIntegerInterval, MatchNumeric types.
+	IntegerIntervals []IntegerInterval `json:"integer_intervals" yaml:"integer_intervals" msgpack:"integer_intervals"`
 
 	// NumberIntervals for MatchNumberInterval type.
-	NumberIntervals []NumberInterval `json:"number_intervals"`
+	NumberIntervals []NumberInterval `json:"number_intervals" yaml:"number_intervals" msgpack:"number_intervals"`
 
 	// Regexp for MatchRegexp type.
-	Regexp         string `json:"regexp"`
+	Regexp         string `json:"regexp" yaml:"regexp" msgpack:"regexp"`
 	compiledRegexp *regexp.Regexp
 
+	// ByteSlices for MatchBytes type.
+	ByteSlices [][]byte `json:"byte_slices,omitempty" yaml:"byte_slices,omitempty" msgpack:"byte_slices,omitempty"`
+
+	// VersionConstraint for MatchSemverRange type, e.g. ">=1.2.0 <2.0.0" (see ParseVersionConstraint).
+	VersionConstraint string `json:"version_constraint,omitempty" yaml:"version_constraint,omitempty" msgpack:"version_constraint,omitempty"`
+	versionRanges     []VersionRange
+
+	// Glob for MatchGlob type, e.g. "user-?-*" (see MatchGlob).
+	Glob string `json:"glob,omitempty" yaml:"glob,omitempty" msgpack:"glob,omitempty"`
+
+	// EnumCodes maps the names in Strings to their codes for MatchEnum type.
+	// Keys of MatchEnum type carry codes in Integer, and match the patterns by code like
+	// MatchInteger, while the names show in Explain and WriteDOT.
+	EnumCodes map[string]int64 `json:"enum_codes,omitempty" yaml:"enum_codes,omitempty" msgpack:"enum_codes,omitempty"`
+
 	// internal fields for pattern walking
 	currentString          string
 	currentInteger         int64
 	currentIntegerInterval IntegerInterval
 	currentNumberInterval  NumberInterval
+	currentIsInteger       bool // whether the current value of a MatchNumeric pattern is an integer
 }
 
 // IsEmpty checks if the MatchPattern is empty (i.e., has no specific matching criteria).
@@ -142,146 +342,293 @@ func (p *MatchPattern) IsEmpty() bool {
 	return p.Type == 0 &&
 		p.IsAny == false &&
 		p.IsInverse == false &&
-		len(p.Strings)+len(p.Integers)+len(p.IntegerIntervals)+len(p.NumberIntervals)+len(p.Regexp) == 0
+		len(p.Strings)+len(p.Integers)+len(p.IntegerIntervals)+len(p.NumberIntervals)+len(p.Regexp)+len(p.ByteSlices)+len(p.VersionConstraint)+len(p.Glob) == 0
 }
 
-// IntegerInterval represents a closed, open, or half-open interval for integers.
-type IntegerInterval struct {
-	Min           *int64 `json:"min"`
-	MinIsExcluded bool   `json:"min_is_excluded"`
-	Max           *int64 `json:"max"`
-	MaxIsExcluded bool   `json:"max_is_excluded"`
+// hasEmptyValueList reports whether the MatchPattern is of a type matched against a list of
+// values or intervals, and the list is empty.
+func (p *MatchPattern) hasEmptyValueList() bool {
+	switch p.Type {
+	case MatchString, MatchEnum:
+		return len(p.Strings) == 0
+	case MatchInteger:
+		return len(p.Integers) == 0
+	case MatchIntegerInterval:
+		return len(p.IntegerIntervals) == 0
+	case MatchNumberInterval:
+		return len(p.NumberIntervals) == 0
+	case MatchBytes:
+		return len(p.ByteSlices) == 0
+	case MatchSemverRange:
+		return p.VersionConstraint == ""
+	case MatchGlob:
+		return p.Glob == ""
+	case MatchNumeric:
+		return len(p.Integers) == 0 && len(p.IntegerIntervals) == 0
+	default:
+		return false
+	}
 }
 
-// Int64Ptr is a helper function to create a pointer to an int64 value.
-func Int64Ptr(x int64) *int64 { return &x }
-
-// Equals checks if two IntegerIntervals are equal.
-func (i IntegerInterval) Equals(other IntegerInterval) bool {
-	if !((i.Min == nil) == (other.Min == nil) &&
-		(i.Max == nil) == (other.Max == nil)) {
-		return false
+// Validate checks that the MatchPattern is well-formed: its type is known, it is not both any and
+// inverse, a pattern that is neither any nor inverse has values of its type, and no values of
+// other types are set.
+func (p *MatchPattern) Validate() error {
+	valueType := p.Type
+	switch p.Type {
+	case MatchString, MatchInteger, MatchIntegerInterval, MatchNumberInterval, MatchRegexp, MatchBytes, MatchSemverRange, MatchGlob, MatchNumeric:
+	case MatchEnum:
+		// enum match type takes values from strings
+		valueType = MatchString
+	default:
+		if !isCustomMatchType(p.Type) {
+			return fmt.Errorf("matchtree: unknown match type %v", p.Type)
+		}
+		// custom match types take values from strings
+		valueType = MatchString
+	}
+	if p.IsAny && p.IsInverse {
+		return fmt.Errorf("matchtree: %v pattern is both any and inverse", p.Type)
 	}
 
-	if i.Min != nil {
-		if *i.Min != *other.Min {
-			return false
+	fields := [...]struct {
+		Type   MatchType
+		Name   string
+		Length int
+	}{
+		{MatchString, "strings", len(p.Strings)},
+		{MatchInteger, "integers", len(p.Integers)},
+		{MatchIntegerInterval, "integer intervals", len(p.IntegerIntervals)},
+		{MatchNumberInterval, "number intervals", len(p.NumberIntervals)},
+		{MatchRegexp, "regexp", len(p.Regexp)},
+		{MatchBytes, "byte slices", len(p.ByteSlices)},
+		{MatchSemverRange, "version constraint", len(p.VersionConstraint)},
+		{MatchGlob, "glob", len(p.Glob)},
+		{MatchNumeric, "integers or integer intervals", len(p.Integers) + len(p.IntegerIntervals)},
+	}
+	for _, field := range fields {
+		if field.Type != valueType {
+			// numeric match type takes values from both integers and integer intervals, which are
+			// counted by its own field and checked by theirs for the other types
+			isNumericValue := field.Type == MatchNumeric ||
+				valueType == MatchNumeric && (field.Type == MatchInteger || field.Type == MatchIntegerInterval)
+			if field.Length >= 1 && !isNumericValue {
+				return fmt.Errorf("matchtree: unexpected %s for %v pattern", field.Name, p.Type)
+			}
+			continue
 		}
-		if i.MinIsExcluded != other.MinIsExcluded {
-			return false
+		if p.IsAny {
+			if field.Length >= 1 {
+				return fmt.Errorf("matchtree: unexpected %s for any %v pattern", field.Name, p.Type)
+			}
+			continue
+		}
+		if !p.IsInverse && field.Length == 0 {
+			return fmt.Errorf("matchtree: no %s for %v pattern", field.Name, p.Type)
 		}
 	}
 
-	if i.Max != nil {
-		if *i.Max != *other.Max {
-			return false
+	if p.Type == MatchRegexp && !p.IsAny {
+		if _, err := regexp.Compile(p.Regexp); err != nil {
+			return fmt.Errorf("matchtree: invalid regexp %q: %w", p.Regexp, err)
 		}
-		if i.MaxIsExcluded != other.MaxIsExcluded {
-			return false
+	}
+	if p.Type == MatchSemverRange && p.VersionConstraint != "" {
+		if _, err := ParseVersionConstraint(p.VersionConstraint); err != nil {
+			return err
 		}
 	}
-
-	return true
+	if p.Type == MatchGlob {
+		if err := checkGlob(p.Glob); err != nil {
+			return err
+		}
+	}
+	if p.Type == MatchEnum {
+		if err := p.checkEnumNames(); err != nil {
+			return err
+		}
+	} else if len(p.EnumCodes) >= 1 {
+		return fmt.Errorf("matchtree: unexpected enum codes for %v pattern", p.Type)
+	}
+	return nil
 }
 
-// Contains checks if the given integer `x` falls within the interval.
-func (i IntegerInterval) Contains(x int64) bool {
-	if i.Min != nil {
-		y := *i.Min
-		if i.MinIsExcluded {
-			if x <= y {
-				return false
-			}
-		} else {
-			if x < y {
-				return false
-			}
+// String returns a readable form of the MatchPattern for debugging, e.g. "STRING in {a,b}",
+// "STRING not in {x}", "STRING any" or "INTEGER_INTERVAL [1,5)".
+func (p MatchPattern) String() string {
+	if p.IsAny {
+		return p.Type.String() + " any"
+	}
+	items := formatPatternItems(&p, func(s string) string { return s })
+	if p.IsInverse {
+		return p.Type.String() + " not in {" + strings.Join(items, ",") + "}"
+	}
+	switch p.Type {
+	case MatchIntegerInterval, MatchNumberInterval, MatchRegexp, MatchSemverRange, MatchGlob, MatchNumeric:
+		if len(items) == 1 {
+			return p.Type.String() + " " + items[0]
 		}
 	}
-	if i.Max != nil {
-		y := *i.Max
-		if i.MaxIsExcluded {
-			if x >= y {
-				return false
-			}
-		} else {
-			if x > y {
-				return false
-			}
+	return p.Type.String() + " in {" + strings.Join(items, ",") + "}"
+}
+
+// checkEnumNames checks that the names of a MatchEnum pattern all have codes.
+func (p *MatchPattern) checkEnumNames() error {
+	for _, name := range p.Strings {
+		if _, ok := p.EnumCodes[name]; !ok {
+			return fmt.Errorf("matchtree: unknown enum name %q", name)
 		}
 	}
-	return true
+	return nil
 }
 
-// NumberInterval represents a closed, open, or half-open interval for floating-point numbers.
-type NumberInterval struct {
-	Min           *float64 `json:"min"`
-	MinIsExcluded bool     `json:"min_is_excluded"`
-	Max           *float64 `json:"max"`
-	MaxIsExcluded bool     `json:"max_is_excluded"`
+// AnyPattern creates a MatchPattern matching any value of the given type.
+func AnyPattern(type1 MatchType) MatchPattern { return MatchPattern{Type: type1, IsAny: true} }
+
+// StringsPattern creates a MatchPattern matching any of the strings.
+func StringsPattern(strings ...string) MatchPattern {
+	return MatchPattern{Type: MatchString, Strings: strings}
 }
 
-// Float64Ptr is a helper function to create a pointer to a float64 value.
-func Float64Ptr(x float64) *float64 { return &x }
+// InverseStringsPattern creates a MatchPattern matching any string not in the strings.
+func InverseStringsPattern(strings ...string) MatchPattern {
+	return MatchPattern{Type: MatchString, IsInverse: true, Strings: strings}
+}
 
-const epsilon = 1e-10
+// IntegersPattern creates a MatchPattern matching any of the integers.
+func IntegersPattern(integers ...int64) MatchPattern {
+	return MatchPattern{Type: MatchInteger, Integers: integers}
+}
 
-// Equals checks if two NumberIntervals are equal, considering floating-point precision.
-func (i NumberInterval) Equals(other NumberInterval) bool {
-	if !((i.Min == nil) == (other.Min == nil) &&
-		(i.Max == nil) == (other.Max == nil)) {
-		return false
-	}
+// InverseIntegersPattern creates a MatchPattern matching any integer not in the integers.
+func InverseIntegersPattern(integers ...int64) MatchPattern {
+	return MatchPattern{Type: MatchInteger, IsInverse: true, Integers: integers}
+}
 
-	if i.Min != nil {
-		if math.Abs(*i.Min-*other.Min) >= epsilon {
-			return false
-		}
-		if i.MinIsExcluded != other.MinIsExcluded {
-			return false
+// IntegerIntervalPattern creates a MatchPattern matching the integers in any of the intervals.
+func IntegerIntervalPattern(intervals ...IntegerInterval) MatchPattern {
+	return MatchPattern{Type: MatchIntegerInterval, IntegerIntervals: intervals}
+}
+
+// InverseIntegerIntervalPattern creates a MatchPattern matching the integers in none of the intervals.
+func InverseIntegerIntervalPattern(intervals ...IntegerInterval) MatchPattern {
+	return MatchPattern{Type: MatchIntegerInterval, IsInverse: true, IntegerIntervals: intervals}
+}
+
+// NumericPattern creates a MatchPattern of the MatchNumeric type matching any of the integers and
+// the integers in any of the intervals.
+func NumericPattern(integers []int64, intervals ...IntegerInterval) MatchPattern {
+	return MatchPattern{Type: MatchNumeric, Integers: integers, IntegerIntervals: intervals}
+}
+
+// InverseNumericPattern creates a MatchPattern of the MatchNumeric type matching the integers
+// neither in the integers nor in any of the intervals.
+func InverseNumericPattern(integers []int64, intervals ...IntegerInterval) MatchPattern {
+	return MatchPattern{Type: MatchNumeric, IsInverse: true, Integers: integers, IntegerIntervals: intervals}
+}
+
+// NumberIntervalPattern creates a MatchPattern matching the numbers in any of the intervals.
+func NumberIntervalPattern(intervals ...NumberInterval) MatchPattern {
+	return MatchPattern{Type: MatchNumberInterval, NumberIntervals: intervals}
+}
+
+// InverseNumberIntervalPattern creates a MatchPattern matching the numbers in none of the intervals.
+func InverseNumberIntervalPattern(intervals ...NumberInterval) MatchPattern {
+	return MatchPattern{Type: MatchNumberInterval, IsInverse: true, NumberIntervals: intervals}
+}
+
+// RegexpPattern creates a MatchPattern matching the strings matching the regular expression.
+func RegexpPattern(regexp string) MatchPattern {
+	return MatchPattern{Type: MatchRegexp, Regexp: regexp}
+}
+
+// InverseRegexpPattern creates a MatchPattern matching the strings not matching the regular expression.
+func InverseRegexpPattern(regexp string) MatchPattern {
+	return MatchPattern{Type: MatchRegexp, IsInverse: true, Regexp: regexp}
+}
+
+// BytesPattern creates a MatchPattern matching any of the byte slices.
+func BytesPattern(byteSlices ...[]byte) MatchPattern {
+	return MatchPattern{Type: MatchBytes, ByteSlices: byteSlices}
+}
+
+// InverseBytesPattern creates a MatchPattern matching any byte slice not in the byte slices.
+func InverseBytesPattern(byteSlices ...[]byte) MatchPattern {
+	return MatchPattern{Type: MatchBytes, IsInverse: true, ByteSlices: byteSlices}
+}
+
+// SemverRangePattern creates a MatchPattern matching the versions admitted by the version constraint.
+func SemverRangePattern(constraint string) MatchPattern {
+	return MatchPattern{Type: MatchSemverRange, VersionConstraint: constraint}
+}
+
+// InverseSemverRangePattern creates a MatchPattern matching the versions not admitted by the
+// version constraint.
+func InverseSemverRangePattern(constraint string) MatchPattern {
+	return MatchPattern{Type: MatchSemverRange, IsInverse: true, VersionConstraint: constraint}
+}
+
+// GlobPattern creates a MatchPattern matching the strings matching the glob.
+func GlobPattern(glob string) MatchPattern {
+	return MatchPattern{Type: MatchGlob, Glob: glob}
+}
+
+// InverseGlobPattern creates a MatchPattern matching the strings not matching the glob.
+func InverseGlobPattern(glob string) MatchPattern {
+	return MatchPattern{Type: MatchGlob, IsInverse: true, Glob: glob}
+}
+
+// EnumPattern creates a MatchPattern matching any of the enum values with the names, given
+// the codes of the names.
+func EnumPattern(codes map[string]int64, names ...string) MatchPattern {
+	return MatchPattern{Type: MatchEnum, Strings: names, EnumCodes: codes}
+}
+
+// InverseEnumPattern creates a MatchPattern matching any enum value without the names, given
+// the codes of the names.
+func InverseEnumPattern(codes map[string]int64, names ...string) MatchPattern {
+	return MatchPattern{Type: MatchEnum, IsInverse: true, Strings: names, EnumCodes: codes}
+}
+
+// AddStrings appends to the strings of the MatchPattern, e.g. of a MatchString pattern or the
+// names of a MatchEnum pattern, the ones it does not have yet, so that patterns can be built up
+// from several sources without duplicates.
+func (p *MatchPattern) AddStrings(strings ...string) {
+	for _, v := range strings {
+		if !slices.Contains(p.Strings, v) {
+			p.Strings = append(p.Strings, v)
 		}
 	}
+}
 
-	if i.Max != nil {
-		if math.Abs(*i.Max-*other.Max) >= epsilon {
-			return false
-		}
-		if i.MaxIsExcluded != other.MaxIsExcluded {
-			return false
+// AddIntegers appends to the integers of the MatchPattern the ones it does not have yet.
+func (p *MatchPattern) AddIntegers(integers ...int64) {
+	for _, v := range integers {
+		if !slices.Contains(p.Integers, v) {
+			p.Integers = append(p.Integers, v)
 		}
 	}
-
-	return true
 }
 
-// Contains checks if the given floating-point number `x` falls within the interval,
-// considering floating-point precision.
-func (i NumberInterval) Contains(x float64) bool {
-	if i.Min != nil {
-		y := *i.Min
-		if i.MinIsExcluded {
-			if x <= y+epsilon {
-				return false
-			}
-		} else {
-			if x < y-epsilon {
-				return false
-			}
+// AddIntegerIntervals appends to the integer intervals of the MatchPattern the ones it does not
+// have yet, as per IntegerInterval.Equals. Overlapping intervals are kept apart; AddRule merges
+// them.
+func (p *MatchPattern) AddIntegerIntervals(intervals ...IntegerInterval) {
+	for _, v := range intervals {
+		if !slices.ContainsFunc(p.IntegerIntervals, v.Equals) {
+			p.IntegerIntervals = append(p.IntegerIntervals, v)
 		}
 	}
-	if i.Max != nil {
-		y := *i.Max
-		if i.MaxIsExcluded {
-			if x >= y-epsilon {
-				return false
-			}
-		} else {
-			if x > y+epsilon {
-				return false
-			}
+}
+
+// AddNumberIntervals appends to the number intervals of the MatchPattern the ones it does not have
+// yet, as per NumberInterval.Equals. Overlapping intervals are kept apart; AddRule merges them.
+func (p *MatchPattern) AddNumberIntervals(intervals ...NumberInterval) {
+	for _, v := range intervals {
+		if !slices.ContainsFunc(p.NumberIntervals, v.Equals) {
+			p.NumberIntervals = append(p.NumberIntervals, v)
 		}
 	}
-	return true
 }
 
 // AddRuleOptionFunc defines a function type for configuring the AddRule operation.
@@ -289,8 +636,15 @@ type AddRuleOptionFunc func(addRuleOptions) addRuleOptions
 
 type addRuleOptions struct {
 	TreatEmptyPatternAsAny bool
+	DedupIdenticalRules    bool
+	MaxLeaves              int
+	SkipCloning            bool // set by AddRuleUnsafe only
 }
 
+// DefaultMaxLeaves is the maximum number of leaf paths that a rule may expand into by default,
+// i.e. the product of the numbers of values of its exact patterns.
+const DefaultMaxLeaves = 1 << 20
+
 // TreatEmptyPatternAsAny configures the AddRule operation to treat empty patterns as wildcards.
 func TreatEmptyPatternAsAny() AddRuleOptionFunc {
 	return func(o addRuleOptions) addRuleOptions {
@@ -299,865 +653,1610 @@ func TreatEmptyPatternAsAny() AddRuleOptionFunc {
 	}
 }
 
-// AddRule adds a new MatchRule to the MatchTree.
-// It returns an error if the rule's patterns do not match the tree's defined types.
-func (t *MatchTree[T]) AddRule(rule MatchRule[T], optionFuncs ...AddRuleOptionFunc) error {
+// WithDedupIdenticalRules configures the AddRule operation to hide the result added to a leaf node
+// that already has a result with an equal value (as reported by reflect.DeepEqual), the same
+// priority, weight, expiry and labels, so that re-adding an unchanged rule does not return its value
+// twice. The hidden result still belongs to the new rule: it takes the place of the identical one
+// when that is removed or disabled, so that each rule keeps matching on its own.
+func WithDedupIdenticalRules() AddRuleOptionFunc {
+	return func(o addRuleOptions) addRuleOptions {
+		o.DedupIdenticalRules = true
+		return o
+	}
+}
+
+// WithMaxLeaves configures the AddRule operation to reject a rule expanding into more than n leaf
+// paths, instead of the limit of the tree (see WithMaxExpansion). An n of 0 or less leaves the limit
+// of the tree in effect.
+func WithMaxLeaves(n int) AddRuleOptionFunc {
+	return func(o addRuleOptions) addRuleOptions {
+		o.MaxLeaves = n
+		return o
+	}
+}
+
+func makeAddRuleOptions(optionFuncs []AddRuleOptionFunc) addRuleOptions {
 	options := addRuleOptions{
 		TreatEmptyPatternAsAny: false,
+		DedupIdenticalRules:    false,
+		MaxLeaves:              0,
+		SkipCloning:            false,
 	}
 	for _, optionFunc := range optionFuncs {
 		options = optionFunc(options)
 	}
+	return options
+}
 
-	if len(rule.Patterns) != len(t.types) {
-		return fmt.Errorf("matchtree: unexpected number of match patterns; expected=%v actual=%v", len(t.types), len(rule.Patterns))
-	}
-	patterns := slices.Clone(rule.Patterns)
-	for i, pattern := range patterns {
-		type1 := t.types[i]
-		if pattern.IsEmpty() && options.TreatEmptyPatternAsAny {
-			patterns[i] = MatchPattern{
-				Type:  type1,
-				IsAny: true,
-			}
-		} else {
-			if pattern.Type != type1 {
-				return fmt.Errorf("matchtree: unexpected match type #%d; expected=%v actual=%v", i+1, type1, pattern.Type)
-			}
-		}
-	}
+// AddRule adds a new MatchRule to the MatchTree and returns the RuleID assigned to it.
+// It returns an error if the rule's patterns do not match the tree's defined types, i.e. one
+// wrapping ErrPatternCountMismatch or a *TypeMismatchError.
+func (t *MatchTree[T]) AddRule(rule MatchRule[T], optionFuncs ...AddRuleOptionFunc) (RuleID, error) {
+	options := makeAddRuleOptions(optionFuncs)
 
-	for i := range patterns {
-		pattern := &patterns[i]
-		switch pattern.Type {
-		case MatchString:
-			pattern.Strings = cloneStrings(pattern.Strings)
-		case MatchInteger:
-			pattern.Integers = cloneIntegers(pattern.Integers)
-		case MatchIntegerInterval:
-			pattern.IntegerIntervals = cloneIntegerIntervals(pattern.IntegerIntervals)
-		case MatchNumberInterval:
-			pattern.NumberIntervals = cloneNumberIntervals(pattern.NumberIntervals)
-		case MatchRegexp:
-			var err error
-			pattern.compiledRegexp, err = t.compileRegexp(pattern.Regexp)
-			if err != nil {
-				return fmt.Errorf("matchtree: invalid regexp %q", pattern.Regexp)
-			}
-		default:
-			panic("unreachable")
-		}
+	patterns, err := t.preparePatterns(rule.Patterns, options)
+	if err != nil {
+		return 0, err
 	}
+	t.lastRuleID++
+	id := t.lastRuleID
+	t.insertRule(id, -1, patterns, &rule, options)
+	return id, nil
+}
 
-	valueIndex := len(t.values)
-	t.values = append(t.values, rule.Value)
+// AddRuleUnsafe is like AddRule but, for bulk loads, skips copying the values of the patterns of
+// the rule and removing the duplicates among them. The caller must ensure that the values of each
+// pattern (strings, integers, enum names and so on) are distinct, and must not modify the slices
+// of the patterns afterwards, which the tree may keep referring to. Intervals are still merged.
+func (t *MatchTree[T]) AddRuleUnsafe(rule MatchRule[T], optionFuncs ...AddRuleOptionFunc) (RuleID, error) {
+	options := makeAddRuleOptions(optionFuncs)
+	options.SkipCloning = true
 
-	var walkPatterns func(int)
-	walkPatterns = func(i int) {
-		if i == len(patterns) {
-			t.doAddRule(patterns, valueIndex, rule.Priority)
-			return
-		}
+	patterns, err := t.preparePatterns(rule.Patterns, options)
+	if err != nil {
+		return 0, err
+	}
+	t.lastRuleID++
+	id := t.lastRuleID
+	t.insertRule(id, -1, patterns, &rule, options)
+	return id, nil
+}
 
-		pattern := &patterns[i]
-		if pattern.IsAny {
-			walkPatterns(i + 1)
-			return
-		}
-		if pattern.IsInverse {
-			walkPatterns(i + 1)
-			return
-		}
+// HasRule checks if the MatchRule is already in the MatchTree, i.e. if every leaf node its
+// patterns expand into, interpreted as by AddRule with the options, has a result with an equal
+// value (as reported by reflect.DeepEqual), the same priority, weight, expiry and labels, which is
+// what WithDedupIdenticalRules detects. It returns false for an invalid rule. Each child along the
+// way is looked up among all the children of its parent node, so it is meant for change
+// detection, such as on config reload, rather than for hot paths.
+func (t *MatchTree[T]) HasRule(rule MatchRule[T], optionFuncs ...AddRuleOptionFunc) bool {
+	options := makeAddRuleOptions(optionFuncs)
 
-		switch pattern.Type {
-		case MatchString:
-			for _, v := range pattern.Strings {
-				pattern.currentString = v
-				walkPatterns(i + 1)
-			}
-		case MatchInteger:
-			for _, v := range pattern.Integers {
-				pattern.currentInteger = v
-				walkPatterns(i + 1)
-			}
-		case MatchIntegerInterval:
-			for _, v := range pattern.IntegerIntervals {
-				pattern.currentIntegerInterval = v
-				walkPatterns(i + 1)
-			}
-		case MatchNumberInterval:
-			for _, v := range pattern.NumberIntervals {
-				pattern.currentNumberInterval = v
-				walkPatterns(i + 1)
-			}
-		case MatchRegexp:
-			walkPatterns(i + 1)
-		default:
-			panic("unreachable")
-		}
+	patterns, err := t.preparePatterns(rule.Patterns, options)
+	if err != nil {
+		return false
 	}
-	walkPatterns(0)
-	return nil
+	return t.hasRule(patterns, &rule)
 }
 
-func cloneStrings(s []string) []string {
-	clone := make([]string, 0, len(s))
-	for _, v := range s {
-		if slices.Contains(clone, v) {
-			continue
+// hasRule is HasRule with the prepared patterns of the rule.
+func (t *MatchTree[T]) hasRule(patterns []MatchPattern, rule *MatchRule[T]) bool {
+	result := matchResult{
+		Priority: rule.Priority,
+		Weight:   rule.Weight,
+		Expiry:   makeExpiry(rule.ExpiresAt),
+	}
+	for range selectPaths(patterns) {
+		leaf := t.findLeaf(patterns)
+		if leaf == nil || !slices.ContainsFunc(leaf.GetResults(), func(x matchResult) bool {
+			return !x.IsDisabled && t.isIdenticalResult(x, rule, result)
+		}) {
+			return false
 		}
-		clone = append(clone, v)
 	}
-	return clone
+	return true
 }
 
-func cloneIntegers(s []int64) []int64 {
-	clone := make([]int64, 0, len(s))
-	for _, v := range s {
-		if slices.Contains(clone, v) {
-			continue
-		}
-		clone = append(clone, v)
+// AddRuleIfAbsent is like AddRule with WithDedupIdenticalRules, but it also reports whether the
+// rule was newly added, i.e. whether any leaf node its patterns expand into did not have an enabled
+// result identical to it yet (see HasRule). A rule already present is not added at all, in which
+// case it returns a zero RuleID and false.
+func (t *MatchTree[T]) AddRuleIfAbsent(rule MatchRule[T], optionFuncs ...AddRuleOptionFunc) (RuleID, bool, error) {
+	options := makeAddRuleOptions(optionFuncs)
+	options.DedupIdenticalRules = true
+
+	patterns, err := t.preparePatterns(rule.Patterns, options)
+	if err != nil {
+		return 0, false, err
 	}
-	return clone
+	if t.hasRule(patterns, &rule) {
+		return 0, false, nil
+	}
+	t.lastRuleID++
+	id := t.lastRuleID
+	t.insertRule(id, -1, patterns, &rule, options)
+	return id, true, nil
 }
 
-func cloneIntegerIntervals(s []IntegerInterval) []IntegerInterval {
-	clone := make([]IntegerInterval, 0, len(s))
-	for _, v := range s {
-		if slices.ContainsFunc(clone, v.Equals) {
-			continue
+// AddRules adds the MatchRules to the MatchTree one by one, like AddRule.
+// Invalid rules are skipped while valid ones are still added, and the errors of all invalid rules,
+// each annotated with the rule's position, are returned joined with errors.Join.
+func (t *MatchTree[T]) AddRules(rules []MatchRule[T], optionFuncs ...AddRuleOptionFunc) error {
+	var errs []error
+	for i, rule := range rules {
+		if _, err := t.AddRule(rule, optionFuncs...); err != nil {
+			errs = append(errs, wrapError(err, "match rule #%d", i+1))
 		}
-		clone = append(clone, v)
 	}
-	return clone
+	return errors.Join(errs...)
 }
 
-func cloneNumberIntervals(s []NumberInterval) []NumberInterval {
-	clone := make([]NumberInterval, 0, len(s))
-	for _, v := range s {
-		if slices.ContainsFunc(clone, v.Equals) {
+// AddRulesStrict is like AddRules, but if any rule is invalid, no rule is added at all.
+func (t *MatchTree[T]) AddRulesStrict(rules []MatchRule[T], optionFuncs ...AddRuleOptionFunc) error {
+	options := makeAddRuleOptions(optionFuncs)
+
+	var errs []error
+	rulePatterns := make([][]MatchPattern, len(rules))
+	for i, rule := range rules {
+		patterns, err := t.preparePatterns(rule.Patterns, options)
+		if err != nil {
+			errs = append(errs, wrapError(err, "match rule #%d", i+1))
 			continue
 		}
-		clone = append(clone, v)
+		rulePatterns[i] = patterns
 	}
-	return clone
+	if len(errs) >= 1 {
+		return errors.Join(errs...)
+	}
+
+	for i, rule := range rules {
+		t.lastRuleID++
+		t.insertRule(t.lastRuleID, -1, rulePatterns[i], &rule, options)
+	}
+	return nil
 }
 
-func (t *MatchTree[T]) compileRegexp(regexp1 string) (*regexp.Regexp, error) {
-	compiledRegexps := t.compiledRegexps
-	if v, ok := compiledRegexps[regexp1]; ok {
-		return v, nil
+// AddRulesFromJSON reads a JSON array of MatchRules from r and adds them to the MatchTree one by one,
+// like AddRule, decoding each rule only when it is added, so the whole array is never held in memory.
+// It stops at the first malformed or invalid rule, returning an error annotated with the rule's position.
+// It returns the number of rules added.
+func (t *MatchTree[T]) AddRulesFromJSON(r io.Reader, optionFuncs ...AddRuleOptionFunc) (int, error) {
+	decoder := json.NewDecoder(r)
+	token, err := decoder.Token()
+	if err != nil {
+		return 0, fmt.Errorf("matchtree: read match rules: %w", err)
 	}
-	v, err := regexp.Compile(regexp1)
+	if token != json.Delim('[') {
+		return 0, fmt.Errorf("matchtree: unexpected token %v; expected=[", token)
+	}
+
+	n := 0
+	for decoder.More() {
+		var rule MatchRule[T]
+		if err := decoder.Decode(&rule); err != nil {
+			return n, wrapError(wrapError(err, "decode match rule"), "match rule #%d", n+1)
+		}
+		if _, err := t.AddRule(rule, optionFuncs...); err != nil {
+			return n, wrapError(err, "match rule #%d", n+1)
+		}
+		n++
+	}
+	if _, err := decoder.Token(); err != nil {
+		return n, fmt.Errorf("matchtree: read match rules: %w", err)
+	}
+	return n, nil
+}
+
+// RemoveRuleByID removes the rule with the RuleID from the MatchTree, so that searches no longer
+// return its value. The nodes created for the rule are kept, still to be reused by other rules.
+// It returns ErrRuleNotFound if no rule has the RuleID.
+func (t *MatchTree[T]) RemoveRuleByID(id RuleID) error {
+	location, ok := t.rules[id]
+	if !ok {
+		return fmt.Errorf("%w; id=%v", ErrRuleNotFound, id)
+	}
+	t.deleteRule(id, location)
+	return nil
+}
+
+// ReplaceRuleByID replaces the rule with the RuleID with the given MatchRule, keeping the RuleID
+// and the rule's place in the insertion order.
+// It returns ErrRuleNotFound if no rule has the RuleID, or an error like AddRule does if the new
+// rule is invalid, in which case the old rule is kept.
+func (t *MatchTree[T]) ReplaceRuleByID(id RuleID, rule MatchRule[T], optionFuncs ...AddRuleOptionFunc) error {
+	location, ok := t.rules[id]
+	if !ok {
+		return fmt.Errorf("%w; id=%v", ErrRuleNotFound, id)
+	}
+	options := makeAddRuleOptions(optionFuncs)
+
+	patterns, err := t.preparePatterns(rule.Patterns, options)
 	if err != nil {
-		return v, err
+		return err
 	}
-	if compiledRegexps == nil {
-		compiledRegexps = make(map[string]*regexp.Regexp, 1)
-		t.compiledRegexps = compiledRegexps
+	t.removeRule(id, location)
+	if location.ValueIndex >= 0 {
+		t.values[location.ValueIndex] = rule.Value
 	}
-	compiledRegexps[regexp1] = v
-	return v, nil
+	t.insertRule(id, location.ValueIndex, patterns, &rule, options)
+	if location.IsDisabled {
+		t.setRuleDisabled(id, true)
+	}
+	return nil
 }
 
-func (t *MatchTree[T]) doAddRule(patterns []MatchPattern, valueIndex int, priority int) {
-	getOrInsertNode := func(newNodeType MatchType) matchNode {
-		node := t.root
-		if node == nil {
-			node = newMatchNode(newNodeType)
-			t.root = node
+// SetRuleEnabled enables or disables the rule with the RuleID. Searches skip disabled rules,
+// which stay in the MatchTree to be enabled again. Rules are enabled when added, and a rule
+// replaced with ReplaceRuleByID keeps its state.
+// It returns ErrRuleNotFound if no rule has the RuleID.
+func (t *MatchTree[T]) SetRuleEnabled(id RuleID, enabled bool) error {
+	if _, ok := t.rules[id]; !ok {
+		return fmt.Errorf("%w; id=%v", ErrRuleNotFound, id)
+	}
+	t.setRuleDisabled(id, !enabled)
+	return nil
+}
+
+// setRuleDisabled flags the results of the rule in the leaf nodes in place.
+func (t *MatchTree[T]) setRuleDisabled(id RuleID, isDisabled bool) {
+	location := t.rules[id]
+	for _, leaf := range location.Leaves {
+		results := leaf.GetResults()
+		for i := range results {
+			if results[i].RuleID == id {
+				results[i].IsDisabled = isDisabled
+			}
+		}
+		updateDuplicateResults(results)
+	}
+	location.IsDisabled = isDisabled
+	t.rules[id] = location
+}
+
+// PurgeExpired removes the rules expired at the time now (see MatchRule.ExpiresAt) from the
+// MatchTree, like RemoveRuleByID, and returns the number of rules removed. Unlike RemoveRuleByID,
+// it also removes the nodes left with no results and frees the slots of the values removed, which
+// renumbers the value indexes reported by Walk and FindShadowedRules.
+func (t *MatchTree[T]) PurgeExpired(now time.Time) int {
+	now1 := now.UnixNano()
+	n := 0
+	for id, location := range t.rules {
+		if location.Expiry.isExpiredAt(now1) {
+			t.deleteRule(id, location)
+			n++
+		}
+	}
+	if n >= 1 {
+		t.prune()
+	}
+	return n
+}
+
+// deleteRule removes the rule from the tree along with its value and location.
+func (t *MatchTree[T]) deleteRule(id RuleID, location ruleLocation) {
+	t.removeRule(id, location)
+	if location.ValueIndex >= 0 {
+		var zero T
+		t.values[location.ValueIndex] = zero
+	}
+	delete(t.rules, id)
+}
+
+// removeRule removes the results of the rule from the leaf nodes.
+func (t *MatchTree[T]) removeRule(id RuleID, location ruleLocation) {
+	for _, leaf := range location.Leaves {
+		leaf.RemoveResults(id)
+	}
+}
+
+// preparePatterns validates the patterns of a rule against the tree's defined types,
+// and returns a normalized copy of them ready for insertion.
+func (t *MatchTree[T]) preparePatterns(rulePatterns []MatchPattern, options addRuleOptions) ([]MatchPattern, error) {
+	if len(rulePatterns) != len(t.types) {
+		return nil, fmt.Errorf("%w; expected=%v actual=%v", ErrPatternCountMismatch, len(t.types), len(rulePatterns))
+	}
+	patterns := slices.Clone(rulePatterns)
+	for i, pattern := range patterns {
+		type1 := t.types[i]
+		if pattern.IsEmpty() && options.TreatEmptyPatternAsAny {
+			patterns[i] = MatchPattern{
+				Type:  type1,
+				IsAny: true,
+			}
+		} else {
+			if pattern.Type != type1 {
+				return nil, &TypeMismatchError{Index: i, Expected: type1, Actual: pattern.Type}
+			}
+			if pattern.IsAny && pattern.IsInverse {
+				return nil, fmt.Errorf("matchtree: match pattern #%d is both any and inverse", i+1)
+			}
+			if !pattern.IsAny && !pattern.IsInverse && pattern.hasEmptyValueList() {
+				// no leaf would be reached
+				return nil, fmt.Errorf("matchtree: match pattern #%d has no values for %v type", i+1, pattern.Type)
+			}
+			if pattern.IsInverse && pattern.hasEmptyValueList() {
+				// nothing is excluded
+				patterns[i] = MatchPattern{
+					Type:  type1,
+					IsAny: true,
+				}
+			}
 		}
-		return node
 	}
 
 	for i := range patterns {
-		// non-leaf
 		pattern := &patterns[i]
-		node := getOrInsertNode(pattern.Type)
+		switch pattern.Type {
+		case MatchString:
+			if t.stringForm != nil {
+				pattern.Strings = normalizeStrings(pattern.Strings, t.stringForm)
+			}
+			if !options.SkipCloning {
+				pattern.Strings = cloneStrings(pattern.Strings)
+			}
+		case MatchBytes:
+			// byte slices are keyed by their strings internally
+			pattern.Strings = make([]string, 0, len(pattern.ByteSlices))
+			for _, v := range pattern.ByteSlices {
+				pattern.Strings = append(pattern.Strings, string(v))
+			}
+			if !options.SkipCloning {
+				pattern.Strings = cloneStrings(pattern.Strings)
+			}
+			pattern.ByteSlices = nil
+		case MatchInteger:
+			if !options.SkipCloning {
+				pattern.Integers = cloneIntegers(pattern.Integers)
+			}
+		case MatchIntegerInterval:
+			// overlapping intervals would be separate children reaching the same leaves
+			if intervals := MergeIntegerIntervals(pattern.IntegerIntervals); len(intervals) >= 1 {
+				pattern.IntegerIntervals = intervals
+			} else {
+				// empty intervals only, which match nothing anyway
+				pattern.IntegerIntervals = cloneIntegerIntervals(pattern.IntegerIntervals)
+			}
+		case MatchNumeric:
+			pattern.Integers, pattern.IntegerIntervals = prepareNumericValues(pattern.Integers, pattern.IntegerIntervals, pattern.IsInverse)
+		case MatchNumberInterval:
+			if intervals := MergeNumberIntervals(pattern.NumberIntervals); len(intervals) >= 1 {
+				pattern.NumberIntervals = intervals
+			} else {
+				pattern.NumberIntervals = cloneNumberIntervals(pattern.NumberIntervals)
+			}
+			for j, interval := range pattern.NumberIntervals {
+				pattern.NumberIntervals[j] = interval.normalizeZeros()
+			}
+		case MatchRegexp:
+			var err error
+			pattern.compiledRegexp, err = t.compileRegexp(pattern.Regexp)
+			if err != nil {
+				return nil, fmt.Errorf("matchtree: invalid regexp %q", pattern.Regexp)
+			}
+		case MatchSemverRange:
+			if pattern.IsAny {
+				// no constraint to parse
+				break
+			}
+			var err error
+			pattern.versionRanges, err = ParseVersionConstraint(pattern.VersionConstraint)
+			if err != nil {
+				return nil, err
+			}
+		case MatchGlob:
+			if err := checkGlob(pattern.Glob); err != nil {
+				return nil, err
+			}
+		case MatchEnum:
+			if err := pattern.checkEnumNames(); err != nil {
+				return nil, err
+			}
+			if !options.SkipCloning {
+				pattern.Strings = cloneStrings(pattern.Strings)
+			}
+			pattern.Integers = make([]int64, 0, len(pattern.Strings))
+			for _, name := range pattern.Strings {
+				pattern.Integers = append(pattern.Integers, pattern.EnumCodes[name])
+			}
+			if !options.SkipCloning {
+				pattern.Integers = cloneIntegers(pattern.Integers)
+			}
+		default:
+			// custom match type
+			if !options.SkipCloning {
+				pattern.Strings = slices.Clone(pattern.Strings)
+			}
+		}
+	}
 
-		getOrInsertNode = func(
-			lastNode matchNode,
-			lastPattern *MatchPattern,
-		) func(MatchType) matchNode {
-			return func(newNodeType MatchType) matchNode {
-				return lastNode.GetOrInsertChild(lastPattern, newNodeType)
+	maxLeaves := options.MaxLeaves
+	if maxLeaves <= 0 {
+		maxLeaves = t.maxExpansion
+	}
+	numberOfLeaves := 1
+	for i := range patterns {
+		n := patterns[i].numberOfValues()
+		if n >= 1 && numberOfLeaves > maxLeaves/n {
+			return nil, fmt.Errorf("matchtree: match patterns expand into more than %d leaves", maxLeaves)
+		}
+		numberOfLeaves *= n
+	}
+	return patterns, nil
+}
+
+// insertRule inserts a rule with the prepared patterns into the tree, storing the value at
+// valueIndex, or at a new index if valueIndex is -1. With options.DedupIdenticalRules, a result
+// identical to one already in a leaf node joins its dedup group, to be hidden behind it.
+func (t *MatchTree[T]) insertRule(id RuleID, valueIndex int, patterns []MatchPattern, rule *MatchRule[T], options addRuleOptions) {
+	if valueIndex < 0 {
+		valueIndex = len(t.values)
+		t.values = append(t.values, rule.Value)
+	}
+	result := matchResult{
+		ValueIndex: valueIndex,
+		Priority:   rule.Priority,
+		Weight:     rule.Weight,
+		RuleID:     id,
+		Expiry:     makeExpiry(rule.ExpiresAt),
+	}
+	var leaves []matchNode
+
+	for range selectPaths(patterns) {
+		leaf := t.getOrInsertLeaf(patterns)
+		result.DedupGroup = 0
+		if options.DedupIdenticalRules {
+			results := leaf.GetResults()
+			if i := slices.IndexFunc(results, func(x matchResult) bool { return t.isIdenticalResult(x, rule, result) }); i >= 0 {
+				if results[i].DedupGroup == 0 {
+					results[i].DedupGroup = results[i].RuleID
+				}
+				result.DedupGroup = results[i].DedupGroup
 			}
-		}(node, pattern)
+		}
+		leaf.AddResult(result)
+		leaves = append(leaves, leaf)
 	}
 
-	// leaf
-	node := getOrInsertNode(MatchNone)
-	node.AddResult(matchResult{
+	if t.rules == nil {
+		t.rules = make(map[RuleID]ruleLocation)
+	}
+	t.rules[id] = ruleLocation{
 		ValueIndex: valueIndex,
-		Priority:   priority,
-	})
+		Leaves:     leaves,
+		Expiry:     result.Expiry,
+		Labels:     maps.Clone(rule.Labels),
+	}
+	if onAddRule := t.metrics.OnAddRule; onAddRule != nil {
+		onAddRule(len(leaves))
+	}
 }
 
-// MatchKey represents a single key to search within the MatchTree.
-// It specifies the type and the value for that key.
-type MatchKey struct {
-	Type MatchType `json:"type"`
-
-	// String for MatchString, MatchRegexp types.
-	String string `json:"string"`
+// selectPaths returns an iterator that selects the values of the prepared patterns for each
+// path to the leaves in turn. The patterns are expanded like an odometer, advancing the value
+// positions from the last pattern and carrying over to the previous one on wrap-around.
+func selectPaths(patterns []MatchPattern) iter.Seq[struct{}] {
+	return func(yield func(struct{}) bool) {
+		positions := make([]int, len(patterns))
+		for i := range patterns {
+			if patterns[i].numberOfValues() == 0 {
+				return
+			}
+			patterns[i].selectValue(0)
+		}
+		for {
+			if !yield(struct{}{}) {
+				return
+			}
 
-	// Integer for MatchInteger, MatchIntegerInterval types.
-	Integer int64 `json:"integer"`
+			i := len(patterns) - 1
+			for ; i >= 0; i-- {
+				pattern := &patterns[i]
+				positions[i]++
+				if positions[i] < pattern.numberOfValues() {
+					pattern.selectValue(positions[i])
+					break
+				}
+				positions[i] = 0
+				pattern.selectValue(0)
+			}
+			if i < 0 {
+				return
+			}
+		}
+	}
+}
 
-	// Number for MatchNumberInterval type.
-	Number float64 `json:"number"`
+// numberOfValues returns the number of values of the prepared pattern that lead to different
+// children, which is 1 for the patterns leading to a single child.
+func (p *MatchPattern) numberOfValues() int {
+	if p.IsAny || p.IsInverse {
+		return 1
+	}
+	switch p.Type {
+	case MatchString, MatchBytes:
+		return len(p.Strings)
+	case MatchInteger, MatchEnum:
+		return len(p.Integers)
+	case MatchIntegerInterval:
+		return len(p.IntegerIntervals)
+	case MatchNumberInterval:
+		return len(p.NumberIntervals)
+	case MatchNumeric:
+		return len(p.Integers) + len(p.IntegerIntervals)
+	default:
+		// regexp, semver range or custom match type
+		return 1
+	}
 }
 
-// Search traverses the MatchTree with the given keys and returns a slice of matching values.
-// The returned values are sorted by priority (descending) and then by their insertion order.
-// It returns an error if the keys do not match the tree's defined types.
-func (t *MatchTree[T]) Search(keys []MatchKey) ([]T, error) {
-	if len(keys) != len(t.types) {
-		return nil, fmt.Errorf("matchtree: unexpected number of match keys; expected=%v actual=%v", len(t.types), len(keys))
+// selectValue makes the value at position i current for inserting the prepared pattern.
+func (p *MatchPattern) selectValue(i int) {
+	if p.IsAny || p.IsInverse {
+		return
 	}
-	for i, key := range keys {
-		type1 := t.types[i]
-		if key.Type != type1 {
-			return nil, fmt.Errorf("matchtree: unexpected match type #%d; expected=%v actual=%v", i+1, type1, key.Type)
+	switch p.Type {
+	case MatchString, MatchBytes:
+		p.currentString = p.Strings[i]
+	case MatchInteger, MatchEnum:
+		p.currentInteger = p.Integers[i]
+	case MatchIntegerInterval:
+		p.currentIntegerInterval = p.IntegerIntervals[i]
+	case MatchNumberInterval:
+		p.currentNumberInterval = p.NumberIntervals[i]
+	case MatchNumeric:
+		// the integers go before the intervals
+		p.currentIsInteger = i < len(p.Integers)
+		if p.currentIsInteger {
+			p.currentInteger = p.Integers[i]
+		} else {
+			p.currentIntegerInterval = p.IntegerIntervals[i-len(p.Integers)]
 		}
 	}
+}
 
-	var nodes []matchNode
-	if t.root != nil {
-		nodes = []matchNode{t.root}
+// currentEdgePattern returns the prepared pattern with its current value only, in the form of the
+// patterns of the edges to the children (see matchNode.Edges).
+func (p *MatchPattern) currentEdgePattern() MatchPattern {
+	edgePattern := *p
+	if p.IsAny {
+		return edgePattern
 	}
-	var nextNodes []matchNode
-	for _, key := range keys {
-		for _, node := range nodes {
-			// non-leaf
-			nextNodes = slices.AppendSeq(nextNodes, node.FindChildren(key))
+	switch p.Type {
+	case MatchString:
+		if !p.IsInverse {
+			edgePattern.Strings = []string{p.currentString}
+		}
+	case MatchBytes:
+		if !p.IsInverse {
+			edgePattern.Strings = []string{p.currentString}
+		}
+		edgePattern.ByteSlices = make([][]byte, 0, len(edgePattern.Strings))
+		for _, v := range edgePattern.Strings {
+			edgePattern.ByteSlices = append(edgePattern.ByteSlices, []byte(v))
+		}
+		edgePattern.Strings = nil
+	case MatchInteger:
+		if !p.IsInverse {
+			edgePattern.Integers = []int64{p.currentInteger}
+		}
+	case MatchEnum:
+		if !p.IsInverse {
+			i := slices.IndexFunc(p.Strings, func(name string) bool { return p.EnumCodes[name] == p.currentInteger })
+			edgePattern.Strings = p.Strings[i : i+1]
+		}
+	case MatchIntegerInterval:
+		if !p.IsInverse {
+			edgePattern.IntegerIntervals = []IntegerInterval{p.currentIntegerInterval}
+		}
+	case MatchNumberInterval:
+		if !p.IsInverse {
+			edgePattern.NumberIntervals = []NumberInterval{p.currentNumberInterval}
+		}
+	case MatchNumeric:
+		if !p.IsInverse {
+			if p.currentIsInteger {
+				edgePattern.Integers, edgePattern.IntegerIntervals = []int64{p.currentInteger}, nil
+			} else {
+				edgePattern.Integers, edgePattern.IntegerIntervals = nil, []IntegerInterval{p.currentIntegerInterval}
+			}
 		}
-		nodes, nextNodes = nextNodes, nodes[:0]
 	}
-	if len(nodes) == 0 {
-		return nil, nil
+	return edgePattern
+}
+
+// prepareNumericValues returns the integers and intervals of a MatchNumeric pattern in the form
+// of its children: the intervals are merged, and the ones of a single integer become integers,
+// so that an integer leads to an exact child and an interval of two or more integers to an interval
+// child. The integers in the intervals are dropped, for they would be separate children reaching
+// the same leaves. The values of an inverse pattern are all turned into intervals, which its
+// inverse child excludes together.
+func prepareNumericValues(integers []int64, intervals []IntegerInterval, isInverse bool) ([]int64, []IntegerInterval) {
+	if isInverse {
+		allIntervals := make([]IntegerInterval, 0, len(integers)+len(intervals))
+		for _, v := range integers {
+			allIntervals = append(allIntervals, ClosedInterval(v, v))
+		}
+		allIntervals = append(allIntervals, intervals...)
+		if mergedIntervals := MergeIntegerIntervals(allIntervals); len(mergedIntervals) >= 1 {
+			return nil, mergedIntervals
+		}
+		// empty intervals only, which exclude nothing anyway
+		return nil, cloneIntegerIntervals(allIntervals)
 	}
 
-	return t.extractValues(nodes), nil
+	var pointIntegers []int64
+	var preparedIntervals []IntegerInterval
+	for _, interval := range MergeIntegerIntervals(intervals) {
+		if lowerBound, upperBound, _ := integerIntervalBounds(interval); lowerBound == upperBound {
+			pointIntegers = append(pointIntegers, lowerBound)
+			continue
+		}
+		preparedIntervals = append(preparedIntervals, interval)
+	}
+	var preparedIntegers []int64
+	for _, v := range slices.Concat(integers, pointIntegers) {
+		if slices.Contains(preparedIntegers, v) || slices.ContainsFunc(preparedIntervals, func(x IntegerInterval) bool { return x.Contains(v) }) {
+			continue
+		}
+		preparedIntegers = append(preparedIntegers, v)
+	}
+	if len(preparedIntegers) == 0 && len(preparedIntervals) == 0 {
+		// empty intervals only, which match nothing anyway
+		preparedIntervals = cloneIntegerIntervals(intervals)
+	}
+	return preparedIntegers, preparedIntervals
 }
 
-func (t *MatchTree[T]) extractValues(nodes []matchNode) []T {
-	n := 0
-	for _, node := range nodes {
-		n += len(node.GetResults())
-	}
-	if n == 1 {
-		return []T{t.values[nodes[0].GetResults()[0].ValueIndex]}
+func cloneStrings(s []string) []string {
+	clone := make([]string, 0, len(s))
+	for _, v := range s {
+		if slices.Contains(clone, v) {
+			continue
+		}
+		clone = append(clone, v)
 	}
+	return clone
+}
 
-	results := make([]matchResult, 0, n)
-	for _, node := range nodes {
-		results = append(results, node.GetResults()...)
+func cloneIntegers(s []int64) []int64 {
+	clone := make([]int64, 0, len(s))
+	for _, v := range s {
+		if slices.Contains(clone, v) {
+			continue
+		}
+		clone = append(clone, v)
 	}
-	slices.SortFunc(results, func(x, y matchResult) int {
-		delta := y.Priority - x.Priority
-		if delta == 0 {
-			delta = x.ValueIndex - y.ValueIndex
+	return clone
+}
+
+func cloneIntegerIntervals(s []IntegerInterval) []IntegerInterval {
+	clone := make([]IntegerInterval, 0, len(s))
+	for _, v := range s {
+		if slices.ContainsFunc(clone, v.Equals) {
+			continue
 		}
-		return delta
-	})
-	lastValueIndex := -1
-	n = 0
-	for _, result := range results {
-		if result.ValueIndex == lastValueIndex {
+		clone = append(clone, v)
+	}
+	return clone
+}
+
+func cloneNumberIntervals(s []NumberInterval) []NumberInterval {
+	clone := make([]NumberInterval, 0, len(s))
+	for _, v := range s {
+		if slices.ContainsFunc(clone, v.Equals) {
 			continue
 		}
-		results[n] = result
-		n++
-		lastValueIndex = result.ValueIndex
+		clone = append(clone, v)
 	}
-	results = results[:n]
+	return clone
+}
 
-	values := make([]T, n)
-	for i, result := range results {
-		values[i] = t.values[result.ValueIndex]
+func (t *MatchTree[T]) compileRegexp(regexp1 string) (*regexp.Regexp, error) {
+	compiledRegexps := t.compiledRegexps
+	if v, ok := compiledRegexps[regexp1]; ok {
+		return v, nil
+	}
+	v, err := regexp.Compile(regexp1)
+	if err != nil {
+		return v, err
+	}
+	if compiledRegexps == nil {
+		compiledRegexps = make(map[string]*regexp.Regexp, 1)
+		t.compiledRegexps = compiledRegexps
 	}
-	return values
+	compiledRegexps[regexp1] = v
+	return v, nil
 }
 
-// matchNode is an interface that defines the behavior of nodes within the MatchTree.
-type matchNode interface {
-	// GetOrInsertChild retrieves an existing child node or inserts a new one based on the pattern and newChildType.
-	GetOrInsertChild(pattern *MatchPattern, newChildType MatchType) matchNode
-	// FindChildren finds child nodes that match the given key.
-	FindChildren(key MatchKey) iter.Seq[matchNode]
+// getOrInsertLeaf returns the leaf node for the current values of the patterns being walked,
+// inserting the nodes along the path as needed.
+func (t *MatchTree[T]) getOrInsertLeaf(patterns []MatchPattern) matchNode {
+	getOrInsertNode := func(newNodeType MatchType) matchNode {
+		node := t.root
+		if node == nil {
+			node = newMatchNode(newNodeType)
+			t.root = node
+		}
+		return node
+	}
 
-	// AddResult adds a match result to a leaf node.
-	AddResult(result matchResult)
-	// GetResults returns the match results associated with a leaf node.
-	GetResults() []matchResult
+	for i := range patterns {
+		// non-leaf
+		pattern := &patterns[i]
+		node := getOrInsertNode(pattern.Type)
+
+		getOrInsertNode = func(
+			lastNode matchNode,
+			lastPattern *MatchPattern,
+		) func(MatchType) matchNode {
+			return func(newNodeType MatchType) matchNode {
+				return lastNode.GetOrInsertChild(lastPattern, newNodeType)
+			}
+		}(node, pattern)
+	}
+
+	// leaf
+	return getOrInsertNode(MatchNone)
 }
 
-// matchResult stores the index of the matched value and its priority.
-type matchResult struct {
-	ValueIndex int
-	Priority   int
+// findLeaf returns the leaf node the prepared patterns with their current values lead to, like
+// getOrInsertLeaf but without inserting any node, or nil if there is no such leaf node.
+// Each child is looked up among the edges of its parent node, whose patterns must be equivalent
+// to the pattern with its current value.
+func (t *MatchTree[T]) findLeaf(patterns []MatchPattern) matchNode {
+	node := t.root
+	for i := range patterns {
+		if node == nil {
+			return nil
+		}
+		pattern := patterns[i].currentEdgePattern()
+		var child matchNode
+		for edgePattern, edgeChild := range node.Edges() {
+			if coversPattern(&edgePattern, &pattern) && coversPattern(&pattern, &edgePattern) {
+				child = edgeChild
+				break
+			}
+		}
+		node = child
+	}
+	return node
 }
 
-var matchNodeFactories = [NumberOfMatchTypes]func() matchNode{
-	MatchNone:            func() matchNode { return new(matchNodeOfNone) },
-	MatchString:          func() matchNode { return new(matchNodeOfString) },
-	MatchInteger:         func() matchNode { return new(matchNodeOfInteger) },
-	MatchIntegerInterval: func() matchNode { return new(matchNodeOfIntegerInterval) },
-	MatchNumberInterval:  func() matchNode { return new(matchNodeOfNumberInterval) },
-	MatchRegexp:          func() matchNode { return new(matchNodeOfRegexp) },
+// isIdenticalResult reports whether the result has the value and labels of the rule, and the
+// priority, weight and expiry of the new result, whether it is enabled or not.
+func (t *MatchTree[T]) isIdenticalResult(result matchResult, rule *MatchRule[T], newResult matchResult) bool {
+	return result.Priority == newResult.Priority && result.Weight == newResult.Weight && result.Expiry == newResult.Expiry &&
+		reflect.DeepEqual(t.values[result.ValueIndex], rule.Value) && maps.Equal(t.rules[result.RuleID].Labels, rule.Labels)
 }
 
-func newMatchNode(type1 MatchType) matchNode { return matchNodeFactories[type1]() }
+// MatchKey represents a single key to search within the MatchTree.
+// It specifies the type and the value for that key.
+type MatchKey struct {
+	Type MatchType `json:"type" yaml:"type" msgpack:"type"`
 
-// ----- dummy match node -----
+	// IsAbsent indicates that there is no value for the dimension, e.g. for an optional header
+	// missing from a request, in which case the key matches only the patterns that are IsAny,
+	// and no value field may be set.
+	IsAbsent bool `json:"is_absent,omitempty" yaml:"is_absent,omitempty" msgpack:"is_absent,omitempty"`
 
-type dummyMatchNode struct{}
+	// String for MatchString, MatchRegexp, MatchGlob types.
+	String string `json:"string" yaml:"string" msgpack:"string"`
 
-var _ matchNode = (*dummyMatchNode)(nil)
+	// Strings for MatchString type, making the key multi-valued in place of String.
+	// A multi-valued key matches an exact child if any of the values matches it, and an inverse
+	// child only if none of the values is excluded by it.
+	Strings []string `json:"strings" yaml:"strings" msgpack:"strings"`
 
-func (n dummyMatchNode) GetOrInsertChild(pattern *MatchPattern, newChildType MatchType) matchNode {
-	panic("unreachable")
-}
-func (n dummyMatchNode) FindChildren(key MatchKey) iter.Seq[matchNode] { panic("unreachable") }
-func (n dummyMatchNode) AddResult(result matchResult)                  { panic("unreachable") }
-func (n dummyMatchNode) GetResults() []matchResult                     { panic("unreachable") }
+	// Integer for MatchInteger, MatchIntegerInterval, MatchEnum, MatchNumeric types.
+	Integer int64 `json:"integer" yaml:"integer" msgpack:"integer"`
 
-// ----- match node of none -----
+	// Integers for MatchInteger, MatchEnum types, making the key multi-valued in place of Integer,
+	// like Strings.
+	Integers []int64 `json:"integers" yaml:"integers" msgpack:"integers"`
 
-type matchNodeOfNone struct {
-	dummyMatchNode
+	// IntegerRange for MatchInteger type, opting in to a range query in place of Integer: the key
+	// matches an exact child if the interval contains its integer, and an inverse child only if
+	// the interval contains none of the integers excluded by it, as if the key were multi-valued
+	// with all the integers in the interval. An empty interval matches only the any child.
+	IntegerRange *IntegerInterval `json:"integer_range,omitempty" yaml:"integer_range,omitempty" msgpack:"integer_range,omitempty"`
 
-	results []matchResult
-}
+	// Number for MatchNumberInterval type.
+	Number float64 `json:"number" yaml:"number" msgpack:"number"`
 
-var _ matchNode = (*matchNodeOfNone)(nil)
+	// Bytes for MatchBytes type.
+	Bytes []byte `json:"bytes,omitempty" yaml:"bytes,omitempty" msgpack:"bytes,omitempty"`
 
-func (n *matchNodeOfNone) AddResult(result matchResult) {
-	n.results = append(n.results, result)
+	// Version for MatchSemverRange type.
+	Version Version `json:"version,omitzero" yaml:"version,omitempty" msgpack:"version,omitempty"`
 }
-func (n *matchNodeOfNone) GetResults() []matchResult { return n.results }
 
-// ----- match node of string -----
+// AbsentKey creates a MatchKey of the type without a value, which matches only the patterns that
+// are IsAny.
+func AbsentKey(type1 MatchType) MatchKey { return MatchKey{Type: type1, IsAbsent: true} }
+
+// StringKey creates a MatchKey of the MatchString type.
+func StringKey(s string) MatchKey { return MatchKey{Type: MatchString, String: s} }
+
+// RegexpKey creates a MatchKey of the MatchRegexp type.
+func RegexpKey(s string) MatchKey { return MatchKey{Type: MatchRegexp, String: s} }
 
-type matchNodeOfString struct {
-	dummyMatchNode
+// GlobKey creates a MatchKey of the MatchGlob type.
+func GlobKey(s string) MatchKey { return MatchKey{Type: MatchGlob, String: s} }
 
-	children            map[string]matchNode
-	inverseChildren     []matchNodeWithRefCount
-	inverseChildIndexes map[string][]int
-	anyChild            matchNode
+// StringsKey creates a multi-valued MatchKey of the MatchString type.
+func StringsKey(strings ...string) MatchKey { return MatchKey{Type: MatchString, Strings: strings} }
+
+// IntegerKey creates a MatchKey of the MatchInteger type.
+func IntegerKey(i int64) MatchKey { return MatchKey{Type: MatchInteger, Integer: i} }
+
+// IntegersKey creates a multi-valued MatchKey of the MatchInteger type.
+func IntegersKey(integers ...int64) MatchKey { return MatchKey{Type: MatchInteger, Integers: integers} }
+
+// IntegerRangeKey creates a MatchKey of the MatchInteger type querying the integers in the
+// interval (see MatchKey.IntegerRange).
+func IntegerRangeKey(interval IntegerInterval) MatchKey {
+	return MatchKey{Type: MatchInteger, IntegerRange: &interval}
 }
 
-var _ matchNode = (*matchNodeOfString)(nil)
+// BytesKey creates a MatchKey of the MatchBytes type.
+func BytesKey(b []byte) MatchKey { return MatchKey{Type: MatchBytes, Bytes: b} }
+
+// VersionKey creates a MatchKey of the MatchSemverRange type.
+func VersionKey(v Version) MatchKey { return MatchKey{Type: MatchSemverRange, Version: v} }
+
+// EnumKey creates a MatchKey of the MatchEnum type with the code of an enum value.
+func EnumKey(code int64) MatchKey { return MatchKey{Type: MatchEnum, Integer: code} }
+
+// IntegerIntervalKey creates a MatchKey of the MatchIntegerInterval type.
+func IntegerIntervalKey(i int64) MatchKey { return MatchKey{Type: MatchIntegerInterval, Integer: i} }
+
+// NumericKey creates a MatchKey of the MatchNumeric type.
+func NumericKey(i int64) MatchKey { return MatchKey{Type: MatchNumeric, Integer: i} }
+
+// NumberKey creates a MatchKey of the MatchNumberInterval type.
+func NumberKey(f float64) MatchKey { return MatchKey{Type: MatchNumberInterval, Number: f} }
+
+// Validate checks that the MatchKey is well-formed: its type is known and no field irrelevant
+// to its type is set.
+func (k *MatchKey) Validate() error {
+	var usesString, usesInteger, usesNumber, usesBytes, usesVersion bool
+	switch k.Type {
+	case MatchString, MatchRegexp, MatchGlob:
+		usesString = true
+	case MatchInteger, MatchIntegerInterval, MatchEnum, MatchNumeric:
+		usesInteger = true
+	case MatchNumberInterval:
+		usesNumber = true
+	case MatchBytes:
+		usesBytes = true
+	case MatchSemverRange:
+		usesVersion = true
+	default:
+		if !isCustomMatchType(k.Type) {
+			return fmt.Errorf("matchtree: unknown match type %v", k.Type)
+		}
+		usesString = true
+	}
 
-func (n *matchNodeOfString) GetOrInsertChild(pattern *MatchPattern, newChildType MatchType) matchNode {
-	if pattern.IsAny {
-		child := n.anyChild
-		if child == nil {
-			child = newMatchNode(newChildType)
-			n.anyChild = child
+	if !usesString && k.String != "" {
+		return fmt.Errorf("matchtree: unexpected string for %v key", k.Type)
+	}
+	if !usesInteger && k.Integer != 0 {
+		return fmt.Errorf("matchtree: unexpected integer for %v key", k.Type)
+	}
+	if !usesNumber && k.Number != 0 {
+		return fmt.Errorf("matchtree: unexpected number for %v key", k.Type)
+	}
+	if !usesBytes && len(k.Bytes) >= 1 {
+		return fmt.Errorf("matchtree: unexpected bytes for %v key", k.Type)
+	}
+	if !usesVersion && !k.Version.IsZero() {
+		return fmt.Errorf("matchtree: unexpected version for %v key", k.Type)
+	}
+	if len(k.Strings) >= 1 {
+		if k.Type != MatchString {
+			return fmt.Errorf("matchtree: unexpected strings for %v key", k.Type)
+		}
+		if k.String != "" {
+			return fmt.Errorf("matchtree: both string and strings for %v key", k.Type)
 		}
-		return child
 	}
-
-	if pattern.IsInverse {
-		refCounts := make([]int, len(n.inverseChildren))
-		for _, v := range pattern.Strings {
-			for _, childIndex := range n.inverseChildIndexes[v] {
-				refCounts[childIndex]++
-			}
+	if len(k.Integers) >= 1 {
+		if k.Type != MatchInteger && k.Type != MatchEnum {
+			return fmt.Errorf("matchtree: unexpected integers for %v key", k.Type)
 		}
-		maxRefCount := len(pattern.Strings)
-		for childIndex, refCount := range refCounts {
-			if refCount == maxRefCount && n.inverseChildren[childIndex].MaxRefCount == maxRefCount {
-				return n.inverseChildren[childIndex].MatchNode
-			}
+		if k.Integer != 0 {
+			return fmt.Errorf("matchtree: both integer and integers for %v key", k.Type)
 		}
-		newChild := newMatchNode(newChildType)
-		newChildIndex := len(n.inverseChildren)
-		n.inverseChildren = append(n.inverseChildren, matchNodeWithRefCount{
-			MatchNode:   newChild,
-			MaxRefCount: maxRefCount,
-		})
-		inverseChildIndexes := n.inverseChildIndexes
-		if inverseChildIndexes == nil {
-			inverseChildIndexes = make(map[string][]int, maxRefCount)
-			n.inverseChildIndexes = inverseChildIndexes
+	}
+	if k.IntegerRange != nil {
+		if k.Type != MatchInteger {
+			return fmt.Errorf("matchtree: unexpected integer range for %v key", k.Type)
 		}
-		for _, v := range pattern.Strings {
-			inverseChildIndexes[v] = append(inverseChildIndexes[v], newChildIndex)
+		if k.Integer != 0 || len(k.Integers) >= 1 {
+			return fmt.Errorf("matchtree: both integer and integer range for %v key", k.Type)
 		}
-		return newChild
 	}
-
-	children := n.children
-	if children == nil {
-		children = make(map[string]matchNode, 1)
-		n.children = children
+	if k.IsAbsent && (k.String != "" || len(k.Strings) >= 1 || k.Integer != 0 || len(k.Integers) >= 1 ||
+		k.IntegerRange != nil || k.Number != 0 || len(k.Bytes) >= 1 || !k.Version.IsZero()) {
+		return fmt.Errorf("matchtree: unexpected value for absent %v key", k.Type)
 	}
-	child, ok := children[pattern.currentString]
-	if !ok {
-		child = newMatchNode(newChildType)
-		children[pattern.currentString] = child
+	return nil
+}
+
+// Format implements fmt.Formatter for MatchKey, whose field String rules out a String method.
+// The verbs %v and %s print a readable form of the MatchKey for debugging, e.g. `STRING="foo"`
+// or "INTEGER={1,2}" for a multi-valued key, and the other verbs print the struct as usual.
+func (k MatchKey) Format(f fmt.State, verb rune) {
+	if (verb != 'v' && verb != 's') || f.Flag('#') || f.Flag('+') {
+		type matchKey MatchKey // without methods
+		fmt.Fprintf(f, fmt.FormatString(f, verb), matchKey(k))
+		return
 	}
-	return child
+	io.WriteString(f, k.format())
 }
 
-func (n *matchNodeOfString) FindChildren(key MatchKey) iter.Seq[matchNode] {
-	return func(yield func(matchNode) bool) {
-		if child, ok := n.children[key.String]; ok {
-			if !yield(child) {
-				return
-			}
-		}
+func (k MatchKey) format() string {
+	if k.IsAbsent {
+		return k.Type.String() + " absent"
+	}
 
-		if len(n.inverseChildren) >= 1 {
-			refCounts := make([]int, len(n.inverseChildren))
-			for _, childIndex := range n.inverseChildIndexes[key.String] {
-				refCounts[childIndex]++
+	var value string
+	switch k.Type {
+	case MatchInteger, MatchIntegerInterval, MatchEnum, MatchNumeric:
+		if k.IntegerRange != nil {
+			value = k.IntegerRange.String()
+		} else if len(k.Integers) >= 1 {
+			items := make([]string, len(k.Integers))
+			for i, v := range k.Integers {
+				items[i] = strconv.FormatInt(v, 10)
 			}
-			for childIndex, refCount := range refCounts {
-				if refCount >= 1 {
-					continue
-				}
-				if !yield(n.inverseChildren[childIndex].MatchNode) {
-					return
-				}
-			}
-		}
-
-		if child := n.anyChild; child != nil {
-			if !yield(child) {
-				return
+			value = "{" + strings.Join(items, ",") + "}"
+		} else {
+			value = strconv.FormatInt(k.Integer, 10)
+		}
+	case MatchNumberInterval:
+		value = strconv.FormatFloat(k.Number, 'g', -1, 64)
+	case MatchBytes:
+		value = "0x" + hex.EncodeToString(k.Bytes)
+	case MatchSemverRange:
+		value = k.Version.String()
+	default:
+		if len(k.Strings) >= 1 {
+			items := make([]string, len(k.Strings))
+			for i, v := range k.Strings {
+				items[i] = strconv.Quote(v)
 			}
+			value = "{" + strings.Join(items, ",") + "}"
+		} else {
+			value = strconv.Quote(k.String)
 		}
 	}
+	return k.Type.String() + "=" + value
 }
 
-// ----- match node of integer -----
+// Search traverses the MatchTree with the given keys and returns a slice of matching values.
+// The returned values are sorted by priority (descending) and then by their insertion order.
+// It returns an error if the keys do not match the tree's defined types, i.e. one wrapping
+// ErrKeyCountMismatch or a *TypeMismatchError.
+func (t *MatchTree[T]) Search(keys []MatchKey) ([]T, error) {
+	return t.search(nil, keys, defaultSearchOptions)
+}
 
-type matchNodeOfInteger struct {
-	dummyMatchNode
+// SearchAbovePriority is like Search but only returns the values of rules whose priorities are
+// not less than minPriority.
+func (t *MatchTree[T]) SearchAbovePriority(keys []MatchKey, minPriority int64) ([]T, error) {
+	options := defaultSearchOptions
+	options.MinPriority = minPriority
+	return t.search(nil, keys, options)
+}
 
-	children            map[int64]matchNode
-	inverseChildren     []matchNodeWithRefCount
-	inverseChildIndexes map[int64][]int
-	anyChild            matchNode
+// SearchAll is like Search but skips the collapsing of equal values configured by WithValueDedup
+// or WithValueKey: the value of every rule matched is returned, once per rule, still in the order
+// of priority. Without either option, it returns the same values as Search.
+func (t *MatchTree[T]) SearchAll(keys []MatchKey) ([]T, error) {
+	options := defaultSearchOptions
+	options.KeepEqualValues = true
+	return t.search(nil, keys, options)
 }
 
-var _ matchNode = (*matchNodeOfInteger)(nil)
+// SearchAppend is like Search but appends the values to dst and returns the extended slice, so
+// that the caller can reuse a buffer across searches. Once dst has enough capacity, SearchAppend
+// does not allocate, unless the CustomMatchNodes of a custom match type do.
+func (t *MatchTree[T]) SearchAppend(dst []T, keys []MatchKey) ([]T, error) {
+	return t.search(dst, keys, defaultSearchOptions)
+}
 
-func (n *matchNodeOfInteger) GetOrInsertChild(pattern *MatchPattern, newChildType MatchType) matchNode {
-	if pattern.IsAny {
-		child := n.anyChild
-		if child == nil {
-			child = newMatchNode(newChildType)
-			n.anyChild = child
+// SearchMulti searches the MatchTree with each of the key sets, e.g. of a batch of lookups, and
+// returns the values for each key set like Search, in the order of the key sets. The key sets are
+// all checked before any search, and the values share a single backing array, which cuts the
+// allocations per key set. It returns an error if any key set does not match the tree's defined
+// types, wrapped with the position of the key set.
+func (t *MatchTree[T]) SearchMulti(keySets [][]MatchKey) ([][]T, error) {
+	for i, keys := range keySets {
+		if err := checkKeys(t.types, keys); err != nil {
+			return nil, wrapError(err, "key set #%d", i+1)
 		}
-		return child
 	}
 
-	if pattern.IsInverse {
-		refCounts := make([]int, len(n.inverseChildren))
-		for _, v := range pattern.Integers {
-			for _, childIndex := range n.inverseChildIndexes[v] {
-				refCounts[childIndex]++
-			}
-		}
-		maxRefCount := len(pattern.Integers)
-		for childIndex, refCount := range refCounts {
-			if refCount == maxRefCount && n.inverseChildren[childIndex].MaxRefCount == maxRefCount {
-				return n.inverseChildren[childIndex].MatchNode
-			}
-		}
-		newChild := newMatchNode(newChildType)
-		newChildIndex := len(n.inverseChildren)
-		n.inverseChildren = append(n.inverseChildren, matchNodeWithRefCount{
-			MatchNode:   newChild,
-			MaxRefCount: maxRefCount,
-		})
-		inverseChildIndexes := n.inverseChildIndexes
-		if inverseChildIndexes == nil {
-			inverseChildIndexes = make(map[int64][]int, maxRefCount)
-			n.inverseChildIndexes = inverseChildIndexes
-		}
-		for _, v := range pattern.Integers {
-			inverseChildIndexes[v] = append(inverseChildIndexes[v], newChildIndex)
+	var values []T
+	ends := make([]int, len(keySets))
+	for i, keys := range keySets {
+		var err error
+		values, err = t.search(values, keys, defaultSearchOptions)
+		if err != nil {
+			return nil, wrapError(err, "key set #%d", i+1)
 		}
-		return newChild
+		ends[i] = len(values)
 	}
-
-	children := n.children
-	if children == nil {
-		children = make(map[int64]matchNode, 1)
-		n.children = children
-	}
-	child, ok := children[pattern.currentInteger]
-	if !ok {
-		child = newMatchNode(newChildType)
-		children[pattern.currentInteger] = child
+	valueLists := make([][]T, len(keySets))
+	start := 0
+	for i, end := range ends {
+		if end > start {
+			valueLists[i] = values[start:end:end]
+		}
+		start = end
 	}
-	return child
+	return valueLists, nil
 }
 
-func (n *matchNodeOfInteger) FindChildren(key MatchKey) iter.Seq[matchNode] {
-	return func(yield func(matchNode) bool) {
-		if child, ok := n.children[key.Integer]; ok {
-			if !yield(child) {
-				return
-			}
-		}
+// SearchContext is like Search but checks ctx while expanding the nodes matching the keys,
+// between the keys and every contextCheckInterval nodes, and returns ctx.Err() if ctx is done.
+func (t *MatchTree[T]) SearchContext(ctx context.Context, keys []MatchKey) ([]T, error) {
+	options := defaultSearchOptions
+	options.Context = ctx
+	return t.search(nil, keys, options)
+}
 
-		if len(n.inverseChildren) >= 1 {
-			refCounts := make([]int, len(n.inverseChildren))
-			for _, childIndex := range n.inverseChildIndexes[key.Integer] {
-				refCounts[childIndex]++
-			}
-			for childIndex, refCount := range refCounts {
-				if refCount >= 1 {
-					continue
-				}
-				if !yield(n.inverseChildren[childIndex].MatchNode) {
-					return
-				}
-			}
-		}
+// SearchAt is like Search but also skips the values of the rules expired at the time now
+// (see MatchRule.ExpiresAt).
+func (t *MatchTree[T]) SearchAt(now time.Time, keys []MatchKey) ([]T, error) {
+	options := defaultSearchOptions
+	options.Now = now.UnixNano()
+	return t.search(nil, keys, options)
+}
 
-		if child := n.anyChild; child != nil {
-			if !yield(child) {
-				return
-			}
-		}
+// SearchPage is like Search but returns only the page of the values starting at the offset, of at
+// most limit values, for paginating through them, and reports whether more values follow the page.
+// It returns an error if the offset or the limit is negative.
+func (t *MatchTree[T]) SearchPage(keys []MatchKey, offset, limit int) ([]T, bool, error) {
+	if offset < 0 || limit < 0 {
+		return nil, false, fmt.Errorf("matchtree: invalid page; offset=%v limit=%v", offset, limit)
+	}
+	values, err := t.search(nil, keys, defaultSearchOptions)
+	if err != nil || offset >= len(values) {
+		return nil, false, err
 	}
+	end := offset + min(limit, len(values)-offset)
+	if end == offset {
+		return nil, true, nil
+	}
+	return values[offset:end:end], end < len(values), nil
 }
 
-// ----- match node of integer interval -----
-
-type matchNodeOfIntegerInterval struct {
-	dummyMatchNode
+type searchOptions struct {
+	MinPriority     int64
+	KeepEqualValues bool // of different rules, see WithValueDedup and WithValueKey
+	Context         context.Context
+	Now             int64 // in Unix nanoseconds, math.MinInt64 to ignore expiry
+	FirstOnly       bool
+	Stats           *SearchStats // nil to collect no stats
+}
 
-	children            []integerIntervalAndMatchNode
-	inverseChildren     []matchNodeWithRefCount
-	inverseChildIndexes []integerIntervalAndMatchNodeIndexes
-	anyChild            matchNode
+var defaultSearchOptions = searchOptions{
+	MinPriority:     math.MinInt64,
+	KeepEqualValues: false,
+	Context:         nil,
+	Now:             math.MinInt64,
+	FirstOnly:       false,
+	Stats:           nil,
 }
 
-var _ matchNode = (*matchNodeOfIntegerInterval)(nil)
+// contextCheckInterval is the number of nodes expanded between two checks of the context.
+const contextCheckInterval = 64
+
+func (t *MatchTree[T]) search(dst []T, keys []MatchKey, options searchOptions) ([]T, error) {
+	buffer := nodesBufferPool.Get().(*nodesBuffer)
+	defer nodesBufferPool.Put(buffer)
 
-type integerIntervalAndMatchNode struct {
-	IntegerInterval IntegerInterval
-	MatchNode       matchNode
+	results, err := t.searchResults(keys, buffer, options)
+	if err != nil {
+		return dst, err
+	}
+	if len(results) == 0 {
+		return dst, nil
+	}
+
+	dst = slices.Grow(dst, len(results))
+	n := len(dst)
+	for _, result := range results {
+		dst = append(dst, t.values[result.ValueIndex])
+	}
+	if (t.valueEqual != nil || t.valueKey != nil) && !options.KeepEqualValues {
+		dst = dst[:n+len(dedupValuesWith(dst[n:], t.valueEqual, t.valueKey))]
+	}
+	return dst, nil
 }
 
-type integerIntervalAndMatchNodeIndexes struct {
-	IntegerInterval  IntegerInterval
-	MatchNodeIndexes []int
+// dedupValuesWith removes in place the values with the same key as a preceding one if key is not
+// nil, or else the values equal to a preceding one if equal is not nil, and returns the shortened
+// slice.
+func dedupValuesWith[T any](values []T, equal func(x, y T) bool, key func(T) string) []T {
+	switch {
+	case key != nil:
+		return dedupValuesByKey(values, key)
+	case equal != nil:
+		return dedupValues(values, equal)
+	default:
+		return values
+	}
 }
 
-func (n *matchNodeOfIntegerInterval) GetOrInsertChild(pattern *MatchPattern, newChildType MatchType) matchNode {
-	if pattern.IsAny {
-		child := n.anyChild
-		if child == nil {
-			child = newMatchNode(newChildType)
-			n.anyChild = child
+// dedupValuesByKey removes in place the values with the same key as a preceding one as per the
+// function, and returns the shortened slice.
+func dedupValuesByKey[T any](values []T, key func(T) string) []T {
+	seenKeys := make(map[string]struct{}, len(values))
+	n := 0
+	for _, value := range values {
+		k := key(value)
+		if _, ok := seenKeys[k]; ok {
+			continue
 		}
-		return child
+		seenKeys[k] = struct{}{}
+		values[n] = value
+		n++
 	}
+	clear(values[n:])
+	return values[:n]
+}
 
-	if pattern.IsInverse {
-		refCounts := make([]int, len(n.inverseChildren))
-		for _, v := range pattern.IntegerIntervals {
-			i := slices.IndexFunc(n.inverseChildIndexes, func(x integerIntervalAndMatchNodeIndexes) bool {
-				return x.IntegerInterval.Equals(v)
-			})
-			if i < 0 {
-				continue
-			}
-			for _, childIndex := range n.inverseChildIndexes[i].MatchNodeIndexes {
-				refCounts[childIndex]++
-			}
-		}
-		maxRefCount := len(pattern.IntegerIntervals)
-		for childIndex, refCount := range refCounts {
-			if refCount == maxRefCount && n.inverseChildren[childIndex].MaxRefCount == maxRefCount {
-				return n.inverseChildren[childIndex].MatchNode
-			}
-		}
-		newChild := newMatchNode(newChildType)
-		newChildIndex := len(n.inverseChildren)
-		n.inverseChildren = append(n.inverseChildren, matchNodeWithRefCount{
-			MatchNode:   newChild,
-			MaxRefCount: maxRefCount,
-		})
-		for _, v := range pattern.IntegerIntervals {
-			i := slices.IndexFunc(n.inverseChildIndexes, func(x integerIntervalAndMatchNodeIndexes) bool {
-				return x.IntegerInterval.Equals(v)
-			})
-			if i < 0 {
-				n.inverseChildIndexes = append(n.inverseChildIndexes, integerIntervalAndMatchNodeIndexes{
-					IntegerInterval:  v,
-					MatchNodeIndexes: []int{newChildIndex},
-				})
-				continue
-			}
-			n.inverseChildIndexes[i].MatchNodeIndexes = append(n.inverseChildIndexes[i].MatchNodeIndexes, newChildIndex)
+// dedupValues removes in place the values equal to a preceding one as per the function, and
+// returns the shortened slice.
+func dedupValues[T any](values []T, equal func(x, y T) bool) []T {
+	n := 0
+	for _, value := range values {
+		if slices.ContainsFunc(values[:n], func(v T) bool { return equal(v, value) }) {
+			continue
 		}
-		return newChild
+		values[n] = value
+		n++
 	}
+	clear(values[n:])
+	return values[:n]
+}
 
-	if childIndex := slices.IndexFunc(n.children, func(x integerIntervalAndMatchNode) bool {
-		return x.IntegerInterval.Equals(pattern.currentIntegerInterval)
-	}); childIndex >= 0 {
-		return n.children[childIndex].MatchNode
+// searchResults returns the results matching the keys, sorted and filtered as per the options.
+// The results may be held by the buffer, so they are only valid until the buffer is reused.
+func (t *MatchTree[T]) searchResults(keys []MatchKey, buffer *nodesBuffer, options searchOptions) ([]matchResult, error) {
+	onSearch := t.metrics.OnSearch
+	if onSearch == nil {
+		return t.findResults(keys, buffer, options)
 	}
-	newChild := newMatchNode(newChildType)
-	n.children = append(n.children, integerIntervalAndMatchNode{
-		IntegerInterval: pattern.currentIntegerInterval,
-		MatchNode:       newChild,
-	})
-	return newChild
+	start := time.Now()
+	results, err := t.findResults(keys, buffer, options)
+	if err != nil {
+		return nil, err
+	}
+	onSearch(len(keys), len(results), time.Since(start))
+	return results, nil
 }
 
-func (n *matchNodeOfIntegerInterval) FindChildren(key MatchKey) iter.Seq[matchNode] {
-	return func(yield func(matchNode) bool) {
-		for i := range n.children {
-			if n.children[i].IntegerInterval.Contains(key.Integer) {
-				if !yield(n.children[i].MatchNode) {
-					return
-				}
-			}
-		}
+// findResults is searchResults without reporting the search.
+func (t *MatchTree[T]) findResults(keys []MatchKey, buffer *nodesBuffer, options searchOptions) ([]matchResult, error) {
+	if err := checkKeys(t.types, keys); err != nil {
+		return nil, err
+	}
 
-		if len(n.inverseChildren) >= 1 {
-			refCounts := make([]int, len(n.inverseChildren))
-			for _, v := range n.inverseChildIndexes {
-				if !v.IntegerInterval.Contains(key.Integer) {
-					continue
-				}
-				for _, childIndex := range v.MatchNodeIndexes {
-					refCounts[childIndex]++
-				}
-			}
-			for childIndex, refCount := range refCounts {
-				if refCount >= 1 {
-					continue
-				}
-				if !yield(n.inverseChildren[childIndex].MatchNode) {
-					return
+	if t.root == nil {
+		return nil, nil
+	}
+
+	keys = normalizeKeys(keys, t.stringForm)
+	nodes := append(buffer.Nodes[:0], t.root)
+	nextNodes := buffer.NextNodes[:0]
+	defer func() {
+		clear(nodes)
+		clear(nextNodes)
+		buffer.Nodes, buffer.NextNodes = nodes[:0], nextNodes[:0]
+	}()
+	ctx := options.Context
+	stats := options.Stats
+	if stats != nil {
+		stats.MaxFrontierSize = 1
+	}
+	for _, key := range keys {
+		if t.visitCounts != nil {
+			t.visitCounts.add(nodes)
+		}
+		for i, node := range nodes {
+			if ctx != nil && i%contextCheckInterval == 0 {
+				if err := ctx.Err(); err != nil {
+					return nil, err
 				}
 			}
-		}
 
-		if child := n.anyChild; child != nil {
-			if !yield(child) {
-				return
-			}
+			// non-leaf
+			nextNodes = node.FindChildren(nextNodes, key)
+		}
+		if stats != nil {
+			stats.NodesVisited += len(nodes)
+			stats.ChildrenYielded += len(nextNodes)
+			stats.MaxFrontierSize = max(stats.MaxFrontierSize, len(nextNodes))
+		}
+		nodes, nextNodes = nextNodes, nodes[:0]
+	}
+	if len(nodes) == 0 {
+		return nil, nil
+	}
+	if ctx != nil {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if t.visitCounts != nil {
+		t.visitCounts.add(nodes)
+	}
+	for _, node := range nodes {
+		if err := checkLeaf(node); err != nil {
+			return nil, err
 		}
 	}
-}
-
-// ----- match node of number interval -----
 
-type matchNodeOfNumberInterval struct {
-	dummyMatchNode
+	return extractResults(nodes, buffer, options), nil
+}
 
-	children            []numberIntervalAndMatchNode
-	inverseChildren     []matchNodeWithRefCount
-	inverseChildIndexes []numberIntervalAndMatchNodeIndexes
-	anyChild            matchNode
+// SearchResult describes a value found by SearchDetailed.
+type SearchResult[T any] struct {
+	Value    T
+	Priority int64
+	RuleID   RuleID
+	// Labels holds the labels of the rule, which must not be modified.
+	Labels map[string]string
 }
 
-var _ matchNode = (*matchNodeOfNumberInterval)(nil)
+// SearchDetailed is like Search but returns the values along with the details of their rules.
+func (t *MatchTree[T]) SearchDetailed(keys []MatchKey) ([]SearchResult[T], error) {
+	buffer := nodesBufferPool.Get().(*nodesBuffer)
+	defer nodesBufferPool.Put(buffer)
 
-type numberIntervalAndMatchNode struct {
-	NumberInterval NumberInterval
-	MatchNode      matchNode
+	results, err := t.searchResults(keys, buffer, defaultSearchOptions)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+
+	searchResults := make([]SearchResult[T], len(results))
+	for i, result := range results {
+		searchResults[i] = SearchResult[T]{
+			Value:    t.values[result.ValueIndex],
+			Priority: result.Priority,
+			RuleID:   result.RuleID,
+			Labels:   t.rules[result.RuleID].Labels,
+		}
+	}
+	return searchResults, nil
 }
 
-type numberIntervalAndMatchNodeIndexes struct {
-	NumberInterval   NumberInterval
-	MatchNodeIndexes []int
+// PriorityGroup holds the values found by SearchGroupedByPriority with the same priority.
+type PriorityGroup[T any] struct {
+	Priority int64
+	Values   []T
 }
 
-func (n *matchNodeOfNumberInterval) GetOrInsertChild(pattern *MatchPattern, newChildType MatchType) matchNode {
-	if pattern.IsAny {
-		child := n.anyChild
-		if child == nil {
-			child = newMatchNode(newChildType)
-			n.anyChild = child
-		}
-		return child
+// SearchGroupedByPriority is like Search but buckets the values by the priorities of their rules,
+// for evaluating the rules tier by tier. The groups are sorted by priority (descending), and the
+// values of each group by their insertion order.
+func (t *MatchTree[T]) SearchGroupedByPriority(keys []MatchKey) ([]PriorityGroup[T], error) {
+	buffer := nodesBufferPool.Get().(*nodesBuffer)
+	defer nodesBufferPool.Put(buffer)
+
+	results, err := t.searchResults(keys, buffer, defaultSearchOptions)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil
 	}
 
-	if pattern.IsInverse {
-		refCounts := make([]int, len(n.inverseChildren))
-		for _, v := range pattern.NumberIntervals {
-			i := slices.IndexFunc(n.inverseChildIndexes, func(x numberIntervalAndMatchNodeIndexes) bool {
-				return x.NumberInterval.Equals(v)
-			})
-			if i < 0 {
+	// the groups share the backing array of the values
+	var groups []PriorityGroup[T]
+	values := make([]T, 0, len(results))
+	var seenKeys map[string]struct{}
+	if t.valueKey != nil {
+		seenKeys = make(map[string]struct{}, len(results))
+	}
+	for _, result := range results {
+		value := t.values[result.ValueIndex]
+		if t.valueKey != nil {
+			k := t.valueKey(value)
+			if _, ok := seenKeys[k]; ok {
 				continue
 			}
-			for _, childIndex := range n.inverseChildIndexes[i].MatchNodeIndexes {
-				refCounts[childIndex]++
-			}
-		}
-		maxRefCount := len(pattern.NumberIntervals)
-		for childIndex, refCount := range refCounts {
-			if refCount == maxRefCount && n.inverseChildren[childIndex].MaxRefCount == maxRefCount {
-				return n.inverseChildren[childIndex].MatchNode
-			}
+			seenKeys[k] = struct{}{}
+		} else if t.valueEqual != nil && slices.ContainsFunc(values, func(v T) bool { return t.valueEqual(v, value) }) {
+			continue
 		}
-		newChild := newMatchNode(newChildType)
-		newChildIndex := len(n.inverseChildren)
-		n.inverseChildren = append(n.inverseChildren, matchNodeWithRefCount{
-			MatchNode:   newChild,
-			MaxRefCount: maxRefCount,
-		})
-		for _, v := range pattern.NumberIntervals {
-			i := slices.IndexFunc(n.inverseChildIndexes, func(x numberIntervalAndMatchNodeIndexes) bool {
-				return x.NumberInterval.Equals(v)
-			})
-			if i < 0 {
-				n.inverseChildIndexes = append(n.inverseChildIndexes, numberIntervalAndMatchNodeIndexes{
-					NumberInterval:   v,
-					MatchNodeIndexes: []int{newChildIndex},
-				})
-				continue
-			}
-			n.inverseChildIndexes[i].MatchNodeIndexes = append(n.inverseChildIndexes[i].MatchNodeIndexes, newChildIndex)
+		if len(groups) == 0 || groups[len(groups)-1].Priority != result.Priority {
+			groups = append(groups, PriorityGroup[T]{Priority: result.Priority})
 		}
-		return newChild
+		values = append(values, value)
+		group := &groups[len(groups)-1]
+		group.Values = values[len(values)-len(group.Values)-1 : len(values) : len(values)]
 	}
+	return groups, nil
+}
 
-	if childIndex := slices.IndexFunc(n.children, func(x numberIntervalAndMatchNode) bool {
-		return x.NumberInterval.Equals(pattern.currentNumberInterval)
-	}); childIndex >= 0 {
-		return n.children[childIndex].MatchNode
+// SearchOrDefault is like Search but returns only the top value, i.e. the first value Search
+// would return, or def if no value matches the keys.
+func (t *MatchTree[T]) SearchOrDefault(keys []MatchKey, def T) (T, error) {
+	value, ok, err := t.SearchFirstMatch(keys)
+	if err != nil || !ok {
+		return def, err
 	}
-	newChild := newMatchNode(newChildType)
-	n.children = append(n.children, numberIntervalAndMatchNode{
-		NumberInterval: pattern.currentNumberInterval,
-		MatchNode:      newChild,
-	})
-	return newChild
+	return value, nil
 }
 
-func (n *matchNodeOfNumberInterval) FindChildren(key MatchKey) iter.Seq[matchNode] {
-	return func(yield func(matchNode) bool) {
-		for i := range n.children {
-			if n.children[i].NumberInterval.Contains(key.Number) {
-				if !yield(n.children[i].MatchNode) {
-					return
-				}
-			}
+// SearchFirstMatch returns the value of the first rule, by priority and then by insertion order,
+// that matches the keys, like a rule list where evaluation stops at the first match; it reports
+// false if no rule matches. Only that single value is returned: the results of the matching leaf
+// nodes are not merged beyond the first one, and the values are not collected.
+func (t *MatchTree[T]) SearchFirstMatch(keys []MatchKey) (T, bool, error) {
+	buffer := nodesBufferPool.Get().(*nodesBuffer)
+	defer nodesBufferPool.Put(buffer)
+
+	options := defaultSearchOptions
+	options.FirstOnly = true
+	results, err := t.searchResults(keys, buffer, options)
+	if err != nil || len(results) == 0 {
+		var zero T
+		return zero, false, err
+	}
+	return t.values[results[0].ValueIndex], true, nil
+}
+
+// SearchWeightedOne returns a value picked at random with rng among the values of the highest
+// priority matching the keys, each with a chance proportional to the Weight of its rule, e.g. for
+// load balancing among equally preferred targets; it reports false if no value matches.
+// A nil rng stands for the global source of math/rand. The weights are summed up to
+// math.MaxUint64 at most, so if they add up to more, the values ordered last, as in Search, get
+// less than their share.
+func (t *MatchTree[T]) SearchWeightedOne(keys []MatchKey, rng *rand.Rand) (T, bool, error) {
+	buffer := nodesBufferPool.Get().(*nodesBuffer)
+	defer nodesBufferPool.Put(buffer)
+
+	results, err := t.searchResults(keys, buffer, defaultSearchOptions)
+	if err != nil || len(results) == 0 {
+		var zero T
+		return zero, false, err
+	}
+
+	// the results are sorted by priority, so the highest priority tier leads
+	totalWeight := uint64(0)
+	n := 0
+	for _, result := range results {
+		if result.Priority != results[0].Priority {
+			break
 		}
+		if weight := uint64(max(result.Weight, 1)); totalWeight > math.MaxUint64-weight {
+			totalWeight = math.MaxUint64
+		} else {
+			totalWeight += weight
+		}
+		n++
+	}
+	x := randUint64n(rng, totalWeight)
+	for _, result := range results[:n] {
+		weight := uint64(max(result.Weight, 1))
+		if x < weight {
+			return t.values[result.ValueIndex], true, nil
+		}
+		x -= weight
+	}
+	panic("unreachable")
+}
 
-		if len(n.inverseChildren) >= 1 {
-			refCounts := make([]int, len(n.inverseChildren))
-			for _, v := range n.inverseChildIndexes {
-				if !v.NumberInterval.Contains(key.Number) {
-					continue
-				}
-				for _, childIndex := range v.MatchNodeIndexes {
-					refCounts[childIndex]++
-				}
+// randUint64n returns a uniformly distributed random number in [0,n) from rng, or from the global
+// source of math/rand if rng is nil.
+func randUint64n(rng *rand.Rand, n uint64) uint64 {
+	next := rand.Uint64
+	if rng != nil {
+		next = rng.Uint64
+	}
+	if n&(n-1) == 0 {
+		return next() & (n - 1)
+	}
+	// reject the numbers past the largest multiple of n to avoid the modulo bias
+	limit := math.MaxUint64 - math.MaxUint64%n
+	for {
+		if x := next(); x < limit {
+			return x % n
+		}
+	}
+}
+
+// SearchAny reports whether any value matches the keys, like len(Search(keys)) >= 1 but
+// without collecting the values: the tree is traversed depth-first and the search stops at
+// the first leaf node with results.
+func (t *MatchTree[T]) SearchAny(keys []MatchKey) (bool, error) {
+	if err := checkKeys(t.types, keys); err != nil {
+		return false, err
+	}
+
+	if t.root == nil {
+		return false, nil
+	}
+
+	buffer := nodesBufferPool.Get().(*nodesBuffer)
+	defer nodesBufferPool.Put(buffer)
+
+	keys = normalizeKeys(keys, t.stringForm)
+	nodes := append(buffer.Nodes[:0], t.root)
+	depths := append(buffer.Depths[:0], 0)
+	defer func() {
+		clear(nodes)
+		buffer.Nodes, buffer.Depths = nodes[:0], depths[:0]
+	}()
+	for len(nodes) >= 1 {
+		node, depth := nodes[len(nodes)-1], depths[len(depths)-1]
+		nodes, depths = nodes[:len(nodes)-1], depths[:len(depths)-1]
+		if depth == len(keys) {
+			// leaf
+			if err := checkLeaf(node); err != nil {
+				return false, err
 			}
-			for childIndex, refCount := range refCounts {
-				if refCount >= 1 {
-					continue
-				}
-				if !yield(n.inverseChildren[childIndex].MatchNode) {
-					return
-				}
+			if slices.ContainsFunc(node.GetResults(), matchResult.isEnabled) {
+				return true, nil
 			}
+			continue
 		}
 
-		if child := n.anyChild; child != nil {
-			if !yield(child) {
-				return
-			}
+		// non-leaf
+		n := len(nodes)
+		nodes = node.FindChildren(nodes, keys[depth])
+		for range len(nodes) - n {
+			depths = append(depths, depth+1)
 		}
 	}
+	return false, nil
 }
 
-// ----- match node of regexp -----
+type nodesBuffer struct {
+	Nodes       []matchNode
+	NextNodes   []matchNode
+	Depths      []int
+	ResultLists [][]matchResult
+	Results     []matchResult
+}
 
-type matchNodeOfRegexp struct {
-	dummyMatchNode
+var nodesBufferPool = sync.Pool{New: func() any { return new(nodesBuffer) }}
 
-	children        []regexpAndMatchNode
-	inverseChildren []regexpAndMatchNode
-	anyChild        matchNode
+func checkKeys(types []MatchType, keys []MatchKey) error {
+	if len(keys) != len(types) {
+		return fmt.Errorf("%w; expected=%v actual=%v", ErrKeyCountMismatch, len(types), len(keys))
+	}
+	for i, key := range keys {
+		type1 := types[i]
+		if key.Type != type1 {
+			return &TypeMismatchError{Index: i, Expected: type1, Actual: key.Type}
+		}
+	}
+	return nil
 }
 
-var _ matchNode = (*matchNodeOfRegexp)(nil)
-
-type regexpAndMatchNode struct {
-	Regexp    *regexp.Regexp
-	MatchNode matchNode
+// checkLeaf returns an error wrapping ErrMisalignedTree if the node reached by the last key of a
+// search is not a leaf node.
+func checkLeaf(node matchNode) error {
+	if _, ok := node.(*matchNodeOfNone); !ok {
+		return fmt.Errorf("%w; node=%T", ErrMisalignedTree, node)
+	}
+	return nil
 }
 
-func (n *matchNodeOfRegexp) GetOrInsertChild(pattern *MatchPattern, newChildType MatchType) matchNode {
-	if pattern.IsAny {
-		child := n.anyChild
-		if child == nil {
-			child = newMatchNode(newChildType)
-			n.anyChild = child
+func extractResults(nodes []matchNode, buffer *nodesBuffer, options searchOptions) []matchResult {
+	n := 0
+	for _, node := range nodes {
+		n += len(node.GetResults())
+	}
+	if n == 1 {
+		if options.Stats != nil {
+			options.Stats.UsedSingleResultFastPath = true
+		}
+		// leaf nodes of removed rules may have no results
+		i := slices.IndexFunc(nodes, func(node matchNode) bool { return len(node.GetResults()) == 1 })
+		results := nodes[i].GetResults()
+		if results[0].Priority < options.MinPriority || !results[0].isActiveAt(options.Now) {
+			return nil
 		}
-		return child
+		return results
 	}
 
-	var children *[]regexpAndMatchNode
-	if pattern.IsInverse {
-		children = &n.inverseChildren
-	} else {
-		children = &n.children
+	resultLists := buffer.ResultLists[:0]
+	for _, node := range nodes {
+		resultLists = append(resultLists, resultsAbovePriority(node.GetResults(), options.MinPriority))
 	}
-	for _, child := range *children {
-		if child.Regexp == pattern.compiledRegexp {
-			return child.MatchNode
-		}
+	results := mergeResults(buffer.Results[:0], resultLists, options)
+	clear(resultLists)
+	buffer.ResultLists, buffer.Results = resultLists, results
+	return results
+}
+
+// resultsAbovePriority returns the leading results, sorted with compareResults, whose priorities
+// are not less than minPriority.
+func resultsAbovePriority(results []matchResult, minPriority int64) []matchResult {
+	if minPriority == math.MinInt64 {
+		return results
 	}
-	newChild := newMatchNode(newChildType)
-	*children = append(*children, regexpAndMatchNode{
-		Regexp:    pattern.compiledRegexp,
-		MatchNode: newChild,
+	i, _ := slices.BinarySearchFunc(results, minPriority, func(result matchResult, minPriority int64) int {
+		if result.Priority >= minPriority {
+			return -1
+		}
+		return 1
 	})
-	return newChild
+	return results[:i]
 }
 
-func (n *matchNodeOfRegexp) FindChildren(key MatchKey) iter.Seq[matchNode] {
-	return func(yield func(matchNode) bool) {
-		for _, child := range n.children {
-			if child.Regexp.MatchString(key.String) {
-				if !yield(child.MatchNode) {
-					return
-				}
-			}
-		}
+// compareResults orders results by priority (descending) and then by value index.
+func compareResults(x, y matchResult) int {
+	// cmp.Compare rather than a subtraction, which may overflow with priorities far apart
+	if c := cmp.Compare(y.Priority, x.Priority); c != 0 {
+		return c
+	}
+	return cmp.Compare(x.ValueIndex, y.ValueIndex)
+}
 
-		for _, child := range n.inverseChildren {
-			if !child.Regexp.MatchString(key.String) {
-				if !yield(child.MatchNode) {
-					return
-				}
-			}
+// mergeResults merges the sorted result lists into results with a k-way merge, skipping the results
+// not active at options.Now and the results with duplicate value indexes, i.e. of a rule reached
+// through several paths, and stopping at the first result if options.FirstOnly is true.
+// The result lists are consumed.
+func mergeResults(results []matchResult, resultLists [][]matchResult, options searchOptions) []matchResult {
+	n := 0
+	for _, resultList := range resultLists {
+		if len(resultList) >= 1 {
+			resultLists[n] = resultList
+			n++
 		}
+	}
+	resultLists = resultLists[:n]
+	for i := len(resultLists)/2 - 1; i >= 0; i-- {
+		siftDownResultLists(resultLists, i)
+	}
 
-		if child := n.anyChild; child != nil {
-			if !yield(child) {
-				return
+	lastValueIndex := -1
+	for len(resultLists) >= 1 {
+		result := resultLists[0][0]
+		if result.isActiveAt(options.Now) && result.ValueIndex != lastValueIndex {
+			results = append(results, result)
+			if options.FirstOnly {
+				break
 			}
+			lastValueIndex = result.ValueIndex
+		}
+		if len(resultLists[0]) == 1 {
+			resultLists[0] = resultLists[len(resultLists)-1]
+			resultLists = resultLists[:len(resultLists)-1]
+		} else {
+			resultLists[0] = resultLists[0][1:]
 		}
+		siftDownResultLists(resultLists, 0)
 	}
+	return results
 }
 
-// ----- match node common -----
-
-type matchNodeWithRefCount struct {
-	MatchNode   matchNode
-	MaxRefCount int
+// siftDownResultLists maintains the min-heap of result lists ordered by their first results.
+func siftDownResultLists(resultLists [][]matchResult, i int) {
+	for {
+		j := 2*i + 1
+		if j >= len(resultLists) {
+			return
+		}
+		if k := j + 1; k < len(resultLists) && compareResults(resultLists[k][0], resultLists[j][0]) < 0 {
+			j = k
+		}
+		if compareResults(resultLists[i][0], resultLists[j][0]) <= 0 {
+			return
+		}
+		resultLists[i], resultLists[j] = resultLists[j], resultLists[i]
+		i = j
+	}
 }
@@ -1,14 +1,25 @@
 package matchtree_test
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"math"
+	"math/rand"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	. "github.com/roy2220/matchtree"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+	"golang.org/x/text/unicode/norm"
+	"gopkg.in/yaml.v3"
 )
 
 type TestSuite struct {
@@ -24,25 +35,33 @@ type TestCase struct {
 	Values    []string   `json:"values"`
 }
 
-func TestMatchTree_Search(t *testing.T) {
+func loadTestSuites(t *testing.T) []TestSuite {
 	data, err := os.ReadFile("testsuites.json")
 	require.NoError(t, err)
 
 	var suites []TestSuite
 	err = json.Unmarshal(data, &suites)
 	require.NoError(t, err)
+	return suites
+}
 
-	for _, suite := range suites {
-		matchTree := NewMatchTree[string](suite.MatchTypes)
+func buildMatchTree(t *testing.T, suite TestSuite) *MatchTree[string] {
+	matchTree := NewMatchTree[string](suite.MatchTypes)
 
-		var optionFuncs []AddRuleOptionFunc
-		if suite.TreatEmptyPatternAsAny {
-			optionFuncs = append(optionFuncs, TreatEmptyPatternAsAny())
-		}
-		for _, matchRule := range suite.MatchRules {
-			err = matchTree.AddRule(matchRule, optionFuncs...)
-			require.NoError(t, err)
-		}
+	var optionFuncs []AddRuleOptionFunc
+	if suite.TreatEmptyPatternAsAny {
+		optionFuncs = append(optionFuncs, TreatEmptyPatternAsAny())
+	}
+	for _, matchRule := range suite.MatchRules {
+		_, err := matchTree.AddRule(matchRule, optionFuncs...)
+		require.NoError(t, err)
+	}
+	return matchTree
+}
+
+func TestMatchTree_Search(t *testing.T) {
+	for _, suite := range loadTestSuites(t) {
+		matchTree := buildMatchTree(t, suite)
 
 		for i, case1 := range suite.Cases {
 			t.Run(fmt.Sprintf("%s#%d", suite.Scenario, i+1), func(t *testing.T) {
@@ -313,6 +332,266 @@ func TestIntegerInterval_Contains(t *testing.T) {
 	}
 }
 
+func TestIntegerInterval_Overlaps(t *testing.T) {
+	f := Int64Ptr
+
+	tests := []struct {
+		name string
+		i    IntegerInterval
+		j    IntegerInterval
+		want bool
+	}{
+		{
+			name: "disjoint intervals",
+			i:    IntegerInterval{Min: f(1), Max: f(2)},
+			j:    IntegerInterval{Min: f(3), Max: f(4)},
+			want: false,
+		},
+		{
+			name: "intersecting intervals",
+			i:    IntegerInterval{Min: f(1), Max: f(5)},
+			j:    IntegerInterval{Min: f(3), Max: f(10)},
+			want: true,
+		},
+		{
+			name: "nested intervals",
+			i:    IntegerInterval{Min: f(1), Max: f(10)},
+			j:    IntegerInterval{Min: f(3), MinIsExcluded: true, Max: f(5), MaxIsExcluded: true},
+			want: true,
+		},
+		{
+			name: "touching at included endpoints",
+			i:    IntegerInterval{Min: f(1), Max: f(5)},
+			j:    IntegerInterval{Min: f(5), Max: f(10)},
+			want: true,
+		},
+		{
+			name: "touching at excluded max",
+			i:    IntegerInterval{Min: f(1), Max: f(5), MaxIsExcluded: true},
+			j:    IntegerInterval{Min: f(5), Max: f(10)},
+			want: false,
+		},
+		{
+			name: "touching at excluded min",
+			i:    IntegerInterval{Min: f(1), Max: f(5)},
+			j:    IntegerInterval{Min: f(5), MinIsExcluded: true, Max: f(10)},
+			want: false,
+		},
+		{
+			name: "adjacent integers",
+			i:    IntegerInterval{Min: f(1), Max: f(5)},
+			j:    IntegerInterval{Min: f(6), Max: f(10)},
+			want: false,
+		},
+		{
+			name: "open interval without integers",
+			i:    IntegerInterval{Min: f(1), MinIsExcluded: true, Max: f(2), MaxIsExcluded: true},
+			j:    IntegerInterval{Min: f(0), Max: f(3)},
+			want: false,
+		},
+		{
+			name: "extreme bounds",
+			i:    IntegerInterval{Min: f(math.MaxInt64)},
+			j:    IntegerInterval{Max: f(math.MaxInt64)},
+			want: true,
+		},
+		{
+			name: "excluded extreme bound",
+			i:    IntegerInterval{Min: f(math.MaxInt64), MinIsExcluded: true},
+			j:    IntegerInterval{},
+			want: false,
+		},
+		{
+			name: "unbounded intervals",
+			i:    IntegerInterval{Max: f(5)},
+			j:    IntegerInterval{Min: f(-5)},
+			want: true,
+		},
+		{
+			name: "lower bounded and upper bounded, disjoint",
+			i:    IntegerInterval{Min: f(5), MinIsExcluded: true},
+			j:    IntegerInterval{Max: f(5)},
+			want: false,
+		},
+		{
+			name: "fully unbounded interval",
+			i:    IntegerInterval{},
+			j:    IntegerInterval{Min: f(1), Max: f(2)},
+			want: true,
+		},
+		{
+			name: "empty interval",
+			i:    IntegerInterval{Min: f(5), MinIsExcluded: true, Max: f(5)},
+			j:    IntegerInterval{},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.i.Overlaps(tt.j); got != tt.want {
+				t.Errorf("IntegerInterval.Overlaps() for %v with %v = %v, want %v", tt.i, tt.j, got, tt.want)
+			}
+			if got := tt.j.Overlaps(tt.i); got != tt.want {
+				t.Errorf("IntegerInterval.Overlaps() for %v with %v = %v, want %v", tt.j, tt.i, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIntegerInterval_ContainsInterval(t *testing.T) {
+	f := Int64Ptr
+
+	tests := []struct {
+		name string
+		i    IntegerInterval
+		j    IntegerInterval
+		want bool
+	}{
+		{
+			name: "nested open interval",
+			i:    IntegerInterval{Min: f(1), Max: f(10)},
+			j:    IntegerInterval{Min: f(2), MinIsExcluded: true, Max: f(9), MaxIsExcluded: true},
+			want: true,
+		},
+		{
+			name: "intersecting intervals",
+			i:    IntegerInterval{Min: f(2), Max: f(10)},
+			j:    IntegerInterval{Min: f(1), Max: f(5)},
+			want: false,
+		},
+		{
+			name: "equal intervals",
+			i:    IntegerInterval{Min: f(1), Max: f(5)},
+			j:    IntegerInterval{Min: f(1), Max: f(5)},
+			want: true,
+		},
+		{
+			name: "excluded endpoints with the same integers",
+			i:    IntegerInterval{Min: f(0), MinIsExcluded: true, Max: f(6), MaxIsExcluded: true},
+			j:    IntegerInterval{Min: f(1), Max: f(5)},
+			want: true,
+		},
+		{
+			name: "excluded endpoint",
+			i:    IntegerInterval{Min: f(1), MinIsExcluded: true, Max: f(5)},
+			j:    IntegerInterval{Min: f(1), Max: f(5)},
+			want: false,
+		},
+		{
+			name: "unbounded interval",
+			i:    IntegerInterval{},
+			j:    IntegerInterval{Min: f(math.MinInt64), Max: f(math.MaxInt64)},
+			want: true,
+		},
+		{
+			name: "lower bounded interval",
+			i:    IntegerInterval{Min: f(1)},
+			j:    IntegerInterval{Max: f(5)},
+			want: false,
+		},
+		{
+			name: "empty interval",
+			i:    IntegerInterval{Min: f(1), Max: f(2)},
+			j:    IntegerInterval{Min: f(5), MinIsExcluded: true, Max: f(5)},
+			want: true,
+		},
+		{
+			name: "within empty interval",
+			i:    IntegerInterval{Min: f(5), MinIsExcluded: true, Max: f(5)},
+			j:    IntegerInterval{Min: f(5), Max: f(5)},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.i.ContainsInterval(tt.j); got != tt.want {
+				t.Errorf("IntegerInterval.ContainsInterval() for %v with %v = %v, want %v", tt.i, tt.j, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIntegerInterval_IsEmpty(t *testing.T) {
+	f := Int64Ptr
+
+	tests := []struct {
+		name string
+		i    IntegerInterval
+		want bool
+	}{
+		{
+			name: "closed interval",
+			i:    IntegerInterval{Min: f(1), Max: f(5)},
+			want: false,
+		},
+		{
+			name: "degenerate closed interval",
+			i:    IntegerInterval{Min: f(5), Max: f(5)},
+			want: false,
+		},
+		{
+			name: "degenerate open interval",
+			i:    IntegerInterval{Min: f(5), MinIsExcluded: true, Max: f(5), MaxIsExcluded: true},
+			want: true,
+		},
+		{
+			name: "degenerate half-open interval [min, max)",
+			i:    IntegerInterval{Min: f(5), Max: f(5), MaxIsExcluded: true},
+			want: true,
+		},
+		{
+			name: "degenerate half-open interval (min, max]",
+			i:    IntegerInterval{Min: f(5), MinIsExcluded: true, Max: f(5)},
+			want: true,
+		},
+		{
+			name: "reversed interval",
+			i:    IntegerInterval{Min: f(6), Max: f(5)},
+			want: true,
+		},
+		{
+			name: "lower bounded interval",
+			i:    IntegerInterval{Min: f(5), MinIsExcluded: true},
+			want: false,
+		},
+		{
+			name: "upper bounded interval",
+			i:    IntegerInterval{Max: f(5), MaxIsExcluded: true},
+			want: false,
+		},
+		{
+			name: "unbounded interval",
+			i:    IntegerInterval{},
+			want: false,
+		},
+		{
+			name: "open interval without integers",
+			i:    IntegerInterval{Min: f(1), MinIsExcluded: true, Max: f(2), MaxIsExcluded: true},
+			want: true,
+		},
+		{
+			name: "excluded extreme lower bound",
+			i:    IntegerInterval{Min: f(math.MaxInt64), MinIsExcluded: true},
+			want: true,
+		},
+		{
+			name: "excluded extreme upper bound",
+			i:    IntegerInterval{Max: f(math.MinInt64), MaxIsExcluded: true},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.i.IsEmpty(); got != tt.want {
+				t.Errorf("IntegerInterval.IsEmpty() for %v = %v, want %v", tt.i, got, tt.want)
+			}
+		})
+	}
+}
+
 const epsilon = 1e-10
 
 func TestNumberInterval_Equals(t *testing.T) {
@@ -406,6 +685,30 @@ func TestNumberInterval_Equals(t *testing.T) {
 			i2:   NumberInterval{Min: &min1, Max: &max5},
 			want: false,
 		},
+		{
+			name: "equal intervals with infinite bounds",
+			i1:   NumberInterval{Min: Float64Ptr(math.Inf(-1)), Max: Float64Ptr(math.Inf(1)), MaxIsExcluded: true},
+			i2:   NumberInterval{Min: Float64Ptr(math.Inf(-1)), Max: Float64Ptr(math.Inf(1)), MaxIsExcluded: true},
+			want: true,
+		},
+		{
+			name: "unequal intervals with opposite infinite bounds",
+			i1:   NumberInterval{Min: Float64Ptr(math.Inf(-1)), Max: &max5},
+			i2:   NumberInterval{Min: Float64Ptr(math.Inf(1)), Max: &max5},
+			want: false,
+		},
+		{
+			name: "unequal intervals with infinite and finite bounds",
+			i1:   NumberInterval{Min: &min1, Max: Float64Ptr(math.Inf(1))},
+			i2:   NumberInterval{Min: &min1, Max: Float64Ptr(math.MaxFloat64)},
+			want: false,
+		},
+		{
+			name: "unequal intervals with infinite and nil bounds",
+			i1:   NumberInterval{Min: &min1, Max: Float64Ptr(math.Inf(1))},
+			i2:   NumberInterval{Min: &min1},
+			want: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -613,6 +916,48 @@ func TestNumberInterval_Contains(t *testing.T) {
 			x:    5.0 - epsilon/2, // within exclusion boundary, means not contained
 			want: false,
 		},
+		{
+			name: "infinite lower bound (included), contains finite",
+			i:    NumberInterval{Min: Float64Ptr(math.Inf(-1)), Max: &max5},
+			x:    -math.MaxFloat64,
+			want: true,
+		},
+		{
+			name: "infinite lower bound (included), contains -Inf",
+			i:    NumberInterval{Min: Float64Ptr(math.Inf(-1)), Max: &max5},
+			x:    math.Inf(-1),
+			want: true,
+		},
+		{
+			name: "infinite lower bound (excluded), does not contain -Inf",
+			i:    NumberInterval{Min: Float64Ptr(math.Inf(-1)), MinIsExcluded: true, Max: &max5},
+			x:    math.Inf(-1),
+			want: false,
+		},
+		{
+			name: "infinite upper bound (excluded), contains finite",
+			i:    NumberInterval{Min: &min1, Max: Float64Ptr(math.Inf(1)), MaxIsExcluded: true},
+			x:    math.MaxFloat64,
+			want: true,
+		},
+		{
+			name: "infinite upper bound (excluded), does not contain +Inf",
+			i:    NumberInterval{Min: &min1, Max: Float64Ptr(math.Inf(1)), MaxIsExcluded: true},
+			x:    math.Inf(1),
+			want: false,
+		},
+		{
+			name: "infinite upper bound (included), contains +Inf",
+			i:    NumberInterval{Min: &min1, Max: Float64Ptr(math.Inf(1))},
+			x:    math.Inf(1),
+			want: true,
+		},
+		{
+			name: "infinite upper bound, does not contain below finite min",
+			i:    NumberInterval{Min: &min1, Max: Float64Ptr(math.Inf(1)), MaxIsExcluded: true},
+			x:    1.0 - 2*epsilon,
+			want: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -623,3 +968,2903 @@ func TestNumberInterval_Contains(t *testing.T) {
 		})
 	}
 }
+
+func TestNumberInterval_Overlaps(t *testing.T) {
+	f := Float64Ptr
+
+	tests := []struct {
+		name string
+		i    NumberInterval
+		j    NumberInterval
+		want bool
+	}{
+		{
+			name: "disjoint intervals",
+			i:    NumberInterval{Min: f(1), Max: f(2)},
+			j:    NumberInterval{Min: f(3), Max: f(4)},
+			want: false,
+		},
+		{
+			name: "intersecting intervals",
+			i:    NumberInterval{Min: f(1), Max: f(5)},
+			j:    NumberInterval{Min: f(3), Max: f(10)},
+			want: true,
+		},
+		{
+			name: "nested intervals",
+			i:    NumberInterval{Min: f(1), Max: f(10)},
+			j:    NumberInterval{Min: f(3), MinIsExcluded: true, Max: f(4), MaxIsExcluded: true},
+			want: true,
+		},
+		{
+			name: "touching at included endpoints",
+			i:    NumberInterval{Min: f(1), Max: f(5)},
+			j:    NumberInterval{Min: f(5), Max: f(10)},
+			want: true,
+		},
+		{
+			name: "touching at excluded max",
+			i:    NumberInterval{Min: f(1), Max: f(5), MaxIsExcluded: true},
+			j:    NumberInterval{Min: f(5), Max: f(10)},
+			want: false,
+		},
+		{
+			name: "touching at excluded min",
+			i:    NumberInterval{Min: f(1), Max: f(5)},
+			j:    NumberInterval{Min: f(5), MinIsExcluded: true, Max: f(10)},
+			want: false,
+		},
+		{
+			name: "touching at included endpoints slightly apart",
+			i:    NumberInterval{Min: f(1), Max: f(5)},
+			j:    NumberInterval{Min: f(5 + epsilon/2), Max: f(10)},
+			want: true,
+		},
+		{
+			name: "touching at excluded max slightly apart",
+			i:    NumberInterval{Min: f(1), Max: f(5), MaxIsExcluded: true},
+			j:    NumberInterval{Min: f(5 + epsilon/2), Max: f(10)},
+			want: false,
+		},
+		{
+			name: "apart beyond precision",
+			i:    NumberInterval{Min: f(1), Max: f(5)},
+			j:    NumberInterval{Min: f(5 + 3*epsilon), Max: f(10)},
+			want: false,
+		},
+		{
+			name: "unbounded intervals",
+			i:    NumberInterval{Max: f(5)},
+			j:    NumberInterval{Min: f(-5)},
+			want: true,
+		},
+		{
+			name: "lower bounded and upper bounded, disjoint",
+			i:    NumberInterval{Min: f(5), MinIsExcluded: true},
+			j:    NumberInterval{Max: f(5)},
+			want: false,
+		},
+		{
+			name: "fully unbounded interval",
+			i:    NumberInterval{},
+			j:    NumberInterval{Min: f(1), Max: f(2)},
+			want: true,
+		},
+		{
+			name: "empty interval",
+			i:    NumberInterval{Min: f(5), MinIsExcluded: true, Max: f(5)},
+			j:    NumberInterval{},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.i.Overlaps(tt.j); got != tt.want {
+				t.Errorf("NumberInterval.Overlaps() for %v with %v = %v, want %v", tt.i, tt.j, got, tt.want)
+			}
+			if got := tt.j.Overlaps(tt.i); got != tt.want {
+				t.Errorf("NumberInterval.Overlaps() for %v with %v = %v, want %v", tt.j, tt.i, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNumberInterval_ContainsInterval(t *testing.T) {
+	f := Float64Ptr
+
+	tests := []struct {
+		name string
+		i    NumberInterval
+		j    NumberInterval
+		want bool
+	}{
+		{
+			name: "nested open interval",
+			i:    NumberInterval{Min: f(1), Max: f(10)},
+			j:    NumberInterval{Min: f(2), MinIsExcluded: true, Max: f(9), MaxIsExcluded: true},
+			want: true,
+		},
+		{
+			name: "intersecting intervals",
+			i:    NumberInterval{Min: f(2), Max: f(10)},
+			j:    NumberInterval{Min: f(1), Max: f(5)},
+			want: false,
+		},
+		{
+			name: "equal open intervals",
+			i:    NumberInterval{Min: f(1), MinIsExcluded: true, Max: f(5), MaxIsExcluded: true},
+			j:    NumberInterval{Min: f(1), MinIsExcluded: true, Max: f(5), MaxIsExcluded: true},
+			want: true,
+		},
+		{
+			name: "open interval within closed interval",
+			i:    NumberInterval{Min: f(1), Max: f(5)},
+			j:    NumberInterval{Min: f(1), MinIsExcluded: true, Max: f(5), MaxIsExcluded: true},
+			want: true,
+		},
+		{
+			name: "closed interval within open interval",
+			i:    NumberInterval{Min: f(1), MinIsExcluded: true, Max: f(5), MaxIsExcluded: true},
+			j:    NumberInterval{Min: f(1), Max: f(5)},
+			want: false,
+		},
+		{
+			name: "within precision",
+			i:    NumberInterval{Min: f(1), Max: f(5)},
+			j:    NumberInterval{Min: f(1 - epsilon/2), Max: f(5 + epsilon/2)},
+			want: true,
+		},
+		{
+			name: "beyond precision",
+			i:    NumberInterval{Min: f(1), Max: f(5)},
+			j:    NumberInterval{Min: f(1 - 2*epsilon), Max: f(5)},
+			want: false,
+		},
+		{
+			name: "unbounded interval",
+			i:    NumberInterval{},
+			j:    NumberInterval{Min: f(math.Inf(-1)), Max: f(math.Inf(1))},
+			want: true,
+		},
+		{
+			name: "unbounded interval within excluded infinities",
+			i:    NumberInterval{Min: f(math.Inf(-1)), MinIsExcluded: true, Max: f(math.Inf(1)), MaxIsExcluded: true},
+			j:    NumberInterval{},
+			want: false,
+		},
+		{
+			name: "upper bounded interval",
+			i:    NumberInterval{Max: f(5)},
+			j:    NumberInterval{Min: f(1)},
+			want: false,
+		},
+		{
+			name: "empty interval",
+			i:    NumberInterval{Min: f(1), Max: f(2)},
+			j:    NumberInterval{Min: f(5), MinIsExcluded: true, Max: f(5)},
+			want: true,
+		},
+		{
+			name: "within empty interval",
+			i:    NumberInterval{Min: f(5), MinIsExcluded: true, Max: f(5)},
+			j:    NumberInterval{Min: f(5), Max: f(5)},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.i.ContainsInterval(tt.j); got != tt.want {
+				t.Errorf("NumberInterval.ContainsInterval() for %v with %v = %v, want %v", tt.i, tt.j, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNumberInterval_SignedZero(t *testing.T) {
+	negativeZero := math.Copysign(0, -1)
+	i := NumberInterval{Min: Float64Ptr(negativeZero), Max: Float64Ptr(negativeZero)}
+	j := NumberInterval{Min: Float64Ptr(0), Max: Float64Ptr(0)}
+	assert.True(t, i.Equals(j))
+	for _, x := range []float64{negativeZero, 0} {
+		assert.True(t, i.Contains(x))
+		assert.True(t, j.Contains(x))
+		assert.False(t, NumberInterval{Min: Float64Ptr(negativeZero), MinIsExcluded: true}.Contains(x))
+		assert.False(t, NumberInterval{Max: Float64Ptr(0), MaxIsExcluded: true}.Contains(x))
+	}
+
+	interval, err := ParseNumberInterval("[-0,-0]")
+	require.NoError(t, err)
+	assert.False(t, math.Signbit(*interval.Min))
+	assert.False(t, math.Signbit(*interval.Max))
+	assert.Equal(t, "[0,0]", interval.String())
+
+	matchTree := NewMatchTree[string]([]MatchType{MatchNumberInterval})
+	_, err = matchTree.AddRule(MatchRule[string]{
+		Patterns: []MatchPattern{NumberIntervalPattern(NumberInterval{Min: Float64Ptr(negativeZero), Max: Float64Ptr(1)})},
+		Value:    "a",
+	})
+	require.NoError(t, err)
+	_, err = matchTree.AddRule(MatchRule[string]{
+		Patterns: []MatchPattern{NumberIntervalPattern(NumberInterval{Min: Float64Ptr(0), Max: Float64Ptr(1)})},
+		Value:    "b",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, matchTree.Stats().LeafCount)
+	for _, x := range []float64{negativeZero, 0} {
+		values, err := matchTree.Search([]MatchKey{NumberKey(x)})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "b"}, values)
+	}
+
+	data, err := json.Marshal(matchTree.ToRules())
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "-0")
+	var rules []MatchRule[string]
+	require.NoError(t, json.Unmarshal(data, &rules))
+	assert.Equal(t, matchTree.ToRules(), rules)
+}
+
+func TestNumberInterval_IsEmpty(t *testing.T) {
+	f := Float64Ptr
+
+	tests := []struct {
+		name string
+		i    NumberInterval
+		want bool
+	}{
+		{
+			name: "closed interval",
+			i:    NumberInterval{Min: f(1), Max: f(5)},
+			want: false,
+		},
+		{
+			name: "degenerate closed interval",
+			i:    NumberInterval{Min: f(5), Max: f(5)},
+			want: false,
+		},
+		{
+			name: "degenerate open interval",
+			i:    NumberInterval{Min: f(5), MinIsExcluded: true, Max: f(5), MaxIsExcluded: true},
+			want: true,
+		},
+		{
+			name: "degenerate half-open interval [min, max)",
+			i:    NumberInterval{Min: f(5), Max: f(5), MaxIsExcluded: true},
+			want: true,
+		},
+		{
+			name: "degenerate half-open interval (min, max]",
+			i:    NumberInterval{Min: f(5), MinIsExcluded: true, Max: f(5)},
+			want: true,
+		},
+		{
+			name: "reversed interval",
+			i:    NumberInterval{Min: f(6), Max: f(5)},
+			want: true,
+		},
+		{
+			name: "lower bounded interval",
+			i:    NumberInterval{Min: f(5), MinIsExcluded: true},
+			want: false,
+		},
+		{
+			name: "upper bounded interval",
+			i:    NumberInterval{Max: f(5), MaxIsExcluded: true},
+			want: false,
+		},
+		{
+			name: "unbounded interval",
+			i:    NumberInterval{},
+			want: false,
+		},
+		{
+			name: "open interval between integers",
+			i:    NumberInterval{Min: f(1), MinIsExcluded: true, Max: f(2), MaxIsExcluded: true},
+			want: false,
+		},
+		{
+			name: "closed interval reversed within precision",
+			i:    NumberInterval{Min: f(5 + epsilon/2), Max: f(5)},
+			want: false,
+		},
+		{
+			name: "half-open interval within precision",
+			i:    NumberInterval{Min: f(5), Max: f(5 + epsilon/2), MaxIsExcluded: true},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.i.IsEmpty(); got != tt.want {
+				t.Errorf("NumberInterval.IsEmpty() for %v = %v, want %v", tt.i, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchTree_Search_ManyIntegerIntervals(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	randomInterval := func() IntegerInterval {
+		var i IntegerInterval
+		if rand.Intn(8) != 0 {
+			i.Min = Int64Ptr(rand.Int63n(200) - 100)
+			i.MinIsExcluded = rand.Intn(2) == 0
+		}
+		if rand.Intn(8) != 0 {
+			i.Max = Int64Ptr(rand.Int63n(200) - 100)
+			i.MaxIsExcluded = rand.Intn(2) == 0
+		}
+		return i
+	}
+
+	matchTree := NewMatchTree[int]([]MatchType{MatchIntegerInterval})
+	var rules []MatchRule[int]
+	for i := range 1000 {
+		rule := MatchRule[int]{
+			Patterns: []MatchPattern{{
+				Type:             MatchIntegerInterval,
+				IsInverse:        rand.Intn(4) == 0,
+				IntegerIntervals: []IntegerInterval{randomInterval(), randomInterval()},
+			}},
+			Value:    i,
+			Priority: int64(rand.Intn(3)),
+		}
+		rules = append(rules, rule)
+		_, err := matchTree.AddRule(rule)
+		require.NoError(t, err)
+	}
+	frozenMatchTree := matchTree.Freeze()
+
+	for x := int64(-110); x <= 110; x++ {
+		var expectedValues []int
+		for priority := int64(2); priority >= 0; priority-- {
+			for _, rule := range rules {
+				pattern := rule.Patterns[0]
+				if rule.Priority != priority {
+					continue
+				}
+				contains := pattern.IntegerIntervals[0].Contains(x) || pattern.IntegerIntervals[1].Contains(x)
+				if contains != pattern.IsInverse {
+					expectedValues = append(expectedValues, rule.Value)
+				}
+			}
+		}
+
+		keys := []MatchKey{{Type: MatchIntegerInterval, Integer: x}}
+		values, err := matchTree.Search(keys)
+		require.NoError(t, err)
+		assert.Equal(t, expectedValues, values, "x=%v", x)
+		values, err = frozenMatchTree.Search(keys)
+		require.NoError(t, err)
+		assert.Equal(t, expectedValues, values, "x=%v", x)
+	}
+}
+
+func TestMatchTree_Search_IntegerIntervalExtremes(t *testing.T) {
+	minInt64, maxInt64 := Int64Ptr(math.MinInt64), Int64Ptr(math.MaxInt64)
+	matchTree := NewMatchTree[string]([]MatchType{MatchIntegerInterval})
+	require.NoError(t, matchTree.AddRules([]MatchRule[string]{
+		{Patterns: []MatchPattern{IntegerIntervalPattern(IntegerInterval{Min: minInt64, Max: maxInt64})}, Value: "closed"},
+		{Patterns: []MatchPattern{IntegerIntervalPattern(IntegerInterval{Min: minInt64, MinIsExcluded: true, Max: maxInt64, MaxIsExcluded: true})}, Value: "open"},
+		{Patterns: []MatchPattern{IntegerIntervalPattern(IntegerInterval{Min: maxInt64, MinIsExcluded: true})}, Value: "above_max"},
+		{Patterns: []MatchPattern{IntegerIntervalPattern(IntegerInterval{Max: minInt64, MaxIsExcluded: true})}, Value: "below_min"},
+		{Patterns: []MatchPattern{IntegerIntervalPattern(IntegerInterval{Min: maxInt64})}, Value: "max"},
+		{Patterns: []MatchPattern{IntegerIntervalPattern(IntegerInterval{Max: minInt64})}, Value: "min"},
+		{Patterns: []MatchPattern{InverseIntegerIntervalPattern(IntegerInterval{Min: minInt64, MinIsExcluded: true})}, Value: "not_above_min"},
+		{Patterns: []MatchPattern{InverseIntegerIntervalPattern(IntegerInterval{Max: maxInt64, MaxIsExcluded: true})}, Value: "not_below_max"},
+	}))
+
+	tests := []struct {
+		x    int64
+		want []string
+	}{
+		{math.MinInt64, []string{"closed", "min", "not_above_min"}},
+		{math.MinInt64 + 1, []string{"closed", "open"}},
+		{0, []string{"closed", "open"}},
+		{math.MaxInt64 - 1, []string{"closed", "open"}},
+		{math.MaxInt64, []string{"closed", "max", "not_below_max"}},
+	}
+	for _, tt := range tests {
+		values, err := matchTree.Search([]MatchKey{IntegerIntervalKey(tt.x)})
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, values, "%d", tt.x)
+		values, err = matchTree.Freeze().Search([]MatchKey{IntegerIntervalKey(tt.x)})
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, values, "frozen %d", tt.x)
+	}
+
+	for _, interval := range []IntegerInterval{
+		{Min: maxInt64, MinIsExcluded: true},
+		{Max: minInt64, MaxIsExcluded: true},
+		{Min: maxInt64, MinIsExcluded: true, Max: maxInt64},
+	} {
+		assert.True(t, interval.IsEmpty(), "%v", interval)
+		assert.False(t, interval.Contains(math.MinInt64), "%v", interval)
+		assert.False(t, interval.Contains(math.MaxInt64), "%v", interval)
+	}
+	assert.True(t, IntegerInterval{Min: minInt64, Max: minInt64}.Contains(math.MinInt64))
+	assert.True(t, IntegerInterval{Min: maxInt64, Max: maxInt64}.Contains(math.MaxInt64))
+	assert.True(t, IntegerInterval{Min: minInt64}.Overlaps(IntegerInterval{Max: minInt64}))
+	assert.False(t, IntegerInterval{Min: minInt64, MinIsExcluded: true}.Overlaps(IntegerInterval{Max: minInt64}))
+}
+
+func TestMatchTree_Search_NumberIntervalBoundaries(t *testing.T) {
+	min1 := 1.0
+	max5 := 5.0
+
+	tests := []struct {
+		name string
+		i    NumberInterval
+		x    float64
+		want bool
+	}{
+		{
+			name: "closed interval, contains min boundary slightly off",
+			i:    NumberInterval{Min: &min1, Max: &max5},
+			x:    1.0 - epsilon/2,
+			want: true,
+		},
+		{
+			name: "closed interval, contains max boundary slightly off",
+			i:    NumberInterval{Min: &min1, Max: &max5},
+			x:    5.0 + epsilon/2,
+			want: true,
+		},
+		{
+			name: "closed interval, does not contain below min (just outside)",
+			i:    NumberInterval{Min: &min1, Max: &max5},
+			x:    1.0 - 2*epsilon,
+			want: false,
+		},
+		{
+			name: "closed interval, does not contain above max (just outside)",
+			i:    NumberInterval{Min: &min1, Max: &max5},
+			x:    5.0 + 2*epsilon,
+			want: false,
+		},
+		{
+			name: "open interval, does not contain min boundary",
+			i:    NumberInterval{Min: &min1, MinIsExcluded: true, Max: &max5, MaxIsExcluded: true},
+			x:    1.0,
+			want: false,
+		},
+		{
+			name: "open interval, does not contain max boundary",
+			i:    NumberInterval{Min: &min1, MinIsExcluded: true, Max: &max5, MaxIsExcluded: true},
+			x:    5.0,
+			want: false,
+		},
+		{
+			name: "open interval, contains just above min",
+			i:    NumberInterval{Min: &min1, MinIsExcluded: true, Max: &max5, MaxIsExcluded: true},
+			x:    1.0 + 2*epsilon,
+			want: true,
+		},
+		{
+			name: "open interval, contains just below max",
+			i:    NumberInterval{Min: &min1, MinIsExcluded: true, Max: &max5, MaxIsExcluded: true},
+			x:    5.0 - 2*epsilon,
+			want: true,
+		},
+		{
+			name: "lower bounded (excluded), does not contain min (just below)",
+			i:    NumberInterval{Min: &min1, MinIsExcluded: true},
+			x:    1.0 + epsilon/2,
+			want: false,
+		},
+		{
+			name: "upper bounded (excluded), does not contain max (just above)",
+			i:    NumberInterval{Max: &max5, MaxIsExcluded: true},
+			x:    5.0 - epsilon/2,
+			want: false,
+		},
+		{
+			name: "unbounded interval, contains any number",
+			i:    NumberInterval{},
+			x:    -100.0,
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, tt.i.Contains(tt.x))
+
+			matchTree := NewMatchTree[string]([]MatchType{MatchNumberInterval})
+			_, err := matchTree.AddRule(MatchRule[string]{
+				Patterns: []MatchPattern{{Type: MatchNumberInterval, NumberIntervals: []NumberInterval{tt.i}}},
+				Value:    "rule_1",
+			})
+			require.NoError(t, err)
+			_, err = matchTree.AddRule(MatchRule[string]{
+				Patterns: []MatchPattern{{Type: MatchNumberInterval, IsInverse: true, NumberIntervals: []NumberInterval{tt.i}}},
+				Value:    "rule_2",
+			})
+			require.NoError(t, err)
+
+			expectedValues := []string{"rule_2"}
+			if tt.want {
+				expectedValues = []string{"rule_1"}
+			}
+			keys := []MatchKey{{Type: MatchNumberInterval, Number: tt.x}}
+			values, err := matchTree.Search(keys)
+			require.NoError(t, err)
+			assert.Equal(t, expectedValues, values)
+			values, err = matchTree.Freeze().Search(keys)
+			require.NoError(t, err)
+			assert.Equal(t, expectedValues, values)
+		})
+	}
+}
+
+func TestMatchTree_Search_NumberIntervalInfinities(t *testing.T) {
+	negInf, posInf := Float64Ptr(math.Inf(-1)), Float64Ptr(math.Inf(1))
+	matchTree := NewMatchTree[string]([]MatchType{MatchNumberInterval})
+	require.NoError(t, matchTree.AddRules([]MatchRule[string]{
+		{Patterns: []MatchPattern{NumberIntervalPattern(NumberInterval{Min: negInf, Max: Float64Ptr(5)})}, Value: "up_to_5"},
+		{Patterns: []MatchPattern{NumberIntervalPattern(NumberInterval{Min: negInf, MinIsExcluded: true, Max: posInf, MaxIsExcluded: true})}, Value: "finite"},
+		{Patterns: []MatchPattern{NumberIntervalPattern(NumberInterval{Min: posInf, Max: posInf})}, Value: "pos_inf"},
+		{Patterns: []MatchPattern{InverseNumberIntervalPattern(NumberInterval{Min: negInf, Max: Float64Ptr(0), MaxIsExcluded: true})}, Value: "not_negative"},
+	}))
+
+	tests := []struct {
+		x    float64
+		want []string
+	}{
+		{math.Inf(-1), []string{"up_to_5"}},
+		{-math.MaxFloat64, []string{"up_to_5", "finite"}},
+		{5 + epsilon/2, []string{"up_to_5", "finite", "not_negative"}},
+		{6, []string{"finite", "not_negative"}},
+		{math.MaxFloat64, []string{"finite", "not_negative"}},
+		{math.Inf(1), []string{"pos_inf", "not_negative"}},
+	}
+	for _, tt := range tests {
+		values, err := matchTree.Search([]MatchKey{NumberKey(tt.x)})
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, values, "%v", tt.x)
+		values, err = matchTree.Freeze().Search([]MatchKey{NumberKey(tt.x)})
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, values, "frozen %v", tt.x)
+	}
+
+	assert.False(t, NumberInterval{Min: posInf, Max: posInf}.IsEmpty())
+	assert.True(t, NumberInterval{Min: posInf, MinIsExcluded: true, Max: posInf}.IsEmpty())
+	assert.False(t, NumberInterval{Min: negInf, Max: posInf}.IsEmpty())
+	assert.True(t, NumberInterval{Min: negInf, Max: Float64Ptr(0)}.Overlaps(NumberInterval{Min: Float64Ptr(0), Max: posInf}))
+	assert.False(t, NumberInterval{Max: posInf, MaxIsExcluded: true}.Overlaps(NumberInterval{Min: posInf}))
+}
+
+func TestMatchTree_Search_ManyNumberIntervals(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	randomBound := func() float64 { return float64(rand.Intn(20)) }
+	randomInterval := func() NumberInterval {
+		var i NumberInterval
+		if rand.Intn(8) != 0 {
+			i.Min = Float64Ptr(randomBound())
+			i.MinIsExcluded = rand.Intn(2) == 0
+		}
+		if rand.Intn(8) != 0 {
+			i.Max = Float64Ptr(randomBound())
+			i.MaxIsExcluded = rand.Intn(2) == 0
+		}
+		return i
+	}
+
+	matchTree := NewMatchTree[int]([]MatchType{MatchNumberInterval})
+	var rules []MatchRule[int]
+	for i := range 1000 {
+		rule := MatchRule[int]{
+			Patterns: []MatchPattern{{
+				Type:            MatchNumberInterval,
+				IsInverse:       rand.Intn(4) == 0,
+				NumberIntervals: []NumberInterval{randomInterval(), randomInterval()},
+			}},
+			Value:    i,
+			Priority: int64(rand.Intn(3)),
+		}
+		rules = append(rules, rule)
+		_, err := matchTree.AddRule(rule)
+		require.NoError(t, err)
+	}
+	frozenMatchTree := matchTree.Freeze()
+
+	for b := -1; b <= 21; b++ {
+		for _, offset := range []float64{-2 * epsilon, -epsilon / 2, 0, epsilon / 2, 2 * epsilon, 0.5} {
+			x := float64(b) + offset
+			var expectedValues []int
+			for priority := int64(2); priority >= 0; priority-- {
+				for _, rule := range rules {
+					pattern := rule.Patterns[0]
+					if rule.Priority != priority {
+						continue
+					}
+					contains := pattern.NumberIntervals[0].Contains(x) || pattern.NumberIntervals[1].Contains(x)
+					if contains != pattern.IsInverse {
+						expectedValues = append(expectedValues, rule.Value)
+					}
+				}
+			}
+
+			keys := []MatchKey{{Type: MatchNumberInterval, Number: x}}
+			values, err := matchTree.Search(keys)
+			require.NoError(t, err)
+			assert.Equal(t, expectedValues, values, "x=%v", x)
+			values, err = frozenMatchTree.Search(keys)
+			require.NoError(t, err)
+			assert.Equal(t, expectedValues, values, "x=%v", x)
+		}
+	}
+}
+
+func TestMatchTree_Search_StableOnPriorityTie(t *testing.T) {
+	rules := []MatchRule[string]{
+		{
+			Patterns: []MatchPattern{
+				{Type: MatchString, IsInverse: true, Strings: []string{"x", "y"}},
+				{Type: MatchIntegerInterval, IntegerIntervals: []IntegerInterval{{Min: Int64Ptr(1)}, {Max: Int64Ptr(9)}}},
+			},
+			Value: "rule_1",
+		},
+		{
+			Patterns: []MatchPattern{
+				{Type: MatchString, Strings: []string{"a", "b", "c"}},
+				{Type: MatchIntegerInterval, IsAny: true},
+			},
+			Value: "rule_2",
+		},
+		{
+			Patterns: []MatchPattern{
+				{Type: MatchString, IsAny: true},
+				{Type: MatchIntegerInterval, IsInverse: true, IntegerIntervals: []IntegerInterval{{Min: Int64Ptr(100)}}},
+			},
+			Value: "rule_3",
+		},
+		{
+			Patterns: []MatchPattern{
+				{Type: MatchString, IsInverse: true, Strings: []string{"z"}},
+				{Type: MatchIntegerInterval, IntegerIntervals: []IntegerInterval{{Min: Int64Ptr(5), Max: Int64Ptr(5)}}},
+			},
+			Value: "rule_4",
+		},
+	}
+	keys := []MatchKey{
+		{Type: MatchString, String: "a"},
+		{Type: MatchIntegerInterval, Integer: 5},
+	}
+
+	for range 100 {
+		matchTree := NewMatchTree[string]([]MatchType{MatchString, MatchIntegerInterval})
+		for _, rule := range rules {
+			_, err := matchTree.AddRule(rule)
+			require.NoError(t, err)
+		}
+
+		values, err := matchTree.Search(keys)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"rule_1", "rule_2", "rule_3", "rule_4"}, values)
+		values, err = matchTree.Freeze().Search(keys)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"rule_1", "rule_2", "rule_3", "rule_4"}, values)
+	}
+}
+
+func TestNewMatchTreeChecked(t *testing.T) {
+	matchTree, err := NewMatchTreeChecked[string]([]MatchType{MatchString, MatchRegexp})
+	require.NoError(t, err)
+	assert.NotNil(t, matchTree)
+
+	_, err = NewMatchTreeChecked[string]([]MatchType{MatchString, MatchNone})
+	assert.EqualError(t, err, "matchtree: unknown match type #2: NONE")
+
+	_, err = NewMatchTreeChecked[string]([]MatchType{MatchType(99)})
+	assert.EqualError(t, err, "matchtree: unknown match type #1: UNKNOWN(99)")
+
+	assert.PanicsWithValue(t, "matchtree: unknown match type #1: UNKNOWN(99)", func() {
+		NewMatchTree[string]([]MatchType{MatchType(99)})
+	})
+}
+
+func TestMatchTree_AddRules(t *testing.T) {
+	rules := []MatchRule[string]{
+		{Patterns: []MatchPattern{{Type: MatchString, Strings: []string{"foo"}}}, Value: "rule_1"},
+		{Patterns: []MatchPattern{{Type: MatchInteger, Integers: []int64{1}}}, Value: "rule_2"},
+		{Patterns: []MatchPattern{{Type: MatchString, IsAny: true}}, Value: "rule_3"},
+		{Patterns: []MatchPattern{}, Value: "rule_4"},
+	}
+	keys := []MatchKey{{Type: MatchString, String: "foo"}}
+
+	t.Run("lenient", func(t *testing.T) {
+		matchTree := NewMatchTree[string]([]MatchType{MatchString})
+		err := matchTree.AddRules(rules)
+		assert.EqualError(t, err, "matchtree: match rule #2: unexpected match type #1; expected=STRING actual=INTEGER\n"+
+			"matchtree: match rule #4: unexpected number of match patterns; expected=1 actual=0")
+
+		values, err := matchTree.Search(keys)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"rule_1", "rule_3"}, values)
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		matchTree := NewMatchTree[string]([]MatchType{MatchString})
+		err := matchTree.AddRulesStrict(rules)
+		assert.EqualError(t, err, "matchtree: match rule #2: unexpected match type #1; expected=STRING actual=INTEGER\n"+
+			"matchtree: match rule #4: unexpected number of match patterns; expected=1 actual=0")
+
+		values, err := matchTree.Search(keys)
+		require.NoError(t, err)
+		assert.Nil(t, values)
+
+		err = matchTree.AddRulesStrict([]MatchRule[string]{rules[0], rules[2]})
+		require.NoError(t, err)
+		values, err = matchTree.Search(keys)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"rule_1", "rule_3"}, values)
+	})
+}
+
+func TestMatchTree_SearchOrDefault(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString})
+	err := matchTree.AddRules([]MatchRule[string]{
+		{Patterns: []MatchPattern{{Type: MatchString, Strings: []string{"foo"}}}, Value: "rule_1", Priority: 1},
+		{Patterns: []MatchPattern{{Type: MatchString, Strings: []string{"foo"}}}, Value: "rule_2", Priority: 2},
+	})
+	require.NoError(t, err)
+
+	value, err := matchTree.SearchOrDefault([]MatchKey{{Type: MatchString, String: "foo"}}, "default")
+	require.NoError(t, err)
+	assert.Equal(t, "rule_2", value)
+
+	value, err = matchTree.SearchOrDefault([]MatchKey{{Type: MatchString, String: "bar"}}, "default")
+	require.NoError(t, err)
+	assert.Equal(t, "default", value)
+
+	value, err = matchTree.SearchOrDefault(nil, "default")
+	assert.Error(t, err)
+	assert.Equal(t, "default", value)
+}
+
+func TestMatchTree_Search_AbsentKey(t *testing.T) {
+	types := []MatchType{MatchString, MatchInteger, MatchIntegerInterval, MatchNumberInterval, MatchRegexp, MatchBytes, MatchSemverRange}
+	exactPatterns := []MatchPattern{
+		StringsPattern(""),
+		IntegersPattern(0),
+		IntegerIntervalPattern(IntegerInterval{}),
+		NumberIntervalPattern(NumberInterval{}),
+		RegexpPattern(""),
+		BytesPattern(nil),
+		SemverRangePattern(">=0.0.0"),
+	}
+	for i, type1 := range types {
+		t.Run(type1.String(), func(t *testing.T) {
+			inversePattern := exactPatterns[i]
+			inversePattern.IsInverse = true
+			matchTree := NewMatchTree[string]([]MatchType{MatchString, type1})
+			require.NoError(t, matchTree.AddRules([]MatchRule[string]{
+				{Patterns: []MatchPattern{StringsPattern("a"), exactPatterns[i]}, Value: "exact"},
+				{Patterns: []MatchPattern{StringsPattern("a"), inversePattern}, Value: "inverse"},
+				{Patterns: []MatchPattern{StringsPattern("a"), AnyPattern(type1)}, Value: "any"},
+			}))
+
+			keys := []MatchKey{StringKey("a"), AbsentKey(type1)}
+			values, err := matchTree.Search(keys)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"any"}, values)
+			values, err = matchTree.Freeze().Search(keys)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"any"}, values)
+			explanations, err := matchTree.Explain(keys)
+			require.NoError(t, err)
+			require.Len(t, explanations, 1)
+			assert.Equal(t, AnyChild, explanations[0].Steps[1].Kind)
+
+			values, err = matchTree.Search([]MatchKey{AbsentKey(MatchString), AbsentKey(type1)})
+			require.NoError(t, err)
+			assert.Empty(t, values)
+		})
+	}
+}
+
+func TestMatchTree_SearchGroupedByPriority(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString})
+	require.NoError(t, matchTree.AddRules([]MatchRule[string]{
+		{Patterns: []MatchPattern{StringsPattern("a")}, Value: "rule_1", Priority: 5},
+		{Patterns: []MatchPattern{AnyPattern(MatchString)}, Value: "rule_2", Priority: 10},
+		{Patterns: []MatchPattern{InverseStringsPattern("b")}, Value: "rule_3", Priority: 5},
+		{Patterns: []MatchPattern{StringsPattern("a", "b")}, Value: "rule_4", Priority: 10},
+		{Patterns: []MatchPattern{StringsPattern("b")}, Value: "rule_5"},
+	}))
+
+	groups, err := matchTree.SearchGroupedByPriority([]MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.Equal(t, []PriorityGroup[string]{
+		{Priority: 10, Values: []string{"rule_2", "rule_4"}},
+		{Priority: 5, Values: []string{"rule_1", "rule_3"}},
+	}, groups)
+	groups[0].Values = append(groups[0].Values, "rule_6")
+	assert.Equal(t, []string{"rule_1", "rule_3"}, groups[1].Values)
+
+	groups, err = matchTree.SearchGroupedByPriority([]MatchKey{StringKey("b")})
+	require.NoError(t, err)
+	assert.Equal(t, []PriorityGroup[string]{
+		{Priority: 10, Values: []string{"rule_2", "rule_4"}},
+		{Priority: 0, Values: []string{"rule_5"}},
+	}, groups)
+
+	groups, err = matchTree.SearchGroupedByPriority([]MatchKey{IntegerKey(1)})
+	assert.Error(t, err)
+	assert.Nil(t, groups)
+
+	matchTree = NewMatchTree([]MatchType{MatchString}, WithValueDedup(func(x, y string) bool { return x == y }))
+	require.NoError(t, matchTree.AddRules([]MatchRule[string]{
+		{Patterns: []MatchPattern{StringsPattern("a")}, Value: "deny", Priority: 10},
+		{Patterns: []MatchPattern{AnyPattern(MatchString)}, Value: "deny", Priority: 5},
+		{Patterns: []MatchPattern{AnyPattern(MatchString)}, Value: "allow", Priority: 1},
+	}))
+	groups, err = matchTree.SearchGroupedByPriority([]MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.Equal(t, []PriorityGroup[string]{
+		{Priority: 10, Values: []string{"deny"}},
+		{Priority: 1, Values: []string{"allow"}},
+	}, groups)
+}
+
+func TestMatchTree_SearchPage(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString})
+	require.NoError(t, matchTree.AddRules([]MatchRule[string]{
+		{Patterns: []MatchPattern{StringsPattern("a")}, Value: "rule_1"},
+		{Patterns: []MatchPattern{AnyPattern(MatchString)}, Value: "rule_2", Priority: 1},
+		{Patterns: []MatchPattern{StringsPattern("a", "b")}, Value: "rule_3"},
+		{Patterns: []MatchPattern{InverseStringsPattern("b")}, Value: "rule_4", Priority: 2},
+		{Patterns: []MatchPattern{StringsPattern("a")}, Value: "rule_5", Priority: -1},
+	}))
+
+	tests := []struct {
+		offset, limit int
+		want          []string
+		wantHasMore   bool
+	}{
+		{0, 2, []string{"rule_4", "rule_2"}, true},
+		{2, 2, []string{"rule_1", "rule_3"}, true},
+		{4, 2, []string{"rule_5"}, false},
+		{3, 2, []string{"rule_3", "rule_5"}, false},
+		{0, 10, []string{"rule_4", "rule_2", "rule_1", "rule_3", "rule_5"}, false},
+		{1, 0, nil, true},
+		{5, 2, nil, false},
+		{9, 2, nil, false},
+	}
+	for _, tt := range tests {
+		values, hasMore, err := matchTree.SearchPage([]MatchKey{StringKey("a")}, tt.offset, tt.limit)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, values, "offset=%v limit=%v", tt.offset, tt.limit)
+		assert.Equal(t, tt.wantHasMore, hasMore, "offset=%v limit=%v", tt.offset, tt.limit)
+	}
+
+	_, _, err := matchTree.SearchPage([]MatchKey{StringKey("a")}, -1, 2)
+	assert.EqualError(t, err, "matchtree: invalid page; offset=-1 limit=2")
+	_, _, err = matchTree.SearchPage([]MatchKey{IntegerKey(1)}, 0, 2)
+	assert.Error(t, err)
+}
+
+func TestMatchTree_SearchWeightedOne(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString})
+	ruleIDs := make([]RuleID, 0, 4)
+	for _, rule := range []MatchRule[string]{
+		{Patterns: []MatchPattern{StringsPattern("a")}, Value: "backup", Priority: 0, Weight: 100},
+		{Patterns: []MatchPattern{AnyPattern(MatchString)}, Value: "target_1", Priority: 1, Weight: 3},
+		{Patterns: []MatchPattern{StringsPattern("a", "b")}, Value: "target_2", Priority: 1, Weight: 1},
+		{Patterns: []MatchPattern{StringsPattern("b")}, Value: "target_3", Priority: 1},
+	} {
+		ruleID, err := matchTree.AddRule(rule)
+		require.NoError(t, err)
+		ruleIDs = append(ruleIDs, ruleID)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	counts := make(map[string]int)
+	for range 4000 {
+		value, ok, err := matchTree.SearchWeightedOne([]MatchKey{StringKey("a")}, rng)
+		require.NoError(t, err)
+		require.True(t, ok)
+		counts[value]++
+	}
+	assert.Len(t, counts, 2)
+	assert.InDelta(t, 3000, counts["target_1"], 150)
+	assert.InDelta(t, 1000, counts["target_2"], 150)
+
+	// a weight of 0 counts as 1
+	counts = make(map[string]int)
+	for range 4000 {
+		value, _, err := matchTree.SearchWeightedOne([]MatchKey{StringKey("b")}, rng)
+		require.NoError(t, err)
+		counts[value]++
+	}
+	assert.InDelta(t, 2400, counts["target_1"], 150)
+	assert.InDelta(t, 800, counts["target_2"], 150)
+	assert.InDelta(t, 800, counts["target_3"], 150)
+
+	value, ok, err := matchTree.SearchWeightedOne([]MatchKey{StringKey("c")}, rng)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "target_1", value)
+
+	require.NoError(t, matchTree.RemoveRuleByID(ruleIDs[1]))
+	_, ok, err = matchTree.SearchWeightedOne([]MatchKey{StringKey("c")}, rng)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	_, _, err = matchTree.SearchWeightedOne([]MatchKey{IntegerKey(1)}, rng)
+	assert.Error(t, err)
+
+	assert.Equal(t, []MatchRule[string]{
+		{Patterns: []MatchPattern{StringsPattern("a")}, Value: "backup", Priority: 0, Weight: 100},
+		{Patterns: []MatchPattern{StringsPattern("a", "b")}, Value: "target_2", Priority: 1, Weight: 1},
+		{Patterns: []MatchPattern{StringsPattern("b")}, Value: "target_3", Priority: 1},
+	}, matchTree.ToRules())
+
+	// weights adding up past math.MaxInt neither overflow nor panic, and a nil rng is allowed
+	for _, value := range []string{"heavy_1", "heavy_2", "heavy_3"} {
+		_, err := matchTree.AddRule(MatchRule[string]{Patterns: []MatchPattern{StringsPattern("d")}, Value: value, Priority: 1, Weight: math.MaxInt})
+		require.NoError(t, err)
+	}
+	counts = make(map[string]int)
+	for range 300 {
+		value, ok, err := matchTree.SearchWeightedOne([]MatchKey{StringKey("d")}, nil)
+		require.NoError(t, err)
+		require.True(t, ok)
+		counts[value]++
+	}
+	assert.Less(t, 50, counts["heavy_1"])
+	assert.Less(t, 50, counts["heavy_2"])
+}
+
+func TestMatchTree_SearchFirstMatch(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString, MatchIntegerInterval})
+	ruleIDs := make([]RuleID, 0, 4)
+	for _, rule := range []MatchRule[string]{
+		{Patterns: []MatchPattern{StringsPattern("10.0.0.1"), AnyPattern(MatchIntegerInterval)}, Value: "deny_host"},
+		{Patterns: []MatchPattern{AnyPattern(MatchString), IntegerIntervalPattern(IntegerInterval{Min: Int64Ptr(1), Max: Int64Ptr(1024)})}, Value: "deny_low_ports"},
+		{Patterns: []MatchPattern{StringsPattern("10.0.0.1"), IntegerIntervalPattern(IntegerInterval{Min: Int64Ptr(443), Max: Int64Ptr(443)})}, Value: "allow_https", Priority: 1},
+		{Patterns: []MatchPattern{AnyPattern(MatchString), AnyPattern(MatchIntegerInterval)}, Value: "allow", Priority: -1},
+	} {
+		ruleID, err := matchTree.AddRule(rule)
+		require.NoError(t, err)
+		ruleIDs = append(ruleIDs, ruleID)
+	}
+
+	tests := []struct {
+		keys []MatchKey
+		want string
+	}{
+		{[]MatchKey{StringKey("10.0.0.1"), IntegerIntervalKey(443)}, "allow_https"},
+		{[]MatchKey{StringKey("10.0.0.1"), IntegerIntervalKey(80)}, "deny_host"},
+		{[]MatchKey{StringKey("10.0.0.2"), IntegerIntervalKey(80)}, "deny_low_ports"},
+		{[]MatchKey{StringKey("10.0.0.2"), IntegerIntervalKey(8080)}, "allow"},
+	}
+	for _, tt := range tests {
+		value, ok, err := matchTree.SearchFirstMatch(tt.keys)
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, tt.want, value, "%v", tt.keys)
+		values, err := matchTree.Search(tt.keys)
+		require.NoError(t, err)
+		assert.Equal(t, values[0], value, "%v", tt.keys)
+	}
+
+	require.NoError(t, matchTree.SetRuleEnabled(ruleIDs[0], false))
+	require.NoError(t, matchTree.RemoveRuleByID(ruleIDs[3]))
+	value, ok, err := matchTree.SearchFirstMatch([]MatchKey{StringKey("10.0.0.1"), IntegerIntervalKey(80)})
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "deny_low_ports", value)
+	value, ok, err = matchTree.SearchFirstMatch([]MatchKey{StringKey("10.0.0.1"), IntegerIntervalKey(8080)})
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Empty(t, value)
+	_, ok, err = matchTree.SearchFirstMatch(nil)
+	assert.Error(t, err)
+	assert.False(t, ok)
+}
+
+func TestMatchPattern_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern MatchPattern
+		wantErr string
+	}{
+		{
+			name:    "exact strings",
+			pattern: MatchPattern{Type: MatchString, Strings: []string{"foo"}},
+		},
+		{
+			name:    "any",
+			pattern: MatchPattern{Type: MatchInteger, IsAny: true},
+		},
+		{
+			name:    "inverse integer intervals",
+			pattern: MatchPattern{Type: MatchIntegerInterval, IsInverse: true, IntegerIntervals: []IntegerInterval{{}}},
+		},
+		{
+			name:    "regexp",
+			pattern: MatchPattern{Type: MatchRegexp, Regexp: "^foo$"},
+		},
+		{
+			name:    "unknown type",
+			pattern: MatchPattern{Type: MatchNone, IsAny: true},
+			wantErr: "matchtree: unknown match type NONE",
+		},
+		{
+			name:    "both any and inverse",
+			pattern: MatchPattern{Type: MatchString, IsAny: true, IsInverse: true},
+			wantErr: "matchtree: STRING pattern is both any and inverse",
+		},
+		{
+			name:    "no values",
+			pattern: MatchPattern{Type: MatchNumberInterval},
+			wantErr: "matchtree: no number intervals for NUMBER_INTERVAL pattern",
+		},
+		{
+			name:    "values for any",
+			pattern: MatchPattern{Type: MatchString, IsAny: true, Strings: []string{"foo"}},
+			wantErr: "matchtree: unexpected strings for any STRING pattern",
+		},
+		{
+			name:    "values of wrong type",
+			pattern: MatchPattern{Type: MatchString, Strings: []string{"foo"}, Integers: []int64{1}},
+			wantErr: "matchtree: unexpected integers for STRING pattern",
+		},
+		{
+			name:    "invalid regexp",
+			pattern: MatchPattern{Type: MatchRegexp, IsInverse: true, Regexp: "("},
+			wantErr: "matchtree: invalid regexp \"(\": error parsing regexp: missing closing ): `(`",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.pattern.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatchKey_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     MatchKey
+		wantErr string
+	}{
+		{
+			name: "string",
+			key:  MatchKey{Type: MatchString, String: "foo"},
+		},
+		{
+			name: "absent",
+			key:  AbsentKey(MatchSemverRange),
+		},
+		{
+			name:    "absent with value",
+			key:     MatchKey{Type: MatchInteger, IsAbsent: true, Integers: []int64{1}},
+			wantErr: "matchtree: unexpected value for absent INTEGER key",
+		},
+		{
+			name: "regexp",
+			key:  MatchKey{Type: MatchRegexp, String: "foo"},
+		},
+		{
+			name: "zero integer",
+			key:  MatchKey{Type: MatchIntegerInterval},
+		},
+		{
+			name: "number",
+			key:  MatchKey{Type: MatchNumberInterval, Number: 1.5},
+		},
+		{
+			name:    "unknown type",
+			key:     MatchKey{},
+			wantErr: "matchtree: unknown match type NONE",
+		},
+		{
+			name:    "string for integer",
+			key:     MatchKey{Type: MatchInteger, String: "1"},
+			wantErr: "matchtree: unexpected string for INTEGER key",
+		},
+		{
+			name:    "integer for number interval",
+			key:     MatchKey{Type: MatchNumberInterval, Integer: 1},
+			wantErr: "matchtree: unexpected integer for NUMBER_INTERVAL key",
+		},
+		{
+			name:    "number for string",
+			key:     MatchKey{Type: MatchString, String: "foo", Number: 1},
+			wantErr: "matchtree: unexpected number for STRING key",
+		},
+		{
+			name: "strings",
+			key:  StringsKey("foo", "bar"),
+		},
+		{
+			name:    "strings for regexp",
+			key:     MatchKey{Type: MatchRegexp, Strings: []string{"foo"}},
+			wantErr: "matchtree: unexpected strings for REGEXP key",
+		},
+		{
+			name:    "string and strings",
+			key:     MatchKey{Type: MatchString, String: "foo", Strings: []string{"bar"}},
+			wantErr: "matchtree: both string and strings for STRING key",
+		},
+		{
+			name:    "integers for integer interval",
+			key:     MatchKey{Type: MatchIntegerInterval, Integers: []int64{1}},
+			wantErr: "matchtree: unexpected integers for INTEGER_INTERVAL key",
+		},
+		{
+			name:    "integer and integers",
+			key:     MatchKey{Type: MatchInteger, Integer: 1, Integers: []int64{2}},
+			wantErr: "matchtree: both integer and integers for INTEGER key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.key.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPatternHelpers(t *testing.T) {
+	interval := IntegerInterval{Min: Int64Ptr(1)}
+	numberInterval := NumberInterval{Max: Float64Ptr(2.5)}
+	tests := []struct {
+		name    string
+		pattern MatchPattern
+		want    MatchPattern
+	}{
+		{"AnyPattern", AnyPattern(MatchInteger), MatchPattern{Type: MatchInteger, IsAny: true}},
+		{"StringsPattern", StringsPattern("a", "b"), MatchPattern{Type: MatchString, Strings: []string{"a", "b"}}},
+		{"InverseStringsPattern", InverseStringsPattern("a"), MatchPattern{Type: MatchString, IsInverse: true, Strings: []string{"a"}}},
+		{"IntegersPattern", IntegersPattern(1, 2), MatchPattern{Type: MatchInteger, Integers: []int64{1, 2}}},
+		{"InverseIntegersPattern", InverseIntegersPattern(1), MatchPattern{Type: MatchInteger, IsInverse: true, Integers: []int64{1}}},
+		{"IntegerIntervalPattern", IntegerIntervalPattern(interval), MatchPattern{Type: MatchIntegerInterval, IntegerIntervals: []IntegerInterval{interval}}},
+		{"InverseIntegerIntervalPattern", InverseIntegerIntervalPattern(interval), MatchPattern{Type: MatchIntegerInterval, IsInverse: true, IntegerIntervals: []IntegerInterval{interval}}},
+		{"NumberIntervalPattern", NumberIntervalPattern(numberInterval), MatchPattern{Type: MatchNumberInterval, NumberIntervals: []NumberInterval{numberInterval}}},
+		{"InverseNumberIntervalPattern", InverseNumberIntervalPattern(numberInterval), MatchPattern{Type: MatchNumberInterval, IsInverse: true, NumberIntervals: []NumberInterval{numberInterval}}},
+		{"RegexpPattern", RegexpPattern("^a"), MatchPattern{Type: MatchRegexp, Regexp: "^a"}},
+		{"InverseRegexpPattern", InverseRegexpPattern("^a"), MatchPattern{Type: MatchRegexp, IsInverse: true, Regexp: "^a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.pattern)
+			assert.NoError(t, tt.pattern.Validate())
+		})
+	}
+}
+
+func TestKeyHelpers(t *testing.T) {
+	assert.Equal(t, MatchKey{Type: MatchString, String: "a"}, StringKey("a"))
+	assert.Equal(t, MatchKey{Type: MatchRegexp, String: "a"}, RegexpKey("a"))
+	assert.Equal(t, MatchKey{Type: MatchInteger, Integer: 1}, IntegerKey(1))
+	assert.Equal(t, MatchKey{Type: MatchIntegerInterval, Integer: 1}, IntegerIntervalKey(1))
+	assert.Equal(t, MatchKey{Type: MatchNumberInterval, Number: 1.5}, NumberKey(1.5))
+
+	matchTree := NewMatchTree[string]([]MatchType{MatchString, MatchInteger, MatchNumberInterval})
+	_, err := matchTree.AddRule(MatchRule[string]{
+		Patterns: []MatchPattern{
+			StringsPattern("tom"),
+			IntegersPattern(18),
+			AnyPattern(MatchNumberInterval),
+		},
+		Value: "rule_1",
+	})
+	require.NoError(t, err)
+	values, err := matchTree.Search([]MatchKey{StringKey("tom"), IntegerKey(18), NumberKey(1.5)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_1"}, values)
+}
+
+func TestMatchType_YAML(t *testing.T) {
+	data, err := yaml.Marshal([]MatchType{MatchString, MatchNumberInterval})
+	require.NoError(t, err)
+	assert.Equal(t, "- STRING\n- NUMBER_INTERVAL\n", string(data))
+
+	var types []MatchType
+	require.NoError(t, yaml.Unmarshal(data, &types))
+	assert.Equal(t, []MatchType{MatchString, MatchNumberInterval}, types)
+
+	var type1 MatchType
+	assert.EqualError(t, yaml.Unmarshal([]byte("FOO"), &type1), `matchtree: unknown match type "FOO"`)
+
+	var rule MatchRule[string]
+	require.NoError(t, yaml.Unmarshal([]byte(`
+patterns:
+  - type: STRING
+    is_inverse: true
+    strings: [joe]
+  - type: INTEGER_INTERVAL
+    integer_intervals:
+      - min: 18
+        max: 65
+        max_is_excluded: true
+value: rule_1
+priority: 2
+`), &rule))
+	assert.Equal(t, MatchRule[string]{
+		Patterns: []MatchPattern{
+			InverseStringsPattern("joe"),
+			IntegerIntervalPattern(IntegerInterval{Min: Int64Ptr(18), Max: Int64Ptr(65), MaxIsExcluded: true}),
+		},
+		Value:    "rule_1",
+		Priority: 2,
+	}, rule)
+}
+
+func TestMatchType_Text(t *testing.T) {
+	text, err := MatchIntegerInterval.MarshalText()
+	require.NoError(t, err)
+	assert.Equal(t, "INTEGER_INTERVAL", string(text))
+
+	var type1 MatchType
+	require.NoError(t, type1.UnmarshalText([]byte("REGEXP")))
+	assert.Equal(t, MatchRegexp, type1)
+	assert.EqualError(t, type1.UnmarshalText([]byte("FOO")), `matchtree: unknown match type "FOO"`)
+
+	// as a map key
+	data, err := json.Marshal(map[MatchType]int{MatchString: 1})
+	require.NoError(t, err)
+	assert.Equal(t, `{"STRING":1}`, string(data))
+	var m map[MatchType]int
+	require.NoError(t, json.Unmarshal(data, &m))
+	assert.Equal(t, map[MatchType]int{MatchString: 1}, m)
+
+	// with the flag package
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.TextVar(&type1, "type", MatchNone, "match type")
+	require.NoError(t, fs.Parse([]string{"-type", "INTEGER"}))
+	assert.Equal(t, MatchInteger, type1)
+}
+
+func TestMatchTree_AddRulesFromJSON(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString})
+	n, err := matchTree.AddRulesFromJSON(strings.NewReader(`[
+		{"patterns": [{"type": "STRING", "strings": ["a"]}], "value": "rule_1"},
+		{"patterns": [{"type": "STRING", "is_any": true}], "value": "rule_2", "priority": 1}
+	]`))
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	values, err := matchTree.Search([]MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_2", "rule_1"}, values)
+
+	n, err = matchTree.AddRulesFromJSON(strings.NewReader(`[]`))
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = matchTree.AddRulesFromJSON(strings.NewReader(`{}`))
+	assert.EqualError(t, err, "matchtree: unexpected token {; expected=[")
+	assert.Equal(t, 0, n)
+
+	n, err = matchTree.AddRulesFromJSON(strings.NewReader(`[
+		{"patterns": [{"type": "STRING", "strings": ["b"]}], "value": "rule_3"},
+		{"patterns": [{"type": "FOO"}], "value": "rule_4"},
+		{"patterns": [{"type": "STRING", "strings": ["c"]}], "value": "rule_5"}
+	]`))
+	assert.EqualError(t, err, `matchtree: match rule #2: decode match rule: unknown match type "FOO"`)
+	assert.Equal(t, 1, n)
+
+	n, err = matchTree.AddRulesFromJSON(strings.NewReader(`[
+		{"patterns": [{"type": "INTEGER", "integers": [1]}], "value": "rule_6"}
+	]`))
+	assert.EqualError(t, err, "matchtree: match rule #1: unexpected match type #1; expected=STRING actual=INTEGER")
+	assert.Equal(t, 0, n)
+
+	values, err = matchTree.Search([]MatchKey{StringKey("c")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_2"}, values)
+}
+
+func TestMatchTree_AddRule_WithDedupIdenticalRules(t *testing.T) {
+	rules := []MatchRule[string]{
+		{
+			Patterns: []MatchPattern{StringsPattern("a", "b")},
+			Value:    "rule_1",
+		},
+		{
+			Patterns: []MatchPattern{StringsPattern("b", "c")},
+			Value:    "rule_1",
+		},
+		{
+			Patterns: []MatchPattern{StringsPattern("a")},
+			Value:    "rule_1",
+			Priority: 1,
+		},
+	}
+
+	matchTree := NewMatchTree[string]([]MatchType{MatchString})
+	for range 2 {
+		require.NoError(t, matchTree.AddRules(rules, WithDedupIdenticalRules()))
+	}
+	stats := matchTree.Stats()
+	assert.Equal(t, 3, stats.LeafCount)
+	assert.Equal(t, 10, stats.ResultCount) // 6 of them hidden
+	values, err := matchTree.Search([]MatchKey{StringKey("b")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_1"}, values)
+	explanations, err := matchTree.Explain([]MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	if assert.Len(t, explanations, 2) {
+		assert.Equal(t, int64(1), explanations[0].Priority)
+		assert.Equal(t, int64(0), explanations[1].Priority)
+	}
+
+	matchTree = NewMatchTree[string]([]MatchType{MatchString})
+	for range 2 {
+		require.NoError(t, matchTree.AddRules(rules))
+	}
+	assert.Equal(t, 10, matchTree.Stats().ResultCount)
+}
+
+func TestMatchTree_AddRule_WithDedupIdenticalRules_RemoveOrDisable(t *testing.T) {
+	newMatchTree := func() (*MatchTree[string], RuleID, RuleID) {
+		matchTree := NewMatchTree[string]([]MatchType{MatchString})
+		idA, err := matchTree.AddRule(MatchRule[string]{Patterns: []MatchPattern{StringsPattern("a", "b")}, Value: "v"})
+		require.NoError(t, err)
+		idB, err := matchTree.AddRule(MatchRule[string]{Patterns: []MatchPattern{StringsPattern("a", "b", "c")}, Value: "v"}, WithDedupIdenticalRules())
+		require.NoError(t, err)
+		return matchTree, idA, idB
+	}
+	search := func(matchTree *MatchTree[string], s string) []string {
+		values, err := matchTree.Search([]MatchKey{StringKey(s)})
+		require.NoError(t, err)
+		frozenValues, err := matchTree.Freeze().Search([]MatchKey{StringKey(s)})
+		require.NoError(t, err)
+		assert.Equal(t, values, frozenValues, s)
+		return values
+	}
+
+	matchTree, idA, idB := newMatchTree()
+	for _, s := range []string{"a", "b", "c"} {
+		assert.Equal(t, []string{"v"}, search(matchTree, s), s)
+	}
+	require.NoError(t, matchTree.RemoveRuleByID(idA))
+	for _, s := range []string{"a", "b", "c"} {
+		assert.Equal(t, []string{"v"}, search(matchTree, s), s)
+	}
+	require.NoError(t, matchTree.RemoveRuleByID(idB))
+	assert.Empty(t, search(matchTree, "a"))
+
+	matchTree, idA, idB = newMatchTree()
+	require.NoError(t, matchTree.SetRuleEnabled(idA, false))
+	assert.Equal(t, []string{"v"}, search(matchTree, "a"))
+	require.NoError(t, matchTree.SetRuleEnabled(idB, false))
+	assert.Empty(t, search(matchTree, "a"))
+	require.NoError(t, matchTree.SetRuleEnabled(idA, true))
+	assert.Equal(t, []string{"v"}, search(matchTree, "a"))
+	assert.Empty(t, search(matchTree, "c"))
+	require.NoError(t, matchTree.SetRuleEnabled(idB, true))
+	assert.Equal(t, []string{"v"}, search(matchTree, "a"))
+
+	// replacing the rule holding the shown result shows the hidden one
+	matchTree, idA, _ = newMatchTree()
+	require.NoError(t, matchTree.ReplaceRuleByID(idA, MatchRule[string]{Patterns: []MatchPattern{StringsPattern("d")}, Value: "w"}))
+	assert.Equal(t, []string{"v"}, search(matchTree, "a"))
+	assert.Equal(t, []string{"w"}, search(matchTree, "d"))
+}
+
+func TestMatchTree_HasRule(t *testing.T) {
+	codes := map[string]int64{"red": 1, "green": 2}
+	types := []MatchType{MatchString, MatchInteger, MatchIntegerInterval, MatchNumberInterval, MatchRegexp, MatchBytes, MatchSemverRange, MatchEnum}
+	exactPatterns := []MatchPattern{
+		StringsPattern("a", "b"),
+		IntegersPattern(1, 2),
+		IntegerIntervalPattern(IntegerInterval{Max: Int64Ptr(0)}, IntegerInterval{Min: Int64Ptr(10)}),
+		NumberIntervalPattern(NumberInterval{Min: Float64Ptr(0.5), Max: Float64Ptr(1)}),
+		RegexpPattern("^a"),
+		BytesPattern([]byte("a"), []byte("b")),
+		SemverRangePattern(">=1.0.0"),
+		EnumPattern(codes, "red", "green"),
+	}
+	for i, type1 := range types {
+		t.Run(type1.String(), func(t *testing.T) {
+			inversePattern := exactPatterns[i]
+			inversePattern.IsInverse = true
+			rules := []MatchRule[string]{
+				{Patterns: []MatchPattern{StringsPattern("x"), exactPatterns[i]}, Value: "exact"},
+				{Patterns: []MatchPattern{StringsPattern("x"), inversePattern}, Value: "inverse", Priority: 1},
+				{Patterns: []MatchPattern{StringsPattern("x"), AnyPattern(type1)}, Value: "any", Labels: map[string]string{"k": "v"}},
+			}
+			matchTree := NewMatchTree[string]([]MatchType{MatchString, type1})
+			for _, rule := range rules {
+				assert.False(t, matchTree.HasRule(rule))
+				_, err := matchTree.AddRule(rule)
+				require.NoError(t, err)
+				assert.True(t, matchTree.HasRule(rule))
+			}
+
+			for _, rule := range rules {
+				rule.Priority++
+				assert.False(t, matchTree.HasRule(rule))
+			}
+			rule := rules[0]
+			rule.Value = "other"
+			assert.False(t, matchTree.HasRule(rule))
+			rule = rules[2]
+			rule.Labels = nil
+			assert.False(t, matchTree.HasRule(rule))
+			rule = rules[0]
+			rule.Patterns = []MatchPattern{StringsPattern("x", "y"), exactPatterns[i]}
+			assert.False(t, matchTree.HasRule(rule))
+			rule.Patterns = []MatchPattern{StringsPattern("x")}
+			assert.False(t, matchTree.HasRule(rule))
+		})
+	}
+}
+
+func TestMatchTree_HasRule_Expansion(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString, MatchInteger})
+	rule := MatchRule[string]{
+		Patterns: []MatchPattern{StringsPattern("a", "b"), IntegersPattern(1)},
+		Value:    "rule_1",
+	}
+	_, err := matchTree.AddRule(rule)
+	require.NoError(t, err)
+	assert.True(t, matchTree.HasRule(rule))
+	rule.Patterns[0] = StringsPattern("b")
+	assert.True(t, matchTree.HasRule(rule))
+	rule.Patterns[1] = IntegersPattern(1, 2)
+	assert.False(t, matchTree.HasRule(rule))
+}
+
+func TestMatchTree_AddRuleIfAbsent(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString})
+	rule := MatchRule[string]{Patterns: []MatchPattern{StringsPattern("a", "b")}, Value: "rule_1"}
+	id, added, err := matchTree.AddRuleIfAbsent(rule)
+	require.NoError(t, err)
+	assert.True(t, added)
+	assert.NotZero(t, id)
+
+	id2, added, err := matchTree.AddRuleIfAbsent(rule)
+	require.NoError(t, err)
+	assert.False(t, added)
+	assert.Zero(t, id2)
+	assert.Equal(t, 2, matchTree.Stats().ResultCount)
+
+	rule.Patterns = []MatchPattern{StringsPattern("b", "c")}
+	id2, added, err = matchTree.AddRuleIfAbsent(rule)
+	require.NoError(t, err)
+	assert.True(t, added)
+	assert.Equal(t, 4, matchTree.Stats().ResultCount) // the one of "b" hidden
+
+	// the rule added later still matches "b" on its own
+	require.NoError(t, matchTree.RemoveRuleByID(id))
+	values, err := matchTree.Search([]MatchKey{StringKey("b")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_1"}, values)
+	require.NoError(t, matchTree.RemoveRuleByID(id2))
+	for _, s := range []string{"b", "c"} {
+		values, err = matchTree.Search([]MatchKey{StringKey(s)})
+		require.NoError(t, err)
+		assert.Empty(t, values)
+	}
+
+	_, added, err = matchTree.AddRuleIfAbsent(MatchRule[string]{Patterns: []MatchPattern{IntegersPattern(1)}})
+	assert.EqualError(t, err, "matchtree: unexpected match type #1; expected=STRING actual=INTEGER")
+	assert.False(t, added)
+}
+
+func TestMatchTree_Search_MultiValuedKeys(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString, MatchInteger})
+	require.NoError(t, matchTree.AddRules([]MatchRule[string]{
+		{
+			Patterns: []MatchPattern{StringsPattern("a", "b"), AnyPattern(MatchInteger)},
+			Value:    "rule_1",
+		},
+		{
+			Patterns: []MatchPattern{InverseStringsPattern("c"), IntegersPattern(1)},
+			Value:    "rule_2",
+		},
+		{
+			Patterns: []MatchPattern{InverseStringsPattern("d", "e"), InverseIntegersPattern(2)},
+			Value:    "rule_3",
+		},
+		{
+			Patterns: []MatchPattern{StringsPattern("c"), IntegersPattern(3)},
+			Value:    "rule_4",
+		},
+	}))
+	frozenMatchTree := matchTree.Freeze()
+
+	tests := []struct {
+		keys []MatchKey
+		want []string
+	}{
+		{[]MatchKey{StringsKey("a", "b", "a"), IntegerKey(1)}, []string{"rule_1", "rule_2", "rule_3"}},
+		{[]MatchKey{StringsKey("a", "c"), IntegerKey(1)}, []string{"rule_1", "rule_3"}},
+		{[]MatchKey{StringsKey("a", "d"), IntegerKey(1)}, []string{"rule_1", "rule_2"}},
+		{[]MatchKey{StringsKey("c", "x"), IntegersKey(2, 3)}, []string{"rule_4"}},
+		{[]MatchKey{StringsKey("x"), IntegersKey(1, 2)}, []string{"rule_2"}},
+		{[]MatchKey{StringsKey("x"), IntegersKey(1, 4)}, []string{"rule_2", "rule_3"}},
+	}
+
+	for _, tt := range tests {
+		values, err := matchTree.Search(tt.keys)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, values, "%v", tt.keys)
+
+		values, err = frozenMatchTree.Search(tt.keys)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, values, "frozen %v", tt.keys)
+	}
+}
+
+func TestMatchTree_Search_IntegerRangeKeys(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchInteger})
+	require.NoError(t, matchTree.AddRules([]MatchRule[string]{
+		{Patterns: []MatchPattern{IntegersPattern(1)}, Value: "rule_1"},
+		{Patterns: []MatchPattern{IntegersPattern(5, 10)}, Value: "rule_2"},
+		{Patterns: []MatchPattern{InverseIntegersPattern(3)}, Value: "rule_3"},
+		{Patterns: []MatchPattern{AnyPattern(MatchInteger)}, Value: "rule_4"},
+		{Patterns: []MatchPattern{IntegersPattern(math.MaxInt64)}, Value: "rule_5"},
+	}))
+	frozenMatchTree := matchTree.Freeze()
+	path := filepath.Join(t.TempDir(), "tree.mmap")
+	require.NoError(t, matchTree.SaveMmapFile(path))
+	mappedTree, err := OpenMmap[string](path)
+	require.NoError(t, err)
+	defer mappedTree.Close()
+
+	tests := []struct {
+		interval IntegerInterval
+		want     []string
+	}{
+		{ClosedInterval(1, 5), []string{"rule_1", "rule_2", "rule_4"}},
+		{OpenInterval(1, 5), []string{"rule_4"}},
+		{ClosedInterval(4, 9), []string{"rule_2", "rule_3", "rule_4"}},
+		{FromInterval(6), []string{"rule_2", "rule_3", "rule_4", "rule_5"}},
+		{ToInterval(2), []string{"rule_1", "rule_3", "rule_4"}},
+		{IntegerInterval{}, []string{"rule_1", "rule_2", "rule_4", "rule_5"}},
+		{OpenInterval(5, 5), []string{"rule_4"}},
+	}
+	for _, tt := range tests {
+		keys := []MatchKey{IntegerRangeKey(tt.interval)}
+		values, err := matchTree.Search(keys)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, values, "%v", keys)
+
+		values, err = frozenMatchTree.Search(keys)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, values, "frozen %v", keys)
+
+		values, err = mappedTree.Search(keys)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, values, "mapped %v", keys)
+	}
+
+	assert.Equal(t, "INTEGER=[1,5)", fmt.Sprint(IntegerRangeKey(RightOpenInterval(1, 5))))
+	key := IntegerRangeKey(ClosedInterval(1, 5))
+	key.Integer = 1
+	assert.EqualError(t, key.Validate(), "matchtree: both integer and integer range for INTEGER key")
+	key = MatchKey{Type: MatchIntegerInterval, IntegerRange: &IntegerInterval{}}
+	assert.EqualError(t, key.Validate(), "matchtree: unexpected integer range for INTEGER_INTERVAL key")
+}
+
+func TestMatchTree_AddRule_AnyAndInverse(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString, MatchInteger})
+	_, err := matchTree.AddRule(MatchRule[string]{
+		Patterns: []MatchPattern{
+			AnyPattern(MatchString),
+			{Type: MatchInteger, IsAny: true, IsInverse: true, Integers: []int64{1}},
+		},
+		Value: "rule_1",
+	})
+	assert.EqualError(t, err, "matchtree: match pattern #2 is both any and inverse")
+	values, err := matchTree.Search([]MatchKey{StringKey("a"), IntegerKey(2)})
+	require.NoError(t, err)
+	assert.Empty(t, values)
+}
+
+func TestMatchTree_AddRule_EmptyInverse(t *testing.T) {
+	types := []MatchType{MatchString, MatchInteger, MatchIntegerInterval, MatchNumberInterval}
+	matchTree := NewMatchTree[string](types)
+	_, err := matchTree.AddRule(MatchRule[string]{
+		Patterns: []MatchPattern{
+			{Type: MatchString, IsInverse: true},
+			{Type: MatchInteger, IsInverse: true, Integers: []int64{}},
+			{Type: MatchIntegerInterval, IsInverse: true},
+			{Type: MatchNumberInterval, IsInverse: true},
+		},
+		Value: "rule_1",
+	})
+	require.NoError(t, err)
+
+	values, err := matchTree.Search([]MatchKey{StringKey(""), IntegerKey(0), IntegerIntervalKey(1), NumberKey(2)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_1"}, values)
+	assert.Equal(t, []MatchRule[string]{
+		{
+			Patterns: []MatchPattern{
+				AnyPattern(MatchString),
+				AnyPattern(MatchInteger),
+				AnyPattern(MatchIntegerInterval),
+				AnyPattern(MatchNumberInterval),
+			},
+			Value: "rule_1",
+		},
+	}, matchTree.ToRules())
+}
+
+func TestMatchTree_AddRule_MergeIntervals(t *testing.T) {
+	types := []MatchType{MatchIntegerInterval, MatchNumberInterval}
+	matchTree := NewMatchTree[string](types)
+	_, err := matchTree.AddRule(MatchRule[string]{
+		Patterns: []MatchPattern{
+			IntegerIntervalPattern(
+				IntegerInterval{Min: Int64Ptr(3), Max: Int64Ptr(8)},
+				IntegerInterval{Min: Int64Ptr(20)},
+				IntegerInterval{Min: Int64Ptr(1), Max: Int64Ptr(5)},
+			),
+			InverseNumberIntervalPattern(
+				NumberInterval{Min: Float64Ptr(1), Max: Float64Ptr(2), MaxIsExcluded: true},
+				NumberInterval{Min: Float64Ptr(2), Max: Float64Ptr(3)},
+			),
+		},
+		Value: "rule_1",
+	})
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		keys []MatchKey
+		want []string
+	}{
+		{[]MatchKey{IntegerIntervalKey(4), NumberKey(0)}, []string{"rule_1"}},
+		{[]MatchKey{IntegerIntervalKey(20), NumberKey(3.5)}, []string{"rule_1"}},
+		{[]MatchKey{IntegerIntervalKey(9), NumberKey(0)}, nil},
+		{[]MatchKey{IntegerIntervalKey(4), NumberKey(2)}, nil},
+	} {
+		values, err := matchTree.SearchAll(tt.keys)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, values)
+	}
+	assert.Equal(t, 2, matchTree.Stats().LeafCount)
+	assert.Equal(t, []MatchRule[string]{
+		{
+			Patterns: []MatchPattern{
+				IntegerIntervalPattern(
+					IntegerInterval{Min: Int64Ptr(1), Max: Int64Ptr(8)},
+					IntegerInterval{Min: Int64Ptr(20)},
+				),
+				InverseNumberIntervalPattern(
+					NumberInterval{Min: Float64Ptr(1), Max: Float64Ptr(3)},
+				),
+			},
+			Value: "rule_1",
+		},
+	}, matchTree.ToRules())
+}
+
+func TestMatchTree_AddRule_EmptyValueList(t *testing.T) {
+	types := []MatchType{MatchString, MatchInteger, MatchIntegerInterval, MatchNumberInterval}
+	matchTree := NewMatchTree[string](types)
+	patterns := []MatchPattern{
+		StringsPattern("a"),
+		IntegersPattern(1),
+		IntegerIntervalPattern(IntegerInterval{}),
+		NumberIntervalPattern(NumberInterval{}),
+	}
+	for i, type1 := range types {
+		rulePatterns := slices.Clone(patterns)
+		rulePatterns[i] = MatchPattern{Type: type1}
+		_, err := matchTree.AddRule(MatchRule[string]{Patterns: rulePatterns, Value: "rule_1"})
+		assert.EqualError(t, err, fmt.Sprintf("matchtree: match pattern #%d has no values for %v type", i+1, type1))
+	}
+	assert.Empty(t, matchTree.ToRules())
+}
+
+func TestMatchTree_AddRule_MaxLeaves(t *testing.T) {
+	values := make([]int64, 10)
+	for i := range values {
+		values[i] = int64(i)
+	}
+	types := []MatchType{MatchInteger, MatchString, MatchInteger, MatchInteger}
+	patterns := []MatchPattern{IntegersPattern(values...), AnyPattern(MatchString), IntegersPattern(values...), IntegersPattern(values...)}
+
+	matchTree := NewMatchTree[string](types)
+	_, err := matchTree.AddRule(MatchRule[string]{Patterns: patterns, Value: "rule_1"}, WithMaxLeaves(999))
+	assert.EqualError(t, err, "matchtree: match patterns expand into more than 999 leaves")
+	assert.Empty(t, matchTree.ToRules())
+
+	_, err = matchTree.AddRule(MatchRule[string]{Patterns: patterns, Value: "rule_1"}, WithMaxLeaves(1000))
+	require.NoError(t, err)
+	for _, keyValues := range [][3]int64{{0, 0, 0}, {3, 5, 7}, {9, 9, 9}} {
+		values, err := matchTree.Search([]MatchKey{IntegerKey(keyValues[0]), StringKey("x"), IntegerKey(keyValues[1]), IntegerKey(keyValues[2])})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"rule_1"}, values)
+	}
+	rules := matchTree.ToRules()
+	require.Len(t, rules, 1)
+	assert.Equal(t, patterns, rules[0].Patterns)
+}
+
+func TestMatchTree_AddRule_WithMaxExpansion(t *testing.T) {
+	values := make([]int64, 20)
+	for i := range values {
+		values[i] = int64(i)
+	}
+	types := []MatchType{MatchInteger, MatchInteger, MatchInteger, MatchInteger, MatchInteger}
+	patterns := make([]MatchPattern, len(types))
+	for i := range patterns {
+		patterns[i] = IntegersPattern(values...)
+	}
+
+	matchTree := NewMatchTree[string](types)
+	_, err := matchTree.AddRule(MatchRule[string]{Patterns: patterns, Value: "rule_1"})
+	assert.EqualError(t, err, fmt.Sprintf("matchtree: match patterns expand into more than %d leaves", DefaultMaxLeaves))
+
+	matchTree = NewMatchTree(types, WithMaxExpansion[string](400))
+	for i := 2; i < len(patterns); i++ {
+		patterns[i] = AnyPattern(MatchInteger)
+	}
+	_, err = matchTree.AddRule(MatchRule[string]{Patterns: patterns, Value: "rule_1"})
+	require.NoError(t, err)
+	patterns[2] = IntegersPattern(0, 1)
+	_, err = matchTree.AddRule(MatchRule[string]{Patterns: patterns, Value: "rule_2"})
+	assert.EqualError(t, err, "matchtree: match patterns expand into more than 400 leaves")
+	assert.Equal(t, 400, matchTree.Stats().LeafCount)
+	_, err = matchTree.AddRule(MatchRule[string]{Patterns: patterns, Value: "rule_2"}, WithMaxLeaves(800))
+	require.NoError(t, err)
+	_, err = matchTree.AddRule(MatchRule[string]{Patterns: patterns, Value: "rule_3"}, WithMaxLeaves(0))
+	assert.EqualError(t, err, "matchtree: match patterns expand into more than 400 leaves", "0 keeps the limit of the tree")
+	_, err = matchTree.AddRule(MatchRule[string]{Patterns: patterns, Value: "rule_3"}, WithMaxLeaves(-1))
+	assert.EqualError(t, err, "matchtree: match patterns expand into more than 400 leaves", "-1 keeps the limit of the tree")
+
+	for _, n := range []int{0, -1} {
+		matchTree = NewMatchTree(types, WithMaxExpansion[string](n))
+		_, err = matchTree.AddRule(MatchRule[string]{Patterns: patterns, Value: "rule_1"})
+		require.NoError(t, err, "%d keeps DefaultMaxLeaves", n)
+	}
+}
+
+func TestMatchTree_AddRuleUnsafe(t *testing.T) {
+	types := []MatchType{MatchString, MatchInteger, MatchEnum, MatchBytes, MatchIntegerInterval, matchPrefix}
+	codes := map[string]int64{"red": 1, "green": 2}
+	rules := []MatchRule[string]{
+		{
+			Patterns: []MatchPattern{
+				StringsPattern("a", "b"), InverseIntegersPattern(1, 2), EnumPattern(codes, "red"),
+				BytesPattern([]byte("x")), IntegerIntervalPattern(ClosedInterval(1, 5), ClosedInterval(3, 8)),
+				{Type: matchPrefix, Strings: []string{"p"}},
+			},
+			Value: "rule_1",
+		},
+		{
+			Patterns: []MatchPattern{
+				InverseStringsPattern("a"), IntegersPattern(3), InverseEnumPattern(codes, "red", "green"),
+				AnyPattern(MatchBytes), AnyPattern(MatchIntegerInterval), AnyPattern(matchPrefix),
+			},
+			Value:    "rule_2",
+			Priority: 1,
+		},
+	}
+	matchTree := NewMatchTree[string](types)
+	unsafeMatchTree := NewMatchTree[string](types)
+	for _, rule := range rules {
+		_, err := matchTree.AddRule(rule)
+		require.NoError(t, err)
+		_, err = unsafeMatchTree.AddRuleUnsafe(rule)
+		require.NoError(t, err)
+	}
+	require.NoError(t, unsafeMatchTree.Validate())
+	assert.Equal(t, matchTree.Stats(), unsafeMatchTree.Stats())
+	for _, s := range []string{"a", "c"} {
+		for _, i := range []int64{2, 3, 7} {
+			for _, e := range []int64{1, 3} {
+				keys := []MatchKey{
+					StringKey(s), IntegerKey(i), EnumKey(e), BytesKey([]byte("x")), IntegerIntervalKey(i),
+					{Type: matchPrefix, String: "pq"},
+				}
+				want, err := matchTree.Search(keys)
+				require.NoError(t, err)
+				values, err := unsafeMatchTree.Search(keys)
+				require.NoError(t, err)
+				assert.Equal(t, want, values, "%v", keys)
+			}
+		}
+	}
+
+	_, err := unsafeMatchTree.AddRuleUnsafe(MatchRule[string]{Patterns: rules[0].Patterns[:1]})
+	assert.ErrorIs(t, err, ErrPatternCountMismatch)
+}
+
+func TestMatchTree_SearchAny(t *testing.T) {
+	for _, suite := range loadTestSuites(t) {
+		matchTree := buildMatchTree(t, suite)
+
+		for i, case1 := range suite.Cases {
+			t.Run(fmt.Sprintf("%s#%d", suite.Scenario, i+1), func(t *testing.T) {
+				ok, err := matchTree.SearchAny(case1.MatchKeys)
+				require.NoError(t, err)
+				assert.Equal(t, len(case1.Values) >= 1, ok)
+			})
+		}
+	}
+
+	matchTree := NewMatchTree[string]([]MatchType{MatchString})
+	ok, err := matchTree.SearchAny([]MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.False(t, ok)
+	_, err = matchTree.SearchAny([]MatchKey{IntegerKey(1)})
+	assert.EqualError(t, err, "matchtree: unexpected match type #1; expected=STRING actual=INTEGER")
+}
+
+func TestMatchTree_SearchAbovePriority(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString})
+	require.NoError(t, matchTree.AddRules([]MatchRule[string]{
+		{Patterns: []MatchPattern{StringsPattern("a")}, Value: "rule_1", Priority: 1},
+		{Patterns: []MatchPattern{AnyPattern(MatchString)}, Value: "rule_2", Priority: 3},
+		{Patterns: []MatchPattern{InverseStringsPattern("b")}, Value: "rule_3", Priority: 2},
+		{Patterns: []MatchPattern{StringsPattern("c")}, Value: "rule_4", Priority: -1},
+	}))
+
+	tests := []struct {
+		key         MatchKey
+		minPriority int64
+		want        []string
+	}{
+		{StringKey("a"), math.MinInt64, []string{"rule_2", "rule_3", "rule_1"}},
+		{StringKey("a"), 1, []string{"rule_2", "rule_3", "rule_1"}},
+		{StringKey("a"), 2, []string{"rule_2", "rule_3"}},
+		{StringKey("a"), 4, nil},
+		{StringKey("c"), 0, []string{"rule_2", "rule_3"}},
+		{StringKey("c"), -1, []string{"rule_2", "rule_3", "rule_4"}},
+	}
+	for _, tt := range tests {
+		values, err := matchTree.SearchAbovePriority([]MatchKey{tt.key}, tt.minPriority)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, values, "%v %v", tt.key, tt.minPriority)
+	}
+
+	matchTree = NewMatchTree[string]([]MatchType{MatchString})
+	_, err := matchTree.AddRule(MatchRule[string]{Patterns: []MatchPattern{StringsPattern("a")}, Value: "rule_1", Priority: 1})
+	require.NoError(t, err)
+	values, err := matchTree.SearchAbovePriority([]MatchKey{StringKey("a")}, 2)
+	require.NoError(t, err)
+	assert.Nil(t, values)
+}
+
+func TestMatchTree_Search_ExtremePriorities(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString})
+	require.NoError(t, matchTree.AddRules([]MatchRule[string]{
+		{Patterns: []MatchPattern{StringsPattern("a")}, Value: "rule_1", Priority: math.MinInt64},
+		{Patterns: []MatchPattern{AnyPattern(MatchString)}, Value: "rule_2", Priority: math.MaxInt64},
+		{Patterns: []MatchPattern{InverseStringsPattern("b")}, Value: "rule_3", Priority: 1 << 40},
+		{Patterns: []MatchPattern{StringsPattern("a", "c")}, Value: "rule_4", Priority: -1 << 40},
+	}))
+	want := []string{"rule_2", "rule_3", "rule_4", "rule_1"}
+	values, err := matchTree.Search([]MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.Equal(t, want, values)
+	values, err = matchTree.Freeze().Search([]MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.Equal(t, want, values)
+	values, err = matchTree.SearchAbovePriority([]MatchKey{StringKey("a")}, -1<<40)
+	require.NoError(t, err)
+	assert.Equal(t, want[:3], values)
+
+	groups, err := matchTree.SearchGroupedByPriority([]MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.Equal(t, []PriorityGroup[string]{
+		{Priority: math.MaxInt64, Values: []string{"rule_2"}},
+		{Priority: 1 << 40, Values: []string{"rule_3"}},
+		{Priority: -1 << 40, Values: []string{"rule_4"}},
+		{Priority: math.MinInt64, Values: []string{"rule_1"}},
+	}, groups)
+	explanations, err := matchTree.Explain([]MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	var explainedValues []string
+	for _, explanation := range explanations {
+		explainedValues = append(explainedValues, explanation.Value)
+	}
+	assert.Equal(t, want, explainedValues)
+}
+
+func TestMatchTree_SearchAll(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchIntegerInterval})
+	require.NoError(t, matchTree.AddRules([]MatchRule[string]{
+		{
+			Patterns: []MatchPattern{IntegerIntervalPattern(
+				IntegerInterval{Min: Int64Ptr(0), Max: Int64Ptr(10)},
+				IntegerInterval{Min: Int64Ptr(5), Max: Int64Ptr(15)},
+			)},
+			Value:    "rule_1",
+			Priority: 1,
+		},
+		{Patterns: []MatchPattern{AnyPattern(MatchIntegerInterval)}, Value: "rule_2", Priority: 2},
+	}))
+
+	keys := []MatchKey{IntegerIntervalKey(7)}
+	values, err := matchTree.Search(keys)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_2", "rule_1"}, values)
+	values, err = matchTree.SearchAll(keys)
+	require.NoError(t, err)
+	// the overlapping intervals are merged at AddRule, so without value dedup options SearchAll
+	// returns the same values as Search
+	assert.Equal(t, []string{"rule_2", "rule_1"}, values)
+
+	values, err = matchTree.SearchAll([]MatchKey{IntegerIntervalKey(12)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_2", "rule_1"}, values)
+
+	for _, optionFunc := range []MatchTreeOptionFunc[string]{
+		WithValueDedup(func(x, y string) bool { return x[:1] == y[:1] }),
+		WithValueKey(func(value string) string { return value[:1] }),
+	} {
+		matchTree := NewMatchTree([]MatchType{MatchString}, optionFunc)
+		require.NoError(t, matchTree.AddRules([]MatchRule[string]{
+			{Patterns: []MatchPattern{StringsPattern("a")}, Value: "x1", Priority: 2},
+			{Patterns: []MatchPattern{AnyPattern(MatchString)}, Value: "y1", Priority: 1},
+			{Patterns: []MatchPattern{StringsPattern("a", "b")}, Value: "x2"},
+		}))
+		keys := []MatchKey{StringKey("a")}
+		values, err := matchTree.Search(keys)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"x1", "y1"}, values)
+		values, err = matchTree.SearchAll(keys)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"x1", "y1", "x2"}, values, "equal values are not collapsed")
+	}
+}
+
+func TestMatchTree_SearchContext(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString, MatchInteger})
+	_, err := matchTree.AddRule(MatchRule[string]{
+		Patterns: []MatchPattern{StringsPattern("a"), IntegersPattern(1)},
+		Value:    "rule_1",
+	})
+	require.NoError(t, err)
+	keys := []MatchKey{StringKey("a"), IntegerKey(1)}
+
+	values, err := matchTree.SearchContext(context.Background(), keys)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_1"}, values)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	values, err = matchTree.SearchContext(ctx, keys)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, values)
+
+	ctx, cancel = context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	_, err = matchTree.SearchContext(ctx, keys)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestMatchTree_SearchAppend(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString})
+	require.NoError(t, matchTree.AddRules([]MatchRule[string]{
+		{Patterns: []MatchPattern{StringsPattern("a")}, Value: "rule_1", Priority: 1},
+		{Patterns: []MatchPattern{AnyPattern(MatchString)}, Value: "rule_2", Priority: 2},
+	}))
+
+	buffer := make([]string, 0, 8)
+	values, err := matchTree.SearchAppend(buffer, []MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_2", "rule_1"}, values)
+	assert.Same(t, &buffer[:1][0], &values[0])
+
+	values, err = matchTree.SearchAppend(values, []MatchKey{StringKey("b")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_2", "rule_1", "rule_2"}, values)
+
+	values, err = matchTree.SearchAppend(values[:0], []MatchKey{{Type: MatchInteger}})
+	assert.Error(t, err)
+	assert.Empty(t, values)
+
+	values, err = matchTree.SearchAppend(nil, []MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_2", "rule_1"}, values)
+}
+
+func TestMatchTree_SearchMulti(t *testing.T) {
+	matchTree := NewMatchTree(randomTypes, WithValueKey(func(v int) string { return fmt.Sprint(v % 50) }))
+	require.NoError(t, matchTree.AddRules(GenerateRandomRules(randomTypes, 1, 100)))
+	frozenMatchTree := matchTree.Freeze()
+
+	var keySets [][]MatchKey
+	var want [][]int
+	for seed := range int64(100) {
+		keys := GenerateRandomKeys(randomTypes, seed)
+		keySets = append(keySets, keys)
+		values, err := matchTree.Search(keys)
+		require.NoError(t, err)
+		want = append(want, values)
+	}
+	valueLists, err := matchTree.SearchMulti(keySets)
+	require.NoError(t, err)
+	assert.Equal(t, want, valueLists)
+	for _, parallelism := range []int{0, 1, 3, 200} {
+		valueLists, err = frozenMatchTree.SearchMulti(keySets, parallelism)
+		require.NoError(t, err)
+		assert.Equal(t, want, valueLists, "%v", parallelism)
+	}
+
+	// appending to the values of a key set leaves the others intact
+	valueLists, err = matchTree.SearchMulti(keySets[:2])
+	require.NoError(t, err)
+	_ = append(valueLists[0], -1)
+	assert.Equal(t, want[:2], valueLists)
+
+	valueLists, err = matchTree.SearchMulti(nil)
+	require.NoError(t, err)
+	assert.Empty(t, valueLists)
+
+	keySets[1] = keySets[1][:1]
+	_, err = matchTree.SearchMulti(keySets)
+	assert.ErrorIs(t, err, ErrKeyCountMismatch)
+	assert.EqualError(t, err, "matchtree: key set #2: unexpected number of match keys; expected=11 actual=1")
+	_, err = frozenMatchTree.SearchMulti(keySets, 4)
+	assert.ErrorIs(t, err, ErrKeyCountMismatch)
+	assert.EqualError(t, err, "matchtree: key set #2: unexpected number of match keys; expected=11 actual=1")
+}
+
+func TestMatchTree_RemoveRuleByID(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString, MatchInteger})
+	id1, err := matchTree.AddRule(MatchRule[string]{
+		Patterns: []MatchPattern{StringsPattern("a", "b"), IntegersPattern(1)},
+		Value:    "rule_1",
+	})
+	require.NoError(t, err)
+	id2, err := matchTree.AddRule(MatchRule[string]{
+		Patterns: []MatchPattern{AnyPattern(MatchString), IntegersPattern(1)},
+		Value:    "rule_2",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, RuleID(1), id1)
+	assert.Equal(t, RuleID(2), id2)
+
+	keys := []MatchKey{StringKey("a"), IntegerKey(1)}
+	require.NoError(t, matchTree.RemoveRuleByID(id1))
+	values, err := matchTree.Search(keys)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_2"}, values)
+	values, err = matchTree.Search([]MatchKey{StringKey("b"), IntegerKey(1)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_2"}, values)
+
+	err = matchTree.RemoveRuleByID(id1)
+	assert.ErrorIs(t, err, ErrRuleNotFound)
+	err = matchTree.RemoveRuleByID(RuleID(100))
+	assert.ErrorIs(t, err, ErrRuleNotFound)
+
+	id3, err := matchTree.AddRule(MatchRule[string]{
+		Patterns: []MatchPattern{StringsPattern("a"), IntegersPattern(1)},
+		Value:    "rule_3",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, RuleID(3), id3)
+	require.NoError(t, matchTree.RemoveRuleByID(id2))
+	values, err = matchTree.Search(keys)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_3"}, values)
+}
+
+func TestMatchTree_ReplaceRuleByID(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString})
+	id1, err := matchTree.AddRule(MatchRule[string]{Patterns: []MatchPattern{StringsPattern("a")}, Value: "rule_1"})
+	require.NoError(t, err)
+	_, err = matchTree.AddRule(MatchRule[string]{Patterns: []MatchPattern{AnyPattern(MatchString)}, Value: "rule_2"})
+	require.NoError(t, err)
+
+	err = matchTree.ReplaceRuleByID(id1, MatchRule[string]{Patterns: []MatchPattern{StringsPattern("b")}, Value: "rule_1b"})
+	require.NoError(t, err)
+	values, err := matchTree.Search([]MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_2"}, values)
+	values, err = matchTree.Search([]MatchKey{StringKey("b")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_1b", "rule_2"}, values, "the replaced rule keeps its place in insertion order")
+
+	err = matchTree.ReplaceRuleByID(id1, MatchRule[string]{Patterns: []MatchPattern{{Type: MatchInteger}}})
+	assert.ErrorContains(t, err, "unexpected match type")
+	values, err = matchTree.Search([]MatchKey{StringKey("b")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_1b", "rule_2"}, values, "an invalid rule leaves the old rule in place")
+
+	require.NoError(t, matchTree.RemoveRuleByID(id1))
+	err = matchTree.ReplaceRuleByID(id1, MatchRule[string]{Patterns: []MatchPattern{StringsPattern("b")}})
+	assert.ErrorIs(t, err, ErrRuleNotFound)
+}
+
+func TestMatchTree_SetRuleEnabled(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString})
+	id1, err := matchTree.AddRule(MatchRule[string]{Patterns: []MatchPattern{StringsPattern("a", "b")}, Value: "rule_1", Priority: 1})
+	require.NoError(t, err)
+	_, err = matchTree.AddRule(MatchRule[string]{Patterns: []MatchPattern{StringsPattern("b")}, Value: "rule_2"})
+	require.NoError(t, err)
+
+	search := func(key string) []string {
+		values, err := matchTree.Search([]MatchKey{StringKey(key)})
+		require.NoError(t, err)
+		return values
+	}
+	searchAny := func(key string) bool {
+		ok, err := matchTree.SearchAny([]MatchKey{StringKey(key)})
+		require.NoError(t, err)
+		return ok
+	}
+
+	require.NoError(t, matchTree.SetRuleEnabled(id1, false))
+	assert.Nil(t, search("a"))
+	assert.False(t, searchAny("a"))
+	assert.Equal(t, []string{"rule_2"}, search("b"))
+	values, err := matchTree.Freeze().Search([]MatchKey{StringKey("b")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_2"}, values)
+
+	require.NoError(t, matchTree.ReplaceRuleByID(id1, MatchRule[string]{Patterns: []MatchPattern{StringsPattern("a")}, Value: "rule_1", Priority: 1}))
+	assert.Nil(t, search("a"), "a replaced rule stays disabled")
+
+	require.NoError(t, matchTree.SetRuleEnabled(id1, true))
+	assert.Equal(t, []string{"rule_1"}, search("a"))
+	assert.True(t, searchAny("a"))
+
+	err = matchTree.SetRuleEnabled(RuleID(100), true)
+	assert.ErrorIs(t, err, ErrRuleNotFound)
+}
+
+func TestMatchTree_SearchAt(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	expiresAt := now.Add(time.Hour)
+	matchTree := NewMatchTree[string]([]MatchType{MatchString})
+	require.NoError(t, matchTree.AddRules([]MatchRule[string]{
+		{Patterns: []MatchPattern{StringsPattern("a")}, Value: "rule_1", Priority: 1, ExpiresAt: &expiresAt},
+		{Patterns: []MatchPattern{AnyPattern(MatchString)}, Value: "rule_2"},
+	}))
+
+	tests := []struct {
+		now  time.Time
+		want []string
+	}{
+		{now, []string{"rule_1", "rule_2"}},
+		{expiresAt.Add(-time.Nanosecond), []string{"rule_1", "rule_2"}},
+		{expiresAt, []string{"rule_2"}},
+		{expiresAt.Add(time.Hour), []string{"rule_2"}},
+	}
+	for _, tt := range tests {
+		values, err := matchTree.SearchAt(tt.now, []MatchKey{StringKey("a")})
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, values, "%v", tt.now)
+	}
+	values, err := matchTree.Search([]MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_1", "rule_2"}, values, "Search ignores expiry")
+
+	assert.Equal(t, 0, matchTree.PurgeExpired(now))
+	assert.Equal(t, 1, matchTree.PurgeExpired(expiresAt))
+	values, err = matchTree.Search([]MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_2"}, values)
+	assert.Equal(t, 0, matchTree.PurgeExpired(expiresAt))
+}
+
+func TestMatchTree_PurgeExpired_Prune(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	expiresAt := now.Add(time.Hour)
+	matchTree := NewMatchTree[string]([]MatchType{MatchString, MatchIntegerInterval, MatchRegexp})
+	require.NoError(t, matchTree.AddRules([]MatchRule[string]{
+		{Patterns: []MatchPattern{StringsPattern("a"), IntegerIntervalPattern(ClosedInterval(1, 2)), RegexpPattern("^x")}, Value: "rule_1"},
+		{Patterns: []MatchPattern{StringsPattern("b"), InverseIntegerIntervalPattern(ClosedInterval(3, 4)), AnyPattern(MatchRegexp)}, Value: "rule_2"},
+	}))
+	statsBefore := matchTree.Stats()
+	for i := range 1000 {
+		require.NoError(t, matchTree.AddRules([]MatchRule[string]{
+			{
+				Patterns:  []MatchPattern{StringsPattern(fmt.Sprintf("s%d", i)), IntegerIntervalPattern(ClosedInterval(int64(i), int64(i)+1)), RegexpPattern(fmt.Sprintf("^r%d", i))},
+				Value:     fmt.Sprintf("expiring_%d", i),
+				ExpiresAt: &expiresAt,
+			},
+			{
+				Patterns:  []MatchPattern{StringsPattern("b"), InverseIntegerIntervalPattern(ClosedInterval(int64(i), int64(i))), InverseRegexpPattern(fmt.Sprintf("^r%d", i))},
+				Value:     fmt.Sprintf("expiring_inverse_%d", i),
+				ExpiresAt: &expiresAt,
+			},
+		}))
+	}
+	require.Greater(t, matchTree.Stats().NodeCount, statsBefore.NodeCount)
+
+	assert.Equal(t, 2000, matchTree.PurgeExpired(expiresAt))
+	assert.Equal(t, statsBefore, matchTree.Stats())
+	var valueIndexes []int
+	matchTree.Walk(func(depth int, matchType MatchType, info NodeInfo) bool {
+		for _, result := range info.Results {
+			valueIndexes = append(valueIndexes, result.ValueIndex)
+		}
+		return true
+	})
+	slices.Sort(valueIndexes)
+	assert.Equal(t, []int{0, 1}, valueIndexes, "value slots freed")
+	require.NoError(t, matchTree.Validate())
+
+	values, err := matchTree.Search([]MatchKey{StringKey("a"), IntegerIntervalKey(1), RegexpKey("xyz")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_1"}, values)
+	values, err = matchTree.Search([]MatchKey{StringKey("b"), IntegerIntervalKey(5), RegexpKey("r5")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_2"}, values)
+	values, err = matchTree.Freeze().Search([]MatchKey{StringKey("b"), IntegerIntervalKey(5), RegexpKey("r5")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_2"}, values)
+
+	id, err := matchTree.AddRule(MatchRule[string]{
+		Patterns: []MatchPattern{StringsPattern("a"), IntegerIntervalPattern(ClosedInterval(1, 2)), RegexpPattern("^x")},
+		Value:    "rule_3",
+	})
+	require.NoError(t, err)
+	values, err = matchTree.Search([]MatchKey{StringKey("a"), IntegerIntervalKey(1), RegexpKey("xyz")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_1", "rule_3"}, values)
+
+	for _, id := range []RuleID{1, 2, id} {
+		require.NoError(t, matchTree.RemoveRuleByID(id))
+	}
+	_, err = matchTree.AddRule(MatchRule[string]{Patterns: []MatchPattern{StringsPattern("c"), AnyPattern(MatchIntegerInterval), AnyPattern(MatchRegexp)}, Value: "rule_4", ExpiresAt: &expiresAt})
+	require.NoError(t, err)
+	assert.Equal(t, 1, matchTree.PurgeExpired(expiresAt))
+	assert.Equal(t, TreeStats{}, matchTree.Stats(), "empty tree")
+}
+
+func TestMatchTree_SearchDetailed(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString})
+	labels := map[string]string{"owner": "tom", "source": "rules.json"}
+	id1, err := matchTree.AddRule(MatchRule[string]{
+		Patterns: []MatchPattern{StringsPattern("a")},
+		Value:    "rule_1",
+		Priority: 1,
+		Labels:   labels,
+	})
+	require.NoError(t, err)
+	id2, err := matchTree.AddRule(MatchRule[string]{Patterns: []MatchPattern{AnyPattern(MatchString)}, Value: "rule_2"})
+	require.NoError(t, err)
+	labels["owner"] = "jerry"
+
+	results, err := matchTree.SearchDetailed([]MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.Equal(t, []SearchResult[string]{
+		{Value: "rule_1", Priority: 1, RuleID: id1, Labels: map[string]string{"owner": "tom", "source": "rules.json"}},
+		{Value: "rule_2", Priority: 0, RuleID: id2},
+	}, results)
+
+	results, err = matchTree.SearchDetailed([]MatchKey{{Type: MatchInteger}})
+	assert.Error(t, err)
+	assert.Nil(t, results)
+
+	rules := matchTree.ToRules()
+	require.Len(t, rules, 2)
+	assert.Equal(t, map[string]string{"owner": "tom", "source": "rules.json"}, rules[0].Labels)
+}
+
+func TestMatchRule_Msgpack(t *testing.T) {
+	rules := []MatchRule[string]{
+		{
+			Patterns: []MatchPattern{
+				InverseStringsPattern("joe"),
+				IntegerIntervalPattern(IntegerInterval{Min: Int64Ptr(0), Max: Int64Ptr(65), MaxIsExcluded: true}),
+				NumberIntervalPattern(NumberInterval{Min: Float64Ptr(1.5)}),
+			},
+			Value:    "rule_1",
+			Priority: 2,
+			Labels:   map[string]string{"owner": "tom"},
+		},
+		{
+			Patterns: []MatchPattern{
+				AnyPattern(MatchString),
+				InverseIntegerIntervalPattern(IntegerInterval{Max: Int64Ptr(0)}),
+				AnyPattern(MatchNumberInterval),
+			},
+			Value: "rule_2",
+		},
+	}
+	data, err := msgpack.Marshal(rules)
+	require.NoError(t, err)
+
+	var raw []map[string]any
+	require.NoError(t, msgpack.Unmarshal(data, &raw))
+	assert.Equal(t, "STRING", raw[0]["patterns"].([]any)[0].(map[string]any)["type"])
+
+	var rules2 []MatchRule[string]
+	require.NoError(t, msgpack.Unmarshal(data, &rules2))
+	assert.Equal(t, rules, rules2)
+
+	types := []MatchType{MatchString, MatchIntegerInterval, MatchNumberInterval}
+	matchTree := NewMatchTree[string](types)
+	require.NoError(t, matchTree.AddRules(rules))
+	matchTree2 := NewMatchTree[string](types)
+	require.NoError(t, matchTree2.AddRules(rules2))
+	for _, keys := range [][]MatchKey{
+		{StringKey("tom"), IntegerIntervalKey(0), NumberKey(2)},
+		{StringKey("tom"), IntegerIntervalKey(-1), NumberKey(1)},
+		{StringKey("joe"), IntegerIntervalKey(65), NumberKey(2)},
+	} {
+		values, err := matchTree.Search(keys)
+		require.NoError(t, err)
+		values2, err := matchTree2.Search(keys)
+		require.NoError(t, err)
+		assert.Equal(t, values, values2, "%v", keys)
+	}
+}
+
+func TestMatchTree_Search_Enum(t *testing.T) {
+	colors := map[string]int64{"RED": 1, "GREEN": 2, "BLUE": 3}
+	matchTree := NewMatchTree[string]([]MatchType{MatchEnum})
+	require.NoError(t, matchTree.AddRules([]MatchRule[string]{
+		{Patterns: []MatchPattern{EnumPattern(colors, "RED", "GREEN")}, Value: "rule_1", Priority: 1},
+		{Patterns: []MatchPattern{InverseEnumPattern(colors, "RED")}, Value: "rule_2"},
+	}))
+
+	tests := []struct {
+		key  MatchKey
+		want []string
+	}{
+		{EnumKey(1), []string{"rule_1"}},
+		{EnumKey(2), []string{"rule_1", "rule_2"}},
+		{EnumKey(3), []string{"rule_2"}},
+		{MatchKey{Type: MatchEnum, Integers: []int64{1, 3}}, []string{"rule_1"}},
+	}
+	for _, tt := range tests {
+		values, err := matchTree.Search([]MatchKey{tt.key})
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, values, "%v", tt.key)
+		values, err = matchTree.Freeze().Search([]MatchKey{tt.key})
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, values, "frozen %v", tt.key)
+	}
+
+	explanations, err := matchTree.Explain([]MatchKey{EnumKey(2)})
+	require.NoError(t, err)
+	require.Len(t, explanations, 2)
+	assert.Equal(t, []string{"GREEN"}, explanations[0].Steps[0].Pattern.Strings)
+	assert.Equal(t, []string{"RED"}, explanations[1].Steps[0].Pattern.Strings)
+
+	var b strings.Builder
+	require.NoError(t, matchTree.WriteDOT(&b))
+	assert.Contains(t, b.String(), `label="\"GREEN\""`)
+	assert.Contains(t, b.String(), `label="!{\"RED\"}"`)
+
+	assert.Equal(t, []MatchRule[string]{
+		{Patterns: []MatchPattern{EnumPattern(map[string]int64{"RED": 1, "GREEN": 2}, "RED", "GREEN")}, Value: "rule_1", Priority: 1},
+		{Patterns: []MatchPattern{InverseEnumPattern(map[string]int64{"RED": 1}, "RED")}, Value: "rule_2"},
+	}, matchTree.ToRules())
+
+	_, err = matchTree.AddRule(MatchRule[string]{Patterns: []MatchPattern{EnumPattern(colors, "PINK")}})
+	assert.EqualError(t, err, `matchtree: unknown enum name "PINK"`)
+	pattern := EnumPattern(colors, "PINK")
+	assert.EqualError(t, pattern.Validate(), `matchtree: unknown enum name "PINK"`)
+	pattern = StringsPattern("a")
+	pattern.EnumCodes = colors
+	assert.EqualError(t, pattern.Validate(), "matchtree: unexpected enum codes for STRING pattern")
+	key := EnumKey(1)
+	assert.NoError(t, key.Validate())
+}
+
+func TestMatchTree_Search_Bytes(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchBytes})
+	require.NoError(t, matchTree.AddRules([]MatchRule[string]{
+		{Patterns: []MatchPattern{BytesPattern([]byte{0xff, 0x00}, []byte("raw"))}, Value: "rule_1", Priority: 1},
+		{Patterns: []MatchPattern{InverseBytesPattern([]byte{0xff, 0x00})}, Value: "rule_2"},
+		{Patterns: []MatchPattern{AnyPattern(MatchBytes)}, Value: "rule_3", Priority: -1},
+	}))
+
+	tests := []struct {
+		key  MatchKey
+		want []string
+	}{
+		{BytesKey([]byte{0xff, 0x00}), []string{"rule_1", "rule_3"}},
+		{BytesKey([]byte("raw")), []string{"rule_1", "rule_2", "rule_3"}},
+		{BytesKey([]byte{0xff}), []string{"rule_2", "rule_3"}},
+		{BytesKey(nil), []string{"rule_2", "rule_3"}},
+	}
+	for _, tt := range tests {
+		values, err := matchTree.Search([]MatchKey{tt.key})
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, values, "%v", tt.key)
+		values, err = matchTree.Freeze().Search([]MatchKey{tt.key})
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, values, "frozen %v", tt.key)
+	}
+
+	var b strings.Builder
+	require.NoError(t, matchTree.WriteDOT(&b))
+	assert.Contains(t, b.String(), `label="0xff00"`)
+	assert.Contains(t, b.String(), `label="!{0xff00}"`)
+
+	assert.Equal(t, []MatchRule[string]{
+		{Patterns: []MatchPattern{BytesPattern([]byte("raw"), []byte{0xff, 0x00})}, Value: "rule_1", Priority: 1},
+		{Patterns: []MatchPattern{InverseBytesPattern([]byte{0xff, 0x00})}, Value: "rule_2"},
+		{Patterns: []MatchPattern{AnyPattern(MatchBytes)}, Value: "rule_3", Priority: -1},
+	}, matchTree.ToRules())
+
+	key := MatchKey{Type: MatchString, Bytes: []byte("a")}
+	assert.EqualError(t, key.Validate(), "matchtree: unexpected bytes for STRING key")
+	key = BytesKey([]byte("a"))
+	assert.NoError(t, key.Validate())
+}
+
+func TestMatchTree_Explain_IntegerRangeKeyChildOrder(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchInteger})
+	_, err := matchTree.AddRule(MatchRule[string]{Patterns: []MatchPattern{IntegersPattern(5, 3, 9, 1, 7)}, Value: "rule_1"})
+	require.NoError(t, err)
+	id, err := matchTree.AddRule(MatchRule[string]{Patterns: []MatchPattern{IntegersPattern(4, 6)}, Value: "rule_2"})
+	require.NoError(t, err)
+	_, err = matchTree.AddRule(MatchRule[string]{Patterns: []MatchPattern{InverseIntegersPattern(2, 8)}, Value: "rule_3"})
+	require.NoError(t, err)
+
+	explainIntegers := func() []int64 {
+		explanations, err := matchTree.Explain([]MatchKey{IntegerRangeKey(ClosedInterval(0, 10))})
+		require.NoError(t, err)
+		var integers []int64
+		for _, explanation := range explanations {
+			if explanation.Value == "rule_1" {
+				integers = append(integers, explanation.Steps[0].Pattern.Integers...)
+			}
+		}
+		return integers
+	}
+	for range 20 {
+		assert.Equal(t, []int64{1, 3, 5, 7, 9}, explainIntegers())
+	}
+
+	require.NoError(t, matchTree.RemoveRuleByID(id))
+	matchTree.Compact()
+	for range 20 {
+		assert.Equal(t, []int64{1, 3, 5, 7, 9}, explainIntegers())
+	}
+	values, err := matchTree.Search([]MatchKey{IntegerRangeKey(ClosedInterval(6, 8))})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_1"}, values)
+}
+
+func TestMatchTree_Search_SemverRange(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchSemverRange})
+	require.NoError(t, matchTree.AddRules([]MatchRule[string]{
+		{Patterns: []MatchPattern{SemverRangePattern(">=1.2.0 <2.0.0")}, Value: "rule_1", Priority: 2},
+		{Patterns: []MatchPattern{SemverRangePattern("^0.3.1 || ~2.1.0")}, Value: "rule_2", Priority: 1},
+		{Patterns: []MatchPattern{InverseSemverRangePattern("<1.0.0")}, Value: "rule_3"},
+	}))
+
+	tests := []struct {
+		version string
+		want    []string
+	}{
+		{"1.2.0", []string{"rule_1", "rule_3"}},
+		{"v1.9.9+build.1", []string{"rule_1", "rule_3"}},
+		{"1.2.0-rc.1", []string{"rule_3"}},
+		{"2.0.0", []string{"rule_3"}},
+		{"2.1.5", []string{"rule_2", "rule_3"}},
+		{"0.3.9", []string{"rule_2"}},
+		{"0.4.0", nil},
+		{"1.0.0-alpha", nil},
+	}
+	for _, tt := range tests {
+		version, err := ParseVersion(tt.version)
+		require.NoError(t, err)
+		values, err := matchTree.Search([]MatchKey{VersionKey(version)})
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, values, tt.version)
+		values, err = matchTree.Freeze().Search([]MatchKey{VersionKey(version)})
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, values, "frozen %v", tt.version)
+	}
+
+	var b strings.Builder
+	require.NoError(t, matchTree.WriteDOT(&b))
+	assert.Contains(t, b.String(), `label=">=1.2.0 <2.0.0"`)
+	assert.Contains(t, b.String(), `label="!{<1.0.0}"`)
+
+	assert.Equal(t, []MatchRule[string]{
+		{Patterns: []MatchPattern{SemverRangePattern(">=1.2.0 <2.0.0")}, Value: "rule_1", Priority: 2},
+		{Patterns: []MatchPattern{SemverRangePattern("^0.3.1 || ~2.1.0")}, Value: "rule_2", Priority: 1},
+		{Patterns: []MatchPattern{InverseSemverRangePattern("<1.0.0")}, Value: "rule_3"},
+	}, matchTree.ToRules())
+
+	_, err := matchTree.AddRule(MatchRule[string]{Patterns: []MatchPattern{SemverRangePattern(">=1.2")}})
+	assert.EqualError(t, err, `matchtree: invalid version constraint ">=1.2": comparator ">=1.2": expected major.minor.patch`)
+	pattern := SemverRangePattern("!1.0.0")
+	assert.EqualError(t, pattern.Validate(), `matchtree: invalid version constraint "!1.0.0": comparator "!1.0.0": unknown operator "!"`)
+	key := MatchKey{Type: MatchString, Version: Version{Major: 1}}
+	assert.EqualError(t, key.Validate(), "matchtree: unexpected version for STRING key")
+	key = VersionKey(Version{})
+	assert.NoError(t, key.Validate())
+}
+
+func TestMatchTree_Search_Glob(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchGlob})
+	require.NoError(t, matchTree.AddRules([]MatchRule[string]{
+		{Patterns: []MatchPattern{GlobPattern("user-?")}, Value: "rule_1", Priority: 2},
+		{Patterns: []MatchPattern{GlobPattern("*.go")}, Value: "rule_2", Priority: 1},
+		{Patterns: []MatchPattern{GlobPattern(`a\*?`)}, Value: "rule_3", Priority: 1},
+		{Patterns: []MatchPattern{InverseGlobPattern("*-*")}, Value: "rule_4"},
+	}))
+
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{"user-a", []string{"rule_1"}},
+		{"user-é", []string{"rule_1"}},    // a 2-byte rune
+		{"user-世", []string{"rule_1"}},    // a 3-byte rune
+		{"user-😀", []string{"rule_1"}},    // a 4-byte rune
+		{"user-\xff", []string{"rule_1"}}, // a byte of an invalid encoding
+		{"user-", nil},
+		{"user-ab", nil},
+		{"user-éé", nil},
+		{"main.go", []string{"rule_2", "rule_4"}},
+		{".go", []string{"rule_2", "rule_4"}},
+		{"世界.go", []string{"rule_2", "rule_4"}},
+		{"main.go.bak", []string{"rule_4"}},
+		{"a*b", []string{"rule_3", "rule_4"}},
+		{"a*世", []string{"rule_3", "rule_4"}},
+		{"axb", []string{"rule_4"}},
+		{"x-y", nil},
+	}
+	frozenMatchTree := matchTree.Freeze()
+	for _, tt := range tests {
+		values, err := matchTree.Search([]MatchKey{GlobKey(tt.key)})
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, values, tt.key)
+		values, err = frozenMatchTree.Search([]MatchKey{GlobKey(tt.key)})
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, values, "frozen %v", tt.key)
+	}
+
+	var b strings.Builder
+	require.NoError(t, matchTree.WriteDOT(&b))
+	assert.Contains(t, b.String(), `label="\"user-?\""`)
+	assert.Contains(t, b.String(), `label="!{\"*-*\"}"`)
+	assert.Equal(t, "GLOB user-?", GlobPattern("user-?").String())
+
+	assert.Equal(t, []MatchRule[string]{
+		{Patterns: []MatchPattern{GlobPattern("user-?")}, Value: "rule_1", Priority: 2},
+		{Patterns: []MatchPattern{GlobPattern("*.go")}, Value: "rule_2", Priority: 1},
+		{Patterns: []MatchPattern{GlobPattern(`a\*?`)}, Value: "rule_3", Priority: 1},
+		{Patterns: []MatchPattern{InverseGlobPattern("*-*")}, Value: "rule_4"},
+	}, matchTree.ToRules())
+
+	_, err := matchTree.AddRule(MatchRule[string]{Patterns: []MatchPattern{GlobPattern(`a\`)}})
+	assert.EqualError(t, err, `matchtree: invalid glob "a\\": trailing backslash`)
+	pattern := MatchPattern{Type: MatchGlob, Strings: []string{"a"}}
+	assert.EqualError(t, pattern.Validate(), "matchtree: unexpected strings for GLOB pattern")
+	key := MatchKey{Type: MatchGlob, Integer: 1}
+	assert.EqualError(t, key.Validate(), "matchtree: unexpected integer for GLOB key")
+}
+
+func TestMatchTree_Search_Numeric(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchNumeric})
+	require.NoError(t, matchTree.AddRules([]MatchRule[string]{
+		{Patterns: []MatchPattern{NumericPattern([]int64{1, 7}, ClosedInterval(3, 5))}, Value: "rule_1", Priority: 3},
+		{Patterns: []MatchPattern{NumericPattern([]int64{4, 20}, FromInterval(10), ClosedInterval(8, 8))}, Value: "rule_2", Priority: 2},
+		{Patterns: []MatchPattern{InverseNumericPattern([]int64{1}, ClosedInterval(10, 15))}, Value: "rule_3", Priority: 1},
+		{Patterns: []MatchPattern{NumericPattern(nil, HalfOpenInterval(1, 3))}, Value: "rule_4"},
+	}))
+
+	tests := []struct {
+		key  int64
+		want []string
+	}{
+		{0, []string{"rule_3"}},
+		{1, []string{"rule_1", "rule_4"}},
+		{2, []string{"rule_3", "rule_4"}},
+		{4, []string{"rule_1", "rule_2", "rule_3"}},
+		{7, []string{"rule_1", "rule_3"}},
+		{8, []string{"rule_2", "rule_3"}},
+		{12, []string{"rule_2"}},
+		{20, []string{"rule_2", "rule_3"}},
+	}
+	frozenMatchTree := matchTree.Freeze()
+	for _, tt := range tests {
+		values, err := matchTree.Search([]MatchKey{NumericKey(tt.key)})
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, values, tt.key)
+		values, err = frozenMatchTree.Search([]MatchKey{NumericKey(tt.key)})
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, values, "frozen %v", tt.key)
+	}
+	values, err := matchTree.Search([]MatchKey{AbsentKey(MatchNumeric)})
+	require.NoError(t, err)
+	assert.Empty(t, values)
+	require.NoError(t, matchTree.Validate())
+
+	// the intervals of a single integer are exact children, and the integers in the intervals
+	// are dropped
+	assert.Equal(t, []MatchRule[string]{
+		{Patterns: []MatchPattern{NumericPattern([]int64{1, 7}, ClosedInterval(3, 5))}, Value: "rule_1", Priority: 3},
+		{Patterns: []MatchPattern{NumericPattern([]int64{4, 8}, FromInterval(10))}, Value: "rule_2", Priority: 2},
+		{Patterns: []MatchPattern{InverseNumericPattern(nil, ClosedInterval(1, 1), ClosedInterval(10, 15))}, Value: "rule_3", Priority: 1},
+		{Patterns: []MatchPattern{NumericPattern(nil, HalfOpenInterval(1, 3))}, Value: "rule_4"},
+	}, matchTree.ToRules())
+
+	var b strings.Builder
+	require.NoError(t, matchTree.WriteDOT(&b))
+	assert.Contains(t, b.String(), `label="7"`)
+	assert.Contains(t, b.String(), `label="[3,5]"`)
+	assert.Equal(t, "NUMERIC 7", NumericPattern([]int64{7}).String())
+	assert.Equal(t, "NUMERIC in {1,[3,5]}", NumericPattern([]int64{1}, ClosedInterval(3, 5)).String())
+
+	pattern := MatchPattern{Type: MatchNumeric}
+	assert.EqualError(t, pattern.Validate(), "matchtree: no integers or integer intervals for NUMERIC pattern")
+	pattern = MatchPattern{Type: MatchNumeric, Strings: []string{"a"}}
+	assert.EqualError(t, pattern.Validate(), "matchtree: unexpected strings for NUMERIC pattern")
+	pattern = MatchPattern{Type: MatchNumeric, IsAny: true, Integers: []int64{1}}
+	assert.EqualError(t, pattern.Validate(), "matchtree: unexpected integers or integer intervals for any NUMERIC pattern")
+	key := MatchKey{Type: MatchNumeric, Integers: []int64{1}}
+	assert.EqualError(t, key.Validate(), "matchtree: unexpected integers for NUMERIC key")
+}
+
+func TestVersion_Compare(t *testing.T) {
+	versions := []string{
+		"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2",
+		"1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.2.0", "10.0.0",
+	}
+	for i := range versions {
+		x, err := ParseVersion(versions[i])
+		require.NoError(t, err)
+		assert.Equal(t, versions[i], x.String())
+		assert.Equal(t, 0, x.Compare(x))
+		if i >= 1 {
+			y, err := ParseVersion(versions[i-1])
+			require.NoError(t, err)
+			assert.Equal(t, 1, x.Compare(y), "%v > %v", x, y)
+			assert.Equal(t, -1, y.Compare(x), "%v < %v", y, x)
+		}
+	}
+
+	for _, s := range []string{"1.2", "01.2.3", "1.2.3-", "1.2.3-a..b", "1.2.x"} {
+		_, err := ParseVersion(s)
+		assert.Error(t, err, s)
+	}
+
+	data, err := json.Marshal(VersionKey(Version{Major: 1, Minor: 2, Patch: 3, Prerelease: "rc.1"}))
+	require.NoError(t, err)
+	var key MatchKey
+	require.NoError(t, json.Unmarshal(data, &key))
+	assert.Equal(t, VersionKey(Version{Major: 1, Minor: 2, Patch: 3, Prerelease: "rc.1"}), key)
+	data, err = json.Marshal(IntegerKey(1))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "version")
+}
+
+func TestMatchPattern_String(t *testing.T) {
+	tests := []struct {
+		pattern MatchPattern
+		want    string
+	}{
+		{StringsPattern("a", "b"), "STRING in {a,b}"},
+		{AnyPattern(MatchString), "STRING any"},
+		{InverseStringsPattern("x"), "STRING not in {x}"},
+		{IntegersPattern(1, 2), "INTEGER in {1,2}"},
+		{IntegerIntervalPattern(IntegerInterval{Min: Int64Ptr(1), Max: Int64Ptr(5), MaxIsExcluded: true}), "INTEGER_INTERVAL [1,5)"},
+		{
+			NumberIntervalPattern(NumberInterval{Max: Float64Ptr(0.5)}, NumberInterval{Min: Float64Ptr(1)}),
+			"NUMBER_INTERVAL in {(,0.5],[1,)}",
+		},
+		{InverseIntegerIntervalPattern(IntegerInterval{Min: Int64Ptr(3)}), "INTEGER_INTERVAL not in {[3,)}"},
+		{RegexpPattern("^a+$"), "REGEXP /^a+$/"},
+		{BytesPattern([]byte{0xff}), "BYTES in {0xff}"},
+		{SemverRangePattern(">=1.2.0 <2.0.0"), "SEMVER_RANGE >=1.2.0 <2.0.0"},
+		{EnumPattern(map[string]int64{"RED": 1}, "RED"), "ENUM in {RED}"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.pattern.String())
+	}
+}
+
+func TestMatchPattern_AddValues(t *testing.T) {
+	pattern := StringsPattern("a")
+	pattern.AddStrings("b", "a", "c", "b")
+	assert.Equal(t, []string{"a", "b", "c"}, pattern.Strings)
+
+	var pattern2 MatchPattern
+	pattern2.AddIntegers(3, 1, 3)
+	pattern2.AddIntegers(1, 2)
+	assert.Equal(t, []int64{3, 1, 2}, pattern2.Integers)
+
+	pattern3 := IntegerIntervalPattern(ClosedInterval(1, 5))
+	pattern3.AddIntegerIntervals(ClosedInterval(1, 5), ClosedInterval(3, 8), FromInterval(10), FromInterval(10))
+	assert.Equal(t, []IntegerInterval{ClosedInterval(1, 5), ClosedInterval(3, 8), FromInterval(10)}, pattern3.IntegerIntervals)
+
+	pattern4 := NumberIntervalPattern(NumberInterval{Min: Float64Ptr(0), Max: Float64Ptr(1)})
+	pattern4.AddNumberIntervals(
+		NumberInterval{Min: Float64Ptr(0), Max: Float64Ptr(1)},
+		NumberInterval{Min: Float64Ptr(0), Max: Float64Ptr(1), MaxIsExcluded: true},
+	)
+	assert.Equal(t, []NumberInterval{
+		{Min: Float64Ptr(0), Max: Float64Ptr(1)},
+		{Min: Float64Ptr(0), Max: Float64Ptr(1), MaxIsExcluded: true},
+	}, pattern4.NumberIntervals)
+}
+
+func TestMatchKey_Format(t *testing.T) {
+	tests := []struct {
+		key  MatchKey
+		want string
+	}{
+		{StringKey("foo"), `STRING="foo"`},
+		{StringsKey("a", "b"), `STRING={"a","b"}`},
+		{RegexpKey("user_1"), `REGEXP="user_1"`},
+		{IntegerKey(-1), "INTEGER=-1"},
+		{IntegersKey(1, 2), "INTEGER={1,2}"},
+		{IntegerIntervalKey(5), "INTEGER_INTERVAL=5"},
+		{NumberKey(0.5), "NUMBER_INTERVAL=0.5"},
+		{BytesKey([]byte{0xff, 0x00}), "BYTES=0xff00"},
+		{VersionKey(Version{Major: 1, Minor: 2, Patch: 3}), "SEMVER_RANGE=1.2.3"},
+		{EnumKey(2), "ENUM=2"},
+		{AbsentKey(MatchString), "STRING absent"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, fmt.Sprint(tt.key))
+		assert.Equal(t, tt.want, fmt.Sprintf("%s", tt.key))
+	}
+	assert.Equal(t, "[INTEGER=1 STRING=\"a\"]", fmt.Sprint([]MatchKey{IntegerKey(1), StringKey("a")}))
+	assert.Contains(t, fmt.Sprintf("%+v", IntegerKey(1)), "Integer:1")
+}
+
+func TestMatchTree_ValidationErrors(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString, MatchInteger})
+
+	_, err := matchTree.AddRule(MatchRule[string]{Patterns: []MatchPattern{StringsPattern("a")}})
+	assert.ErrorIs(t, err, ErrPatternCountMismatch)
+	assert.EqualError(t, err, "matchtree: unexpected number of match patterns; expected=2 actual=1")
+
+	_, err = matchTree.AddRule(MatchRule[string]{Patterns: []MatchPattern{StringsPattern("a"), StringsPattern("b")}})
+	var typeMismatchErr *TypeMismatchError
+	require.ErrorAs(t, err, &typeMismatchErr)
+	assert.Equal(t, TypeMismatchError{Index: 1, Expected: MatchInteger, Actual: MatchString}, *typeMismatchErr)
+	assert.EqualError(t, err, "matchtree: unexpected match type #2; expected=INTEGER actual=STRING")
+
+	err = matchTree.AddRules([]MatchRule[string]{
+		{Patterns: []MatchPattern{StringsPattern("a"), IntegersPattern(1)}},
+		{Patterns: []MatchPattern{IntegersPattern(1), IntegersPattern(1)}},
+	})
+	require.ErrorAs(t, err, &typeMismatchErr)
+	assert.Equal(t, 0, typeMismatchErr.Index)
+
+	_, err = matchTree.Search([]MatchKey{StringKey("a")})
+	assert.ErrorIs(t, err, ErrKeyCountMismatch)
+	assert.NotErrorIs(t, err, ErrPatternCountMismatch)
+	_, err = matchTree.Freeze().Search([]MatchKey{StringKey("a"), StringKey("b")})
+	require.ErrorAs(t, err, &typeMismatchErr)
+	assert.Equal(t, TypeMismatchError{Index: 1, Expected: MatchInteger, Actual: MatchString}, *typeMismatchErr)
+
+	_, err = NewRuleBuilder[string]([]MatchType{MatchString}).Pattern(IntegersPattern(1)).Build()
+	require.ErrorAs(t, err, &typeMismatchErr)
+	_, err = NewRuleBuilder[string]([]MatchType{MatchString}).Build()
+	assert.ErrorIs(t, err, ErrPatternCountMismatch)
+}
+
+func TestAllMatchTypes(t *testing.T) {
+	types := AllMatchTypes()
+	require.GreaterOrEqual(t, len(types), NumberOfMatchTypes-1)
+	assert.Equal(t, []MatchType{
+		MatchString, MatchInteger, MatchIntegerInterval, MatchNumberInterval, MatchRegexp, MatchEnum,
+		MatchBytes, MatchSemverRange, MatchGlob, MatchNumeric,
+	}, types[:NumberOfMatchTypes-1])
+	for _, type1 := range types {
+		assert.True(t, type1.IsValid(), "%v", type1)
+		type2, err := ParseMatchType(type1.String())
+		require.NoError(t, err)
+		assert.Equal(t, type1, type2)
+	}
+
+	assert.False(t, MatchNone.IsValid())
+	assert.False(t, MatchType(-1).IsValid())
+	assert.False(t, MatchType(NumberOfMatchTypes+len(types)).IsValid())
+}
+
+func TestMatchTree_Search_WithValueDedup(t *testing.T) {
+	type action struct {
+		Name string
+	}
+	matchTree := NewMatchTree([]MatchType{MatchString}, WithValueDedup(func(x, y *action) bool { return x.Name == y.Name }))
+	require.NoError(t, matchTree.AddRules([]MatchRule[*action]{
+		{Patterns: []MatchPattern{StringsPattern("a")}, Value: &action{"deny"}, Priority: 1},
+		{Patterns: []MatchPattern{AnyPattern(MatchString)}, Value: &action{"allow"}, Priority: 2},
+		{Patterns: []MatchPattern{InverseStringsPattern("b")}, Value: &action{"deny"}, Priority: 3},
+	}))
+
+	values, err := matchTree.Search([]MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.Equal(t, []*action{{"deny"}, {"allow"}}, values)
+	assert.Same(t, matchTree.ToRules()[2].Value, values[0])
+	values, err = matchTree.Freeze().Search([]MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.Equal(t, []*action{{"deny"}, {"allow"}}, values)
+	values, err = matchTree.SearchAppend([]*action{{"first"}}, []MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.Equal(t, []*action{{"first"}, {"deny"}, {"allow"}}, values)
+	values, err = matchTree.SearchAll([]MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.Equal(t, []*action{{"deny"}, {"allow"}, {"deny"}}, values)
+}
+
+func TestMatchTree_Search_WithValueKey(t *testing.T) {
+	type action struct {
+		Name string
+	}
+	matchTree := NewMatchTree([]MatchType{MatchString}, WithValueKey(func(x *action) string { return x.Name }))
+	require.NoError(t, matchTree.AddRules([]MatchRule[*action]{
+		{Patterns: []MatchPattern{StringsPattern("a")}, Value: &action{"deny"}, Priority: 1},
+		{Patterns: []MatchPattern{AnyPattern(MatchString)}, Value: &action{"allow"}, Priority: 2},
+		{Patterns: []MatchPattern{InverseStringsPattern("b")}, Value: &action{"deny"}, Priority: 3},
+	}))
+
+	values, err := matchTree.Search([]MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.Equal(t, []*action{{"deny"}, {"allow"}}, values)
+	assert.Same(t, matchTree.ToRules()[2].Value, values[0])
+	values, err = matchTree.Freeze().Search([]MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.Equal(t, []*action{{"deny"}, {"allow"}}, values)
+	groups, err := matchTree.SearchGroupedByPriority([]MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.Equal(t, []PriorityGroup[*action]{
+		{Priority: 3, Values: []*action{{"deny"}}},
+		{Priority: 2, Values: []*action{{"allow"}}},
+	}, groups)
+	values, err = matchTree.SearchAll([]MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.Equal(t, []*action{{"deny"}, {"allow"}, {"deny"}}, values)
+
+	// the key takes precedence over the equality
+	matchTree = NewMatchTree([]MatchType{MatchString},
+		WithValueDedup(func(x, y *action) bool { return true }),
+		WithValueKey(func(x *action) string { return x.Name }))
+	require.NoError(t, matchTree.AddRules([]MatchRule[*action]{
+		{Patterns: []MatchPattern{AnyPattern(MatchString)}, Value: &action{"allow"}},
+		{Patterns: []MatchPattern{AnyPattern(MatchString)}, Value: &action{"deny"}},
+	}))
+	values, err = matchTree.Search([]MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.Equal(t, []*action{{"allow"}, {"deny"}}, values)
+}
+
+func TestMatchTree_Search_WithStringNormalization(t *testing.T) {
+	const composed, decomposed = "caf\u00e9", "cafe\u0301"
+	rules := []MatchRule[string]{
+		{Patterns: []MatchPattern{StringsPattern(decomposed), AnyPattern(MatchString)}, Value: "exact"},
+		{Patterns: []MatchPattern{AnyPattern(MatchString), InverseStringsPattern(composed)}, Value: "inverse"},
+	}
+
+	matchTree := NewMatchTree[string]([]MatchType{MatchString, MatchString})
+	require.NoError(t, matchTree.AddRules(rules))
+	values, err := matchTree.Search([]MatchKey{StringKey(composed), StringKey(decomposed)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"inverse"}, values)
+
+	matchTree = NewMatchTree([]MatchType{MatchString, MatchString}, WithStringNormalization[string](norm.NFC))
+	require.NoError(t, matchTree.AddRules(rules))
+	keys := []MatchKey{StringKey(composed), StringsKey("tea", decomposed)}
+	values, err = matchTree.Search(keys)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"exact"}, values)
+	assert.Equal(t, decomposed, keys[1].Strings[1])
+	values, err = matchTree.Freeze().Search(keys)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"exact"}, values)
+	explanations, err := matchTree.Explain(keys)
+	require.NoError(t, err)
+	require.Len(t, explanations, 1)
+	assert.Equal(t, "exact", explanations[0].Value)
+	assert.Equal(t, []string{composed}, matchTree.ToRules()[0].Patterns[0].Strings)
+}
@@ -0,0 +1,207 @@
+// Package matchtreepb provides plain structs shaped like the protobuf messages in matchtree.proto,
+// and conversions between them and the rules of package matchtree, so that rules can be carried
+// as gRPC payloads. The structs match the field layout of the code generated by protoc-gen-go
+// for matchtree.proto, optional fields being pointers, so converting them to and from generated
+// messages is a field-by-field copy.
+package matchtreepb
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/roy2220/matchtree"
+)
+
+// MatchRule is the message form of matchtree.MatchRule[[]byte].
+type MatchRule struct {
+	Patterns          []*MatchPattern
+	Value             []byte
+	Priority          int64
+	ExpiresAtUnixNano *int64
+	Labels            map[string]string
+	Weight            int64
+}
+
+// MatchPattern is the message form of matchtree.MatchPattern, with the MatchType as a string.
+type MatchPattern struct {
+	Type              string
+	IsAny             bool
+	IsInverse         bool
+	Strings           []string
+	Integers          []int64
+	IntegerIntervals  []*IntegerInterval
+	NumberIntervals   []*NumberInterval
+	Regexp            string
+	ByteSlices        [][]byte
+	VersionConstraint string
+	Glob              string
+	EnumCodes         map[string]int64
+}
+
+// IntegerInterval is the message form of matchtree.IntegerInterval.
+type IntegerInterval struct {
+	Min           *int64
+	MinIsExcluded bool
+	Max           *int64
+	MaxIsExcluded bool
+}
+
+// NumberInterval is the message form of matchtree.NumberInterval.
+type NumberInterval struct {
+	Min           *float64
+	MinIsExcluded bool
+	Max           *float64
+	MaxIsExcluded bool
+}
+
+// RuleToProto converts a MatchRule to its message form.
+func RuleToProto(rule matchtree.MatchRule[[]byte]) *MatchRule {
+	m := &MatchRule{
+		Patterns: make([]*MatchPattern, len(rule.Patterns)),
+		Value:    slices.Clone(rule.Value),
+		Priority: rule.Priority,
+		Labels:   maps.Clone(rule.Labels),
+		Weight:   int64(rule.Weight),
+	}
+	for i, pattern := range rule.Patterns {
+		m.Patterns[i] = PatternToProto(pattern)
+	}
+	if rule.ExpiresAt != nil {
+		unixNano := rule.ExpiresAt.UnixNano()
+		m.ExpiresAtUnixNano = &unixNano
+	}
+	return m
+}
+
+// RuleFromProto converts the message form of a MatchRule back.
+// It returns an error if a pattern has an unknown MatchType.
+func RuleFromProto(m *MatchRule) (matchtree.MatchRule[[]byte], error) {
+	rule := matchtree.MatchRule[[]byte]{
+		Patterns: make([]matchtree.MatchPattern, len(m.Patterns)),
+		Value:    slices.Clone(m.Value),
+		Priority: m.Priority,
+		Labels:   maps.Clone(m.Labels),
+		Weight:   int(m.Weight),
+	}
+	for i, m2 := range m.Patterns {
+		pattern, err := PatternFromProto(m2)
+		if err != nil {
+			return matchtree.MatchRule[[]byte]{}, fmt.Errorf("match pattern #%d: %w", i+1, err)
+		}
+		rule.Patterns[i] = pattern
+	}
+	if m.ExpiresAtUnixNano != nil {
+		expiresAt := time.Unix(0, *m.ExpiresAtUnixNano)
+		rule.ExpiresAt = &expiresAt
+	}
+	return rule, nil
+}
+
+// PatternToProto converts a MatchPattern to its message form.
+func PatternToProto(pattern matchtree.MatchPattern) *MatchPattern {
+	m := &MatchPattern{
+		Type:              pattern.Type.String(),
+		IsAny:             pattern.IsAny,
+		IsInverse:         pattern.IsInverse,
+		Strings:           slices.Clone(pattern.Strings),
+		Integers:          slices.Clone(pattern.Integers),
+		Regexp:            pattern.Regexp,
+		VersionConstraint: pattern.VersionConstraint,
+		Glob:              pattern.Glob,
+		EnumCodes:         maps.Clone(pattern.EnumCodes),
+	}
+	for _, byteSlice := range pattern.ByteSlices {
+		m.ByteSlices = append(m.ByteSlices, slices.Clone(byteSlice))
+	}
+	for _, interval := range pattern.IntegerIntervals {
+		m.IntegerIntervals = append(m.IntegerIntervals, IntegerIntervalToProto(interval))
+	}
+	for _, interval := range pattern.NumberIntervals {
+		m.NumberIntervals = append(m.NumberIntervals, NumberIntervalToProto(interval))
+	}
+	return m
+}
+
+// PatternFromProto converts the message form of a MatchPattern back.
+// It returns an error if the MatchType is unknown.
+func PatternFromProto(m *MatchPattern) (matchtree.MatchPattern, error) {
+	type1, err := matchtree.ParseMatchType(m.Type)
+	if err != nil {
+		return matchtree.MatchPattern{}, err
+	}
+	pattern := matchtree.MatchPattern{
+		Type:              type1,
+		IsAny:             m.IsAny,
+		IsInverse:         m.IsInverse,
+		Strings:           slices.Clone(m.Strings),
+		Integers:          slices.Clone(m.Integers),
+		Regexp:            m.Regexp,
+		VersionConstraint: m.VersionConstraint,
+		Glob:              m.Glob,
+		EnumCodes:         maps.Clone(m.EnumCodes),
+	}
+	for _, byteSlice := range m.ByteSlices {
+		pattern.ByteSlices = append(pattern.ByteSlices, slices.Clone(byteSlice))
+	}
+	for _, m2 := range m.IntegerIntervals {
+		pattern.IntegerIntervals = append(pattern.IntegerIntervals, IntegerIntervalFromProto(m2))
+	}
+	for _, m2 := range m.NumberIntervals {
+		pattern.NumberIntervals = append(pattern.NumberIntervals, NumberIntervalFromProto(m2))
+	}
+	return pattern, nil
+}
+
+// IntegerIntervalToProto converts an IntegerInterval to its message form, a nil bound being
+// left unset.
+func IntegerIntervalToProto(interval matchtree.IntegerInterval) *IntegerInterval {
+	return &IntegerInterval{
+		Min:           clonePtr(interval.Min),
+		MinIsExcluded: interval.MinIsExcluded,
+		Max:           clonePtr(interval.Max),
+		MaxIsExcluded: interval.MaxIsExcluded,
+	}
+}
+
+// IntegerIntervalFromProto converts the message form of an IntegerInterval back, an unset bound
+// becoming nil.
+func IntegerIntervalFromProto(m *IntegerInterval) matchtree.IntegerInterval {
+	return matchtree.IntegerInterval{
+		Min:           clonePtr(m.Min),
+		MinIsExcluded: m.MinIsExcluded,
+		Max:           clonePtr(m.Max),
+		MaxIsExcluded: m.MaxIsExcluded,
+	}
+}
+
+// NumberIntervalToProto converts a NumberInterval to its message form, a nil bound being
+// left unset.
+func NumberIntervalToProto(interval matchtree.NumberInterval) *NumberInterval {
+	return &NumberInterval{
+		Min:           clonePtr(interval.Min),
+		MinIsExcluded: interval.MinIsExcluded,
+		Max:           clonePtr(interval.Max),
+		MaxIsExcluded: interval.MaxIsExcluded,
+	}
+}
+
+// NumberIntervalFromProto converts the message form of a NumberInterval back, an unset bound
+// becoming nil.
+func NumberIntervalFromProto(m *NumberInterval) matchtree.NumberInterval {
+	return matchtree.NumberInterval{
+		Min:           clonePtr(m.Min),
+		MinIsExcluded: m.MinIsExcluded,
+		Max:           clonePtr(m.Max),
+		MaxIsExcluded: m.MaxIsExcluded,
+	}
+}
+
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
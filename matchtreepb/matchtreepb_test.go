@@ -0,0 +1,72 @@
+package matchtreepb_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/roy2220/matchtree"
+	"github.com/roy2220/matchtree/matchtreepb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuleToProto(t *testing.T) {
+	expiresAt := time.Unix(0, 1700000000123456789)
+	rule := MatchRule[[]byte]{
+		Patterns: []MatchPattern{
+			StringsPattern("a", "b"),
+			InverseIntegersPattern(1),
+			IntegerIntervalPattern(IntegerInterval{Min: Int64Ptr(1), MaxIsExcluded: true}),
+			NumberIntervalPattern(NumberInterval{Max: Float64Ptr(1.5), MaxIsExcluded: true}),
+			RegexpPattern("^a"),
+			AnyPattern(MatchString),
+		},
+		Value:     []byte("value"),
+		Priority:  3,
+		ExpiresAt: &expiresAt,
+		Labels:    map[string]string{"owner": "tom"},
+		Weight:    5,
+	}
+
+	m := matchtreepb.RuleToProto(rule)
+	assert.Equal(t, "STRING", m.Patterns[0].Type)
+	require.Len(t, m.Patterns[2].IntegerIntervals, 1)
+	assert.Equal(t, &matchtreepb.IntegerInterval{Min: Int64Ptr(1), MaxIsExcluded: true}, m.Patterns[2].IntegerIntervals[0])
+	assert.Nil(t, m.Patterns[3].NumberIntervals[0].Min)
+	assert.Equal(t, int64(1700000000123456789), *m.ExpiresAtUnixNano)
+
+	rule2, err := matchtreepb.RuleFromProto(m)
+	require.NoError(t, err)
+	assert.Equal(t, rule.Patterns, rule2.Patterns)
+	assert.Equal(t, rule.Value, rule2.Value)
+	assert.Equal(t, rule.Priority, rule2.Priority)
+	assert.True(t, rule.ExpiresAt.Equal(*rule2.ExpiresAt))
+	assert.Equal(t, rule.Labels, rule2.Labels)
+	assert.Equal(t, rule.Weight, rule2.Weight)
+
+	rule.Patterns[2].IntegerIntervals[0].Min = Int64Ptr(2)
+	assert.Equal(t, int64(1), *m.Patterns[2].IntegerIntervals[0].Min)
+
+	m.Patterns[1].Type = "UNKNOWN"
+	_, err = matchtreepb.RuleFromProto(m)
+	assert.ErrorContains(t, err, "match pattern #2: ")
+}
+
+func TestPatternToProto(t *testing.T) {
+	for _, pattern := range []MatchPattern{
+		BytesPattern([]byte("x"), []byte{}),
+		InverseBytesPattern([]byte("y")),
+		SemverRangePattern(">=1.0.0"),
+		InverseSemverRangePattern(">=1.2.0 <2.0.0"),
+		GlobPattern("a*"),
+		InverseGlobPattern("user-?-*"),
+		EnumPattern(map[string]int64{"a": 1, "b": 2}, "a"),
+		InverseEnumPattern(map[string]int64{"a": 1, "b": 2}, "a", "b"),
+	} {
+		m := matchtreepb.PatternToProto(pattern)
+		pattern2, err := matchtreepb.PatternFromProto(m)
+		require.NoError(t, err)
+		assert.Equal(t, pattern, pattern2)
+		assert.NoError(t, pattern2.Validate())
+	}
+}
@@ -0,0 +1,27 @@
+package matchtree
+
+import "time"
+
+// MetricsHooks holds the callbacks through which a MatchTree reports its activity, e.g. to
+// Prometheus counters and histograms. Any of them may be nil, and none is set by default.
+// The callbacks are called synchronously, so they should be cheap, and the ones of a
+// FrozenMatchTree must be safe for concurrent use, like its Search.
+type MetricsHooks struct {
+	// OnSearch is called after each successful search, by Search and its variants returning
+	// values, with the number of keys, the number of results found, before any dedup of the
+	// values, and the time the search took.
+	OnSearch func(keyCount int, resultCount int, duration time.Duration)
+
+	// OnAddRule is called after each rule is added, by AddRule and its variants, ReplaceRuleByID
+	// and BuildFromRules, with the number of leaves the rule was expanded into.
+	OnAddRule func(expandedLeaves int)
+}
+
+// WithMetrics configures the MatchTree to report its activity through the hooks, which are passed
+// on to the FrozenMatchTree frozen from the MatchTree. A hook left nil costs nothing but a check.
+func WithMetrics[T any](hooks MetricsHooks) MatchTreeOptionFunc[T] {
+	return func(o matchTreeOptions[T]) matchTreeOptions[T] {
+		o.Metrics = hooks
+		return o
+	}
+}
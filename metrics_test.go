@@ -0,0 +1,49 @@
+package matchtree_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/roy2220/matchtree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithMetrics(t *testing.T) {
+	type search struct {
+		KeyCount    int
+		ResultCount int
+	}
+	var searches []search
+	var expandedLeaves []int
+	hooks := MetricsHooks{
+		OnSearch: func(keyCount int, resultCount int, duration time.Duration) {
+			assert.GreaterOrEqual(t, duration, time.Duration(0))
+			searches = append(searches, search{keyCount, resultCount})
+		},
+		OnAddRule: func(n int) { expandedLeaves = append(expandedLeaves, n) },
+	}
+	types := []MatchType{MatchString, MatchInteger}
+	rules := []MatchRule[string]{
+		{Patterns: []MatchPattern{StringsPattern("a", "b"), IntegersPattern(1, 2, 3)}, Value: "x"},
+		{Patterns: []MatchPattern{AnyPattern(MatchString), IntegersPattern(1)}, Value: "x"},
+	}
+
+	matchTree := NewMatchTree(types, WithMetrics[string](hooks), WithValueDedup(func(x, y string) bool { return x == y }))
+	require.NoError(t, matchTree.AddRules(rules))
+	assert.Equal(t, []int{6, 1}, expandedLeaves)
+
+	values, err := matchTree.Search([]MatchKey{StringKey("a"), IntegerKey(1)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"x"}, values)
+	_, err = matchTree.Search([]MatchKey{StringKey("a")})
+	assert.Error(t, err)
+	_, err = matchTree.Freeze().Search([]MatchKey{StringKey("c"), IntegerKey(1)})
+	require.NoError(t, err)
+	assert.Equal(t, []search{{2, 2}, {2, 1}}, searches)
+
+	expandedLeaves = nil
+	_, err = BuildFromRules(types, rules, WithMetrics[string](hooks))
+	require.NoError(t, err)
+	assert.Equal(t, []int{6, 1}, expandedLeaves)
+}
@@ -0,0 +1,1048 @@
+package matchtree
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"unsafe"
+)
+
+// The memory-mapped format lays out a tree in a file whose nodes reference their children by
+// offset, so that a FrozenMatchTree opened by OpenMmap searches the mapped region directly.
+// All the integers are little-endian and all the records start at offsets aligned to 8 bytes.
+// Nodes are written before their parents, and the file ends with a trailer:
+//
+//	trailer:      magic [8]byte, typesOffset, valuesOffset, root, nodeCount uint64
+//	types:        count uint64, then {offset, length uint64} of each type name
+//	values:       kind, size, count uint64, then each fixed-size value padded to 8 bytes,
+//	              or {offset, length uint64} of each string or byte slice value
+//	leaf node:    count uint64, then each result:
+//	              priority int64, ruleID uint64, expiry int64, valueIndex uint32, flags uint32
+//	non-leaf:     anyChild, exactCount, exactOffset, inverseCount, inverseOffset uint64
+//	inverse:      child, excludedCount, excludedOffset uint64
+//
+// where a zero offset stands for no node. The exact children, sorted for binary search, and the
+// values excluded by an inverse child are keyed by type:
+//
+//	STRING, BYTES:     exact {offset, length, child uint64}, excluded {offset, length uint64}
+//	INTEGER, ENUM:     exact {value int64, child uint64}, excluded value int64
+//	INTEGER_INTERVAL:  exact {min, max, maxOfMaxes int64, child uint64}, excluded {min, max int64}
+//	NUMBER_INTERVAL:   exact {min, max, maxOfMaxes float64, flags, child uint64},
+//	                   excluded {min, max float64, flags uint64}
+//
+// where integer intervals have inclusive bounds, number intervals have infinite bounds for the
+// unbounded sides besides the flags from mmapMinIsExcluded on, and maxOfMaxes is the largest
+// max of the exact child and the ones sorted before it, which ends the scan for a key.
+const mmapMagic = "MTMMAP01"
+
+const (
+	mmapTrailerSize      = 40
+	mmapResultSize       = 32
+	mmapNonLeafNodeSize  = 40
+	mmapInverseChildSize = 24
+)
+
+// mmapEntrySizes returns the sizes of the exact entries and of the excluded entries of the match
+// type, or false if the match type cannot be memory-mapped.
+func mmapEntrySizes(type1 MatchType) (uint64, uint64, bool) {
+	switch type1 {
+	case MatchString, MatchBytes:
+		return 24, 16, true
+	case MatchInteger, MatchEnum:
+		return 16, 8, true
+	case MatchIntegerInterval:
+		return 32, 16, true
+	case MatchNumberInterval:
+		return 40, 24, true
+	default:
+		return 0, 0, false
+	}
+}
+
+// mmapValueKind tells how the values are laid out in the memory-mapped format.
+type mmapValueKind uint64
+
+const (
+	// mmapFixedSizeValue is a value without pointers, laid out as in memory.
+	mmapFixedSizeValue = mmapValueKind(iota)
+	// mmapStringValue is a string, referenced by offset.
+	mmapStringValue
+	// mmapBytesValue is a byte slice, referenced by offset.
+	mmapBytesValue
+)
+
+// The flags of a number interval in the memory-mapped format.
+const (
+	mmapMinIsExcluded = 1 << iota
+	mmapMaxIsExcluded
+	mmapHasMin
+	mmapHasMax
+)
+
+// mmapValueKindOf returns the mmapValueKind of T, and the size of T for mmapFixedSizeValue.
+func mmapValueKindOf[T any]() (mmapValueKind, int, error) {
+	type1 := reflect.TypeFor[T]()
+	switch {
+	case type1.Kind() == reflect.String:
+		return mmapStringValue, 0, nil
+	case type1.Kind() == reflect.Slice && type1.Elem().Kind() == reflect.Uint8:
+		return mmapBytesValue, 0, nil
+	case !hasPointers(type1):
+		return mmapFixedSizeValue, int(type1.Size()), nil
+	default:
+		return 0, 0, fmt.Errorf("matchtree: %v values cannot be memory-mapped", type1)
+	}
+}
+
+func hasPointers(type1 reflect.Type) bool {
+	switch type1.Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return false
+	case reflect.Array:
+		return type1.Len() >= 1 && hasPointers(type1.Elem())
+	case reflect.Struct:
+		for i := range type1.NumField() {
+			if hasPointers(type1.Field(i).Type) {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// SaveMmapFile saves the MatchTree to the file at path in the memory-mapped format, to be opened
+// by OpenMmap without deserializing the tree into the heap.
+//
+// Only the STRING, BYTES, INTEGER, ENUM, INTEGER_INTERVAL and NUMBER_INTERVAL match types are
+// supported. The values must be strings or byte slices, which are referenced by offset, or of a
+// fixed-size type without pointers, e.g. an integer or a struct of numbers, which is laid out as
+// in memory and so must be read on an architecture of the same byte order and alignment.
+// Disabled rules are left out, and rule IDs are kept for ordering only.
+// The file is written atomically, by renaming a temporary file in the same directory, which takes
+// the permissions of the file replaced, if any.
+func (t *MatchTree[T]) SaveMmapFile(path string) error {
+	valueKind, valueSize, err := mmapValueKindOf[T]()
+	if err != nil {
+		return err
+	}
+	for i, type1 := range t.types {
+		if _, _, ok := mmapEntrySizes(type1); !ok {
+			return fmt.Errorf("matchtree: match type #%d %v cannot be memory-mapped", i+1, type1)
+		}
+	}
+	if uint64(len(t.values)) > math.MaxUint32+1 {
+		return fmt.Errorf("matchtree: too many values to be memory-mapped; max=%v actual=%v", uint64(math.MaxUint32+1), len(t.values))
+	}
+
+	tempFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("matchtree: create temporary file: %w", err)
+	}
+	tempPath := tempFile.Name()
+	encode := func(w io.Writer, _ any) error {
+		mw := mmapWriter{w: bufio.NewWriter(w), types: t.types}
+		mw.writeTree(t.root, t.values, valueKind, valueSize)
+		return mw.w.Flush()
+	}
+	if err := writeTreeFile(tempFile, path, encode, nil); err != nil {
+		_ = os.Remove(tempPath)
+		return err
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("matchtree: rename temporary file: %w", err)
+	}
+	return nil
+}
+
+// mmapWriter writes a tree in the memory-mapped format, tracking the offset it is at.
+// Errors are left to the Flush of the bufio.Writer.
+type mmapWriter struct {
+	w         *bufio.Writer
+	offset    uint64
+	types     []MatchType
+	nodeCount int
+}
+
+func (w *mmapWriter) writeTree(root matchNode, values any, valueKind mmapValueKind, valueSize int) {
+	w.writeString("\x00") // no node at offset 0
+	var rootOffset uint64
+	if root != nil {
+		rootOffset = w.writeNode(root, 0)
+	}
+
+	typeNames := make([]string, len(w.types))
+	for i, type1 := range w.types {
+		typeNames[i] = type1.String()
+	}
+	typesOffset := w.writeStringRefs(typeNames)
+
+	var valuesOffset uint64
+	valuesValue := reflect.ValueOf(values)
+	numberOfValues := valuesValue.Len()
+	switch valueKind {
+	case mmapFixedSizeValue:
+		valuesOffset = w.writeUint64s(uint64(valueKind), uint64(valueSize), uint64(numberOfValues))
+		for i := range numberOfValues {
+			value := valuesValue.Index(i)
+			w.writeBytes(unsafe.Slice((*byte)(value.Addr().UnsafePointer()), valueSize))
+			w.align()
+		}
+	default:
+		offsets := make([]uint64, 0, 2*numberOfValues)
+		for i := range numberOfValues {
+			value := valuesValue.Index(i)
+			var offset uint64
+			if valueKind == mmapStringValue {
+				offset = w.writeString(value.String())
+			} else {
+				offset = w.writeBytes(value.Bytes())
+			}
+			offsets = append(offsets, offset, uint64(value.Len()))
+		}
+		valuesOffset = w.writeUint64s(uint64(valueKind), uint64(valueSize), uint64(numberOfValues))
+		w.writeUint64s(offsets...)
+	}
+
+	w.align()
+	w.writeString(mmapMagic)
+	w.writeUint64s(typesOffset, valuesOffset, rootOffset, uint64(w.nodeCount))
+}
+
+// mmapEntry is an exact child or an excluded value of an inverse child in the memory-mapped format.
+type mmapEntry struct {
+	String   string
+	Integers [2]int64   // the value, or the inclusive bounds of an integer interval
+	Numbers  [2]float64 // the bounds of a number interval
+	Flags    uint64
+	Child    uint64
+}
+
+// mmapEntriesOf returns the entries of the values of an edge pattern, leaving out empty intervals.
+func mmapEntriesOf(pattern *MatchPattern) []mmapEntry {
+	var entries []mmapEntry
+	switch pattern.Type {
+	case MatchString:
+		for _, v := range pattern.Strings {
+			entries = append(entries, mmapEntry{String: v})
+		}
+	case MatchBytes:
+		for _, v := range pattern.ByteSlices {
+			entries = append(entries, mmapEntry{String: string(v)})
+		}
+	case MatchInteger:
+		for _, v := range pattern.Integers {
+			entries = append(entries, mmapEntry{Integers: [2]int64{v}})
+		}
+	case MatchEnum:
+		for _, name := range pattern.Strings {
+			entries = append(entries, mmapEntry{Integers: [2]int64{pattern.EnumCodes[name]}})
+		}
+	case MatchIntegerInterval:
+		for _, v := range pattern.IntegerIntervals {
+			if lowerBound, upperBound, ok := integerIntervalBounds(v); ok {
+				entries = append(entries, mmapEntry{Integers: [2]int64{lowerBound, upperBound}})
+			}
+		}
+	case MatchNumberInterval:
+		for _, v := range pattern.NumberIntervals {
+			if v.IsEmpty() {
+				continue
+			}
+			entry := mmapEntry{Numbers: [2]float64{math.Inf(-1), math.Inf(1)}}
+			if v.Min != nil {
+				entry.Numbers[0] = *v.Min
+				entry.Flags |= mmapHasMin
+				if v.MinIsExcluded {
+					entry.Flags |= mmapMinIsExcluded
+				}
+			}
+			if v.Max != nil {
+				entry.Numbers[1] = *v.Max
+				entry.Flags |= mmapHasMax
+				if v.MaxIsExcluded {
+					entry.Flags |= mmapMaxIsExcluded
+				}
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func compareMmapEntries(x, y mmapEntry) int {
+	if c := strings.Compare(x.String, y.String); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(x.Integers[0], y.Integers[0]); c != 0 {
+		return c
+	}
+	return cmp.Compare(x.Numbers[0], y.Numbers[0])
+}
+
+func (w *mmapWriter) writeNode(node matchNode, depth int) uint64 {
+	w.nodeCount++
+	if depth == len(w.types) {
+		// leaf
+		var fields []uint64
+		for _, result := range node.GetResults() {
+			if !result.isEnabled() {
+				continue
+			}
+			flags := uint64(0)
+			if result.Expiry.IsSet {
+				flags = 1
+			}
+			fields = append(fields, uint64(result.Priority), uint64(result.RuleID), uint64(result.Expiry.UnixNano),
+				uint64(uint32(result.ValueIndex))|flags<<32)
+		}
+		offset := w.writeUint64s(uint64(len(fields) / 4))
+		w.writeUint64s(fields...)
+		return offset
+	}
+
+	// non-leaf
+	var anyChild uint64
+	var exactEntries []mmapEntry
+	type inverseChild struct {
+		Child           uint64
+		ExcludedEntries []mmapEntry
+	}
+	var inverseChildren []inverseChild
+	for pattern, child := range node.Edges() {
+		switch {
+		case pattern.IsAny:
+			anyChild = w.writeNode(child, depth+1)
+		case pattern.IsInverse:
+			inverseChildren = append(inverseChildren, inverseChild{
+				Child:           w.writeNode(child, depth+1),
+				ExcludedEntries: mmapEntriesOf(&pattern),
+			})
+		default:
+			entries := mmapEntriesOf(&pattern)
+			if len(entries) == 0 {
+				// unreachable
+				continue
+			}
+			entries[0].Child = w.writeNode(child, depth+1)
+			exactEntries = append(exactEntries, entries[0])
+		}
+	}
+
+	type1 := w.types[depth]
+	slices.SortFunc(exactEntries, compareMmapEntries)
+	exactOffset := w.writeEntries(type1, exactEntries, true)
+	inverseFields := make([]uint64, 0, 3*len(inverseChildren))
+	for _, v := range inverseChildren {
+		slices.SortFunc(v.ExcludedEntries, compareMmapEntries)
+		excludedOffset := w.writeEntries(type1, v.ExcludedEntries, false)
+		inverseFields = append(inverseFields, v.Child, uint64(len(v.ExcludedEntries)), excludedOffset)
+	}
+	inverseOffset := w.writeUint64s(inverseFields...)
+	return w.writeUint64s(anyChild, uint64(len(exactEntries)), exactOffset, uint64(len(inverseChildren)), inverseOffset)
+}
+
+// writeEntries writes the sorted entries of the exact children if isExact is true, or of the
+// excluded values of an inverse child otherwise, and returns the offset of the first one.
+func (w *mmapWriter) writeEntries(type1 MatchType, entries []mmapEntry, isExact bool) uint64 {
+	var fields []uint64
+	switch type1 {
+	case MatchString, MatchBytes:
+		for _, entry := range entries {
+			fields = append(fields, w.writeString(entry.String), uint64(len(entry.String)))
+			if isExact {
+				fields = append(fields, entry.Child)
+			}
+		}
+	case MatchInteger, MatchEnum:
+		for _, entry := range entries {
+			fields = append(fields, uint64(entry.Integers[0]))
+			if isExact {
+				fields = append(fields, entry.Child)
+			}
+		}
+	case MatchIntegerInterval:
+		maxOfMaxes := int64(math.MinInt64)
+		for _, entry := range entries {
+			fields = append(fields, uint64(entry.Integers[0]), uint64(entry.Integers[1]))
+			if isExact {
+				maxOfMaxes = max(maxOfMaxes, entry.Integers[1])
+				fields = append(fields, uint64(maxOfMaxes), entry.Child)
+			}
+		}
+	case MatchNumberInterval:
+		maxOfMaxes := math.Inf(-1)
+		for _, entry := range entries {
+			fields = append(fields, math.Float64bits(entry.Numbers[0]), math.Float64bits(entry.Numbers[1]))
+			if isExact {
+				maxOfMaxes = max(maxOfMaxes, entry.Numbers[1])
+				fields = append(fields, math.Float64bits(maxOfMaxes))
+			}
+			fields = append(fields, entry.Flags)
+			if isExact {
+				fields = append(fields, entry.Child)
+			}
+		}
+	}
+	return w.writeUint64s(fields...)
+}
+
+func (w *mmapWriter) writeStringRefs(ss []string) uint64 {
+	fields := make([]uint64, 0, 1+2*len(ss))
+	fields = append(fields, uint64(len(ss)))
+	for _, s := range ss {
+		fields = append(fields, w.writeString(s), uint64(len(s)))
+	}
+	return w.writeUint64s(fields...)
+}
+
+// writeUint64s writes the integers at the next aligned offset, which it returns.
+func (w *mmapWriter) writeUint64s(vs ...uint64) uint64 {
+	w.align()
+	offset := w.offset
+	var buffer [8]byte
+	for _, v := range vs {
+		binary.LittleEndian.PutUint64(buffer[:], v)
+		w.writeBytes(buffer[:])
+	}
+	return offset
+}
+
+func (w *mmapWriter) writeString(s string) uint64 {
+	offset := w.offset
+	n, _ := w.w.WriteString(s)
+	w.offset += uint64(n)
+	return offset
+}
+
+func (w *mmapWriter) writeBytes(b []byte) uint64 {
+	offset := w.offset
+	n, _ := w.w.Write(b)
+	w.offset += uint64(n)
+	return offset
+}
+
+func (w *mmapWriter) align() {
+	var padding [8]byte
+	w.writeBytes(padding[:(8-w.offset%8)%8])
+}
+
+// mappedTree is a tree in the memory-mapped format.
+type mappedTree struct {
+	data         []byte
+	unmap        func([]byte) error
+	valueKind    mmapValueKind
+	valueSize    uint64
+	valueCount   uint64
+	valuesOffset uint64
+	nodesEnd     uint64
+	root         uint64
+}
+
+// OpenMmap opens a FrozenMatchTree from the file at path saved by SaveMmapFile, by mapping the
+// file into memory, so that the tree is not deserialized into the heap, and the pages of the file
+// are shared by all the processes opening it. Search reads the nodes directly from the mapped
+// region, and the returned values of strings or byte slices reference it as well, so they must
+// not be modified nor used after Close, which unmaps the file. On platforms without mmap support,
+// the file is read into memory instead.
+// The options set the behavior of the tree, e.g. WithValueDedup, as the file does not hold it.
+// The offsets of the whole file are checked on opening, returning an error for a truncated or
+// corrupted file rather than letting a later search read past the mapped region.
+// The type of T must be of the same kind as the values saved.
+func OpenMmap[T any](path string, optionFuncs ...MatchTreeOptionFunc[T]) (*FrozenMatchTree[T], error) {
+	valueKind, valueSize, err := mmapValueKindOf[T]()
+	if err != nil {
+		return nil, err
+	}
+	options := matchTreeOptions[T]{}
+	for _, optionFunc := range optionFuncs {
+		options = optionFunc(options)
+	}
+
+	data, unmap, err := mapFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("matchtree: map file: %w", err)
+	}
+	m := &mappedTree{data: data, unmap: unmap}
+	types, nodeCount, err := m.init(valueKind, uint64(valueSize))
+	if err != nil {
+		_ = unmap(data)
+		return nil, wrapError(err, "invalid memory-mapped file %q", path)
+	}
+	frozenTree := &FrozenMatchTree[T]{
+		types:      types,
+		valueEqual: options.ValueEqual,
+		valueKey:   options.ValueKey,
+		stringForm: options.StringForm,
+		nodeCount:  nodeCount,
+		metrics:    options.Metrics,
+		mapped:     m,
+	}
+	frozenTree.scratchPool.New = func() any { return new(searchScratch) }
+	return frozenTree, nil
+}
+
+// init reads the trailer, the types and the header of the values of the mapped tree, and checks
+// that all the offsets of the tree lie within the mapped region, so that searches never read past
+// it however the file is corrupted.
+func (m *mappedTree) init(valueKind mmapValueKind, valueSize uint64) ([]MatchType, int, error) {
+	size := uint64(len(m.data))
+	if size < mmapTrailerSize || string(m.data[size-mmapTrailerSize:][:8]) != mmapMagic {
+		return nil, 0, fmt.Errorf("no trailer")
+	}
+	trailer := size - mmapTrailerSize + 8
+	typesOffset, valuesOffset := m.uint64At(trailer), m.uint64At(trailer+8)
+	m.root = m.uint64At(trailer + 16)
+	nodeCount := m.uint64At(trailer + 24)
+	if !m.isInRange(typesOffset, 1, 8) || !m.isInRange(valuesOffset, 3, 8) || nodeCount > size {
+		return nil, 0, fmt.Errorf("offset out of range")
+	}
+
+	m.nodesEnd = typesOffset
+	numberOfTypes := m.uint64At(typesOffset)
+	if !m.isInRange(typesOffset+8, numberOfTypes, 16) {
+		return nil, 0, fmt.Errorf("offset out of range")
+	}
+	types := make([]MatchType, numberOfTypes)
+	for i := range types {
+		typeNameOffset := typesOffset + 8 + 16*uint64(i)
+		if !m.isStringInRange(typeNameOffset) {
+			return nil, 0, fmt.Errorf("offset out of range")
+		}
+		type1, err := ParseMatchType(m.stringAt(typeNameOffset))
+		if err != nil {
+			return nil, 0, err
+		}
+		if _, _, ok := mmapEntrySizes(type1); !ok {
+			return nil, 0, fmt.Errorf("unexpected match type #%d %v", i+1, type1)
+		}
+		types[i] = type1
+	}
+
+	m.valueKind = mmapValueKind(m.uint64At(valuesOffset))
+	m.valueSize = m.uint64At(valuesOffset + 8)
+	m.valueCount = m.uint64At(valuesOffset + 16)
+	m.valuesOffset = valuesOffset + 24
+	if m.valueKind != valueKind || m.valueSize != valueSize {
+		return nil, 0, fmt.Errorf("unexpected kind of values; expected=%d/%d actual=%d/%d", valueKind, valueSize, m.valueKind, m.valueSize)
+	}
+	if !m.isInRange(m.valuesOffset, m.valueCount, m.valueStride()) {
+		return nil, 0, fmt.Errorf("offset out of range")
+	}
+	if m.valueKind != mmapFixedSizeValue {
+		for i := range m.valueCount {
+			if !m.isStringInRange(m.valuesOffset + i*16) {
+				return nil, 0, fmt.Errorf("offset out of range")
+			}
+		}
+	}
+
+	if m.root != 0 {
+		if err := m.checkNode(m.root, 0, types, make(map[uint64]int)); err != nil {
+			return nil, 0, err
+		}
+	}
+	return types, int(nodeCount), nil
+}
+
+// checkNode checks the node at the offset and its descendants, each only once per depth, as the
+// nodes reached through several parents are found in checkedNodes.
+func (m *mappedTree) checkNode(node uint64, depth int, types []MatchType, checkedNodes map[uint64]int) error {
+	if checkedDepth, ok := checkedNodes[node]; ok {
+		if checkedDepth != depth {
+			return fmt.Errorf("%w; offset=%v", ErrMisalignedTree, node)
+		}
+		return nil
+	}
+	checkedNodes[node] = depth
+	if node >= m.nodesEnd {
+		return fmt.Errorf("node offset out of range; offset=%v", node)
+	}
+
+	if depth == len(types) {
+		// leaf
+		if err := m.checkLeaf(node); err != nil {
+			return err
+		}
+		n := m.uint64At(node)
+		for offset := node + 8; n >= 1; n, offset = n-1, offset+mmapResultSize {
+			if valueIndex := uint64(uint32(m.uint64At(offset + 24))); valueIndex >= m.valueCount {
+				return fmt.Errorf("value index out of range; index=%v count=%v", valueIndex, m.valueCount)
+			}
+		}
+		return nil
+	}
+
+	// non-leaf
+	if !m.isInRange(node, 1, mmapNonLeafNodeSize) {
+		return fmt.Errorf("node offset out of range; offset=%v", node)
+	}
+	checkChild := func(child uint64) error {
+		// the children are written before their parents, which keeps the check from going around
+		if child == 0 || child >= node {
+			return fmt.Errorf("child offset out of range; offset=%v child=%v", node, child)
+		}
+		return m.checkNode(child, depth+1, types, checkedNodes)
+	}
+	if anyChild := m.uint64At(node); anyChild != 0 {
+		if err := checkChild(anyChild); err != nil {
+			return err
+		}
+	}
+	type1 := types[depth]
+	exactSize, excludedSize, _ := mmapEntrySizes(type1)
+	exactCount, exactOffset := m.uint64At(node+8), m.uint64At(node+16)
+	if err := m.checkEntries(type1, exactCount, exactOffset, exactSize); err != nil {
+		return err
+	}
+	for i := range exactCount {
+		if err := checkChild(m.uint64At(exactOffset + i*exactSize + exactSize - 8)); err != nil {
+			return err
+		}
+	}
+	inverseCount, inverseOffset := m.uint64At(node+24), m.uint64At(node+32)
+	if !m.isInRange(inverseOffset, inverseCount, mmapInverseChildSize) {
+		return fmt.Errorf("entry offset out of range; offset=%v count=%v", inverseOffset, inverseCount)
+	}
+	for i := range inverseCount {
+		inverseChild := inverseOffset + i*mmapInverseChildSize
+		if err := m.checkEntries(type1, m.uint64At(inverseChild+8), m.uint64At(inverseChild+16), excludedSize); err != nil {
+			return err
+		}
+		if err := checkChild(m.uint64At(inverseChild)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkEntries checks the n entries of the size at the offset, of the strings they reference if
+// of the STRING or BYTES match type.
+func (m *mappedTree) checkEntries(type1 MatchType, n uint64, offset uint64, size uint64) error {
+	if !m.isInRange(offset, n, size) {
+		return fmt.Errorf("entry offset out of range; offset=%v count=%v", offset, n)
+	}
+	if type1 == MatchString || type1 == MatchBytes {
+		for i := range n {
+			if !m.isStringInRange(offset + i*size) {
+				return fmt.Errorf("string offset out of range; offset=%v", offset+i*size)
+			}
+		}
+	}
+	return nil
+}
+
+// isInRange checks if the n records of the size from the offset lie within the mapped region,
+// without overflowing.
+func (m *mappedTree) isInRange(offset uint64, n uint64, size uint64) bool {
+	dataSize := uint64(len(m.data))
+	if offset > dataSize {
+		return false
+	}
+	return size == 0 || n <= (dataSize-offset)/size
+}
+
+// isStringInRange checks if the string referenced at the offset, which must lie within the mapped
+// region, does so as well.
+func (m *mappedTree) isStringInRange(offset uint64) bool {
+	return m.isInRange(m.uint64At(offset), m.uint64At(offset+8), 1)
+}
+
+func (m *mappedTree) valueStride() uint64 {
+	if m.valueKind == mmapFixedSizeValue {
+		return (m.valueSize + 7) &^ 7
+	}
+	return 16
+}
+
+func (m *mappedTree) uint64At(offset uint64) uint64 {
+	return binary.LittleEndian.Uint64(m.data[offset : offset+8])
+}
+
+func (m *mappedTree) int64At(offset uint64) int64 { return int64(m.uint64At(offset)) }
+
+func (m *mappedTree) float64At(offset uint64) float64 {
+	return math.Float64frombits(m.uint64At(offset))
+}
+
+// stringAt returns the string referenced at the offset, sharing the memory of the mapped region.
+func (m *mappedTree) stringAt(offset uint64) string {
+	stringOffset, length := m.uint64At(offset), m.uint64At(offset+8)
+	return bytesToString(m.data[stringOffset : stringOffset+length])
+}
+
+// mappedValue returns the value at the index of the mapped tree.
+func mappedValue[T any](m *mappedTree, i int) T {
+	offset := m.valuesOffset + uint64(i)*m.valueStride()
+	switch m.valueKind {
+	case mmapFixedSizeValue:
+		var value T
+		copy(unsafe.Slice((*byte)(unsafe.Pointer(&value)), m.valueSize), m.data[offset:])
+		return value
+	case mmapStringValue:
+		s := m.stringAt(offset)
+		return *(*T)(unsafe.Pointer(&s))
+	default:
+		bytesOffset, length := m.uint64At(offset), m.uint64At(offset+8)
+		b := m.data[bytesOffset : bytesOffset+length : bytesOffset+length]
+		return *(*T)(unsafe.Pointer(&b))
+	}
+}
+
+// checkLeaf is like checkLeaf, for the node at the offset of the mapped tree, which tells apart no
+// kinds of nodes, so that a node is only taken for a leaf node if its results lie within the nodes.
+func (m *mappedTree) checkLeaf(node uint64) error {
+	if node > m.nodesEnd || m.nodesEnd-node < 8 || m.uint64At(node) > (m.nodesEnd-node-8)/mmapResultSize {
+		return fmt.Errorf("%w; offset=%v", ErrMisalignedTree, node)
+	}
+	return nil
+}
+
+// appendResults appends the results of the leaf node at the offset.
+func (m *mappedTree) appendResults(results []matchResult, node uint64) []matchResult {
+	n := m.uint64At(node)
+	for offset := node + 8; n >= 1; n, offset = n-1, offset+mmapResultSize {
+		last := m.uint64At(offset + 24)
+		results = append(results, matchResult{
+			ValueIndex: int(uint32(last)),
+			Priority:   m.int64At(offset),
+			RuleID:     RuleID(m.uint64At(offset + 8)),
+			Expiry:     expiry{UnixNano: m.int64At(offset + 16), IsSet: last>>32&1 == 1},
+		})
+	}
+	return results
+}
+
+// findChildren appends the offsets of the children of the non-leaf node at the offset matching
+// the key of the type, in the same order as matchNode.FindChildren does.
+func (m *mappedTree) findChildren(children []uint64, node uint64, type1 MatchType, key MatchKey) []uint64 {
+	anyChild := m.uint64At(node)
+	if !key.IsAbsent {
+		exactCount, exactOffset := int(m.uint64At(node+8)), m.uint64At(node+16)
+		inverseCount, inverseOffset := int(m.uint64At(node+24)), m.uint64At(node+32)
+		switch type1 {
+		case MatchString, MatchBytes:
+			keyString := key.String
+			if type1 == MatchBytes {
+				keyString = bytesToString(key.Bytes)
+			}
+			keyStrings := key.Strings
+			if len(keyStrings) == 0 {
+				keyStrings = []string{keyString}
+			}
+			children = m.findChildrenOfStrings(children, exactCount, exactOffset, inverseCount, inverseOffset, keyStrings)
+		case MatchInteger, MatchEnum:
+			if key.IntegerRange != nil {
+				children = m.findChildrenOfIntegerRange(children, exactCount, exactOffset, inverseCount, inverseOffset, *key.IntegerRange)
+				break
+			}
+			keyIntegers := key.Integers
+			if len(keyIntegers) == 0 {
+				keyIntegers = []int64{key.Integer}
+			}
+			children = m.findChildrenOfIntegers(children, exactCount, exactOffset, inverseCount, inverseOffset, keyIntegers)
+		case MatchIntegerInterval:
+			children = m.findChildrenOfIntegerInterval(children, exactCount, exactOffset, inverseCount, inverseOffset, key.Integer)
+		case MatchNumberInterval:
+			children = m.findChildrenOfNumberInterval(children, exactCount, exactOffset, inverseCount, inverseOffset, key.Number)
+		}
+	}
+	if anyChild != 0 {
+		children = append(children, anyChild)
+	}
+	return children
+}
+
+func (m *mappedTree) findChildrenOfStrings(children []uint64, exactCount int, exactOffset uint64, inverseCount int, inverseOffset uint64, keyStrings []string) []uint64 {
+	const exactSize, excludedSize = 24, 16
+	for i, v := range keyStrings {
+		if slices.Contains(keyStrings[:i], v) {
+			continue
+		}
+		j, ok := m.binarySearchString(exactCount, exactOffset, exactSize, v)
+		if ok {
+			children = append(children, m.uint64At(exactOffset+uint64(j)*exactSize+16))
+		}
+	}
+	for i := range inverseCount {
+		inverseChild := inverseOffset + uint64(i)*mmapInverseChildSize
+		excludedCount, excludedOffset := int(m.uint64At(inverseChild+8)), m.uint64At(inverseChild+16)
+		if !slices.ContainsFunc(keyStrings, func(v string) bool {
+			_, ok := m.binarySearchString(excludedCount, excludedOffset, excludedSize, v)
+			return ok
+		}) {
+			children = append(children, m.uint64At(inverseChild))
+		}
+	}
+	return children
+}
+
+func (m *mappedTree) binarySearchString(n int, offset uint64, size uint64, v string) (int, bool) {
+	i, j := 0, n
+	for i < j {
+		h := int(uint(i+j) >> 1)
+		if m.stringAt(offset+uint64(h)*size) < v {
+			i = h + 1
+		} else {
+			j = h
+		}
+	}
+	return i, i < n && m.stringAt(offset+uint64(i)*size) == v
+}
+
+func (m *mappedTree) findChildrenOfIntegers(children []uint64, exactCount int, exactOffset uint64, inverseCount int, inverseOffset uint64, keyIntegers []int64) []uint64 {
+	const exactSize, excludedSize = 16, 8
+	for i, v := range keyIntegers {
+		if slices.Contains(keyIntegers[:i], v) {
+			continue
+		}
+		j, ok := m.binarySearchInteger(exactCount, exactOffset, exactSize, v)
+		if ok {
+			children = append(children, m.uint64At(exactOffset+uint64(j)*exactSize+8))
+		}
+	}
+	for i := range inverseCount {
+		inverseChild := inverseOffset + uint64(i)*mmapInverseChildSize
+		excludedCount, excludedOffset := int(m.uint64At(inverseChild+8)), m.uint64At(inverseChild+16)
+		if !slices.ContainsFunc(keyIntegers, func(v int64) bool {
+			_, ok := m.binarySearchInteger(excludedCount, excludedOffset, excludedSize, v)
+			return ok
+		}) {
+			children = append(children, m.uint64At(inverseChild))
+		}
+	}
+	return children
+}
+
+func (m *mappedTree) findChildrenOfIntegerRange(children []uint64, exactCount int, exactOffset uint64, inverseCount int, inverseOffset uint64, keyRange IntegerInterval) []uint64 {
+	const exactSize, excludedSize = 16, 8
+	lowerBound, upperBound, ok := integerIntervalBounds(keyRange)
+	if !ok {
+		return children
+	}
+	i, _ := m.binarySearchInteger(exactCount, exactOffset, exactSize, lowerBound)
+	for ; i < exactCount && m.int64At(exactOffset+uint64(i)*exactSize) <= upperBound; i++ {
+		children = append(children, m.uint64At(exactOffset+uint64(i)*exactSize+8))
+	}
+	for i := range inverseCount {
+		inverseChild := inverseOffset + uint64(i)*mmapInverseChildSize
+		excludedCount, excludedOffset := int(m.uint64At(inverseChild+8)), m.uint64At(inverseChild+16)
+		j, _ := m.binarySearchInteger(excludedCount, excludedOffset, excludedSize, lowerBound)
+		if j == excludedCount || m.int64At(excludedOffset+uint64(j)*excludedSize) > upperBound {
+			children = append(children, m.uint64At(inverseChild))
+		}
+	}
+	return children
+}
+
+func (m *mappedTree) binarySearchInteger(n int, offset uint64, size uint64, v int64) (int, bool) {
+	i, j := 0, n
+	for i < j {
+		h := int(uint(i+j) >> 1)
+		if m.int64At(offset+uint64(h)*size) < v {
+			i = h + 1
+		} else {
+			j = h
+		}
+	}
+	return i, i < n && m.int64At(offset+uint64(i)*size) == v
+}
+
+func (m *mappedTree) findChildrenOfIntegerInterval(children []uint64, exactCount int, exactOffset uint64, inverseCount int, inverseOffset uint64, keyInteger int64) []uint64 {
+	const exactSize, excludedSize = 32, 16
+	// the exact children with min <= keyInteger, scanned backwards until no max reaches it
+	i, j := 0, exactCount
+	for i < j {
+		h := int(uint(i+j) >> 1)
+		if m.int64At(exactOffset+uint64(h)*exactSize) <= keyInteger {
+			i = h + 1
+		} else {
+			j = h
+		}
+	}
+	for i--; i >= 0; i-- {
+		exactChild := exactOffset + uint64(i)*exactSize
+		if m.int64At(exactChild+16) < keyInteger {
+			break
+		}
+		if m.int64At(exactChild+8) >= keyInteger {
+			children = append(children, m.uint64At(exactChild+24))
+		}
+	}
+	for i := range inverseCount {
+		inverseChild := inverseOffset + uint64(i)*mmapInverseChildSize
+		excludedCount, excludedOffset := int(m.uint64At(inverseChild+8)), m.uint64At(inverseChild+16)
+		isExcluded := false
+		for j := range excludedCount {
+			excluded := excludedOffset + uint64(j)*excludedSize
+			if m.int64At(excluded) <= keyInteger && keyInteger <= m.int64At(excluded+8) {
+				isExcluded = true
+				break
+			}
+		}
+		if !isExcluded {
+			children = append(children, m.uint64At(inverseChild))
+		}
+	}
+	return children
+}
+
+func (m *mappedTree) findChildrenOfNumberInterval(children []uint64, exactCount int, exactOffset uint64, inverseCount int, inverseOffset uint64, keyNumber float64) []uint64 {
+	const exactSize, excludedSize = 40, 24
+	// the exact children with min <= keyNumber within precision, scanned backwards until no
+	// max reaches it
+	i, j := 0, exactCount
+	for i < j {
+		h := int(uint(i+j) >> 1)
+		if m.float64At(exactOffset+uint64(h)*exactSize) <= keyNumber+epsilon {
+			i = h + 1
+		} else {
+			j = h
+		}
+	}
+	for i--; i >= 0; i-- {
+		exactChild := exactOffset + uint64(i)*exactSize
+		if m.float64At(exactChild+16) < keyNumber-epsilon {
+			break
+		}
+		if m.numberIntervalContains(exactChild, exactChild+24, keyNumber) {
+			children = append(children, m.uint64At(exactChild+32))
+		}
+	}
+	for i := range inverseCount {
+		inverseChild := inverseOffset + uint64(i)*mmapInverseChildSize
+		excludedCount, excludedOffset := int(m.uint64At(inverseChild+8)), m.uint64At(inverseChild+16)
+		isExcluded := false
+		for j := range excludedCount {
+			excluded := excludedOffset + uint64(j)*excludedSize
+			if m.numberIntervalContains(excluded, excluded+16, keyNumber) {
+				isExcluded = true
+				break
+			}
+		}
+		if !isExcluded {
+			children = append(children, m.uint64At(inverseChild))
+		}
+	}
+	return children
+}
+
+// numberIntervalContains checks if the number interval with the bounds at the offset and the
+// flags at flagsOffset contains x, like NumberInterval.Contains.
+func (m *mappedTree) numberIntervalContains(offset uint64, flagsOffset uint64, x float64) bool {
+	flags := m.uint64At(flagsOffset)
+	if flags&mmapHasMin != 0 {
+		y := m.float64At(offset)
+		if flags&mmapMinIsExcluded != 0 {
+			if x <= y+epsilon {
+				return false
+			}
+		} else {
+			if x < y-epsilon {
+				return false
+			}
+		}
+	}
+	if flags&mmapHasMax != 0 {
+		y := m.float64At(offset + 8)
+		if flags&mmapMaxIsExcluded != 0 {
+			if x >= y-epsilon {
+				return false
+			}
+		} else {
+			if x > y+epsilon {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// searchMapped is search for a FrozenMatchTree opened by OpenMmap.
+func (t *FrozenMatchTree[T]) searchMapped(keys []MatchKey) ([]T, int, error) {
+	m := t.mapped
+	if m.root == 0 {
+		return nil, 0, nil
+	}
+
+	scratch := t.scratchPool.Get().(*searchScratch)
+	defer t.scratchPool.Put(scratch)
+
+	keys = normalizeKeys(keys, t.stringForm)
+	nodes := append(scratch.Offsets[:0], m.root)
+	nextNodes := scratch.NextOffsets[:0]
+	for i, key := range keys {
+		for _, node := range nodes {
+			// non-leaf
+			nextNodes = m.findChildren(nextNodes, node, t.types[i], key)
+		}
+		nodes, nextNodes = nextNodes, nodes[:0]
+	}
+	scratch.Offsets, scratch.NextOffsets = nodes, nextNodes
+	if len(nodes) == 0 {
+		return nil, 0, nil
+	}
+
+	for _, node := range nodes {
+		if err := m.checkLeaf(node); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	// the result lists are sliced after all the results are read, which may move them
+	leafResults := scratch.LeafResults[:0]
+	resultListEnds := scratch.ResultListEnds[:0]
+	for _, node := range nodes {
+		leafResults = m.appendResults(leafResults, node)
+		resultListEnds = append(resultListEnds, len(leafResults))
+	}
+	resultLists := scratch.ResultLists[:0]
+	start := 0
+	for _, end := range resultListEnds {
+		resultLists = append(resultLists, leafResults[start:end])
+		start = end
+	}
+	results := mergeResults(scratch.Results[:0], resultLists, defaultSearchOptions)
+	clear(resultLists)
+	scratch.LeafResults, scratch.ResultListEnds = leafResults, resultListEnds
+	scratch.ResultLists, scratch.Results = resultLists, results
+	if len(results) == 0 {
+		return nil, 0, nil
+	}
+
+	values := make([]T, len(results))
+	for i, result := range results {
+		values[i] = mappedValue[T](m, result.ValueIndex)
+	}
+	values = dedupValuesWith(values, t.valueEqual, t.valueKey)
+	return values, len(results), nil
+}
+
+// Close releases the memory-mapped file of a FrozenMatchTree opened by OpenMmap, after which
+// the tree and the values returned by it must no longer be used. It does nothing for a
+// FrozenMatchTree from Freeze.
+func (t *FrozenMatchTree[T]) Close() error {
+	m := t.mapped
+	if m == nil || m.data == nil {
+		return nil
+	}
+	data := m.data
+	m.data = nil
+	if err := m.unmap(data); err != nil {
+		return fmt.Errorf("matchtree: unmap file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package matchtree_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	. "github.com/roy2220/matchtree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenMmap(t *testing.T) {
+	for _, suite := range loadTestSuites(t) {
+		matchTree := buildMatchTree(t, suite)
+		path := filepath.Join(t.TempDir(), "tree.mmap")
+		if err := matchTree.SaveMmapFile(path); err != nil {
+			// a match type which cannot be memory-mapped
+			assert.ErrorContains(t, err, "cannot be memory-mapped")
+			continue
+		}
+		mappedTree, err := OpenMmap[string](path)
+		require.NoError(t, err)
+		assert.Equal(t, matchTree.Freeze().NodeCount(), mappedTree.NodeCount())
+
+		for i, case1 := range suite.Cases {
+			t.Run(fmt.Sprintf("%s#%d", suite.Scenario, i+1), func(t *testing.T) {
+				values, err := mappedTree.Search(case1.MatchKeys)
+				require.NoError(t, err)
+				assert.Equal(t, case1.Values, values)
+			})
+		}
+		require.NoError(t, mappedTree.Close())
+	}
+}
+
+func TestOpenMmap_RandomRules(t *testing.T) {
+	type value struct {
+		ID     int32
+		Weight float64
+	}
+	codes := map[string]int64{"red": 1, "green": 2, "blue": 3}
+	names := []string{"red", "green", "blue"}
+	types := []MatchType{MatchString, MatchBytes, MatchInteger, MatchEnum, MatchIntegerInterval, MatchNumberInterval}
+
+	rand := rand.New(rand.NewSource(1))
+	randomPattern := func(type1 MatchType) MatchPattern {
+		pattern := MatchPattern{Type: type1}
+		switch rand.Intn(4) {
+		case 0:
+			pattern.IsAny = true
+			return pattern
+		case 1:
+			pattern.IsInverse = true
+		}
+		for range 1 + rand.Intn(2) {
+			v := int64(rand.Intn(10))
+			switch type1 {
+			case MatchString:
+				pattern.Strings = append(pattern.Strings, fmt.Sprintf("s%d", v))
+			case MatchBytes:
+				pattern.ByteSlices = append(pattern.ByteSlices, []byte(fmt.Sprintf("b%d", v)))
+			case MatchInteger:
+				pattern.Integers = append(pattern.Integers, v)
+			case MatchEnum:
+				pattern.Strings = append(pattern.Strings, names[v%3])
+				pattern.EnumCodes = codes
+			case MatchIntegerInterval:
+				pattern.IntegerIntervals = append(pattern.IntegerIntervals, IntegerInterval{Min: Int64Ptr(v), Max: Int64Ptr(v + 3), MaxIsExcluded: v%2 == 0})
+			case MatchNumberInterval:
+				interval := NumberInterval{Min: Float64Ptr(float64(v) / 2), MinIsExcluded: v%2 == 1}
+				if v%3 != 0 {
+					interval.Max = Float64Ptr(float64(v))
+				}
+				pattern.NumberIntervals = append(pattern.NumberIntervals, interval)
+			}
+		}
+		return pattern
+	}
+	randomKey := func(type1 MatchType) MatchKey {
+		if rand.Intn(8) == 0 {
+			return AbsentKey(type1)
+		}
+		v := int64(rand.Intn(12))
+		switch type1 {
+		case MatchString:
+			if rand.Intn(4) == 0 {
+				return StringsKey(fmt.Sprintf("s%d", v), fmt.Sprintf("s%d", rand.Intn(12)))
+			}
+			return StringKey(fmt.Sprintf("s%d", v))
+		case MatchBytes:
+			return BytesKey([]byte(fmt.Sprintf("b%d", v)))
+		case MatchInteger:
+			if rand.Intn(4) == 0 {
+				return IntegersKey(v, v, int64(rand.Intn(12)))
+			}
+			return IntegerKey(v)
+		case MatchEnum:
+			return EnumKey(1 + v%4)
+		case MatchIntegerInterval:
+			return IntegerIntervalKey(v)
+		default:
+			return NumberKey(float64(rand.Intn(25)) / 4)
+		}
+	}
+
+	matchTree := NewMatchTree[value](types)
+	for i := range 300 {
+		patterns := make([]MatchPattern, len(types))
+		for j, type1 := range types {
+			patterns[j] = randomPattern(type1)
+		}
+		id, err := matchTree.AddRule(MatchRule[value]{
+			Patterns: patterns,
+			Value:    value{ID: int32(i), Weight: float64(i) / 3},
+			Priority: int64(rand.Intn(5)),
+		})
+		require.NoError(t, err)
+		if i%10 == 0 {
+			require.NoError(t, matchTree.SetRuleEnabled(id, false))
+		}
+	}
+	path := filepath.Join(t.TempDir(), "tree.mmap")
+	require.NoError(t, matchTree.SaveMmapFile(path))
+	mappedTree, err := OpenMmap[value](path)
+	require.NoError(t, err)
+	defer mappedTree.Close()
+	frozenTree := matchTree.Freeze()
+
+	for range 2000 {
+		keys := make([]MatchKey, len(types))
+		for j, type1 := range types {
+			keys[j] = randomKey(type1)
+		}
+		want, err := frozenTree.Search(keys)
+		require.NoError(t, err)
+		got, err := mappedTree.Search(keys)
+		require.NoError(t, err)
+		require.Equal(t, want, got, "%v", keys)
+	}
+}
+
+func TestOpenMmap_Bytes(t *testing.T) {
+	matchTree := NewMatchTree[[]byte]([]MatchType{MatchString})
+	_, err := matchTree.AddRule(MatchRule[[]byte]{Patterns: []MatchPattern{StringsPattern("a")}, Value: []byte("x")})
+	require.NoError(t, err)
+	_, err = matchTree.AddRule(MatchRule[[]byte]{Patterns: []MatchPattern{AnyPattern(MatchString)}, Value: []byte("y")})
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "tree.mmap")
+	require.NoError(t, matchTree.SaveMmapFile(path))
+
+	mappedTree, err := OpenMmap[[]byte](path)
+	require.NoError(t, err)
+	values, err := mappedTree.Search([]MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("x"), []byte("y")}, values)
+	_, err = mappedTree.Search([]MatchKey{IntegerKey(1)})
+	assert.Error(t, err)
+	require.NoError(t, mappedTree.Close())
+	require.NoError(t, mappedTree.Close())
+}
+
+func TestOpenMmap_Errors(t *testing.T) {
+	dir := t.TempDir()
+
+	err := NewMatchTree[string]([]MatchType{MatchString, MatchRegexp}).SaveMmapFile(filepath.Join(dir, "regexp.mmap"))
+	assert.EqualError(t, err, "matchtree: match type #2 REGEXP cannot be memory-mapped")
+	err = NewMatchTree[*int]([]MatchType{MatchString}).SaveMmapFile(filepath.Join(dir, "pointer.mmap"))
+	assert.EqualError(t, err, "matchtree: *int values cannot be memory-mapped")
+	_, err = OpenMmap[map[string]int](filepath.Join(dir, "map.mmap"))
+	assert.EqualError(t, err, "matchtree: map[string]int values cannot be memory-mapped")
+
+	path := filepath.Join(dir, "tree.mmap")
+	require.NoError(t, NewMatchTree[string]([]MatchType{MatchString}).SaveMmapFile(path))
+	_, err = OpenMmap[int64](path)
+	assert.ErrorContains(t, err, "unexpected kind of values")
+	mappedTree, err := OpenMmap[string](path)
+	require.NoError(t, err)
+	values, err := mappedTree.Search([]MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.Empty(t, values)
+	require.NoError(t, mappedTree.Close())
+
+	_, err = OpenMmap[string](filepath.Join(dir, "missing.mmap"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	invalidPath := filepath.Join(dir, "invalid.mmap")
+	require.NoError(t, os.WriteFile(invalidPath, []byte("not a tree"), 0o644))
+	_, err = OpenMmap[string](invalidPath)
+	assert.ErrorContains(t, err, "invalid memory-mapped file")
+}
+
+func TestOpenMmap_MisalignedTree(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString})
+	_, err := matchTree.AddRule(MatchRule[string]{Patterns: []MatchPattern{StringsPattern("a")}, Value: "rule_1"})
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "tree.mmap")
+	require.NoError(t, matchTree.SaveMmapFile(path))
+
+	// the leaf node, written first at offset 8, gets a result count running past the nodes
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	binary.LittleEndian.PutUint64(data[8:], 1<<40)
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	_, err = OpenMmap[string](path)
+	assert.ErrorIs(t, err, ErrMisalignedTree)
+}
+
+func TestOpenMmap_CorruptedFile(t *testing.T) {
+	types := []MatchType{MatchString, MatchInteger, MatchIntegerInterval, MatchNumberInterval}
+	matchTree := NewMatchTree[string](types)
+	for i := range 20 {
+		_, err := matchTree.AddRule(MatchRule[string]{
+			Patterns: []MatchPattern{
+				StringsPattern(fmt.Sprintf("s%d", i%5)),
+				InverseIntegersPattern(int64(i % 3)),
+				IntegerIntervalPattern(ClosedInterval(int64(i), int64(i)+10)),
+				InverseNumberIntervalPattern(NumberInterval{Min: Float64Ptr(float64(i))}),
+			},
+			Value: fmt.Sprintf("rule_%d", i),
+		})
+		require.NoError(t, err)
+	}
+	path := filepath.Join(t.TempDir(), "tree.mmap")
+	require.NoError(t, matchTree.SaveMmapFile(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	keys := []MatchKey{StringKey("s1"), IntegerKey(2), IntegerIntervalKey(5), NumberKey(-1)}
+
+	// truncated, with the trailer kept
+	trailer := data[len(data)-40:]
+	for n := 0; n < len(data)-40; n += 8 {
+		require.NoError(t, os.WriteFile(path, append(slices.Clip(data[:n]), trailer...), 0o644))
+		_, err := OpenMmap[string](path)
+		assert.Error(t, err, "%d", n)
+	}
+
+	// overwritten with random words
+	rng := rand.New(rand.NewSource(0))
+	for range 2000 {
+		corruptedData := slices.Clone(data)
+		i := 8 * rng.Intn(len(data)/8)
+		binary.LittleEndian.PutUint64(corruptedData[i:], []uint64{0, 1, 1 << 32, math.MaxUint64, rng.Uint64()}[rng.Intn(5)])
+		require.NoError(t, os.WriteFile(path, corruptedData, 0o644))
+		mappedTree, err := OpenMmap[string](path)
+		if err != nil {
+			continue
+		}
+		_, _ = mappedTree.Search(keys)
+		require.NoError(t, mappedTree.Close())
+	}
+}
@@ -0,0 +1,197 @@
+package matchtree
+
+import (
+	"cmp"
+	"iter"
+	"slices"
+)
+
+// matchNode is an interface that defines the behavior of nodes within the MatchTree.
+type matchNode interface {
+	// GetOrInsertChild retrieves an existing child node or inserts a new one based on the pattern and newChildType.
+	GetOrInsertChild(pattern *MatchPattern, newChildType MatchType) matchNode
+	// FindChildren appends child nodes that match the given key to children.
+	// Children are appended in a deterministic order, never depending on map iteration:
+	// exact children first (interval children ordered by their lower bounds and then by insertion),
+	// then inverse children in insertion order, and finally the any child.
+	FindChildren(children []matchNode, key MatchKey) []matchNode
+
+	// Edges yields each child node along with a pattern describing how the child is reached,
+	// i.e. a single value or interval for an exact child, the excluded values or intervals for
+	// an inverse child, or IsAny for the any child. Leaf nodes yield nothing.
+	Edges() iter.Seq2[MatchPattern, matchNode]
+
+	// AddResult adds a match result to a leaf node.
+	AddResult(result matchResult)
+	// RemoveResults removes the match results of the rule from a leaf node.
+	RemoveResults(ruleID RuleID)
+	// GetResults returns the match results associated with a leaf node,
+	// sorted by priority (descending) and then by value index.
+	GetResults() []matchResult
+}
+
+// matchResult stores the index of the matched value, its priority and weight, and the rule it
+// belongs to.
+type matchResult struct {
+	ValueIndex int
+	Priority   int64
+	Weight     int
+	RuleID     RuleID
+	// DedupGroup identifies the identical results of a leaf node added with WithDedupIdenticalRules,
+	// by the RuleID of the first of them, or is 0 for a result of no group.
+	DedupGroup  RuleID
+	IsDisabled  bool
+	IsDuplicate bool // hidden behind an enabled result of the same dedup group
+	Expiry      expiry
+}
+
+func (r matchResult) isEnabled() bool { return !r.IsDisabled && !r.IsDuplicate }
+
+// isActiveAt reports whether the result is enabled, not a duplicate and not expired at the time
+// now, in Unix nanoseconds.
+func (r matchResult) isActiveAt(now int64) bool { return r.isEnabled() && !r.Expiry.isExpiredAt(now) }
+
+// updateDuplicateResults marks each result of a dedup group after its first enabled one as a
+// duplicate, so that a group shows as a single result as long as any of its rules is enabled.
+func updateDuplicateResults(results []matchResult) {
+	for i := range results {
+		result := &results[i]
+		if result.DedupGroup == 0 {
+			continue
+		}
+		result.IsDuplicate = slices.ContainsFunc(results[:i], func(x matchResult) bool {
+			return x.DedupGroup == result.DedupGroup && !x.IsDisabled
+		})
+	}
+}
+
+var matchNodeFactories = [NumberOfMatchTypes]func() matchNode{
+	MatchNone:            func() matchNode { return new(matchNodeOfNone) },
+	MatchString:          func() matchNode { return new(matchNodeOfString) },
+	MatchInteger:         func() matchNode { return new(matchNodeOfInteger) },
+	MatchIntegerInterval: func() matchNode { return new(matchNodeOfIntegerInterval) },
+	MatchNumberInterval:  func() matchNode { return new(matchNodeOfNumberInterval) },
+	MatchRegexp:          func() matchNode { return new(matchNodeOfRegexp) },
+	MatchEnum:            func() matchNode { return new(matchNodeOfEnum) },
+	MatchBytes:           func() matchNode { return new(matchNodeOfBytes) },
+	MatchSemverRange:     func() matchNode { return new(matchNodeOfSemverRange) },
+	MatchGlob:            func() matchNode { return new(matchNodeOfGlob) },
+	MatchNumeric:         func() matchNode { return new(matchNodeOfNumeric) },
+}
+
+func newMatchNode(type1 MatchType) matchNode {
+	if int(type1) >= NumberOfMatchTypes {
+		return newCustomMatchNode(type1)
+	}
+	return matchNodeFactories[type1]()
+}
+
+// ----- dummy match node -----
+
+type dummyMatchNode struct{}
+
+var _ matchNode = (*dummyMatchNode)(nil)
+
+func (n dummyMatchNode) GetOrInsertChild(pattern *MatchPattern, newChildType MatchType) matchNode {
+	panic("unreachable")
+}
+func (n dummyMatchNode) FindChildren(children []matchNode, key MatchKey) []matchNode {
+	panic("unreachable")
+}
+func (n dummyMatchNode) Edges() iter.Seq2[MatchPattern, matchNode] { panic("unreachable") }
+func (n dummyMatchNode) AddResult(result matchResult)              { panic("unreachable") }
+func (n dummyMatchNode) RemoveResults(ruleID RuleID)               { panic("unreachable") }
+func (n dummyMatchNode) GetResults() []matchResult                 { panic("unreachable") }
+
+// ----- match node of none -----
+
+type matchNodeOfNone struct {
+	dummyMatchNode
+
+	results []matchResult
+}
+
+var _ matchNode = (*matchNodeOfNone)(nil)
+
+func (n *matchNodeOfNone) AddResult(result matchResult) {
+	// keep results sorted so that searches merge rather than sort them
+	i, _ := slices.BinarySearchFunc(n.results, result, compareResults)
+	n.results = slices.Insert(n.results, i, result)
+	if result.DedupGroup != 0 {
+		updateDuplicateResults(n.results)
+	}
+}
+func (n *matchNodeOfNone) RemoveResults(ruleID RuleID) {
+	n.results = slices.DeleteFunc(n.results, func(result matchResult) bool { return result.RuleID == ruleID })
+	updateDuplicateResults(n.results)
+}
+func (n *matchNodeOfNone) GetResults() []matchResult { return n.results }
+
+func (n *matchNodeOfNone) reserveResults(numberOfResults int) {
+	n.results = slices.Grow(n.results, numberOfResults)
+}
+
+func (n *matchNodeOfNone) Edges() iter.Seq2[MatchPattern, matchNode] {
+	return func(yield func(MatchPattern, matchNode) bool) {}
+}
+
+// ----- match node common -----
+
+// appendAnyChild appends the any child to children if there is one, which is all an absent key
+// matches.
+func appendAnyChild[N comparable](children []N, anyChild N) []N {
+	var none N
+	if anyChild != none {
+		children = append(children, anyChild)
+	}
+	return children
+}
+
+type matchNodeWithRefCount struct {
+	MatchNode   matchNode
+	MaxRefCount int
+}
+
+// appendInverseChildren appends the inverse children whose indexes are not in excludedChildIndexes,
+// which must be sorted in ascending order.
+func appendInverseChildren(children []matchNode, inverseChildren []matchNodeWithRefCount, excludedChildIndexes []int) []matchNode {
+	for childIndex, child := range inverseChildren {
+		if len(excludedChildIndexes) >= 1 && excludedChildIndexes[0] == childIndex {
+			excludedChildIndexes = excludedChildIndexes[1:]
+			continue
+		}
+		children = append(children, child.MatchNode)
+	}
+	return children
+}
+
+// appendInverseChildrenOfValues appends the inverse children excluding none of the values.
+func appendInverseChildrenOfValues[K comparable](children []matchNode, inverseChildren []matchNodeWithRefCount, inverseChildIndexes map[K][]int, values []K) []matchNode {
+	excludedChildIndexes := getBitset(len(inverseChildren))
+	for _, v := range values {
+		for _, childIndex := range inverseChildIndexes[v] {
+			excludedChildIndexes.Add(childIndex)
+		}
+	}
+	children = appendInverseChildrenNotIn(children, inverseChildren, *excludedChildIndexes)
+	putBitset(excludedChildIndexes)
+	return children
+}
+
+// appendInverseChildrenNotIn appends the inverse children whose indexes are not in
+// excludedChildIndexes.
+func appendInverseChildrenNotIn(children []matchNode, inverseChildren []matchNodeWithRefCount, excludedChildIndexes bitset) []matchNode {
+	for childIndex := range excludedChildIndexes.Missing(len(inverseChildren)) {
+		children = append(children, inverseChildren[childIndex].MatchNode)
+	}
+	return children
+}
+
+func sortedKeys[K cmp.Ordered, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
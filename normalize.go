@@ -0,0 +1,53 @@
+package matchtree
+
+import (
+	"slices"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// WithStringNormalization configures the MatchTree to normalize the strings of MatchString patterns
+// and keys to the Unicode normalization form, e.g. norm.NFC, so that strings differing only in
+// their forms match each other. By default, strings are compared as they are.
+// Keys already in the form are searched as they are, while the others are normalized into copies.
+func WithStringNormalization[T any](form norm.Form) MatchTreeOptionFunc[T] {
+	return func(o matchTreeOptions[T]) matchTreeOptions[T] {
+		o.StringForm = &form
+		return o
+	}
+}
+
+// normalizeKeys returns the keys with the strings of the MatchString keys in the normalization
+// form, copying the keys only if there is any string not in the form.
+func normalizeKeys(keys []MatchKey, form *norm.Form) []MatchKey {
+	if form == nil {
+		return keys
+	}
+	normalizedKeys := keys
+	for i := range keys {
+		key := &keys[i]
+		if key.Type != MatchString || (form.IsNormalString(key.String) && !slices.ContainsFunc(key.Strings, func(v string) bool {
+			return !form.IsNormalString(v)
+		})) {
+			continue
+		}
+		if &normalizedKeys[0] == &keys[0] {
+			normalizedKeys = slices.Clone(keys)
+		}
+		normalizedKeys[i].String = form.String(key.String)
+		normalizedKeys[i].Strings = normalizeStrings(key.Strings, form)
+	}
+	return normalizedKeys
+}
+
+// normalizeStrings returns a copy of the strings in the normalization form.
+func normalizeStrings(strings []string, form *norm.Form) []string {
+	if strings == nil {
+		return nil
+	}
+	normalizedStrings := make([]string, len(strings))
+	for i, v := range strings {
+		normalizedStrings[i] = form.String(v)
+	}
+	return normalizedStrings
+}
@@ -0,0 +1,151 @@
+package matchtree
+
+import (
+	"iter"
+	"slices"
+)
+
+// ----- match node of number interval -----
+
+type matchNodeOfNumberInterval struct {
+	dummyMatchNode
+
+	children                []numberIntervalAndMatchNode
+	childTree               numberIntervalTree[matchNode]
+	inverseChildren         []matchNodeWithRefCount
+	inverseChildIndexes     []numberIntervalAndMatchNodeIndexes
+	inverseChildIndexesTree numberIntervalTree[int]
+	anyChild                matchNode
+}
+
+var _ matchNode = (*matchNodeOfNumberInterval)(nil)
+
+type numberIntervalAndMatchNode struct {
+	NumberInterval NumberInterval
+	MatchNode      matchNode
+}
+
+type numberIntervalAndMatchNodeIndexes struct {
+	NumberInterval   NumberInterval
+	MatchNodeIndexes []int
+}
+
+func (n *matchNodeOfNumberInterval) GetOrInsertChild(pattern *MatchPattern, newChildType MatchType) matchNode {
+	if pattern.IsAny {
+		child := n.anyChild
+		if child == nil {
+			child = newMatchNode(newChildType)
+			n.anyChild = child
+		}
+		return child
+	}
+
+	if pattern.IsInverse {
+		refCounts := make([]int, len(n.inverseChildren))
+		for _, v := range pattern.NumberIntervals {
+			i := slices.IndexFunc(n.inverseChildIndexes, func(x numberIntervalAndMatchNodeIndexes) bool {
+				return x.NumberInterval.Equals(v)
+			})
+			if i < 0 {
+				continue
+			}
+			for _, childIndex := range n.inverseChildIndexes[i].MatchNodeIndexes {
+				refCounts[childIndex]++
+			}
+		}
+		maxRefCount := len(pattern.NumberIntervals)
+		for childIndex, refCount := range refCounts {
+			if refCount == maxRefCount && n.inverseChildren[childIndex].MaxRefCount == maxRefCount {
+				return n.inverseChildren[childIndex].MatchNode
+			}
+		}
+		newChild := newMatchNode(newChildType)
+		newChildIndex := len(n.inverseChildren)
+		n.inverseChildren = append(n.inverseChildren, matchNodeWithRefCount{
+			MatchNode:   newChild,
+			MaxRefCount: maxRefCount,
+		})
+		for _, v := range pattern.NumberIntervals {
+			i := slices.IndexFunc(n.inverseChildIndexes, func(x numberIntervalAndMatchNodeIndexes) bool {
+				return x.NumberInterval.Equals(v)
+			})
+			if i < 0 {
+				n.inverseChildIndexesTree.Insert(v, len(n.inverseChildIndexes))
+				n.inverseChildIndexes = append(n.inverseChildIndexes, numberIntervalAndMatchNodeIndexes{
+					NumberInterval:   v,
+					MatchNodeIndexes: []int{newChildIndex},
+				})
+				continue
+			}
+			n.inverseChildIndexes[i].MatchNodeIndexes = append(n.inverseChildIndexes[i].MatchNodeIndexes, newChildIndex)
+		}
+		return newChild
+	}
+
+	if childIndex := slices.IndexFunc(n.children, func(x numberIntervalAndMatchNode) bool {
+		return x.NumberInterval.Equals(pattern.currentNumberInterval)
+	}); childIndex >= 0 {
+		return n.children[childIndex].MatchNode
+	}
+	newChild := newMatchNode(newChildType)
+	n.children = append(n.children, numberIntervalAndMatchNode{
+		NumberInterval: pattern.currentNumberInterval,
+		MatchNode:      newChild,
+	})
+	n.childTree.Insert(pattern.currentNumberInterval, newChild)
+	return newChild
+}
+
+func (n *matchNodeOfNumberInterval) FindChildren(children []matchNode, key MatchKey) []matchNode {
+	if key.IsAbsent {
+		return appendAnyChild(children, n.anyChild)
+	}
+
+	n.childTree.Search(key.Number, func(child matchNode) bool {
+		children = append(children, child)
+		return true
+	})
+
+	if len(n.inverseChildren) >= 1 {
+		excludedChildIndexes := getBitset(len(n.inverseChildren))
+		n.inverseChildIndexesTree.Search(key.Number, func(i int) bool {
+			for _, childIndex := range n.inverseChildIndexes[i].MatchNodeIndexes {
+				excludedChildIndexes.Add(childIndex)
+			}
+			return true
+		})
+		children = appendInverseChildrenNotIn(children, n.inverseChildren, *excludedChildIndexes)
+		putBitset(excludedChildIndexes)
+	}
+
+	if child := n.anyChild; child != nil {
+		children = append(children, child)
+	}
+	return children
+}
+
+func (n *matchNodeOfNumberInterval) Edges() iter.Seq2[MatchPattern, matchNode] {
+	return func(yield func(MatchPattern, matchNode) bool) {
+		for _, child := range n.children {
+			if !yield(MatchPattern{Type: MatchNumberInterval, NumberIntervals: []NumberInterval{child.NumberInterval}}, child.MatchNode) {
+				return
+			}
+		}
+
+		inverseIntervals := make([][]NumberInterval, len(n.inverseChildren))
+		for _, v := range n.inverseChildIndexes {
+			for _, childIndex := range v.MatchNodeIndexes {
+				inverseIntervals[childIndex] = append(inverseIntervals[childIndex], v.NumberInterval)
+			}
+		}
+		for childIndex, child := range n.inverseChildren {
+			if !yield(MatchPattern{Type: MatchNumberInterval, IsInverse: true, NumberIntervals: inverseIntervals[childIndex]}, child.MatchNode) {
+				return
+			}
+		}
+
+		if child := n.anyChild; child != nil {
+			yield(MatchPattern{Type: MatchNumberInterval, IsAny: true}, child)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package matchtree
+
+import "iter"
+
+// ----- match node of numeric -----
+
+// matchNodeOfNumeric keeps the interval and inverse children like matchNodeOfIntegerInterval, and
+// the exact children of single integers in a map like matchNodeOfInteger.
+type matchNodeOfNumeric struct {
+	matchNodeOfIntegerInterval
+
+	integerChildren map[int64]matchNode
+}
+
+var _ matchNode = (*matchNodeOfNumeric)(nil)
+
+func (n *matchNodeOfNumeric) GetOrInsertChild(pattern *MatchPattern, newChildType MatchType) matchNode {
+	if pattern.IsAny || pattern.IsInverse || !pattern.currentIsInteger {
+		return n.matchNodeOfIntegerInterval.GetOrInsertChild(pattern, newChildType)
+	}
+
+	children := n.integerChildren
+	if children == nil {
+		children = make(map[int64]matchNode, 1)
+		n.integerChildren = children
+	}
+	child, ok := children[pattern.currentInteger]
+	if !ok {
+		child = newMatchNode(newChildType)
+		children[pattern.currentInteger] = child
+	}
+	return child
+}
+
+func (n *matchNodeOfNumeric) FindChildren(children []matchNode, key MatchKey) []matchNode {
+	if !key.IsAbsent {
+		if child, ok := n.integerChildren[key.Integer]; ok {
+			children = append(children, child)
+		}
+	}
+	return n.matchNodeOfIntegerInterval.FindChildren(children, key)
+}
+
+func (n *matchNodeOfNumeric) Edges() iter.Seq2[MatchPattern, matchNode] {
+	return func(yield func(MatchPattern, matchNode) bool) {
+		for _, v := range sortedKeys(n.integerChildren) {
+			if !yield(MatchPattern{Type: MatchNumeric, Integers: []int64{v}}, n.integerChildren[v]) {
+				return
+			}
+		}
+
+		for pattern, child := range n.matchNodeOfIntegerInterval.Edges() {
+			pattern.Type = MatchNumeric
+			if !yield(pattern, child) {
+				return
+			}
+		}
+	}
+}
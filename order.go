@@ -0,0 +1,158 @@
+package matchtree
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+)
+
+// SuggestTypeOrder analyzes the patterns of the rules, one per MatchType of a tree in the order of
+// its types, and returns the order of the types that keeps the fewest nodes reached by a search,
+// as a permutation for Rebuild: the types of the most selective patterns go first, so that each key
+// prunes as many nodes as possible before the next one.
+//
+// The selectivity of the patterns of a MatchType is estimated as the fraction of the rules matching
+// a key of one of their distinct values (or intervals, regexps and so on) chosen at random: a
+// rule with n of the d distinct values matches it with a chance of n/d, one excluding n of them
+// with a chance of 1-n/d, and one matching any value always. The types of equal selectivity are
+// kept in their order.
+func SuggestTypeOrder[T any](rules []MatchRule[T]) []int {
+	numberOfTypes := 0
+	for _, rule := range rules {
+		numberOfTypes = max(numberOfTypes, len(rule.Patterns))
+	}
+
+	matchRatios := make([]float64, numberOfTypes)
+	for i := range matchRatios {
+		distinctValues := make(map[string]struct{})
+		for _, rule := range rules {
+			if i < len(rule.Patterns) {
+				for _, v := range formatPatternItems(&rule.Patterns[i], strconv.Quote) {
+					distinctValues[v] = struct{}{}
+				}
+			}
+		}
+		d := float64(max(len(distinctValues), 1))
+
+		sum := 0.0
+		for _, rule := range rules {
+			if i >= len(rule.Patterns) {
+				continue
+			}
+			pattern := &rule.Patterns[i]
+			n := float64(len(formatPatternItems(pattern, strconv.Quote)))
+			switch {
+			case pattern.IsAny || n == 0:
+				sum++
+			case pattern.IsInverse:
+				sum += 1 - n/d
+			default:
+				sum += n / d
+			}
+		}
+		matchRatios[i] = sum / float64(max(len(rules), 1))
+	}
+
+	order := make([]int, numberOfTypes)
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(i, j int) int { return cmp.Compare(matchRatios[i], matchRatios[j]) })
+	return order
+}
+
+// Rebuild returns a new MatchTree holding the same rules as the MatchTree but with its types in
+// the order, e.g. from SuggestTypeOrder, i.e. with order[i]-th type of the MatchTree as its i-th
+// type, so the keys to search it must be permuted likewise: newKeys[i] = keys[order[i]].
+// The rules keep their IDs, priorities, expiry, labels and enabled states, and the rebuilt tree
+// keeps the options of the MatchTree, which is left unchanged. Leaf nodes left without results by
+// removed rules are dropped. It returns an error if the order is not a permutation of the types.
+func (t *MatchTree[T]) Rebuild(order []int) (*MatchTree[T], error) {
+	if len(order) != len(t.types) {
+		return nil, fmt.Errorf("matchtree: unexpected length of type order; expected=%v actual=%v", len(t.types), len(order))
+	}
+	types := make([]MatchType, len(order))
+	isUsed := make([]bool, len(order))
+	for i, j := range order {
+		if j < 0 || j >= len(order) || isUsed[j] {
+			return nil, fmt.Errorf("matchtree: invalid type order %v", order)
+		}
+		isUsed[j] = true
+		types[i] = t.types[j]
+	}
+
+	u := &MatchTree[T]{
+		types:        types,
+		values:       slices.Clone(t.values),
+		lastRuleID:   t.lastRuleID,
+		rules:        make(map[RuleID]ruleLocation, len(t.rules)),
+		valueEqual:   t.valueEqual,
+		valueKey:     t.valueKey,
+		stringForm:   t.stringForm,
+		maxExpansion: t.maxExpansion,
+		metrics:      t.metrics,
+	}
+	if t.visitCounts != nil {
+		u.visitCounts = new(visitCounts)
+	}
+	for id, location := range t.rules {
+		location.Leaves = nil
+		location.Labels = maps.Clone(location.Labels)
+		u.rules[id] = location
+	}
+	if t.root == nil {
+		return u, nil
+	}
+
+	// each path to a leaf is inserted into the rebuilt tree as a rule of single-value patterns
+	path := make([]MatchPattern, len(t.types))
+	patterns := make([]MatchPattern, len(t.types))
+	options := makeAddRuleOptions(nil)
+	var err error
+	var walkNode func(node matchNode, depth int) bool
+	walkNode = func(node matchNode, depth int) bool {
+		if depth == len(t.types) {
+			// leaf
+			results := node.GetResults()
+			if len(results) == 0 {
+				return true
+			}
+			for i, j := range order {
+				patterns[i] = path[j]
+			}
+			var preparedPatterns []MatchPattern
+			preparedPatterns, err = u.preparePatterns(patterns, options)
+			if err != nil {
+				return false
+			}
+			for i := range preparedPatterns {
+				preparedPatterns[i].selectValue(0)
+			}
+			leaf := u.getOrInsertLeaf(preparedPatterns)
+			for _, result := range results {
+				leaf.AddResult(result)
+				location := u.rules[result.RuleID]
+				location.Leaves = append(location.Leaves, leaf)
+				u.rules[result.RuleID] = location
+			}
+			return true
+		}
+
+		// non-leaf
+		for pattern, child := range node.Edges() {
+			pattern.compiledRegexp = nil
+			pattern.versionRanges = nil
+			path[depth] = pattern
+			if !walkNode(child, depth+1) {
+				return false
+			}
+		}
+		return true
+	}
+	if !walkNode(t.root, 0) {
+		return nil, err
+	}
+	return u, nil
+}
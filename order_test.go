@@ -0,0 +1,93 @@
+package matchtree_test
+
+import (
+	"testing"
+
+	. "github.com/roy2220/matchtree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuggestTypeOrder(t *testing.T) {
+	rules := []MatchRule[string]{
+		{Patterns: []MatchPattern{AnyPattern(MatchString), IntegersPattern(1, 2), StringsPattern("a")}},
+		{Patterns: []MatchPattern{StringsPattern("x"), IntegersPattern(2), StringsPattern("b")}},
+		{Patterns: []MatchPattern{AnyPattern(MatchString), InverseIntegersPattern(1), StringsPattern("c")}},
+		{Patterns: []MatchPattern{AnyPattern(MatchString), IntegersPattern(3), StringsPattern("d")}},
+	}
+	// match ratios: (1+1/1+1+1)/4, (2/3+1/3+2/3+1/3)/4, (1/4+1/4+1/4+1/4)/4
+	assert.Equal(t, []int{2, 1, 0}, SuggestTypeOrder(rules))
+	assert.Empty(t, SuggestTypeOrder[string](nil))
+}
+
+func TestMatchTree_Rebuild(t *testing.T) {
+	types := []MatchType{MatchString, MatchIntegerInterval, MatchRegexp, MatchBytes}
+	matchTree := NewMatchTree[string](types)
+	rules := []MatchRule[string]{
+		{
+			Patterns: []MatchPattern{AnyPattern(MatchString), IntegerIntervalPattern(ClosedInterval(1, 5), FromInterval(10)), RegexpPattern("^a"), BytesPattern([]byte("x"))},
+			Value:    "rule_1",
+		},
+		{
+			Patterns: []MatchPattern{InverseStringsPattern("b"), AnyPattern(MatchIntegerInterval), InverseRegexpPattern("^b"), AnyPattern(MatchBytes)},
+			Value:    "rule_2",
+			Priority: 1,
+		},
+		{
+			Patterns: []MatchPattern{StringsPattern("a", "b"), IntegerIntervalPattern(ToInterval(3)), AnyPattern(MatchRegexp), BytesPattern([]byte("x"), []byte("y"))},
+			Value:    "rule_3",
+		},
+		{
+			Patterns: []MatchPattern{StringsPattern("c"), AnyPattern(MatchIntegerInterval), AnyPattern(MatchRegexp), AnyPattern(MatchBytes)},
+			Value:    "rule_4",
+		},
+	}
+	var ids []RuleID
+	for _, rule := range rules {
+		id, err := matchTree.AddRule(rule)
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	require.NoError(t, matchTree.SetRuleEnabled(ids[2], false))
+	require.NoError(t, matchTree.RemoveRuleByID(ids[3]))
+
+	order := []int{3, 1, 0, 2}
+	rebuiltTree, err := matchTree.Rebuild(order)
+	require.NoError(t, err)
+	for _, s := range []string{"a", "b", "c"} {
+		for _, i := range []int64{0, 3, 7, 10} {
+			for _, r := range []string{"apple", "banana"} {
+				for _, b := range []string{"x", "y", "z"} {
+					keys := []MatchKey{StringKey(s), IntegerIntervalKey(i), RegexpKey(r), BytesKey([]byte(b))}
+					want, err := matchTree.Search(keys)
+					require.NoError(t, err)
+					rebuiltKeys := make([]MatchKey, len(keys))
+					for i, j := range order {
+						rebuiltKeys[i] = keys[j]
+					}
+					got, err := rebuiltTree.Search(rebuiltKeys)
+					require.NoError(t, err)
+					assert.Equal(t, want, got, "%v", keys)
+				}
+			}
+		}
+	}
+
+	// the rule IDs and enabled states are kept
+	require.NoError(t, rebuiltTree.SetRuleEnabled(ids[2], true))
+	values, err := rebuiltTree.Search([]MatchKey{BytesKey([]byte("y")), IntegerIntervalKey(0), StringKey("a"), RegexpKey("zz")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_2", "rule_3"}, values)
+	require.NoError(t, rebuiltTree.RemoveRuleByID(ids[0]))
+	assert.Error(t, rebuiltTree.RemoveRuleByID(ids[3]))
+	id, err := rebuiltTree.AddRule(MatchRule[string]{
+		Patterns: []MatchPattern{AnyPattern(MatchBytes), AnyPattern(MatchIntegerInterval), AnyPattern(MatchString), AnyPattern(MatchRegexp)},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ids[3]+1, id)
+
+	_, err = matchTree.Rebuild([]int{0, 1, 2})
+	assert.EqualError(t, err, "matchtree: unexpected length of type order; expected=4 actual=3")
+	_, err = matchTree.Rebuild([]int{0, 1, 1, 3})
+	assert.EqualError(t, err, "matchtree: invalid type order [0 1 1 3]")
+}
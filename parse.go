@@ -0,0 +1,133 @@
+package matchtree
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseIntegerInterval parses an IntegerInterval written in mathematical notation, e.g. "[1,5)".
+// A square bracket denotes an included bound and a parenthesis an excluded one. An unbounded
+// side is written as empty or as ∞ (optionally signed), e.g. "[1,)" or "(-∞,5]".
+func ParseIntegerInterval(s string) (IntegerInterval, error) {
+	min, minIsExcluded, max, maxIsExcluded, err := parseInterval(s, func(s string) (int64, error) {
+		return strconv.ParseInt(s, 10, 64)
+	})
+	if err != nil {
+		return IntegerInterval{}, fmt.Errorf("matchtree: invalid integer interval %q: %w", s, err)
+	}
+	return IntegerInterval{
+		Min:           min,
+		MinIsExcluded: minIsExcluded,
+		Max:           max,
+		MaxIsExcluded: maxIsExcluded,
+	}, nil
+}
+
+// ParseNumberInterval parses a NumberInterval written in mathematical notation, e.g. "(0.5,1]".
+// The notation is the same as for ParseIntegerInterval. A bound of -0 is parsed as 0.
+func ParseNumberInterval(s string) (NumberInterval, error) {
+	min, minIsExcluded, max, maxIsExcluded, err := parseInterval(s, func(s string) (float64, error) {
+		x, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, err
+		}
+		if math.IsNaN(x) {
+			return 0, errors.New("NaN bound")
+		}
+		return x, nil
+	})
+	if err != nil {
+		return NumberInterval{}, fmt.Errorf("matchtree: invalid number interval %q: %w", s, err)
+	}
+	return NumberInterval{
+		Min:           min,
+		MinIsExcluded: minIsExcluded,
+		Max:           max,
+		MaxIsExcluded: maxIsExcluded,
+	}.normalizeZeros(), nil
+}
+
+func parseInterval[N int64 | float64](s string, parseBound func(string) (N, error)) (*N, bool, *N, bool, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 {
+		return nil, false, nil, false, errors.New("missing brackets")
+	}
+
+	var lowerBoundIsExcluded, upperBoundIsExcluded bool
+	switch s[0] {
+	case '[':
+	case '(':
+		lowerBoundIsExcluded = true
+	default:
+		return nil, false, nil, false, errors.New("missing opening bracket")
+	}
+	switch s[len(s)-1] {
+	case ']':
+	case ')':
+		upperBoundIsExcluded = true
+	default:
+		return nil, false, nil, false, errors.New("missing closing bracket")
+	}
+
+	lowerBoundStr, upperBoundStr, ok := strings.Cut(s[1:len(s)-1], ",")
+	if !ok {
+		return nil, false, nil, false, errors.New("missing comma")
+	}
+	lowerBound, err := parseIntervalBound(lowerBoundStr, "-", parseBound)
+	if err != nil {
+		return nil, false, nil, false, fmt.Errorf("lower bound: %w", err)
+	}
+	upperBound, err := parseIntervalBound(upperBoundStr, "+", parseBound)
+	if err != nil {
+		return nil, false, nil, false, fmt.Errorf("upper bound: %w", err)
+	}
+	if lowerBound == nil {
+		lowerBoundIsExcluded = false
+	}
+	if upperBound == nil {
+		upperBoundIsExcluded = false
+	}
+	if lowerBound != nil && upperBound != nil && *lowerBound > *upperBound {
+		return nil, false, nil, false, errors.New("lower bound greater than upper bound")
+	}
+	return lowerBound, lowerBoundIsExcluded, upperBound, upperBoundIsExcluded, nil
+}
+
+// parseIntervalBound parses a bound, returning nil if it is unbounded, i.e. empty or ∞ with
+// no sign or the given sign.
+func parseIntervalBound[N int64 | float64](s string, infinitySign string, parseBound func(string) (N, error)) (*N, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "∞" || s == infinitySign+"∞" {
+		return nil, nil
+	}
+	x, err := parseBound(s)
+	if err != nil {
+		return nil, err
+	}
+	return &x, nil
+}
+
+func formatInterval[N int64 | float64](lowerBound *N, lowerBoundIsExcluded bool, upperBound *N, upperBoundIsExcluded bool) string {
+	var b strings.Builder
+	if lowerBound == nil || lowerBoundIsExcluded {
+		b.WriteByte('(')
+	} else {
+		b.WriteByte('[')
+	}
+	if lowerBound != nil {
+		fmt.Fprint(&b, *lowerBound)
+	}
+	b.WriteByte(',')
+	if upperBound != nil {
+		fmt.Fprint(&b, *upperBound)
+	}
+	if upperBound == nil || upperBoundIsExcluded {
+		b.WriteByte(')')
+	} else {
+		b.WriteByte(']')
+	}
+	return b.String()
+}
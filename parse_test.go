@@ -0,0 +1,117 @@
+package matchtree_test
+
+import (
+	"testing"
+
+	. "github.com/roy2220/matchtree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIntegerInterval(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    IntegerInterval
+		wantErr string
+	}{
+		{s: "[1,5]", want: IntegerInterval{Min: Int64Ptr(1), Max: Int64Ptr(5)}},
+		{s: "(1,5)", want: IntegerInterval{Min: Int64Ptr(1), MinIsExcluded: true, Max: Int64Ptr(5), MaxIsExcluded: true}},
+		{s: " [ -1 , 5 ) ", want: IntegerInterval{Min: Int64Ptr(-1), Max: Int64Ptr(5), MaxIsExcluded: true}},
+		{s: "(1,5]", want: IntegerInterval{Min: Int64Ptr(1), MinIsExcluded: true, Max: Int64Ptr(5)}},
+		{s: "[1,)", want: IntegerInterval{Min: Int64Ptr(1)}},
+		{s: "(,5]", want: IntegerInterval{Max: Int64Ptr(5)}},
+		{s: "(-∞,∞)", want: IntegerInterval{}},
+		{s: "(∞,+∞)", want: IntegerInterval{}},
+		{s: "1,5", wantErr: `matchtree: invalid integer interval "1,5": missing opening bracket`},
+		{s: "[1,5", wantErr: `matchtree: invalid integer interval "[1,5": missing closing bracket`},
+		{s: "[1]", wantErr: `matchtree: invalid integer interval "[1]": missing comma`},
+		{s: "[a,5]", wantErr: `matchtree: invalid integer interval "[a,5]": lower bound: strconv.ParseInt: parsing "a": invalid syntax`},
+		{s: "[1,-∞]", wantErr: `matchtree: invalid integer interval "[1,-∞]": upper bound: strconv.ParseInt: parsing "-∞": invalid syntax`},
+		{s: "[5,1]", wantErr: `matchtree: invalid integer interval "[5,1]": lower bound greater than upper bound`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			interval, err := ParseIntegerInterval(tt.s)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, interval)
+			}
+		})
+	}
+}
+
+func TestParseNumberInterval(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    NumberInterval
+		wantErr string
+	}{
+		{s: "[0.5,1]", want: NumberInterval{Min: Float64Ptr(0.5), Max: Float64Ptr(1)}},
+		{s: "(0.5,1e3)", want: NumberInterval{Min: Float64Ptr(0.5), MinIsExcluded: true, Max: Float64Ptr(1e3), MaxIsExcluded: true}},
+		{s: "(-∞,-1.5]", want: NumberInterval{Max: Float64Ptr(-1.5)}},
+		{s: "[0,)", want: NumberInterval{Min: Float64Ptr(0)}},
+		{s: "[NaN,1]", wantErr: `matchtree: invalid number interval "[NaN,1]": lower bound: NaN bound`},
+		{s: "(2,1.5)", wantErr: `matchtree: invalid number interval "(2,1.5)": lower bound greater than upper bound`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			interval, err := ParseNumberInterval(tt.s)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, interval)
+			}
+		})
+	}
+}
+
+func TestIntegerInterval_String(t *testing.T) {
+	tests := []struct {
+		i    IntegerInterval
+		want string
+	}{
+		{IntegerInterval{Min: Int64Ptr(1), Max: Int64Ptr(5), MaxIsExcluded: true}, "[1,5)"},
+		{IntegerInterval{Min: Int64Ptr(-1), MinIsExcluded: true, Max: Int64Ptr(5)}, "(-1,5]"},
+		{IntegerInterval{Max: Int64Ptr(10)}, "(,10]"},
+		{IntegerInterval{Min: Int64Ptr(0), MinIsExcluded: true}, "(0,)"},
+		{IntegerInterval{}, "(,)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.i.String())
+			interval, err := ParseIntegerInterval(tt.i.String())
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.i, interval)
+			}
+		})
+	}
+}
+
+func TestNumberInterval_String(t *testing.T) {
+	tests := []struct {
+		i    NumberInterval
+		want string
+	}{
+		{NumberInterval{Min: Float64Ptr(0.5), MinIsExcluded: true, Max: Float64Ptr(1)}, "(0.5,1]"},
+		{NumberInterval{Min: Float64Ptr(-1.5), Max: Float64Ptr(1e21), MaxIsExcluded: true}, "[-1.5,1e+21)"},
+		{NumberInterval{Min: Float64Ptr(0)}, "[0,)"},
+		{NumberInterval{}, "(,)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.i.String())
+			interval, err := ParseNumberInterval(tt.i.String())
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.i, interval)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package matchtree
+
+import "slices"
+
+// prune removes the nodes left with no results, e.g. by removing rules, along with their entries
+// in the parent nodes, and frees the slots of the values of the rules removed.
+func (t *MatchTree[T]) prune() {
+	if t.root != nil && t.pruneMatchNode(t.root, 0) {
+		t.root = nil
+	}
+	t.compactValues()
+}
+
+// pruneMatchNode removes the children of the node left with no results, and reports whether the
+// node itself is left with no results. Leaf nodes are expected at the depth of the last type, so
+// that a faulty custom node leading back up the tree cannot make the pruning go on forever.
+func (t *MatchTree[T]) pruneMatchNode(node matchNode, depth int) bool {
+	if depth == len(t.types) {
+		leaf, ok := node.(*matchNodeOfNone)
+		return ok && len(leaf.results) == 0
+	}
+
+	isEmpty := func(child matchNode) bool { return t.pruneMatchNode(child, depth+1) }
+	switch node := node.(type) {
+	case *matchNodeOfString:
+		pruneChildMap(node.children, isEmpty)
+		node.inverseChildren = pruneInverseChildren(node.inverseChildren, node.inverseChildIndexes, isEmpty)
+		node.anyChild = pruneAnyChild(node.anyChild, isEmpty)
+	case *matchNodeOfInteger:
+		pruneChildMap(node.children, isEmpty)
+		node.inverseChildren = pruneInverseChildren(node.inverseChildren, node.inverseChildIndexes, isEmpty)
+		node.anyChild = pruneAnyChild(node.anyChild, isEmpty)
+		node.updateChildKeys()
+	case *matchNodeOfIntegerInterval:
+		pruneMatchNodeOfIntegerInterval(node, isEmpty)
+	case *matchNodeOfNumeric:
+		pruneChildMap(node.integerChildren, isEmpty)
+		pruneMatchNodeOfIntegerInterval(&node.matchNodeOfIntegerInterval, isEmpty)
+	case *matchNodeOfNumberInterval:
+		pruneMatchNodeOfNumberInterval(node, isEmpty)
+	case *matchNodeOfBytes:
+		pruneChildMap(node.children, isEmpty)
+		node.inverseChildren = pruneInverseChildren(node.inverseChildren, node.inverseChildIndexes, isEmpty)
+		node.anyChild = pruneAnyChild(node.anyChild, isEmpty)
+	case *matchNodeOfEnum:
+		pruneChildMap(node.children, isEmpty)
+		node.inverseChildren = pruneInverseChildren(node.inverseChildren, node.inverseChildIndexes, isEmpty)
+		node.anyChild = pruneAnyChild(node.anyChild, isEmpty)
+		node.updateChildKeys()
+	case *matchNodeOfRegexp:
+		isEmptyEdge := func(x regexpAndMatchNode) bool { return isEmpty(x.MatchNode) }
+		node.children = slices.DeleteFunc(node.children, isEmptyEdge)
+		node.inverseChildren = slices.DeleteFunc(node.inverseChildren, isEmptyEdge)
+		node.anyChild = pruneAnyChild(node.anyChild, isEmpty)
+	case *matchNodeOfSemverRange:
+		isEmptyEdge := func(x versionRangesAndMatchNode) bool { return isEmpty(x.MatchNode) }
+		node.children = slices.DeleteFunc(node.children, isEmptyEdge)
+		node.inverseChildren = slices.DeleteFunc(node.inverseChildren, isEmptyEdge)
+		node.anyChild = pruneAnyChild(node.anyChild, isEmpty)
+	case *matchNodeOfGlob:
+		isEmptyEdge := func(x globAndMatchNode) bool { return isEmpty(x.MatchNode) }
+		node.children = slices.DeleteFunc(node.children, isEmptyEdge)
+		node.inverseChildren = slices.DeleteFunc(node.inverseChildren, isEmptyEdge)
+		node.anyChild = pruneAnyChild(node.anyChild, isEmpty)
+	case *customMatchNode:
+		// custom nodes cannot drop their children, so they are never left empty
+		for _, child := range node.Edges() {
+			isEmpty(child)
+		}
+		return false
+	default:
+		return false
+	}
+
+	for range node.Edges() {
+		return false
+	}
+	return true
+}
+
+func pruneChildMap[K comparable](children map[K]matchNode, isEmpty func(matchNode) bool) {
+	for k, child := range children {
+		if isEmpty(child) {
+			delete(children, k)
+		}
+	}
+}
+
+func pruneAnyChild(anyChild matchNode, isEmpty func(matchNode) bool) matchNode {
+	if anyChild != nil && isEmpty(anyChild) {
+		return nil
+	}
+	return anyChild
+}
+
+// pruneInverseChildren removes the inverse children left empty and renumbers the indexes
+// referring to the remaining ones.
+func pruneInverseChildren[K comparable](inverseChildren []matchNodeWithRefCount, inverseChildIndexes map[K][]int, isEmpty func(matchNode) bool) []matchNodeWithRefCount {
+	newChildIndexes, n := pruneInverseChildList(inverseChildren, isEmpty)
+	if n == len(inverseChildren) {
+		return inverseChildren
+	}
+	for k, childIndexes := range inverseChildIndexes {
+		if childIndexes = renumberChildIndexes(childIndexes, newChildIndexes); len(childIndexes) == 0 {
+			delete(inverseChildIndexes, k)
+		} else {
+			inverseChildIndexes[k] = childIndexes
+		}
+	}
+	clear(inverseChildren[n:])
+	return inverseChildren[:n]
+}
+
+// pruneInverseChildList moves the inverse children not left empty to the front, and returns the
+// new index of each child, -1 if removed, along with the number of children remaining.
+func pruneInverseChildList(inverseChildren []matchNodeWithRefCount, isEmpty func(matchNode) bool) ([]int, int) {
+	newChildIndexes := make([]int, len(inverseChildren))
+	n := 0
+	for i, child := range inverseChildren {
+		if isEmpty(child.MatchNode) {
+			newChildIndexes[i] = -1
+			continue
+		}
+		newChildIndexes[i] = n
+		inverseChildren[n] = child
+		n++
+	}
+	return newChildIndexes, n
+}
+
+func renumberChildIndexes(childIndexes []int, newChildIndexes []int) []int {
+	n := 0
+	for _, childIndex := range childIndexes {
+		if newChildIndex := newChildIndexes[childIndex]; newChildIndex >= 0 {
+			childIndexes[n] = newChildIndex
+			n++
+		}
+	}
+	return childIndexes[:n]
+}
+
+// pruneMatchNodeOfIntegerInterval prunes the children of the node, rebuilding its interval trees.
+func pruneMatchNodeOfIntegerInterval(node *matchNodeOfIntegerInterval, isEmpty func(matchNode) bool) {
+	n := len(node.children)
+	node.children = slices.DeleteFunc(node.children, func(x integerIntervalAndMatchNode) bool { return isEmpty(x.MatchNode) })
+	if len(node.children) < n {
+		var childTree integerIntervalTree[matchNode]
+		for _, child := range node.children {
+			childTree.Insert(child.IntegerInterval, child.MatchNode)
+		}
+		node.childTree = childTree
+	}
+
+	newChildIndexes, n := pruneInverseChildList(node.inverseChildren, isEmpty)
+	if n < len(node.inverseChildren) {
+		clear(node.inverseChildren[n:])
+		node.inverseChildren = node.inverseChildren[:n]
+		inverseChildIndexes := node.inverseChildIndexes[:0]
+		var inverseChildIndexesTree integerIntervalTree[int]
+		for _, v := range node.inverseChildIndexes {
+			if v.MatchNodeIndexes = renumberChildIndexes(v.MatchNodeIndexes, newChildIndexes); len(v.MatchNodeIndexes) == 0 {
+				continue
+			}
+			inverseChildIndexesTree.Insert(v.IntegerInterval, len(inverseChildIndexes))
+			inverseChildIndexes = append(inverseChildIndexes, v)
+		}
+		clear(node.inverseChildIndexes[len(inverseChildIndexes):])
+		node.inverseChildIndexes = inverseChildIndexes
+		node.inverseChildIndexesTree = inverseChildIndexesTree
+	}
+
+	node.anyChild = pruneAnyChild(node.anyChild, isEmpty)
+}
+
+// pruneMatchNodeOfNumberInterval prunes the children of the node, rebuilding its interval trees.
+func pruneMatchNodeOfNumberInterval(node *matchNodeOfNumberInterval, isEmpty func(matchNode) bool) {
+	n := len(node.children)
+	node.children = slices.DeleteFunc(node.children, func(x numberIntervalAndMatchNode) bool { return isEmpty(x.MatchNode) })
+	if len(node.children) < n {
+		var childTree numberIntervalTree[matchNode]
+		for _, child := range node.children {
+			childTree.Insert(child.NumberInterval, child.MatchNode)
+		}
+		node.childTree = childTree
+	}
+
+	newChildIndexes, n := pruneInverseChildList(node.inverseChildren, isEmpty)
+	if n < len(node.inverseChildren) {
+		clear(node.inverseChildren[n:])
+		node.inverseChildren = node.inverseChildren[:n]
+		inverseChildIndexes := node.inverseChildIndexes[:0]
+		var inverseChildIndexesTree numberIntervalTree[int]
+		for _, v := range node.inverseChildIndexes {
+			if v.MatchNodeIndexes = renumberChildIndexes(v.MatchNodeIndexes, newChildIndexes); len(v.MatchNodeIndexes) == 0 {
+				continue
+			}
+			inverseChildIndexesTree.Insert(v.NumberInterval, len(inverseChildIndexes))
+			inverseChildIndexes = append(inverseChildIndexes, v)
+		}
+		clear(node.inverseChildIndexes[len(inverseChildIndexes):])
+		node.inverseChildIndexes = inverseChildIndexes
+		node.inverseChildIndexesTree = inverseChildIndexesTree
+	}
+
+	node.anyChild = pruneAnyChild(node.anyChild, isEmpty)
+}
+
+// compactValues frees the slots of the values no rule refers to, renumbering the value indexes of
+// the remaining rules in order, so that results keep their relative order.
+func (t *MatchTree[T]) compactValues() {
+	isUsed := make([]bool, len(t.values))
+	n := 0
+	for _, location := range t.rules {
+		if location.ValueIndex >= 0 {
+			isUsed[location.ValueIndex] = true
+			n++
+		}
+	}
+	if n == len(t.values) {
+		return
+	}
+
+	values := make([]T, 0, n)
+	newValueIndexes := make([]int, len(t.values))
+	for i, value := range t.values {
+		if isUsed[i] {
+			newValueIndexes[i] = len(values)
+			values = append(values, value)
+		}
+	}
+	t.values = values
+	for id, location := range t.rules {
+		if location.ValueIndex >= 0 {
+			location.ValueIndex = newValueIndexes[location.ValueIndex]
+			t.rules[id] = location
+		}
+	}
+	for _, location := range t.rules {
+		for _, leaf := range location.Leaves {
+			results := leaf.GetResults()
+			for i := range results {
+				// idempotent, so leaves shared by several rules may be visited more than once
+				results[i].ValueIndex = t.rules[results[i].RuleID].ValueIndex
+			}
+		}
+	}
+}
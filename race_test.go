@@ -0,0 +1,5 @@
+//go:build race
+
+package matchtree_test
+
+const raceEnabled = true
@@ -0,0 +1,145 @@
+package matchtree
+
+import (
+	"math/rand"
+	"strconv"
+)
+
+// randomEnumCodes are the codes of the enum names of the patterns generated by GenerateRandomRules,
+// while the keys generated by GenerateRandomKeys also take a code of no name.
+var randomEnumCodes = map[string]int64{"red": 1, "green": 2, "blue": 3}
+
+var randomEnumNames = []string{"red", "green", "blue"}
+
+// GenerateRandomRules generates n MatchRules for a MatchTree with the specified sequence of
+// MatchTypes, from a pseudo-random source seeded with the seed, so that the same arguments always
+// give the same rules, e.g. for fuzz tests. The value of each rule is its index, its priority is
+// in [0,5), and each pattern is an any pattern, an inverse pattern or an exact pattern, of one or
+// two values of a small range, such that the keys from GenerateRandomKeys with any seed often
+// match. Patterns of custom match types are always any patterns.
+func GenerateRandomRules(types []MatchType, seed int64, n int) []MatchRule[int] {
+	rand := rand.New(rand.NewSource(seed))
+	rules := make([]MatchRule[int], n)
+	for i := range rules {
+		patterns := make([]MatchPattern, len(types))
+		for j, type1 := range types {
+			patterns[j] = randomPattern(rand, type1)
+		}
+		rules[i] = MatchRule[int]{
+			Patterns: patterns,
+			Value:    i,
+			Priority: int64(rand.Intn(5)),
+		}
+	}
+	return rules
+}
+
+func randomPattern(rand *rand.Rand, type1 MatchType) MatchPattern {
+	pattern := MatchPattern{Type: type1}
+	switch rand.Intn(4) {
+	case 0:
+		pattern.IsAny = true
+		return pattern
+	case 1:
+		pattern.IsInverse = true
+	}
+	v := rand.Intn(10)
+	switch type1 {
+	case MatchRegexp:
+		pattern.Regexp = [...]string{"^a", "b$", "c", "^[ab]+$"}[v%4]
+		return pattern
+	case MatchSemverRange:
+		pattern.VersionConstraint = [...]string{">=1.0.0 <2.0.0", "^0.3.1", "~2.1.0 || >=3.0.0", "<1.0.0"}[v%4]
+		return pattern
+	case MatchGlob:
+		pattern.Glob = [...]string{"a*", "?b", "*c*", "a?c"}[v%4]
+		return pattern
+	case MatchString, MatchInteger, MatchIntegerInterval, MatchNumberInterval, MatchEnum, MatchBytes, MatchNumeric:
+	default:
+		// custom match type
+		return MatchPattern{Type: type1, IsAny: true}
+	}
+
+	for k := range 1 + rand.Intn(2) {
+		if k >= 1 {
+			v = rand.Intn(10)
+		}
+		switch type1 {
+		case MatchString:
+			pattern.Strings = append(pattern.Strings, "s"+strconv.Itoa(v))
+		case MatchInteger:
+			pattern.Integers = append(pattern.Integers, int64(v))
+		case MatchIntegerInterval:
+			pattern.IntegerIntervals = append(pattern.IntegerIntervals, IntegerInterval{Min: Int64Ptr(int64(v)), Max: Int64Ptr(int64(v + 3)), MaxIsExcluded: v%2 == 0})
+		case MatchNumberInterval:
+			interval := NumberInterval{Min: Float64Ptr(float64(v) / 2), MinIsExcluded: v%2 == 1}
+			if v%3 != 0 {
+				interval.Max = Float64Ptr(float64(v))
+			}
+			pattern.NumberIntervals = append(pattern.NumberIntervals, interval)
+		case MatchEnum:
+			pattern.Strings = append(pattern.Strings, randomEnumNames[v%3])
+			pattern.EnumCodes = randomEnumCodes
+		case MatchBytes:
+			pattern.ByteSlices = append(pattern.ByteSlices, []byte{'b', byte(v)})
+		case MatchNumeric:
+			if v%2 == 0 {
+				pattern.Integers = append(pattern.Integers, int64(v))
+			} else {
+				pattern.IntegerIntervals = append(pattern.IntegerIntervals, ClosedInterval(int64(v), int64(v+2)))
+			}
+		}
+	}
+	return pattern
+}
+
+// GenerateRandomKeys generates the match keys for a search of a MatchTree with the specified
+// sequence of MatchTypes, from a pseudo-random source seeded with the seed like
+// GenerateRandomRules, from the ranges of the values of its patterns and a little beyond. A key
+// is absent now and then, and keys of the MatchString and MatchInteger types are multi-valued now
+// and then. Keys of custom match types are always absent.
+func GenerateRandomKeys(types []MatchType, seed int64) []MatchKey {
+	rand := rand.New(rand.NewSource(seed))
+	keys := make([]MatchKey, len(types))
+	for i, type1 := range types {
+		keys[i] = randomKey(rand, type1)
+	}
+	return keys
+}
+
+func randomKey(rand *rand.Rand, type1 MatchType) MatchKey {
+	if rand.Intn(8) == 0 {
+		return AbsentKey(type1)
+	}
+	v := rand.Intn(12)
+	switch type1 {
+	case MatchString:
+		if rand.Intn(4) == 0 {
+			return StringsKey("s"+strconv.Itoa(v), "s"+strconv.Itoa(rand.Intn(12)))
+		}
+		return StringKey("s" + strconv.Itoa(v))
+	case MatchInteger:
+		if rand.Intn(4) == 0 {
+			return IntegersKey(int64(v), int64(rand.Intn(12)))
+		}
+		return IntegerKey(int64(v))
+	case MatchIntegerInterval:
+		return IntegerIntervalKey(int64(v))
+	case MatchNumeric:
+		return NumericKey(int64(v))
+	case MatchNumberInterval:
+		return NumberKey(float64(rand.Intn(25)) / 4)
+	case MatchRegexp:
+		return RegexpKey([...]string{"a", "ab", "abc", "cb", "ba", "xyz"}[v%6])
+	case MatchEnum:
+		return EnumKey(int64(1 + v%4))
+	case MatchBytes:
+		return BytesKey([]byte{'b', byte(v)})
+	case MatchSemverRange:
+		return VersionKey(Version{Major: uint64(v % 4), Minor: uint64(rand.Intn(4)), Patch: uint64(rand.Intn(4))})
+	case MatchGlob:
+		return GlobKey([...]string{"a", "ab", "abc", "cb", "ac", "a世c"}[v%6])
+	default:
+		return AbsentKey(type1)
+	}
+}
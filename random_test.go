@@ -0,0 +1,82 @@
+package matchtree_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/roy2220/matchtree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var randomTypes = []MatchType{
+	MatchString, MatchInteger, MatchIntegerInterval, MatchNumberInterval, MatchRegexp, MatchEnum,
+	MatchBytes, MatchSemverRange, MatchGlob, MatchNumeric, matchPrefix,
+}
+
+func TestGenerateRandomRules(t *testing.T) {
+	rules := GenerateRandomRules(randomTypes, 1, 100)
+	require.Len(t, rules, 100)
+	assert.Equal(t, rules, GenerateRandomRules(randomTypes, 1, 100))
+	assert.NotEqual(t, rules, GenerateRandomRules(randomTypes, 2, 100))
+	for i, rule := range rules {
+		assert.Equal(t, i, rule.Value)
+		for _, pattern := range rule.Patterns {
+			require.NoError(t, pattern.Validate())
+		}
+		assert.True(t, rule.Patterns[len(randomTypes)-1].IsAny)
+	}
+
+	keys := GenerateRandomKeys(randomTypes, 1)
+	assert.Equal(t, keys, GenerateRandomKeys(randomTypes, 1))
+	for _, key := range keys {
+		require.NoError(t, key.Validate())
+	}
+
+	matchTree := NewMatchTree[int](randomTypes)
+	require.NoError(t, matchTree.AddRules(rules))
+	numberOfMatches := 0
+	for seed := range int64(100) {
+		values, err := matchTree.Search(GenerateRandomKeys(randomTypes, seed))
+		require.NoError(t, err)
+		numberOfMatches += len(values)
+	}
+	assert.Positive(t, numberOfMatches)
+}
+
+func FuzzMatchTree_JSONRoundTrip(f *testing.F) {
+	f.Add(int64(1), uint8(20))
+	f.Add(int64(2), uint8(100))
+	f.Fuzz(func(t *testing.T, seed int64, n uint8) {
+		rules := GenerateRandomRules(randomTypes, seed, int(n))
+		data, err := json.Marshal(rules)
+		require.NoError(t, err)
+		var rules2 []MatchRule[int]
+		require.NoError(t, json.Unmarshal(data, &rules2))
+
+		matchTree := NewMatchTree[int](randomTypes)
+		require.NoError(t, matchTree.AddRules(rules))
+		matchTree2 := NewMatchTree[int](randomTypes)
+		require.NoError(t, matchTree2.AddRules(rules2))
+		data, err = json.Marshal(matchTree)
+		require.NoError(t, err)
+		path := filepath.Join(t.TempDir(), "tree.json")
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+		matchTree3, err := LoadFromFile[int](path)
+		require.NoError(t, err)
+
+		for i := range int64(50) {
+			keys := GenerateRandomKeys(randomTypes, seed+i)
+			want, err := matchTree.Search(keys)
+			require.NoError(t, err)
+			values, err := matchTree2.Search(keys)
+			require.NoError(t, err)
+			require.Equal(t, want, values, "rules %v", keys)
+			values, err = matchTree3.Search(keys)
+			require.NoError(t, err)
+			require.Equal(t, want, values, "tree %v", keys)
+		}
+	})
+}
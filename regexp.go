@@ -0,0 +1,95 @@
+package matchtree
+
+import (
+	"iter"
+	"regexp"
+)
+
+// ----- match node of regexp -----
+
+type matchNodeOfRegexp struct {
+	dummyMatchNode
+
+	children        []regexpAndMatchNode
+	inverseChildren []regexpAndMatchNode
+	anyChild        matchNode
+}
+
+var _ matchNode = (*matchNodeOfRegexp)(nil)
+
+type regexpAndMatchNode struct {
+	Regexp    *regexp.Regexp
+	MatchNode matchNode
+}
+
+func (n *matchNodeOfRegexp) GetOrInsertChild(pattern *MatchPattern, newChildType MatchType) matchNode {
+	if pattern.IsAny {
+		child := n.anyChild
+		if child == nil {
+			child = newMatchNode(newChildType)
+			n.anyChild = child
+		}
+		return child
+	}
+
+	var children *[]regexpAndMatchNode
+	if pattern.IsInverse {
+		children = &n.inverseChildren
+	} else {
+		children = &n.children
+	}
+	for _, child := range *children {
+		if child.Regexp == pattern.compiledRegexp {
+			return child.MatchNode
+		}
+	}
+	newChild := newMatchNode(newChildType)
+	*children = append(*children, regexpAndMatchNode{
+		Regexp:    pattern.compiledRegexp,
+		MatchNode: newChild,
+	})
+	return newChild
+}
+
+func (n *matchNodeOfRegexp) FindChildren(children []matchNode, key MatchKey) []matchNode {
+	if key.IsAbsent {
+		return appendAnyChild(children, n.anyChild)
+	}
+
+	for _, child := range n.children {
+		if child.Regexp.MatchString(key.String) {
+			children = append(children, child.MatchNode)
+		}
+	}
+
+	for _, child := range n.inverseChildren {
+		if !child.Regexp.MatchString(key.String) {
+			children = append(children, child.MatchNode)
+		}
+	}
+
+	if child := n.anyChild; child != nil {
+		children = append(children, child)
+	}
+	return children
+}
+
+func (n *matchNodeOfRegexp) Edges() iter.Seq2[MatchPattern, matchNode] {
+	return func(yield func(MatchPattern, matchNode) bool) {
+		for _, child := range n.children {
+			if !yield(MatchPattern{Type: MatchRegexp, Regexp: child.Regexp.String(), compiledRegexp: child.Regexp}, child.MatchNode) {
+				return
+			}
+		}
+
+		for _, child := range n.inverseChildren {
+			if !yield(MatchPattern{Type: MatchRegexp, IsInverse: true, Regexp: child.Regexp.String(), compiledRegexp: child.Regexp}, child.MatchNode) {
+				return
+			}
+		}
+
+		if child := n.anyChild; child != nil {
+			yield(MatchPattern{Type: MatchRegexp, IsAny: true}, child)
+		}
+	}
+}
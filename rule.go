@@ -0,0 +1,40 @@
+package matchtree
+
+import "time"
+
+// RuleID identifies a rule added to a MatchTree. IDs are assigned in ascending order, starting
+// from 1, and are never reused within a tree.
+type RuleID uint64
+
+// ruleLocation records where the results of a rule are stored, for removal.
+type ruleLocation struct {
+	ValueIndex int // -1 if no result was added
+	Leaves     []matchNode
+	IsDisabled bool
+	Expiry     expiry
+	Labels     map[string]string
+}
+
+// expiry is the expiration time of a rule in Unix nanoseconds, if IsSet.
+type expiry struct {
+	UnixNano int64
+	IsSet    bool
+}
+
+func makeExpiry(expiresAt *time.Time) expiry {
+	if expiresAt == nil {
+		return expiry{}
+	}
+	return expiry{UnixNano: expiresAt.UnixNano(), IsSet: true}
+}
+
+// isExpiredAt reports whether the time now, in Unix nanoseconds, is at or after the expiry.
+func (e expiry) isExpiredAt(now int64) bool { return e.IsSet && now >= e.UnixNano }
+
+func (e expiry) toTime() *time.Time {
+	if !e.IsSet {
+		return nil
+	}
+	expiresAt := time.Unix(0, e.UnixNano)
+	return &expiresAt
+}
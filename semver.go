@@ -0,0 +1,353 @@
+package matchtree
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"iter"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version as defined by https://semver.org, with the build metadata dropped
+// since it does not take part in precedence.
+type Version struct {
+	Major uint64
+	Minor uint64
+	Patch uint64
+
+	// Prerelease holds the dot-separated pre-release identifiers, e.g. "rc.1", if any.
+	Prerelease string
+}
+
+// ParseVersion parses a semantic version, e.g. "1.2.3-rc.1+build.5", optionally prefixed with "v".
+func ParseVersion(s string) (Version, error) {
+	v, err := parseVersion(s)
+	if err != nil {
+		return Version{}, fmt.Errorf("matchtree: invalid version %q: %w", s, err)
+	}
+	return v, nil
+}
+
+func parseVersion(s string) (Version, error) {
+	s = strings.TrimPrefix(s, "v")
+	s, _, _ = strings.Cut(s, "+")
+	s, prerelease, hasPrerelease := strings.Cut(s, "-")
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return Version{}, errors.New("expected major.minor.patch")
+	}
+	var numbers [3]uint64
+	for i, part := range parts {
+		if !isNumericIdentifier(part) {
+			return Version{}, fmt.Errorf("invalid version number %q", part)
+		}
+		number, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return Version{}, err
+		}
+		numbers[i] = number
+	}
+	if hasPrerelease {
+		for _, identifier := range strings.Split(prerelease, ".") {
+			if identifier == "" || strings.Trim(identifier, "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz-") != "" {
+				return Version{}, fmt.Errorf("invalid pre-release identifier %q", identifier)
+			}
+		}
+	}
+	return Version{Major: numbers[0], Minor: numbers[1], Patch: numbers[2], Prerelease: prerelease}, nil
+}
+
+// isNumericIdentifier reports whether s is a number without leading zeros.
+func isNumericIdentifier(s string) bool {
+	if s == "" || (len(s) >= 2 && s[0] == '0') {
+		return false
+	}
+	return strings.Trim(s, "0123456789") == ""
+}
+
+// String returns the string representation of a Version, e.g. "1.2.3-rc.1".
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	return s
+}
+
+// IsZero reports whether the Version is the zero value, i.e. 0.0.0.
+func (v Version) IsZero() bool { return v == Version{} }
+
+// MarshalText implements encoding.TextMarshaler for Version.
+func (v Version) MarshalText() ([]byte, error) { return []byte(v.String()), nil }
+
+// UnmarshalText implements encoding.TextUnmarshaler for Version.
+func (v *Version) UnmarshalText(text []byte) error {
+	v2, err := ParseVersion(string(text))
+	if err != nil {
+		return err
+	}
+	*v = v2
+	return nil
+}
+
+// Compare returns -1, 0 or +1 if the Version precedes, equals or follows the other one,
+// by the precedence rules of semantic versioning.
+func (v Version) Compare(other Version) int {
+	if c := cmp.Compare(v.Major, other.Major); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(v.Minor, other.Minor); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(v.Patch, other.Patch); c != 0 {
+		return c
+	}
+	switch {
+	case v.Prerelease == other.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		// a release follows its pre-releases
+		return 1
+	case other.Prerelease == "":
+		return -1
+	}
+	x, y := strings.Split(v.Prerelease, "."), strings.Split(other.Prerelease, ".")
+	for i := 0; i < len(x) && i < len(y); i++ {
+		if c := compareIdentifiers(x[i], y[i]); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(x), len(y))
+}
+
+// compareIdentifiers compares pre-release identifiers, numeric ones numerically and preceding
+// alphanumeric ones.
+func compareIdentifiers(x, y string) int {
+	xIsNumeric, yIsNumeric := isNumericIdentifier(x), isNumericIdentifier(y)
+	switch {
+	case xIsNumeric && yIsNumeric:
+		if c := cmp.Compare(len(x), len(y)); c != 0 {
+			return c
+		}
+		return strings.Compare(x, y)
+	case xIsNumeric:
+		return -1
+	case yIsNumeric:
+		return 1
+	default:
+		return strings.Compare(x, y)
+	}
+}
+
+// VersionRange represents a range of Versions.
+// A nil Min or Max indicates the range is unbounded on that side.
+type VersionRange struct {
+	Min           *Version
+	MinIsExcluded bool
+	Max           *Version
+	MaxIsExcluded bool
+}
+
+// Contains checks if the Version is within the VersionRange.
+func (r VersionRange) Contains(v Version) bool {
+	if r.Min != nil {
+		c := v.Compare(*r.Min)
+		if c < 0 || (c == 0 && r.MinIsExcluded) {
+			return false
+		}
+	}
+	if r.Max != nil {
+		c := v.Compare(*r.Max)
+		if c > 0 || (c == 0 && r.MaxIsExcluded) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseVersionConstraint parses a version constraint into the VersionRanges it admits.
+// A constraint is a list of ranges separated by "||", each of which is a list of comparators
+// separated by spaces or commas that a Version must all satisfy, e.g. ">=1.2.0 <2.0.0 || 3.0.0".
+// A comparator is a full Version prefixed with one of the operators:
+//   - "=" or none for the Version only;
+//   - ">", ">=", "<" or "<=" for the Versions ordered so against it;
+//   - "^" for the Versions from it up to the next one incrementing its first non-zero number,
+//     e.g. "^1.2.3" for ">=1.2.3 <2.0.0" and "^0.2.3" for ">=0.2.3 <0.3.0";
+//   - "~" for the Versions from it up to the next minor one, e.g. "~1.2.3" for ">=1.2.3 <1.3.0".
+func ParseVersionConstraint(s string) ([]VersionRange, error) {
+	var ranges []VersionRange
+	for _, rangeString := range strings.Split(s, "||") {
+		comparators := strings.FieldsFunc(rangeString, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+		if len(comparators) == 0 {
+			return nil, fmt.Errorf("matchtree: invalid version constraint %q: empty range", s)
+		}
+		var range1 VersionRange
+		for _, comparator := range comparators {
+			if err := range1.restrict(comparator); err != nil {
+				return nil, fmt.Errorf("matchtree: invalid version constraint %q: %w", s, err)
+			}
+		}
+		ranges = append(ranges, range1)
+	}
+	return ranges, nil
+}
+
+// restrict narrows the VersionRange down to the Versions satisfying the comparator.
+func (r *VersionRange) restrict(comparator string) error {
+	operator := strings.TrimRight(comparator, "0123456789.-+ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz")
+	v, err := parseVersion(comparator[len(operator):])
+	if err != nil {
+		return fmt.Errorf("comparator %q: %w", comparator, err)
+	}
+	switch operator {
+	case "", "=":
+		r.restrictMin(v, false)
+		r.restrictMax(v, false)
+	case ">":
+		r.restrictMin(v, true)
+	case ">=":
+		r.restrictMin(v, false)
+	case "<":
+		r.restrictMax(v, true)
+	case "<=":
+		r.restrictMax(v, false)
+	case "^":
+		r.restrictMin(v, false)
+		switch {
+		case v.Major >= 1:
+			r.restrictMax(Version{Major: v.Major + 1}, true)
+		case v.Minor >= 1:
+			r.restrictMax(Version{Minor: v.Minor + 1}, true)
+		default:
+			r.restrictMax(Version{Patch: v.Patch + 1}, true)
+		}
+	case "~":
+		r.restrictMin(v, false)
+		r.restrictMax(Version{Major: v.Major, Minor: v.Minor + 1}, true)
+	default:
+		return fmt.Errorf("comparator %q: unknown operator %q", comparator, operator)
+	}
+	return nil
+}
+
+func (r *VersionRange) restrictMin(v Version, isExcluded bool) {
+	if r.Min != nil {
+		if c := v.Compare(*r.Min); c < 0 || (c == 0 && r.MinIsExcluded) {
+			return
+		}
+	}
+	r.Min, r.MinIsExcluded = &v, isExcluded
+}
+
+func (r *VersionRange) restrictMax(v Version, isExcluded bool) {
+	if r.Max != nil {
+		if c := v.Compare(*r.Max); c > 0 || (c == 0 && r.MaxIsExcluded) {
+			return
+		}
+	}
+	r.Max, r.MaxIsExcluded = &v, isExcluded
+}
+
+// containsVersion reports whether any of the VersionRanges contains the Version.
+func containsVersion(ranges []VersionRange, v Version) bool {
+	for _, r := range ranges {
+		if r.Contains(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// ----- match node of semver range -----
+
+// matchNodeOfSemverRange scans its children linearly like matchNodeOfRegexp, as version ranges
+// cannot be keyed.
+type matchNodeOfSemverRange struct {
+	dummyMatchNode
+
+	children        []versionRangesAndMatchNode
+	inverseChildren []versionRangesAndMatchNode
+	anyChild        matchNode
+}
+
+var _ matchNode = (*matchNodeOfSemverRange)(nil)
+
+type versionRangesAndMatchNode struct {
+	Constraint    string
+	VersionRanges []VersionRange
+	MatchNode     matchNode
+}
+
+func (n *matchNodeOfSemverRange) GetOrInsertChild(pattern *MatchPattern, newChildType MatchType) matchNode {
+	if pattern.IsAny {
+		child := n.anyChild
+		if child == nil {
+			child = newMatchNode(newChildType)
+			n.anyChild = child
+		}
+		return child
+	}
+
+	var children *[]versionRangesAndMatchNode
+	if pattern.IsInverse {
+		children = &n.inverseChildren
+	} else {
+		children = &n.children
+	}
+	for _, child := range *children {
+		if child.Constraint == pattern.VersionConstraint {
+			return child.MatchNode
+		}
+	}
+	newChild := newMatchNode(newChildType)
+	*children = append(*children, versionRangesAndMatchNode{
+		Constraint:    pattern.VersionConstraint,
+		VersionRanges: pattern.versionRanges,
+		MatchNode:     newChild,
+	})
+	return newChild
+}
+
+func (n *matchNodeOfSemverRange) FindChildren(children []matchNode, key MatchKey) []matchNode {
+	if key.IsAbsent {
+		return appendAnyChild(children, n.anyChild)
+	}
+
+	for _, child := range n.children {
+		if containsVersion(child.VersionRanges, key.Version) {
+			children = append(children, child.MatchNode)
+		}
+	}
+
+	for _, child := range n.inverseChildren {
+		if !containsVersion(child.VersionRanges, key.Version) {
+			children = append(children, child.MatchNode)
+		}
+	}
+
+	if child := n.anyChild; child != nil {
+		children = append(children, child)
+	}
+	return children
+}
+
+func (n *matchNodeOfSemverRange) Edges() iter.Seq2[MatchPattern, matchNode] {
+	return func(yield func(MatchPattern, matchNode) bool) {
+		for _, child := range n.children {
+			if !yield(MatchPattern{Type: MatchSemverRange, VersionConstraint: child.Constraint, versionRanges: child.VersionRanges}, child.MatchNode) {
+				return
+			}
+		}
+
+		for _, child := range n.inverseChildren {
+			if !yield(MatchPattern{Type: MatchSemverRange, IsInverse: true, VersionConstraint: child.Constraint, versionRanges: child.VersionRanges}, child.MatchNode) {
+				return
+			}
+		}
+
+		if child := n.anyChild; child != nil {
+			yield(MatchPattern{Type: MatchSemverRange, IsAny: true}, child)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package matchtree
+
+import (
+	"bytes"
+	"cmp"
+	"slices"
+)
+
+// ShadowReport describes a rule shadowed by another rule: every key matching the shadowed rule
+// also matches the shadowing one, which ranks before it, so the shadowed rule's value never comes
+// first in the results of a search.
+// Rules are identified by the positions of their values among the values added (see NodeResult).
+type ShadowReport[T any] struct {
+	ValueIndex int
+	Value      T
+	Priority   int64
+
+	ShadowingValueIndex int
+	ShadowingValue      T
+	ShadowingPriority   int64
+
+	// IsDuplicate indicates whether both rules reach exactly the same leaf nodes.
+	IsDuplicate bool
+}
+
+// FindShadowedRules reports the rules shadowed by other rules, in the order of the values of the
+// shadowed rules, each by the first-ranking shadowing rule.
+// The check is conservative: per dimension, a condition is known to cover another one if it is
+// the any condition, the same condition, an inverse condition not excluding the other's value, an
+// inverse condition excluding a subset of the other's excluded values, or an integer interval
+// containing the other's one. Coverage spread over multiple rules is not detected.
+// Disabled rules, like the identical rules hidden by WithDedupIdenticalRules, are left out, as
+// they take no part in searches.
+func (t *MatchTree[T]) FindShadowedRules() []ShadowReport[T] {
+	if t.root == nil {
+		return nil
+	}
+
+	type rulePaths struct {
+		Result matchResult
+		Leaves []matchNode
+		Paths  [][]MatchPattern
+	}
+	var rules []*rulePaths
+	rulesByValueIndex := make(map[int]*rulePaths)
+	patterns := make([]MatchPattern, len(t.types))
+	var walkNode func(node matchNode, depth int)
+	walkNode = func(node matchNode, depth int) {
+		if depth == len(t.types) {
+			// leaf
+			for _, result := range node.GetResults() {
+				if !result.isEnabled() {
+					continue
+				}
+				rule, ok := rulesByValueIndex[result.ValueIndex]
+				if !ok {
+					rule = &rulePaths{Result: result}
+					rulesByValueIndex[result.ValueIndex] = rule
+					rules = append(rules, rule)
+				}
+				rule.Leaves = append(rule.Leaves, node)
+				rule.Paths = append(rule.Paths, slices.Clone(patterns))
+			}
+			return
+		}
+
+		// non-leaf
+		for pattern, child := range node.Edges() {
+			patterns[depth] = pattern
+			walkNode(child, depth+1)
+		}
+	}
+	walkNode(t.root, 0)
+
+	slices.SortFunc(rules, func(x, y *rulePaths) int { return compareResults(x.Result, y.Result) })
+	coversPaths := func(x, y *rulePaths) bool {
+		for _, path := range y.Paths {
+			if !slices.ContainsFunc(x.Paths, func(path2 []MatchPattern) bool { return coversPath(path2, path) }) {
+				return false
+			}
+		}
+		return true
+	}
+	var reports []ShadowReport[T]
+	for i, rule := range rules {
+		for _, shadowingRule := range rules[:i] {
+			if !coversPaths(shadowingRule, rule) {
+				continue
+			}
+			reports = append(reports, ShadowReport[T]{
+				ValueIndex:          rule.Result.ValueIndex,
+				Value:               t.values[rule.Result.ValueIndex],
+				Priority:            rule.Result.Priority,
+				ShadowingValueIndex: shadowingRule.Result.ValueIndex,
+				ShadowingValue:      t.values[shadowingRule.Result.ValueIndex],
+				ShadowingPriority:   shadowingRule.Result.Priority,
+				IsDuplicate:         sameLeaves(shadowingRule.Leaves, rule.Leaves),
+			})
+			break
+		}
+	}
+	slices.SortFunc(reports, func(x, y ShadowReport[T]) int { return cmp.Compare(x.ValueIndex, y.ValueIndex) })
+	return reports
+}
+
+func coversPath(x, y []MatchPattern) bool {
+	for i := range x {
+		if !coversPattern(&x[i], &y[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// coversPattern reports whether every value the edge pattern y admits is known to be admitted by
+// the edge pattern x. Exact edge patterns hold a single value or interval, or a regexp or version
+// constraint.
+func coversPattern(x, y *MatchPattern) bool {
+	switch {
+	case x.IsAny:
+		return true
+	case y.IsAny:
+		return false
+	case x.IsInverse && y.IsInverse:
+		switch x.Type {
+		case MatchString, MatchEnum:
+			return isSubset(x.Strings, y.Strings)
+		case MatchInteger:
+			return isSubset(x.Integers, y.Integers)
+		case MatchIntegerInterval, MatchNumeric:
+			return isSubsetFunc(x.IntegerIntervals, y.IntegerIntervals, IntegerInterval.Equals)
+		case MatchNumberInterval:
+			return isSubsetFunc(x.NumberIntervals, y.NumberIntervals, NumberInterval.Equals)
+		case MatchRegexp:
+			return x.Regexp == y.Regexp
+		case MatchSemverRange:
+			return x.VersionConstraint == y.VersionConstraint
+		case MatchGlob:
+			return x.Glob == y.Glob
+		case MatchBytes:
+			return isSubsetFunc(x.ByteSlices, y.ByteSlices, bytes.Equal)
+		default:
+			return false
+		}
+	case x.IsInverse:
+		switch x.Type {
+		case MatchString, MatchEnum:
+			return !slices.Contains(x.Strings, y.Strings[0])
+		case MatchInteger:
+			return !slices.Contains(x.Integers, y.Integers[0])
+		case MatchIntegerInterval:
+			return !slices.ContainsFunc(x.IntegerIntervals, y.IntegerIntervals[0].Overlaps)
+		case MatchNumeric:
+			return !slices.ContainsFunc(x.IntegerIntervals, numericEdgeInterval(y).Overlaps)
+		case MatchBytes:
+			return !slices.ContainsFunc(x.ByteSlices, func(v []byte) bool { return bytes.Equal(v, y.ByteSlices[0]) })
+		default:
+			return false
+		}
+	case y.IsInverse:
+		return false
+	default:
+		switch x.Type {
+		case MatchString, MatchEnum:
+			return x.Strings[0] == y.Strings[0]
+		case MatchInteger:
+			return x.Integers[0] == y.Integers[0]
+		case MatchIntegerInterval:
+			return x.IntegerIntervals[0].ContainsInterval(y.IntegerIntervals[0])
+		case MatchNumeric:
+			return numericEdgeInterval(x).ContainsInterval(numericEdgeInterval(y))
+		case MatchNumberInterval:
+			return x.NumberIntervals[0].ContainsInterval(y.NumberIntervals[0])
+		case MatchRegexp:
+			return x.Regexp == y.Regexp
+		case MatchSemverRange:
+			return x.VersionConstraint == y.VersionConstraint
+		case MatchGlob:
+			return x.Glob == y.Glob
+		case MatchBytes:
+			return bytes.Equal(x.ByteSlices[0], y.ByteSlices[0])
+		default:
+			return slices.Equal(x.Strings, y.Strings)
+		}
+	}
+}
+
+// numericEdgeInterval returns the single integer or interval of an exact MatchNumeric edge pattern
+// as an interval.
+func numericEdgeInterval(p *MatchPattern) IntegerInterval {
+	if len(p.Integers) >= 1 {
+		return ClosedInterval(p.Integers[0], p.Integers[0])
+	}
+	return p.IntegerIntervals[0]
+}
+
+func isSubset[E comparable](x, y []E) bool {
+	for _, v := range x {
+		if !slices.Contains(y, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func isSubsetFunc[E any](x, y []E, eq func(E, E) bool) bool {
+	for _, v := range x {
+		if !slices.ContainsFunc(y, func(v2 E) bool { return eq(v, v2) }) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameLeaves(x, y []matchNode) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for _, leaf := range y {
+		if !slices.Contains(x, leaf) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,113 @@
+package matchtree_test
+
+import (
+	"testing"
+
+	. "github.com/roy2220/matchtree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchTree_FindShadowedRules(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString, MatchIntegerInterval})
+	assert.Nil(t, matchTree.FindShadowedRules())
+
+	err := matchTree.AddRules([]MatchRule[string]{
+		{
+			Patterns: []MatchPattern{StringsPattern("a", "b"), IntegerIntervalPattern(IntegerInterval{Min: Int64Ptr(0), Max: Int64Ptr(10)})},
+			Value:    "rule_1",
+			Priority: 3,
+		},
+		{
+			// duplicate of rule_1 with a lower priority
+			Patterns: []MatchPattern{StringsPattern("b", "a"), IntegerIntervalPattern(IntegerInterval{Min: Int64Ptr(0), Max: Int64Ptr(10)})},
+			Value:    "rule_2",
+			Priority: 2,
+		},
+		{
+			// covered by rule_1 via a narrower interval
+			Patterns: []MatchPattern{StringsPattern("a"), IntegerIntervalPattern(IntegerInterval{Min: Int64Ptr(2), Max: Int64Ptr(5)})},
+			Value:    "rule_3",
+			Priority: 1,
+		},
+		{
+			// partially covered by rule_1 only
+			Patterns: []MatchPattern{StringsPattern("a", "c"), IntegerIntervalPattern(IntegerInterval{Min: Int64Ptr(2), Max: Int64Ptr(5)})},
+			Value:    "rule_4",
+			Priority: 1,
+		},
+		{
+			Patterns: []MatchPattern{InverseStringsPattern("x"), AnyPattern(MatchIntegerInterval)},
+			Value:    "rule_5",
+			Priority: 0,
+		},
+		{
+			// covered by rule_5, which was added earlier
+			Patterns: []MatchPattern{StringsPattern("c"), InverseIntegerIntervalPattern(IntegerInterval{Max: Int64Ptr(0)})},
+			Value:    "rule_6",
+			Priority: 0,
+		},
+		{
+			// ranks before rule_5 by priority
+			Patterns: []MatchPattern{StringsPattern("d"), AnyPattern(MatchIntegerInterval)},
+			Value:    "rule_7",
+			Priority: 1,
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []ShadowReport[string]{
+		{
+			ValueIndex:          1,
+			Value:               "rule_2",
+			Priority:            2,
+			ShadowingValueIndex: 0,
+			ShadowingValue:      "rule_1",
+			ShadowingPriority:   3,
+			IsDuplicate:         true,
+		},
+		{
+			ValueIndex:          2,
+			Value:               "rule_3",
+			Priority:            1,
+			ShadowingValueIndex: 0,
+			ShadowingValue:      "rule_1",
+			ShadowingPriority:   3,
+		},
+		{
+			ValueIndex:          5,
+			Value:               "rule_6",
+			Priority:            0,
+			ShadowingValueIndex: 4,
+			ShadowingValue:      "rule_5",
+			ShadowingPriority:   0,
+		},
+	}, matchTree.FindShadowedRules())
+}
+
+func TestMatchTree_FindShadowedRules_DisabledRules(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString})
+	_, err := matchTree.AddRule(MatchRule[string]{Patterns: []MatchPattern{StringsPattern("a")}, Value: "a"})
+	require.NoError(t, err)
+	id, err := matchTree.AddRule(MatchRule[string]{Patterns: []MatchPattern{AnyPattern(MatchString)}, Value: "catchall", Priority: 1})
+	require.NoError(t, err)
+	require.NoError(t, matchTree.SetRuleEnabled(id, false))
+
+	// a disabled rule shadows nothing
+	assert.Nil(t, matchTree.FindShadowedRules())
+	values, err := matchTree.Search([]MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, values)
+
+	require.NoError(t, matchTree.SetRuleEnabled(id, true))
+	assert.Equal(t, []ShadowReport[string]{
+		{
+			ValueIndex:          0,
+			Value:               "a",
+			Priority:            0,
+			ShadowingValueIndex: 1,
+			ShadowingValue:      "catchall",
+			ShadowingPriority:   1,
+		},
+	}, matchTree.FindShadowedRules())
+}
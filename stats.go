@@ -0,0 +1,77 @@
+package matchtree
+
+// TreeStats holds metrics about the structure of a MatchTree.
+type TreeStats struct {
+	// MaxDepth is the depth of the deepest node, where the root is at depth 0.
+	MaxDepth int
+	// NodeCount is the total number of nodes, including leaves.
+	NodeCount int
+	// NodeCountsPerLevel holds the number of nodes at each depth.
+	NodeCountsPerLevel []int
+	// LeafCount is the number of leaf nodes.
+	LeafCount int
+	// ResultCount is the total number of results stored in leaf nodes.
+	// A rule with multi-value patterns is expanded into one result per combination of values.
+	ResultCount int
+	// MaxFanOut is the maximum number of children of any node.
+	MaxFanOut int
+}
+
+// Stats traverses the MatchTree once and returns metrics about its structure.
+func (t *MatchTree[T]) Stats() TreeStats {
+	var stats TreeStats
+	if t.root == nil {
+		return stats
+	}
+
+	var visitNode func(node matchNode, depth int)
+	visitNode = func(node matchNode, depth int) {
+		stats.MaxDepth = max(stats.MaxDepth, depth)
+		stats.NodeCount++
+		if depth == len(stats.NodeCountsPerLevel) {
+			stats.NodeCountsPerLevel = append(stats.NodeCountsPerLevel, 0)
+		}
+		stats.NodeCountsPerLevel[depth]++
+		if depth == len(t.types) {
+			// leaf
+			stats.LeafCount++
+			stats.ResultCount += len(node.GetResults())
+			return
+		}
+
+		// non-leaf
+		fanOut := 0
+		for _, child := range node.Edges() {
+			fanOut++
+			visitNode(child, depth+1)
+		}
+		stats.MaxFanOut = max(stats.MaxFanOut, fanOut)
+	}
+	visitNode(t.root, 0)
+	return stats
+}
+
+// SearchStats holds the counters of a search done by SearchWithStats.
+type SearchStats struct {
+	// NodesVisited is the number of non-leaf nodes searched for the children matching the keys,
+	// counting a node reached through several paths once per path.
+	NodesVisited int
+	// ChildrenYielded is the total number of children found by the visited nodes, including
+	// leaf nodes.
+	ChildrenYielded int
+	// MaxFrontierSize is the maximum number of nodes reached at the same depth.
+	MaxFrontierSize int
+	// UsedSingleResultFastPath reports whether the leaf nodes reached held a single result,
+	// so there were no results to merge.
+	UsedSingleResultFastPath bool
+}
+
+// SearchWithStats is like Search but also returns the counters of the search, for profiling
+// whether the tree is worth freezing or its rules restructuring.
+func (t *MatchTree[T]) SearchWithStats(keys []MatchKey) ([]T, SearchStats, error) {
+	var stats SearchStats
+	options := defaultSearchOptions
+	options.Stats = &stats
+	values, err := t.search(nil, keys, options)
+	return values, stats, err
+}
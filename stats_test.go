@@ -0,0 +1,110 @@
+package matchtree_test
+
+import (
+	"testing"
+
+	. "github.com/roy2220/matchtree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchTree_Stats(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString, MatchInteger})
+	assert.Equal(t, TreeStats{}, matchTree.Stats())
+
+	err := matchTree.AddRules([]MatchRule[string]{
+		{
+			Patterns: []MatchPattern{
+				{Type: MatchString, Strings: []string{"a", "b", "c"}},
+				{Type: MatchInteger, Integers: []int64{1, 2}},
+			},
+			Value: "rule_1",
+		},
+		{
+			Patterns: []MatchPattern{
+				{Type: MatchString, Strings: []string{"a"}},
+				{Type: MatchInteger, IsAny: true},
+			},
+			Value: "rule_2",
+		},
+		{
+			Patterns: []MatchPattern{
+				{Type: MatchString, IsInverse: true, Strings: []string{"a"}},
+				{Type: MatchInteger, Integers: []int64{1}},
+			},
+			Value: "rule_3",
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, TreeStats{
+		MaxDepth:           2,
+		NodeCount:          13,
+		NodeCountsPerLevel: []int{1, 4, 8},
+		LeafCount:          8,
+		ResultCount:        8,
+		MaxFanOut:          4,
+	}, matchTree.Stats())
+}
+
+func TestMatchTree_SearchWithStats(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString, MatchInteger})
+	values, stats, err := matchTree.SearchWithStats([]MatchKey{StringKey("a"), IntegerKey(1)})
+	require.NoError(t, err)
+	assert.Nil(t, values)
+	assert.Equal(t, SearchStats{}, stats)
+
+	require.NoError(t, matchTree.AddRules([]MatchRule[string]{
+		{Patterns: []MatchPattern{StringsPattern("a", "b"), IntegersPattern(1, 2)}, Value: "rule_1"},
+		{Patterns: []MatchPattern{StringsPattern("a"), AnyPattern(MatchInteger)}, Value: "rule_2"},
+		{Patterns: []MatchPattern{InverseStringsPattern("a"), IntegersPattern(1)}, Value: "rule_3"},
+	}))
+
+	values, stats, err = matchTree.SearchWithStats([]MatchKey{StringKey("a"), IntegerKey(1)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_1", "rule_2"}, values)
+	assert.Equal(t, SearchStats{
+		NodesVisited:    2,
+		ChildrenYielded: 3,
+		MaxFrontierSize: 2,
+	}, stats)
+
+	values, stats, err = matchTree.SearchWithStats([]MatchKey{StringKey("b"), IntegerKey(2)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_1"}, values)
+	assert.Equal(t, SearchStats{
+		NodesVisited:             3,
+		ChildrenYielded:          3,
+		MaxFrontierSize:          2,
+		UsedSingleResultFastPath: true,
+	}, stats)
+
+	_, _, err = matchTree.SearchWithStats([]MatchKey{StringKey("a")})
+	assert.Error(t, err)
+}
+
+func TestMatchTree_SearchWithStats_SingleResultAfterEmptyLeaf(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString, MatchInteger})
+	var ids []RuleID
+	for _, rule := range []MatchRule[string]{
+		{Patterns: []MatchPattern{StringsPattern("a"), IntegersPattern(1)}, Value: "rule_1"},
+		{Patterns: []MatchPattern{StringsPattern("a"), AnyPattern(MatchInteger)}, Value: "rule_2"},
+		{Patterns: []MatchPattern{AnyPattern(MatchString), IntegersPattern(1)}, Value: "rule_3"},
+	} {
+		id, err := matchTree.AddRule(rule)
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+
+	// the leaf of rule_1, reached first, is left without results
+	require.NoError(t, matchTree.RemoveRuleByID(ids[0]))
+	require.NoError(t, matchTree.RemoveRuleByID(ids[1]))
+	values, stats, err := matchTree.SearchWithStats([]MatchKey{StringKey("a"), IntegerKey(1)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rule_3"}, values)
+	assert.True(t, stats.UsedSingleResultFastPath)
+	value, ok, err := matchTree.SearchFirstMatch([]MatchKey{StringKey("a"), IntegerKey(1)})
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "rule_3", value)
+}
@@ -0,0 +1,147 @@
+package matchtree
+
+import (
+	"iter"
+	"slices"
+)
+
+// ----- match node of string -----
+
+type matchNodeOfString struct {
+	dummyMatchNode
+
+	children            map[string]matchNode
+	inverseChildren     []matchNodeWithRefCount
+	inverseChildIndexes map[string][]int
+	anyChild            matchNode
+}
+
+var _ matchNode = (*matchNodeOfString)(nil)
+
+func (n *matchNodeOfString) GetOrInsertChild(pattern *MatchPattern, newChildType MatchType) matchNode {
+	if pattern.IsAny {
+		child := n.anyChild
+		if child == nil {
+			child = newMatchNode(newChildType)
+			n.anyChild = child
+		}
+		return child
+	}
+
+	if pattern.IsInverse {
+		refCounts := make([]int, len(n.inverseChildren))
+		for _, v := range pattern.Strings {
+			for _, childIndex := range n.inverseChildIndexes[v] {
+				refCounts[childIndex]++
+			}
+		}
+		maxRefCount := len(pattern.Strings)
+		for childIndex, refCount := range refCounts {
+			if refCount == maxRefCount && n.inverseChildren[childIndex].MaxRefCount == maxRefCount {
+				return n.inverseChildren[childIndex].MatchNode
+			}
+		}
+		newChild := newMatchNode(newChildType)
+		newChildIndex := len(n.inverseChildren)
+		n.inverseChildren = append(n.inverseChildren, matchNodeWithRefCount{
+			MatchNode:   newChild,
+			MaxRefCount: maxRefCount,
+		})
+		inverseChildIndexes := n.inverseChildIndexes
+		if inverseChildIndexes == nil {
+			inverseChildIndexes = make(map[string][]int, maxRefCount)
+			n.inverseChildIndexes = inverseChildIndexes
+		}
+		for _, v := range pattern.Strings {
+			inverseChildIndexes[v] = append(inverseChildIndexes[v], newChildIndex)
+		}
+		return newChild
+	}
+
+	children := n.children
+	if children == nil {
+		children = make(map[string]matchNode, 1)
+		n.children = children
+	}
+	child, ok := children[pattern.currentString]
+	if !ok {
+		child = newMatchNode(newChildType)
+		children[pattern.currentString] = child
+	}
+	return child
+}
+
+func (n *matchNodeOfString) reserveChildren(numberOfChildren int) {
+	if n.children == nil {
+		n.children = make(map[string]matchNode, numberOfChildren)
+	}
+}
+
+func (n *matchNodeOfString) FindChildren(children []matchNode, key MatchKey) []matchNode {
+	if key.IsAbsent {
+		return appendAnyChild(children, n.anyChild)
+	}
+
+	if len(key.Strings) >= 1 {
+		return n.findChildrenOfStrings(children, key.Strings)
+	}
+
+	if child, ok := n.children[key.String]; ok {
+		children = append(children, child)
+	}
+
+	if len(n.inverseChildren) >= 1 {
+		children = appendInverseChildren(children, n.inverseChildren, n.inverseChildIndexes[key.String])
+	}
+
+	if child := n.anyChild; child != nil {
+		children = append(children, child)
+	}
+	return children
+}
+
+func (n *matchNodeOfString) findChildrenOfStrings(children []matchNode, keyStrings []string) []matchNode {
+	for i, v := range keyStrings {
+		if slices.Contains(keyStrings[:i], v) {
+			continue
+		}
+		if child, ok := n.children[v]; ok {
+			children = append(children, child)
+		}
+	}
+
+	if len(n.inverseChildren) >= 1 {
+		children = appendInverseChildrenOfValues(children, n.inverseChildren, n.inverseChildIndexes, keyStrings)
+	}
+
+	if child := n.anyChild; child != nil {
+		children = append(children, child)
+	}
+	return children
+}
+
+func (n *matchNodeOfString) Edges() iter.Seq2[MatchPattern, matchNode] {
+	return func(yield func(MatchPattern, matchNode) bool) {
+		for _, v := range sortedKeys(n.children) {
+			if !yield(MatchPattern{Type: MatchString, Strings: []string{v}}, n.children[v]) {
+				return
+			}
+		}
+
+		inverseValues := make([][]string, len(n.inverseChildren))
+		for _, v := range sortedKeys(n.inverseChildIndexes) {
+			for _, childIndex := range n.inverseChildIndexes[v] {
+				inverseValues[childIndex] = append(inverseValues[childIndex], v)
+			}
+		}
+		for childIndex, child := range n.inverseChildren {
+			if !yield(MatchPattern{Type: MatchString, IsInverse: true, Strings: inverseValues[childIndex]}, child.MatchNode) {
+				return
+			}
+		}
+
+		if child := n.anyChild; child != nil {
+			yield(MatchPattern{Type: MatchString, IsAny: true}, child)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package matchtree
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// KeysFromStruct builds the match keys for a MatchTree with the specified sequence of MatchTypes
+// from the fields of the struct v, or of the struct v points to, tagged with the index of the
+// MatchType they are keys for, e.g.
+//
+//	type Request struct {
+//		Method string   `matchtree:"0"`
+//		Tags   []string `matchtree:"1"`
+//		Port   *int     `matchtree:"2"` // nil for an absent key
+//	}
+//
+// Each MatchType must be given exactly one field, whose type is converted to a key as follows:
+//
+//   - MatchString, MatchRegexp, MatchGlob: a string, or a slice of strings for a multi-valued MatchString key
+//   - MatchInteger, MatchEnum: an integer, or a slice of integers for a multi-valued key
+//   - MatchIntegerInterval, MatchNumeric: an integer
+//   - MatchNumberInterval: a floating-point number or an integer
+//   - MatchBytes: a byte slice
+//   - MatchSemverRange: a Version
+//
+// A field may also be a pointer to any of these types, which gives an absent key when it is nil.
+// Fields of embedded structs are included as if they were fields of v. The fields of each struct
+// type are looked up once, and custom match types are not supported.
+func KeysFromStruct(v any, types []MatchType) ([]MatchKey, error) {
+	value := reflect.ValueOf(v)
+	if value.Kind() == reflect.Pointer && !value.IsNil() {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("matchtree: %T is not a struct", v)
+	}
+	fields, err := structKeyFieldsOf(value.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fields) > len(types) {
+		field := fields[len(fields)-1]
+		return nil, fmt.Errorf("matchtree: field %s of %v for match type #%d beyond %d match types", field.Name, value.Type(), len(fields), len(types))
+	}
+	keys := make([]MatchKey, len(types))
+	for i, type1 := range types {
+		if i >= len(fields) || fields[i].Index == nil {
+			return nil, fmt.Errorf("matchtree: no field of %v for match type #%d", value.Type(), i+1)
+		}
+		field := fields[i]
+		fieldValue, err := value.FieldByIndexErr(field.Index)
+		if err != nil {
+			// a nil embedded pointer
+			keys[i] = AbsentKey(type1)
+			continue
+		}
+		key, err := keyFromValue(fieldValue, type1)
+		if err != nil {
+			return nil, wrapError(err, "field %s of %v for match type #%d", field.Name, value.Type(), i+1)
+		}
+		keys[i] = key
+	}
+	return keys, nil
+}
+
+// structKeyField is a field of a struct tagged for KeysFromStruct.
+type structKeyField struct {
+	Name  string
+	Index []int // nil if no field is tagged for the MatchType
+}
+
+// structKeyFields caches the tagged fields of the struct types, indexed by MatchType index.
+var structKeyFields sync.Map // map[reflect.Type][]structKeyField
+
+func structKeyFieldsOf(type1 reflect.Type) ([]structKeyField, error) {
+	if fields, ok := structKeyFields.Load(type1); ok {
+		return fields.([]structKeyField), nil
+	}
+
+	var fields []structKeyField
+	for _, field := range reflect.VisibleFields(type1) {
+		tag, ok := field.Tag.Lookup("matchtree")
+		if !ok {
+			continue
+		}
+		i, err := strconv.Atoi(tag)
+		if err != nil || i < 0 {
+			return nil, fmt.Errorf("matchtree: invalid tag %q of field %s of %v", tag, field.Name, type1)
+		}
+		if !field.IsExported() {
+			return nil, fmt.Errorf("matchtree: unexported field %s of %v", field.Name, type1)
+		}
+		for len(fields) <= i {
+			fields = append(fields, structKeyField{})
+		}
+		if fields[i].Index != nil {
+			return nil, fmt.Errorf("matchtree: both fields %s and %s of %v for match type #%d", fields[i].Name, field.Name, type1, i+1)
+		}
+		fields[i] = structKeyField{Name: field.Name, Index: field.Index}
+	}
+	structKeyFields.Store(type1, fields)
+	return fields, nil
+}
+
+var versionType = reflect.TypeFor[Version]()
+
+func keyFromValue(value reflect.Value, type1 MatchType) (MatchKey, error) {
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return AbsentKey(type1), nil
+		}
+		value = value.Elem()
+	}
+
+	key := MatchKey{Type: type1}
+	switch type1 {
+	case MatchString, MatchRegexp, MatchGlob:
+		switch {
+		case value.Kind() == reflect.String:
+			key.String = value.String()
+			return key, nil
+		case type1 == MatchString && value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.String:
+			key.Strings = make([]string, value.Len())
+			for i := range key.Strings {
+				key.Strings[i] = value.Index(i).String()
+			}
+			return key, nil
+		}
+	case MatchInteger, MatchEnum, MatchIntegerInterval, MatchNumeric:
+		if x, ok, err := integerOfValue(value); ok {
+			key.Integer = x
+			return key, err
+		}
+		if (type1 == MatchInteger || type1 == MatchEnum) && value.Kind() == reflect.Slice {
+			if _, ok, _ := integerOfValue(reflect.Zero(value.Type().Elem())); ok {
+				key.Integers = make([]int64, value.Len())
+				for i := range key.Integers {
+					x, _, err := integerOfValue(value.Index(i))
+					if err != nil {
+						return MatchKey{}, err
+					}
+					key.Integers[i] = x
+				}
+				return key, nil
+			}
+		}
+	case MatchNumberInterval:
+		switch value.Kind() {
+		case reflect.Float32, reflect.Float64:
+			key.Number = value.Float()
+			return key, nil
+		}
+		if x, ok, err := integerOfValue(value); ok {
+			key.Number = float64(x)
+			return key, err
+		}
+	case MatchBytes:
+		if value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Uint8 {
+			key.Bytes = value.Bytes()
+			return key, nil
+		}
+	case MatchSemverRange:
+		if value.Type() == versionType {
+			key.Version = value.Interface().(Version)
+			return key, nil
+		}
+	}
+	return MatchKey{}, fmt.Errorf("%v cannot be a %v key", value.Type(), type1)
+}
+
+// integerOfValue returns the integer of the value if it is of an integer kind, which fails for
+// unsigned integers out of the range of int64.
+func integerOfValue(value reflect.Value) (int64, bool, error) {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int(), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		x := value.Uint()
+		if x > math.MaxInt64 {
+			return 0, true, fmt.Errorf("integer %d out of range", x)
+		}
+		return int64(x), true, nil
+	default:
+		return 0, false, nil
+	}
+}
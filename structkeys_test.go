@@ -0,0 +1,135 @@
+package matchtree_test
+
+import (
+	"testing"
+
+	. "github.com/roy2220/matchtree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type requestHeader struct {
+	Service string `matchtree:"0"`
+}
+
+type request struct {
+	requestHeader
+	Tags    []string `matchtree:"1"`
+	Port    *uint16  `matchtree:"2"`
+	Age     int32    `matchtree:"3"`
+	Height  float32  `matchtree:"4"`
+	Payload []byte   `matchtree:"5"`
+	Note    string
+}
+
+var requestTypes = []MatchType{MatchString, MatchString, MatchInteger, MatchIntegerInterval, MatchNumberInterval, MatchBytes}
+
+func TestKeysFromStruct(t *testing.T) {
+	port := uint16(443)
+	keys, err := KeysFromStruct(&request{
+		requestHeader: requestHeader{Service: "api"},
+		Tags:          []string{"beta", "internal"},
+		Port:          &port,
+		Age:           35,
+		Height:        170.5,
+		Payload:       []byte("raw"),
+	}, requestTypes)
+	require.NoError(t, err)
+	assert.Equal(t, []MatchKey{
+		StringKey("api"),
+		StringsKey("beta", "internal"),
+		IntegerKey(443),
+		IntegerIntervalKey(35),
+		NumberKey(170.5),
+		BytesKey([]byte("raw")),
+	}, keys)
+
+	keys, err = KeysFromStruct(request{}, requestTypes)
+	require.NoError(t, err)
+	assert.Equal(t, AbsentKey(MatchInteger), keys[2])
+
+	matchTree := NewMatchTree[string](requestTypes)
+	_, err = matchTree.AddRule(MatchRule[string]{
+		Patterns: []MatchPattern{
+			StringsPattern("api"),
+			StringsPattern("internal"),
+			AnyPattern(MatchInteger),
+			IntegerIntervalPattern(ClosedInterval(18, 65)),
+			AnyPattern(MatchNumberInterval),
+			AnyPattern(MatchBytes),
+		},
+		Value: "staff",
+	})
+	require.NoError(t, err)
+	keys, err = KeysFromStruct(request{requestHeader: requestHeader{Service: "api"}, Tags: []string{"internal"}, Age: 30}, requestTypes)
+	require.NoError(t, err)
+	values, err := matchTree.Search(keys)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"staff"}, values)
+}
+
+func TestKeysFromStruct_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       any
+		types   []MatchType
+		wantErr string
+	}{
+		{
+			name:    "not a struct",
+			v:       "api",
+			types:   []MatchType{MatchString},
+			wantErr: "matchtree: string is not a struct",
+		},
+		{
+			name:    "missing field",
+			v:       request{},
+			types:   append(requestTypes, MatchString),
+			wantErr: "matchtree: no field of matchtree_test.request for match type #7",
+		},
+		{
+			name:    "extra field",
+			v:       request{},
+			types:   []MatchType{MatchString},
+			wantErr: "matchtree: field Payload of matchtree_test.request for match type #6 beyond 1 match types",
+		},
+		{
+			name:    "mismatched type",
+			v:       request{},
+			types:   []MatchType{MatchString, MatchString, MatchInteger, MatchIntegerInterval, MatchNumberInterval, MatchString},
+			wantErr: "matchtree: field Payload of matchtree_test.request for match type #6: []uint8 cannot be a STRING key",
+		},
+		{
+			name: "duplicate fields",
+			v: struct {
+				A string `matchtree:"0"`
+				B string `matchtree:"0"`
+			}{},
+			types:   []MatchType{MatchString},
+			wantErr: "matchtree: both fields A and B of struct { A string \"matchtree:\\\"0\\\"\"; B string \"matchtree:\\\"0\\\"\" } for match type #1",
+		},
+		{
+			name: "invalid tag",
+			v: struct {
+				A string `matchtree:"first"`
+			}{},
+			types:   []MatchType{MatchString},
+			wantErr: "matchtree: invalid tag \"first\" of field A of struct { A string \"matchtree:\\\"first\\\"\" }",
+		},
+		{
+			name: "integer out of range",
+			v: struct {
+				A uint64 `matchtree:"0"`
+			}{A: 1 << 63},
+			types:   []MatchType{MatchInteger},
+			wantErr: "matchtree: field A of struct { A uint64 \"matchtree:\\\"0\\\"\" } for match type #1: integer 9223372036854775808 out of range",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := KeysFromStruct(tt.v, tt.types)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
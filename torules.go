@@ -0,0 +1,169 @@
+package matchtree
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ToRules reconstructs a list of MatchRules equivalent to the rules added to the MatchTree.
+//
+// The original grouping of values into patterns is not stored in the tree, so the rules come in a
+// canonical form instead: each value (in insertion order) yields the rules covering all the paths
+// leading to it, whose exact patterns are collapsed dimension by dimension, from the last to the
+// first, into multi-value patterns where the paths differ in that dimension only. Values of exact
+// patterns are sorted (intervals by lower bound), and regexp and custom patterns are never
+// collapsed. For example, a rule with patterns {b, a} x {1, 2} is reconstructed as {a, b} x {1, 2},
+// while rules {a} x {1} and {b} x {2} with the same value are reconstructed as two rules.
+//
+// The order of the rules is stable, so that the rules saved from equal trees are equal: they are
+// sorted by the insertion order of their values, then by priority (descending), expiry (none
+// first) and weight, and then by their patterns compared in their string forms.
+//
+// Disabled rules are left out, as MatchRule cannot tell them from enabled ones, so that adding the
+// rules to another tree does not turn them back on.
+func (t *MatchTree[T]) ToRules() []MatchRule[T] {
+	if t.root == nil {
+		return nil
+	}
+
+	type ruleKey struct {
+		ValueIndex int
+		Priority   int64
+		Weight     int
+		Expiry     expiry
+	}
+	var ruleKeys []ruleKey
+	pathsByRuleKey := make(map[ruleKey][][]MatchPattern)
+	labelsByRuleKey := make(map[ruleKey]map[string]string)
+	patterns := make([]MatchPattern, len(t.types))
+	var walkNode func(node matchNode, depth int)
+	walkNode = func(node matchNode, depth int) {
+		if depth == len(t.types) {
+			// leaf
+			for _, result := range node.GetResults() {
+				if result.IsDisabled {
+					continue
+				}
+				ruleKey := ruleKey{ValueIndex: result.ValueIndex, Priority: result.Priority, Weight: result.Weight, Expiry: result.Expiry}
+				paths, ok := pathsByRuleKey[ruleKey]
+				if !ok {
+					ruleKeys = append(ruleKeys, ruleKey)
+					labelsByRuleKey[ruleKey] = t.rules[result.RuleID].Labels
+				}
+				pathsByRuleKey[ruleKey] = append(paths, slices.Clone(patterns))
+			}
+			return
+		}
+
+		// non-leaf
+		for pattern, child := range node.Edges() {
+			pattern.compiledRegexp = nil
+			pattern.versionRanges = nil
+			patterns[depth] = pattern
+			walkNode(child, depth+1)
+		}
+	}
+	walkNode(t.root, 0)
+
+	slices.SortFunc(ruleKeys, func(x, y ruleKey) int {
+		return cmp.Or(
+			cmp.Compare(x.ValueIndex, y.ValueIndex),
+			cmp.Compare(y.Priority, x.Priority),
+			compareExpiries(x.Expiry, y.Expiry),
+			cmp.Compare(x.Weight, y.Weight),
+		)
+	})
+	var rules []MatchRule[T]
+	for _, ruleKey := range ruleKeys {
+		paths := pathsByRuleKey[ruleKey]
+		for depth := len(t.types) - 1; depth >= 0; depth-- {
+			paths = collapsePaths(paths, depth)
+		}
+		// the children of some nodes, e.g. of regexps, are in insertion order
+		slices.SortStableFunc(paths, comparePaths)
+		for _, path := range paths {
+			rules = append(rules, MatchRule[T]{
+				Patterns:  path,
+				Value:     t.values[ruleKey.ValueIndex],
+				Priority:  ruleKey.Priority,
+				Weight:    ruleKey.Weight,
+				ExpiresAt: ruleKey.Expiry.toTime(),
+				Labels:    maps.Clone(labelsByRuleKey[ruleKey]),
+			})
+		}
+	}
+	return rules
+}
+
+// compareExpiries orders the expiries with no expiry first, and then by time.
+func compareExpiries(x, y expiry) int {
+	if x.IsSet != y.IsSet {
+		if x.IsSet {
+			return 1
+		}
+		return -1
+	}
+	return cmp.Compare(x.UnixNano, y.UnixNano)
+}
+
+// comparePaths orders the paths by their patterns in their string forms, dimension by dimension.
+func comparePaths(x, y []MatchPattern) int {
+	for i := range x {
+		if c := strings.Compare(x[i].String(), y[i].String()); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// collapsePaths merges the exact patterns at the depth of the paths that are identical elsewhere.
+func collapsePaths(paths [][]MatchPattern, depth int) [][]MatchPattern {
+	var collapsedPaths [][]MatchPattern
+	pathIndexes := make(map[string]int)
+	for _, path := range paths {
+		pattern := &path[depth]
+		if pattern.IsAny || pattern.IsInverse || !isCollapsibleMatchType(pattern.Type) {
+			collapsedPaths = append(collapsedPaths, path)
+			continue
+		}
+
+		var key strings.Builder
+		for i := range path {
+			if i != depth {
+				key.WriteString(strconv.Quote(edgeLabel(&path[i])))
+			}
+		}
+		pathIndex, ok := pathIndexes[key.String()]
+		if !ok {
+			pathIndexes[key.String()] = len(collapsedPaths)
+			collapsedPaths = append(collapsedPaths, path)
+			continue
+		}
+
+		collapsedPattern := &collapsedPaths[pathIndex][depth]
+		collapsedPattern.Strings = append(collapsedPattern.Strings, pattern.Strings...)
+		collapsedPattern.Integers = append(collapsedPattern.Integers, pattern.Integers...)
+		collapsedPattern.IntegerIntervals = append(collapsedPattern.IntegerIntervals, pattern.IntegerIntervals...)
+		collapsedPattern.NumberIntervals = append(collapsedPattern.NumberIntervals, pattern.NumberIntervals...)
+		collapsedPattern.ByteSlices = append(collapsedPattern.ByteSlices, pattern.ByteSlices...)
+		if pattern.EnumCodes != nil {
+			// the codes may be shared by other paths
+			enumCodes := maps.Clone(collapsedPattern.EnumCodes)
+			maps.Copy(enumCodes, pattern.EnumCodes)
+			collapsedPattern.EnumCodes = enumCodes
+		}
+	}
+	return collapsedPaths
+}
+
+func isCollapsibleMatchType(type1 MatchType) bool {
+	switch type1 {
+	case MatchString, MatchInteger, MatchIntegerInterval, MatchNumberInterval, MatchEnum, MatchBytes, MatchNumeric:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,101 @@
+package matchtree_test
+
+import (
+	"testing"
+
+	. "github.com/roy2220/matchtree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchTree_ToRules(t *testing.T) {
+	types := []MatchType{MatchString, MatchInteger, MatchRegexp}
+	matchTree := NewMatchTree[string](types)
+	assert.Nil(t, matchTree.ToRules())
+
+	err := matchTree.AddRules([]MatchRule[string]{
+		{
+			Patterns: []MatchPattern{StringsPattern("b", "a"), IntegersPattern(2, 1), AnyPattern(MatchRegexp)},
+			Value:    "rule_1",
+		},
+		{
+			Patterns: []MatchPattern{InverseStringsPattern("a"), AnyPattern(MatchInteger), RegexpPattern("^x")},
+			Value:    "rule_2",
+			Priority: 2,
+		},
+		{
+			Patterns: []MatchPattern{StringsPattern("a"), IntegersPattern(1), AnyPattern(MatchRegexp)},
+			Value:    "rule_3",
+			Priority: 1,
+		},
+		{
+			Patterns: []MatchPattern{StringsPattern("b"), IntegersPattern(2), AnyPattern(MatchRegexp)},
+			Value:    "rule_3",
+			Priority: 1,
+		},
+	})
+	require.NoError(t, err)
+
+	rules := matchTree.ToRules()
+	assert.Equal(t, []MatchRule[string]{
+		{
+			Patterns: []MatchPattern{StringsPattern("a", "b"), IntegersPattern(1, 2), AnyPattern(MatchRegexp)},
+			Value:    "rule_1",
+		},
+		{
+			Patterns: []MatchPattern{InverseStringsPattern("a"), AnyPattern(MatchInteger), RegexpPattern("^x")},
+			Value:    "rule_2",
+			Priority: 2,
+		},
+		{
+			Patterns: []MatchPattern{StringsPattern("a"), IntegersPattern(1), AnyPattern(MatchRegexp)},
+			Value:    "rule_3",
+			Priority: 1,
+		},
+		{
+			Patterns: []MatchPattern{StringsPattern("b"), IntegersPattern(2), AnyPattern(MatchRegexp)},
+			Value:    "rule_3",
+			Priority: 1,
+		},
+	}, rules)
+
+	// round-trip
+	matchTree2 := NewMatchTree[string](types)
+	require.NoError(t, matchTree2.AddRules(rules))
+	assert.Equal(t, rules, matchTree2.ToRules())
+	for _, keys := range [][]MatchKey{
+		{StringKey("a"), IntegerKey(1), RegexpKey("xyz")},
+		{StringKey("b"), IntegerKey(2), RegexpKey("xyz")},
+		{StringKey("c"), IntegerKey(3), RegexpKey("xyz")},
+	} {
+		want, err := matchTree.Search(keys)
+		require.NoError(t, err)
+		values, err := matchTree2.Search(keys)
+		require.NoError(t, err)
+		assert.Equal(t, want, values)
+	}
+}
+
+func TestMatchTree_ToRules_DisabledRules(t *testing.T) {
+	types := []MatchType{MatchString}
+	matchTree := NewMatchTree[string](types)
+	_, err := matchTree.AddRule(MatchRule[string]{Patterns: []MatchPattern{StringsPattern("a")}, Value: "rule_1"})
+	require.NoError(t, err)
+	id, err := matchTree.AddRule(MatchRule[string]{Patterns: []MatchPattern{AnyPattern(MatchString)}, Value: "rule_2", Priority: 1})
+	require.NoError(t, err)
+	require.NoError(t, matchTree.SetRuleEnabled(id, false))
+
+	rules := matchTree.ToRules()
+	assert.Equal(t, []MatchRule[string]{{Patterns: []MatchPattern{StringsPattern("a")}, Value: "rule_1"}}, rules)
+
+	// the disabled rule is not turned back on by a round-trip
+	matchTree2 := NewMatchTree[string](types)
+	require.NoError(t, matchTree2.AddRules(rules))
+	for _, keys := range [][]MatchKey{{StringKey("a")}, {StringKey("b")}} {
+		values, err := matchTree.Search(keys)
+		require.NoError(t, err)
+		values2, err := matchTree2.Search(keys)
+		require.NoError(t, err)
+		assert.Equal(t, values, values2, "%v", keys)
+	}
+}
@@ -0,0 +1,140 @@
+package matchtree
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Validate walks the MatchTree and checks its structural invariants, e.g. before trusting a tree
+// that is deserialized or merged: every node at a depth is of the tree's type at the depth, leaf
+// nodes are only at the depth of the number of types, the excluded values of each inverse child
+// add up to the number it is created with, and every result refers to a value and a rule of the
+// tree. It returns an error describing the first violation found.
+func (t *MatchTree[T]) Validate() error {
+	if t.root == nil {
+		return nil
+	}
+
+	var validateNode func(node matchNode, depth int) error
+	validateNode = func(node matchNode, depth int) error {
+		type1 := MatchNone
+		if depth < len(t.types) {
+			type1 = t.types[depth]
+		}
+		if !nodeIsOfType(node, type1) {
+			return fmt.Errorf("matchtree: unexpected node at depth %v; expected=%v actual=%T", depth, type1, node)
+		}
+		if depth == len(t.types) {
+			// leaf
+			for _, result := range node.GetResults() {
+				if result.ValueIndex < 0 || result.ValueIndex >= len(t.values) {
+					return fmt.Errorf("matchtree: value index out of range; index=%v count=%v", result.ValueIndex, len(t.values))
+				}
+				if _, ok := t.rules[result.RuleID]; !ok {
+					return fmt.Errorf("matchtree: result of unknown rule; id=%v", result.RuleID)
+				}
+			}
+			return nil
+		}
+
+		// non-leaf
+		if err := validateInverseChildren(node); err != nil {
+			return fmt.Errorf("%w; depth=%v", err, depth)
+		}
+		for _, child := range node.Edges() {
+			if err := validateNode(child, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return validateNode(t.root, 0)
+}
+
+// nodeIsOfType reports whether the node is one created by newMatchNode for the MatchType.
+func nodeIsOfType(node matchNode, type1 MatchType) bool {
+	switch node.(type) {
+	case *matchNodeOfNone:
+		return type1 == MatchNone
+	case *matchNodeOfString:
+		return type1 == MatchString
+	case *matchNodeOfInteger:
+		return type1 == MatchInteger
+	case *matchNodeOfIntegerInterval:
+		return type1 == MatchIntegerInterval
+	case *matchNodeOfNumberInterval:
+		return type1 == MatchNumberInterval
+	case *matchNodeOfRegexp:
+		return type1 == MatchRegexp
+	case *matchNodeOfEnum:
+		return type1 == MatchEnum
+	case *matchNodeOfBytes:
+		return type1 == MatchBytes
+	case *matchNodeOfSemverRange:
+		return type1 == MatchSemverRange
+	case *matchNodeOfGlob:
+		return type1 == MatchGlob
+	case *matchNodeOfNumeric:
+		return type1 == MatchNumeric
+	case *customMatchNode:
+		return isCustomMatchType(type1)
+	default:
+		return false
+	}
+}
+
+// validateInverseChildren checks that each inverse child of the node is indexed by as many excluded
+// values as its MaxRefCount, with the indexes of each value ascending.
+func validateInverseChildren(node matchNode) error {
+	var inverseChildren []matchNodeWithRefCount
+	var indexLists [][]int
+	switch node := node.(type) {
+	case *matchNodeOfString:
+		inverseChildren = node.inverseChildren
+		for _, indexes := range node.inverseChildIndexes {
+			indexLists = append(indexLists, indexes)
+		}
+	case *matchNodeOfBytes:
+		return validateInverseChildren(&node.matchNodeOfString)
+	case *matchNodeOfInteger:
+		inverseChildren = node.inverseChildren
+		for _, indexes := range node.inverseChildIndexes {
+			indexLists = append(indexLists, indexes)
+		}
+	case *matchNodeOfEnum:
+		return validateInverseChildren(&node.matchNodeOfInteger)
+	case *matchNodeOfIntegerInterval:
+		inverseChildren = node.inverseChildren
+		for _, v := range node.inverseChildIndexes {
+			indexLists = append(indexLists, v.MatchNodeIndexes)
+		}
+	case *matchNodeOfNumeric:
+		return validateInverseChildren(&node.matchNodeOfIntegerInterval)
+	case *matchNodeOfNumberInterval:
+		inverseChildren = node.inverseChildren
+		for _, v := range node.inverseChildIndexes {
+			indexLists = append(indexLists, v.MatchNodeIndexes)
+		}
+	default:
+		return nil
+	}
+
+	refCounts := make([]int, len(inverseChildren))
+	for _, indexes := range indexLists {
+		if !slices.IsSorted(indexes) {
+			return fmt.Errorf("matchtree: unsorted inverse child indexes %v", indexes)
+		}
+		for _, i := range indexes {
+			if i < 0 || i >= len(inverseChildren) {
+				return fmt.Errorf("matchtree: inverse child index out of range; index=%v count=%v", i, len(inverseChildren))
+			}
+			refCounts[i]++
+		}
+	}
+	for i, child := range inverseChildren {
+		if refCounts[i] != child.MaxRefCount {
+			return fmt.Errorf("matchtree: inconsistent ref count of inverse child #%d; expected=%v actual=%v", i+1, child.MaxRefCount, refCounts[i])
+		}
+	}
+	return nil
+}
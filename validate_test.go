@@ -0,0 +1,40 @@
+package matchtree_test
+
+import (
+	"testing"
+
+	. "github.com/roy2220/matchtree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchTree_Validate(t *testing.T) {
+	matchTree := NewMatchTree[int](randomTypes)
+	require.NoError(t, matchTree.Validate())
+
+	var ids []RuleID
+	for _, rule := range GenerateRandomRules(randomTypes, 1, 200) {
+		id, err := matchTree.AddRule(rule)
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	require.NoError(t, matchTree.Validate())
+	for _, id := range ids[:100] {
+		require.NoError(t, matchTree.RemoveRuleByID(id))
+	}
+	require.NoError(t, matchTree.SetRuleEnabled(ids[100], false))
+	require.NoError(t, matchTree.Validate())
+
+	rebuiltTree, err := matchTree.Rebuild([]int{10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 0})
+	require.NoError(t, err)
+	require.NoError(t, rebuiltTree.Validate())
+
+	// the node at depth 1 has itself as its child
+	matchTree2 := NewMatchTree[string]([]MatchType{matchMisaligned, matchMisaligned})
+	_, err = matchTree2.AddRule(MatchRule[string]{
+		Patterns: []MatchPattern{{Type: matchMisaligned, Strings: []string{"a"}}, {Type: matchMisaligned, Strings: []string{"b"}}},
+		Value:    "rule_1",
+	})
+	require.NoError(t, err)
+	assert.ErrorContains(t, matchTree2.Validate(), "matchtree: unexpected node at depth 2; expected=NONE actual=")
+}
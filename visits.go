@@ -0,0 +1,53 @@
+package matchtree
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// WithVisitCounts configures the MatchTree to count the visits of each node by searches, i.e. how
+// many times each node is reached by the keys, through Search and its variants returning values,
+// which Walk reports as NodeInfo.VisitCount. The counts tell the hot parts of the tree, e.g. to
+// put the most selective MatchType first or to prune the rules of cold branches.
+// Counting costs an atomic increment per node reached by a search.
+func WithVisitCounts[T any]() MatchTreeOptionFunc[T] {
+	return func(o matchTreeOptions[T]) matchTreeOptions[T] {
+		o.CountVisits = true
+		return o
+	}
+}
+
+// visitCounts holds the visit counts of the nodes of a MatchTree.
+type visitCounts struct {
+	counters sync.Map // map[matchNode]*atomic.Uint64
+}
+
+func (c *visitCounts) add(nodes []matchNode) {
+	for _, node := range nodes {
+		counter, ok := c.counters.Load(node)
+		if !ok {
+			counter, _ = c.counters.LoadOrStore(node, new(atomic.Uint64))
+		}
+		counter.(*atomic.Uint64).Add(1)
+	}
+}
+
+func (c *visitCounts) get(node matchNode) uint64 {
+	if c == nil {
+		return 0
+	}
+	counter, ok := c.counters.Load(node)
+	if !ok {
+		return 0
+	}
+	return counter.(*atomic.Uint64).Load()
+}
+
+// ResetVisitCounts sets the visit counts of all the nodes back to 0, also releasing the counts of
+// the nodes since removed from the tree. It does nothing unless the MatchTree counts visits
+// (see WithVisitCounts).
+func (t *MatchTree[T]) ResetVisitCounts() {
+	if t.visitCounts != nil {
+		t.visitCounts.counters.Clear()
+	}
+}
@@ -0,0 +1,91 @@
+package matchtree
+
+import (
+	"time"
+)
+
+// NodeInfo describes a node of a MatchTree visited by Walk.
+type NodeInfo struct {
+	// ExactChildren holds the patterns of the exact children of a non-leaf node, each with a single
+	// value or interval, or a regular expression.
+	ExactChildren []MatchPattern
+	// InverseChildren holds the patterns of the inverse children of a non-leaf node, each with the
+	// excluded values or intervals, or the regular expression not to match.
+	InverseChildren []MatchPattern
+	// HasAnyChild indicates whether a non-leaf node has the any child.
+	HasAnyChild bool
+	// Results holds the results of a leaf node, sorted like Search returns the values.
+	Results []NodeResult
+	// VisitCount is the number of searches having reached the node since the MatchTree was created
+	// or ResetVisitCounts was last called, if the MatchTree counts visits (see WithVisitCounts),
+	// or 0 otherwise.
+	VisitCount uint64
+}
+
+// NodeResult describes a result stored in a leaf node.
+type NodeResult struct {
+	// ValueIndex is the position of the result's value among the values added, in insertion order.
+	ValueIndex int
+	Priority   int64
+	// RuleID identifies the rule the result belongs to.
+	RuleID RuleID
+	// IsDisabled indicates whether the rule is disabled with SetRuleEnabled.
+	IsDisabled bool
+	// IsDuplicate indicates whether the result is hidden behind an identical result of another rule
+	// (see WithDedupIdenticalRules).
+	IsDuplicate bool
+	// ExpiresAt is the expiration time of the rule, if any.
+	ExpiresAt *time.Time
+}
+
+// Walk traverses the MatchTree depth-first, calling visit for each node with its depth (the root is
+// at depth 0), its MatchType (MatchNone for leaf nodes) and its NodeInfo. The children of a node of
+// a built-in match type are visited in the order of ExactChildren, InverseChildren and then the any
+// child. If visit returns false, the children of the node are skipped.
+func (t *MatchTree[T]) Walk(visit func(depth int, matchType MatchType, info NodeInfo) bool) {
+	if t.root == nil {
+		return
+	}
+
+	var walkNode func(node matchNode, depth int)
+	walkNode = func(node matchNode, depth int) {
+		if depth == len(t.types) {
+			// leaf
+			info := NodeInfo{VisitCount: t.visitCounts.get(node)}
+			for _, result := range node.GetResults() {
+				info.Results = append(info.Results, NodeResult{
+					ValueIndex:  result.ValueIndex,
+					Priority:    result.Priority,
+					RuleID:      result.RuleID,
+					IsDisabled:  result.IsDisabled,
+					IsDuplicate: result.IsDuplicate,
+					ExpiresAt:   result.Expiry.toTime(),
+				})
+			}
+			visit(depth, MatchNone, info)
+			return
+		}
+
+		// non-leaf
+		info := NodeInfo{VisitCount: t.visitCounts.get(node)}
+		var children []matchNode
+		for pattern, child := range node.Edges() {
+			switch childKindOf(&pattern) {
+			case ExactChild:
+				info.ExactChildren = append(info.ExactChildren, pattern)
+			case InverseChild:
+				info.InverseChildren = append(info.InverseChildren, pattern)
+			case AnyChild:
+				info.HasAnyChild = true
+			}
+			children = append(children, child)
+		}
+		if !visit(depth, t.types[depth], info) {
+			return
+		}
+		for _, child := range children {
+			walkNode(child, depth+1)
+		}
+	}
+	walkNode(t.root, 0)
+}
@@ -0,0 +1,107 @@
+package matchtree_test
+
+import (
+	"testing"
+
+	. "github.com/roy2220/matchtree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchTree_Walk(t *testing.T) {
+	matchTree := NewMatchTree[string]([]MatchType{MatchString, MatchInteger})
+	matchTree.Walk(func(int, MatchType, NodeInfo) bool {
+		t.Fatal("unexpected visit")
+		return true
+	})
+
+	err := matchTree.AddRules([]MatchRule[string]{
+		{
+			Patterns: []MatchPattern{StringsPattern("b", "a"), IntegersPattern(1)},
+			Value:    "rule_1",
+		},
+		{
+			Patterns: []MatchPattern{InverseStringsPattern("a"), AnyPattern(MatchInteger)},
+			Value:    "rule_2",
+			Priority: 2,
+		},
+		{
+			Patterns: []MatchPattern{AnyPattern(MatchString), InverseIntegersPattern(3, 4)},
+			Value:    "rule_3",
+			Priority: 1,
+		},
+	})
+	require.NoError(t, err)
+
+	type visit struct {
+		Depth     int
+		MatchType MatchType
+		Info      NodeInfo
+	}
+	var visits []visit
+	matchTree.Walk(func(depth int, matchType MatchType, info NodeInfo) bool {
+		visits = append(visits, visit{depth, matchType, info})
+		return true
+	})
+	assert.Equal(t, []visit{
+		{0, MatchString, NodeInfo{
+			ExactChildren:   []MatchPattern{StringsPattern("a"), StringsPattern("b")},
+			InverseChildren: []MatchPattern{InverseStringsPattern("a")},
+			HasAnyChild:     true,
+		}},
+		{1, MatchInteger, NodeInfo{ExactChildren: []MatchPattern{IntegersPattern(1)}}},
+		{2, MatchNone, NodeInfo{Results: []NodeResult{{ValueIndex: 0, Priority: 0, RuleID: 1}}}},
+		{1, MatchInteger, NodeInfo{ExactChildren: []MatchPattern{IntegersPattern(1)}}},
+		{2, MatchNone, NodeInfo{Results: []NodeResult{{ValueIndex: 0, Priority: 0, RuleID: 1}}}},
+		{1, MatchInteger, NodeInfo{HasAnyChild: true}},
+		{2, MatchNone, NodeInfo{Results: []NodeResult{{ValueIndex: 1, Priority: 2, RuleID: 2}}}},
+		{1, MatchInteger, NodeInfo{InverseChildren: []MatchPattern{InverseIntegersPattern(3, 4)}}},
+		{2, MatchNone, NodeInfo{Results: []NodeResult{{ValueIndex: 2, Priority: 1, RuleID: 3}}}},
+	}, visits)
+
+	n := 0
+	matchTree.Walk(func(depth int, matchType MatchType, info NodeInfo) bool {
+		n++
+		return depth == 0
+	})
+	assert.Equal(t, 5, n)
+}
+
+func TestMatchTree_Walk_VisitCounts(t *testing.T) {
+	matchTree := NewMatchTree([]MatchType{MatchString, MatchInteger}, WithVisitCounts[string]())
+	require.NoError(t, matchTree.AddRules([]MatchRule[string]{
+		{Patterns: []MatchPattern{StringsPattern("a"), IntegersPattern(1)}, Value: "rule_1"},
+		{Patterns: []MatchPattern{StringsPattern("b"), IntegersPattern(2)}, Value: "rule_2"},
+	}))
+	for _, keys := range [][]MatchKey{
+		{StringKey("a"), IntegerKey(1)},
+		{StringKey("a"), IntegerKey(2)},
+		{StringKey("b"), IntegerKey(2)},
+		{StringKey("c"), IntegerKey(2)},
+	} {
+		_, err := matchTree.Search(keys)
+		require.NoError(t, err)
+	}
+
+	walkCounts := func() []uint64 {
+		var counts []uint64
+		matchTree.Walk(func(_ int, _ MatchType, info NodeInfo) bool {
+			counts = append(counts, info.VisitCount)
+			return true
+		})
+		return counts
+	}
+	// root, a, a -> 1, b, b -> 2
+	assert.Equal(t, []uint64{4, 2, 1, 1, 1}, walkCounts())
+
+	matchTree.ResetVisitCounts()
+	assert.Equal(t, []uint64{0, 0, 0, 0, 0}, walkCounts())
+
+	// no counting by default
+	matchTree = NewMatchTree[string]([]MatchType{MatchString})
+	_, err := matchTree.AddRule(MatchRule[string]{Patterns: []MatchPattern{StringsPattern("a")}, Value: "rule_1"})
+	require.NoError(t, err)
+	_, err = matchTree.Search([]MatchKey{StringKey("a")})
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{0, 0}, walkCounts())
+}